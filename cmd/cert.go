@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/cert"
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+var certCmd = &cobra.Command{
+	Use:   "cert",
+	Short: "Inspect and renew HTTPS certificates",
+	Long: `Inspect and manage the certificates used by 'portree proxy start --https'.
+
+The proxy renews certificates that expire within 30 days on startup; these
+commands show their state and force a renewal or a new CA.
+
+The CA lives in $XDG_DATA_HOME/portree/ca (~/.local/share/portree/ca) and is
+shared by all repositories, so it only has to be trusted once. Set
+'local_ca = true' under [tls] in .portree.toml to keep a separate CA in
+.portree/certs instead.`,
+}
+
+var certInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show the CA, server and leaf certificates",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, err := certPaths()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(paths.CACert); os.IsNotExist(err) {
+			fmt.Println("No certificates yet. Run 'portree proxy start --https' to generate them.")
+			return nil
+		}
+
+		now := time.Now()
+		printCertInfo("CA", cert.Inspect(paths.CACert, paths.CAKey), now)
+		fmt.Println()
+		printCertInfo("Server", cert.Inspect(paths.ServerCert, paths.ServerKey), now)
+
+		leaves, _ := filepath.Glob(filepath.Join(paths.LeafDir(), "*.crt"))
+		sort.Strings(leaves)
+		if len(leaves) > 0 {
+			fmt.Printf("\nLeaf certificates (%s):\n", paths.LeafDir())
+			for _, p := range leaves {
+				info := cert.Inspect(p, strings.TrimSuffix(p, ".crt")+".key")
+				name := strings.TrimSuffix(filepath.Base(p), ".crt")
+				if info.Err != nil {
+					fmt.Printf("  %-40s  %v\n", name, info.Err)
+					continue
+				}
+				fmt.Printf("  %-40s  expires %s\n", name, describeExpiry(info, now))
+			}
+		}
+		return nil
+	},
+}
+
+var certRenewCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Reissue the server and leaf certificates (keeps the CA)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, err := certPaths()
+		if err != nil {
+			return err
+		}
+		if err := cert.Renew(paths); err != nil {
+			return fmt.Errorf("renewing certificates: %w", err)
+		}
+		logging.Info("Renewed %s. Restart the proxy to use it.", paths.ServerCert)
+		return nil
+	},
+}
+
+var certRotateCACmd = &cobra.Command{
+	Use:   "rotate-ca",
+	Short: "Replace the CA and reissue all certificates",
+	Long: `Generate a new CA and reissue every certificate with it.
+
+Browsers and tools that trusted the old CA will reject the new certificates
+until you run 'portree trust' again.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, err := certPaths()
+		if err != nil {
+			return err
+		}
+		if err := cert.RotateCA(paths); err != nil {
+			return fmt.Errorf("rotating CA: %w", err)
+		}
+		logging.Info("New CA written to %s.", paths.CACert)
+		logging.Info("Run 'portree trust' to trust it, then restart the proxy.")
+		return nil
+	},
+}
+
+var certClientCmd = &cobra.Command{
+	Use:   "client <name>",
+	Short: "Issue a client certificate for 'portree proxy start --mtls'",
+	Long: `Issue a client certificate with the common name <name>, signed by the
+portree client CA, for testing mutual TLS with 'portree proxy start --mtls'.
+The client CA is created next to the portree CA the first time.
+
+The certificate and key are written to .portree/certs/client/<name>.crt and
+.key; issuing the same name again replaces them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, err := certPaths()
+		if err != nil {
+			return err
+		}
+		certFile, keyFile, err := cert.IssueClientCert(paths, args[0])
+		if err != nil {
+			return fmt.Errorf("issuing client certificate: %w", err)
+		}
+		caFile, _ := paths.ClientCA()
+
+		fmt.Printf("Client certificate: %s\n", certFile)
+		fmt.Printf("Private key:        %s\n", keyFile)
+		fmt.Printf("Client CA:          %s\n", caFile)
+		fmt.Println("\nStart the proxy with 'portree proxy start --mtls', then for example:")
+		fmt.Printf("  curl --cert %s --key %s https://main.localhost:<proxy_port>/\n", certFile, keyFile)
+		return nil
+	},
+}
+
+// certPaths locates the auto-generated certificates of the current repository.
+func certPaths() (cert.CertPaths, error) {
+	return certPathsFor(repoRoot, cfg)
+}
+
+// certPathsFor keeps the server certificate in <root>/.portree/certs and the
+// CA in the user-level directory shared by all repositories, unless c sets
+// [tls] local_ca.
+func certPathsFor(root string, c *config.Config) (cert.CertPaths, error) {
+	return cert.RepoPaths(filepath.Join(root, ".portree"), c != nil && c.TLS.LocalCA)
+}
+
+func printCertInfo(label string, info cert.Info, now time.Time) {
+	fmt.Printf("%s: %s\n", label, info.Path)
+	if info.Err != nil {
+		fmt.Printf("  error:   %v\n", info.Err)
+		return
+	}
+	fmt.Printf("  subject: %s\n", info.Cert.Subject.CommonName)
+	if len(info.Cert.DNSNames) > 0 || len(info.Cert.IPAddresses) > 0 {
+		sans := append([]string{}, info.Cert.DNSNames...)
+		for _, ip := range info.Cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		fmt.Printf("  SANs:    %s\n", strings.Join(sans, ", "))
+	}
+	fmt.Printf("  expires: %s\n", describeExpiry(info, now))
+	if !info.KeyMatches {
+		fmt.Println("  key:     does not match the certificate")
+	}
+}
+
+// describeExpiry formats the expiry date with the number of days left.
+func describeExpiry(info cert.Info, now time.Time) string {
+	days := int(info.Remaining(now).Hours() / 24)
+	date := info.NotAfter.Format("2006-01-02")
+	if days < 0 {
+		return fmt.Sprintf("%s (expired)", date)
+	}
+	return fmt.Sprintf("%s (%d days left)", date, days)
+}
+
+func init() {
+	certCmd.AddCommand(certInfoCmd)
+	certCmd.AddCommand(certRenewCmd)
+	certCmd.AddCommand(certRotateCACmd)
+	certCmd.AddCommand(certClientCmd)
+	rootCmd.AddCommand(certCmd)
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fairy-pitta/portree/internal/git"
+	"github.com/fairy-pitta/portree/internal/logging"
+	"github.com/fairy-pitta/portree/internal/proxy"
+	"github.com/spf13/cobra"
+)
+
+var chaosCmd = &cobra.Command{
+	Use:   "chaos",
+	Short: "Inject latency and failures into proxied requests",
+	Long: `Manage fault injection rules on the running proxy.
+
+Rules select requests by slug, service and path glob, and can add latency
+and jitter, answer a fraction of requests with an error status, throttle
+response bandwidth, or drop connections. The first matching rule applies.
+Rules live in the proxy process and are lost when it stops.`,
+}
+
+var chaosAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a fault injection rule",
+	Example: `  portree chaos add --slug feature-auth --latency 800ms --jitter 200ms
+  portree chaos add --service api --path '/api/*' --error-rate 0.2 --error-status 502
+  portree chaos add --slug main --bandwidth 64k`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slug, _ := cmd.Flags().GetString("slug")
+		service, _ := cmd.Flags().GetString("service")
+		path, _ := cmd.Flags().GetString("path")
+		latency, _ := cmd.Flags().GetDuration("latency")
+		jitter, _ := cmd.Flags().GetDuration("jitter")
+		errorRate, _ := cmd.Flags().GetFloat64("error-rate")
+		errorStatus, _ := cmd.Flags().GetInt("error-status")
+		bandwidthFlag, _ := cmd.Flags().GetString("bandwidth")
+		dropRate, _ := cmd.Flags().GetFloat64("drop-rate")
+
+		if service != "" {
+			if _, ok := cfg.Services[service]; !ok {
+				return fmt.Errorf("unknown service %q", service)
+			}
+		}
+		var bandwidth int64
+		if bandwidthFlag != "" {
+			var err error
+			if bandwidth, err = parseByteRate(bandwidthFlag); err != nil {
+				return err
+			}
+		}
+
+		rule := proxy.ChaosRule{
+			Slug:        git.BranchSlug(slug),
+			Service:     service,
+			Path:        path,
+			LatencyMS:   int(latency.Milliseconds()),
+			JitterMS:    int(jitter.Milliseconds()),
+			ErrorRate:   errorRate,
+			ErrorStatus: errorStatus,
+			Bandwidth:   bandwidth,
+			DropRate:    dropRate,
+		}
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+		added, err := client.AddChaosRule(rule)
+		if err != nil {
+			return err
+		}
+		logging.Info("Added chaos rule %d: %s", added.ID, added.Effects())
+		return nil
+	},
+}
+
+var chaosLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List fault injection rules",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+		rules, err := client.ChaosRules()
+		if err != nil {
+			return err
+		}
+
+		jsonFlag, _ := cmd.Flags().GetBool("json")
+		if jsonFlag {
+			return json.NewEncoder(os.Stdout).Encode(rules)
+		}
+		if len(rules) == 0 {
+			fmt.Println("No chaos rules.")
+			return nil
+		}
+		return printChaosRules(os.Stdout, rules)
+	},
+}
+
+var chaosRmCmd = &cobra.Command{
+	Use:   "rm <id>",
+	Short: "Remove a fault injection rule",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid rule id %q", args[0])
+		}
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+		if err := client.RemoveChaosRule(id); err != nil {
+			return err
+		}
+		logging.Info("Removed chaos rule %d.", id)
+		return nil
+	},
+}
+
+var chaosClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all fault injection rules",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+		if err := client.ClearChaos(); err != nil {
+			return err
+		}
+		logging.Info("Chaos rules cleared.")
+		return nil
+	},
+}
+
+func printChaosRules(w io.Writer, rules []proxy.ChaosRule) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tSLUG\tSERVICE\tPATH\tEFFECTS")
+	for _, r := range rules {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n",
+			r.ID, orAny(r.Slug), orAny(r.Service), orAny(r.Path), r.Effects())
+	}
+	return tw.Flush()
+}
+
+func orAny(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return s
+}
+
+// parseByteRate parses a bandwidth such as "512", "64k" or "1.5m" into bytes
+// per second. Suffixes are binary (k = 1024).
+func parseByteRate(s string) (int64, error) {
+	num := strings.ToLower(strings.TrimSpace(s))
+	num = strings.TrimSuffix(num, "/s")
+	num = strings.TrimSuffix(num, "b")
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(num, "k"):
+		mult, num = 1<<10, strings.TrimSuffix(num, "k")
+	case strings.HasSuffix(num, "m"):
+		mult, num = 1<<20, strings.TrimSuffix(num, "m")
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q (e.g. 512, 64k, 1m)", s)
+	}
+	return int64(v * mult), nil
+}
+
+func init() {
+	chaosAddCmd.Flags().String("slug", "", "Only affect this worktree (branch name or slug)")
+	chaosAddCmd.Flags().String("service", "", "Only affect this service")
+	chaosAddCmd.Flags().String("path", "", "Only affect request paths matching this glob (e.g. '/api/*')")
+	chaosAddCmd.Flags().Duration("latency", 0, "Delay before forwarding (e.g. 500ms)")
+	chaosAddCmd.Flags().Duration("jitter", 0, "Random extra delay of up to this duration")
+	chaosAddCmd.Flags().Float64("error-rate", 0, "Fraction of requests (0-1) answered with --error-status")
+	chaosAddCmd.Flags().Int("error-status", 503, "Status code for injected errors")
+	chaosAddCmd.Flags().String("bandwidth", "", "Throttle responses to this rate in bytes/s (e.g. 64k, 1m)")
+	chaosAddCmd.Flags().Float64("drop-rate", 0, "Fraction of connections (0-1) closed without a response")
+	chaosLsCmd.Flags().Bool("json", false, "Output in JSON format")
+
+	chaosCmd.AddCommand(chaosAddCmd)
+	chaosCmd.AddCommand(chaosLsCmd)
+	chaosCmd.AddCommand(chaosRmCmd)
+	chaosCmd.AddCommand(chaosClearCmd)
+	rootCmd.AddCommand(chaosCmd)
+}
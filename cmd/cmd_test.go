@@ -4,8 +4,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/fairy-pitta/portree/internal/cert"
 	"github.com/fairy-pitta/portree/internal/config"
 	"github.com/fairy-pitta/portree/internal/git"
 	"github.com/fairy-pitta/portree/internal/logging"
@@ -36,6 +41,8 @@ func setupGitRepo(t *testing.T) string {
 	t.Helper()
 
 	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir()) // no user config
+	t.Setenv("XDG_STATE_HOME", t.TempDir())  // no user-level port leases
 
 	run := func(args ...string) {
 		t.Helper()
@@ -96,6 +103,17 @@ func resetRootCmd() {
 	upAll = false
 	upService = ""
 	openService = ""
+	initDetect = false
+	initYes = false
+	_ = importCmd.PersistentFlags().Set("output", "")
+	_ = importCmd.PersistentFlags().Set("force", "false")
+	_ = configShowCmd.Flags().Set("resolved", "false")
+	_ = configShowCmd.Flags().Set("branch", "")
+	_ = envCmd.Flags().Set("service", "")
+	_ = envCmd.Flags().Set("explain", "false")
+	_ = envCmd.Flags().Set("json", "false")
+	_ = portsCmd.Flags().Set("json", "false")
+	_ = portsCmd.Flags().Set("prune", "false")
 
 	// Reset proxy start flags.
 	proxyStartCmd.Flags().VisitAll(func(f *pflag.Flag) {
@@ -104,6 +122,7 @@ func resetRootCmd() {
 
 	// Reset logging level and persistent flag "changed" state.
 	logging.SetLevel(logging.LevelNormal)
+	_ = rootCmd.PersistentFlags().Set("profile", "")
 	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
 		f.Changed = false
 	})
@@ -123,6 +142,231 @@ func TestInitCommand(t *testing.T) {
 	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
 		t.Errorf("%s was not created", config.FileName)
 	}
+
+	// The local override file is ignored, once.
+	if err := os.Remove(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"init"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("second init command: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "/"+config.LocalFileName+"\n" {
+		t.Errorf(".gitignore = %q, want %s listed once", data, config.LocalFileName)
+	}
+}
+
+func TestInitDetectCommand(t *testing.T) {
+	dir := setupGitRepo(t)
+	if err := os.WriteFile(filepath.Join(dir, "Procfile"), []byte("web: bin/server --port $PORT\nworker: bin/worker\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resetRootCmd()
+	rootCmd.SetIn(strings.NewReader("y\nn\n"))
+	defer rootCmd.SetIn(nil)
+	rootCmd.SetArgs([]string{"init", "--detect"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("init --detect: %v", err)
+	}
+	loaded, err := config.Load(dir)
+	if err != nil {
+		t.Fatalf("loading detected config: %v", err)
+	}
+	if len(loaded.Services) != 1 || loaded.Services["web"].Command != "bin/server --port $PORT" {
+		t.Errorf("services = %+v, want only web", loaded.Services)
+	}
+
+	if err := os.Remove(filepath.Join(dir, config.FileName)); err != nil {
+		t.Fatal(err)
+	}
+	resetRootCmd()
+	rootCmd.SetIn(strings.NewReader(""))
+	rootCmd.SetArgs([]string{"init", "--detect"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Errorf("init --detect without answers error = %v, want a hint to use --yes", err)
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"init", "--detect", "--yes"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("init --detect --yes: %v", err)
+	}
+	if loaded, err = config.Load(dir); err != nil || len(loaded.Services) != 2 {
+		t.Errorf("init --detect --yes services = %v, %v; want web and worker", loaded, err)
+	}
+}
+
+func TestImportCommand(t *testing.T) {
+	dir := setupGitRepo(t)
+	files := map[string]string{
+		"Procfile.dev": "web: bin/rails server -p 3000\nworker: bin/jobs\n",
+		"compose.yaml": "services:\n  app:\n    build: .\n    ports: [\"3000:80\"]\n    depends_on: [db]\n  db:\n    image: postgres\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(dir, config.FileName)
+
+	for _, kind := range []string{"procfile", "compose"} {
+		file := map[string]string{"procfile": "Procfile.dev", "compose": "compose.yaml"}[kind]
+		resetRootCmd()
+		rootCmd.SetArgs([]string{"import", kind, file, "-o", out, "--force"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("import %s: %v", kind, err)
+		}
+		loaded, err := config.Load(dir)
+		if err != nil {
+			t.Fatalf("loading imported %s: %v", kind, err)
+		}
+		if len(loaded.Services) != 2 {
+			t.Errorf("import %s services = %v, want 2", kind, loaded.Services)
+		}
+		if kind == "compose" && !reflect.DeepEqual(loaded.Services["app"].DependsOn, []string{"db"}) {
+			t.Errorf("import compose depends_on = %v, want [db]", loaded.Services["app"].DependsOn)
+		}
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"import", "procfile", "Procfile.dev", "-o", out})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("import over an existing file error = %v, want a hint to use --force", err)
+	}
+}
+
+func TestConfigCommands(t *testing.T) {
+	dir := setupTestRepo(t)
+
+	for _, args := range [][]string{
+		{"config", "validate"},
+		{"config", "show"},
+		{"config", "show", "--resolved"},
+		{"config", "show", "--resolved", "--branch", "feature/x"},
+		{"config", "schema"},
+	} {
+		resetRootCmd()
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Errorf("%s: %v", strings.Join(args, " "), err)
+		}
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"config", "show", "--branch", "main"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("config show --branch without --resolved should error")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, config.FileName), []byte(testConfig+"\nproxyport = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"config", "validate"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Errorf("config validate with an unknown key error = %v", err)
+	}
+}
+
+func TestUserConfigLogRetention(t *testing.T) {
+	dir := setupTestRepo(t)
+	userDir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "portree")
+	if err := os.MkdirAll(userDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(userDir, "config.toml"), []byte("log_retention = \"1d\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logDir := filepath.Join(dir, ".portree", "logs")
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	oldLog := filepath.Join(logDir, "gone.frontend.log")
+	if err := os.WriteFile(oldLog, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(oldLog, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"up"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("up command: %v", err)
+	}
+	t.Cleanup(func() {
+		resetRootCmd()
+		rootCmd.SetArgs([]string{"down"})
+		_ = rootCmd.Execute()
+	})
+	if _, err := os.Stat(oldLog); !os.IsNotExist(err) {
+		t.Errorf("log older than log_retention was kept: %v", err)
+	}
+}
+
+func TestPortsCommand(t *testing.T) {
+	dir := setupTestRepo(t)
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"up"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("up command: %v", err)
+	}
+	t.Cleanup(func() {
+		resetRootCmd()
+		rootCmd.SetArgs([]string{"down"})
+		_ = rootCmd.Execute()
+	})
+
+	stateDir, err := state.GlobalStateDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := state.NewLeaseStore(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leases, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases.Ports) != 1 {
+		t.Fatalf("leases after up = %v, want one", leases.Ports)
+	}
+	for p, l := range leases.Ports {
+		if p < 19100 || p > 19199 || l.Service != "web" || !leases.Live(p) {
+			t.Errorf("lease %d = %+v", p, l)
+		}
+		if resolved, _ := filepath.EvalSymlinks(dir); l.Repo != dir && l.Repo != resolved {
+			t.Errorf("lease repo = %q, want %q", l.Repo, dir)
+		}
+	}
+
+	leases.Ports[19150] = state.NewLease(filepath.Join(t.TempDir(), "gone"), "main", "api")
+	if err := store.Save(leases); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"ports"}, {"ports", "--json"}, {"ports", "--prune"}} {
+		resetRootCmd()
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("%s: %v", strings.Join(args, " "), err)
+		}
+	}
+	leases, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := leases.Ports[19150]; ok || len(leases.Ports) != 1 {
+		t.Errorf("leases after ports --prune = %v, want only the live one", leases.Ports)
+	}
 }
 
 func TestLsCommand(t *testing.T) {
@@ -338,6 +582,33 @@ func TestBuildLsEntries(t *testing.T) {
 	}
 }
 
+func TestBuildLsEntries_ExtraPorts(t *testing.T) {
+	c := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"web": {ProxyPort: 3000, ExtraPorts: map[string]config.PortRange{"hmr": {Min: 24600, Max: 24699}}},
+		},
+	}
+	st := &state.State{
+		Services: map[string]map[string]*state.ServiceState{},
+		PortAssignments: map[string]int{
+			state.PortKey("main", "web"):                                3100,
+			state.PortKey("main", state.ExtraPortService("web", "hmr")): 24642,
+		},
+	}
+	trees := []git.Worktree{{Path: "/a", Branch: "main"}, {Path: "/b", Branch: "feature/x"}}
+
+	entries := buildLsEntries(trees, []string{"web"}, st, c, nil)
+	if len(entries) != 2 {
+		t.Fatalf("buildLsEntries returned %d entries, want 2", len(entries))
+	}
+	if got := entries[0].ExtraPorts; !reflect.DeepEqual(got, map[string]int{"hmr": 24642}) {
+		t.Errorf("main/web extra ports = %v", got)
+	}
+	if got := entries[1].ExtraPorts; got != nil {
+		t.Errorf("feature/x/web extra ports = %v, want none before they are assigned", got)
+	}
+}
+
 func TestBuildLsEntries_DetachedHead(t *testing.T) {
 	trees := []git.Worktree{
 		{Path: "/a", Branch: ""},
@@ -381,6 +652,30 @@ func TestBuildLsEntries_StaleProcess(t *testing.T) {
 	}
 }
 
+func TestBuildLsEntries_Disabled(t *testing.T) {
+	off, on := false, true
+	c := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"api": {ProxyPort: 8000, Enabled: &off},
+			"web": {ProxyPort: 3000},
+		},
+		Worktrees: map[string]config.WTOverride{
+			"data/*": {Services: map[string]config.WTServiceOverride{"api": {Enabled: &on}}},
+		},
+	}
+
+	trees := []git.Worktree{{Path: "/a", Branch: "main"}, {Path: "/b", Branch: "data/x"}}
+	st := &state.State{Services: map[string]map[string]*state.ServiceState{}, PortAssignments: map[string]int{}}
+	entries := buildLsEntries(trees, []string{"api", "web"}, st, c, nil)
+
+	want := []string{state.StatusDisabled, state.StatusStopped, state.StatusStopped, state.StatusStopped}
+	for i, e := range entries {
+		if e.Status != want[i] {
+			t.Errorf("%s/%s status = %q, want %q", e.Worktree, e.Service, e.Status, want[i])
+		}
+	}
+}
+
 func TestPrintLsTable(t *testing.T) {
 	entries := []lsEntry{
 		{Worktree: "main", Service: "web", Port: 3100, Status: state.StatusRunning, PID: 123},
@@ -403,3 +698,267 @@ func TestDownAll(t *testing.T) {
 		t.Fatalf("down --all: %v", err)
 	}
 }
+
+func TestInspectWithoutProxy(t *testing.T) {
+	setupTestRepo(t)
+	resetRootCmd()
+
+	rootCmd.SetArgs([]string{"inspect"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("inspect without a running proxy should error")
+	}
+}
+
+func TestMirrorReportEmpty(t *testing.T) {
+	setupTestRepo(t)
+	resetRootCmd()
+
+	rootCmd.SetArgs([]string{"mirror", "report"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("mirror report: %v", err)
+	}
+}
+
+func TestChaosClearWithoutProxy(t *testing.T) {
+	setupTestRepo(t)
+	resetRootCmd()
+
+	rootCmd.SetArgs([]string{"chaos", "clear"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("chaos clear without a running proxy should error")
+	}
+}
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"64k", 64 << 10, false},
+		{"64KB/s", 64 << 10, false},
+		{"1.5m", 3 << 19, false},
+		{"0", 0, true},
+		{"fast", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteRate(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseByteRate(%q) = %d, %v, want %d (err %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestShareWithoutProxy(t *testing.T) {
+	setupTestRepo(t)
+	resetRootCmd()
+
+	rootCmd.SetArgs([]string{"share"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("share without a sharing proxy should error")
+	}
+}
+
+func TestPrintQR(t *testing.T) {
+	var b strings.Builder
+	if err := printQR(&b, "http://main.192.168.1.5.nip.io:3000/?pt_token=abc"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	width := utf8.RuneCountInString(lines[0])
+	for i, l := range lines {
+		if n := utf8.RuneCountInString(l); n != width {
+			t.Fatalf("line %d has %d columns, want %d", i, n, width)
+		}
+	}
+	// Two modules per row: the output is about half as tall as it is wide.
+	if len(lines) < width/2 || len(lines) > width/2+1 {
+		t.Errorf("QR code is %d rows for %d columns", len(lines), width)
+	}
+}
+
+func TestCertCommands(t *testing.T) {
+	dir := setupTestRepo(t)
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	resetRootCmd()
+
+	rootCmd.SetArgs([]string{"cert", "rotate-ca"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cert rotate-ca error: %v", err)
+	}
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"cert", "renew"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cert renew error: %v", err)
+	}
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"cert", "info"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cert info error: %v", err)
+	}
+
+	certs, err := certPathsFor(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dataHome, "portree", "ca", "ca.crt")); err != nil {
+		t.Errorf("the CA should be created in the user-level directory: %v", err)
+	}
+	for _, r := range checkCerts(certs, time.Now()) {
+		if !r.ok {
+			t.Errorf("%s: %s", r.name, r.detail)
+		}
+	}
+	results := checkCerts(certs, time.Now().Add(400*24*time.Hour))
+	if len(results) != 2 || results[1].ok || !strings.Contains(results[1].detail, "expired") {
+		t.Errorf("checkCerts() a year later = %+v, want an expired server cert", results)
+	}
+	if results := checkCerts(cert.Paths(t.TempDir()), time.Now()); results != nil {
+		t.Errorf("checkCerts() without certs = %+v, want none", results)
+	}
+
+	local, err := certPathsFor(dir, &config.Config{TLS: config.TLSConfig{LocalCA: true}})
+	if err != nil || local.CACert != filepath.Join(dir, ".portree", "certs", "ca.crt") {
+		t.Errorf("certPathsFor(local_ca) CA = %q, %v", local.CACert, err)
+	}
+}
+
+func TestCertClientCommand(t *testing.T) {
+	dir := setupTestRepo(t)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	resetRootCmd()
+
+	rootCmd.SetArgs([]string{"cert", "client", "alice"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cert client error: %v", err)
+	}
+	for _, name := range []string{"alice.crt", "alice.key"} {
+		if _, err := os.Stat(filepath.Join(dir, ".portree", "certs", "client", name)); err != nil {
+			t.Errorf("%s should exist: %v", name, err)
+		}
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"cert", "client", "../bob"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("cert client should reject an invalid name")
+	}
+}
+
+func TestProfileFlag(t *testing.T) {
+	dir := setupTestRepo(t)
+	local := "[profiles.alt.services.web]\ncommand = \"echo alt\"\n"
+	if err := os.WriteFile(filepath.Join(dir, config.LocalFileName), []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"ls", "--profile", "alt"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("ls --profile alt error: %v", err)
+	}
+	if cfg.Profile != "alt" || cfg.Services["web"].Command != "echo alt" {
+		t.Errorf("profile not applied: %q, %+v", cfg.Profile, cfg.Services["web"])
+	}
+
+	resetRootCmd()
+	t.Setenv(config.ProfileEnv, "alt")
+	rootCmd.SetArgs([]string{"ls"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("ls with %s error: %v", config.ProfileEnv, err)
+	}
+	if cfg.Profile != "alt" {
+		t.Errorf("Profile = %q, want alt from %s", cfg.Profile, config.ProfileEnv)
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"ls", "--profile", "missing"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "available: alt") {
+		t.Errorf("ls --profile missing error = %v", err)
+	}
+	resetRootCmd()
+}
+
+func TestEnvCommand(t *testing.T) {
+	dir := setupTestRepo(t)
+	extra := "env_file = [\".env\"]\n\n[env]\nGREETING = \"hello ${slug}\"\n"
+	if err := os.WriteFile(filepath.Join(dir, config.FileName), []byte(extra+testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("GREETING=from file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"env", "--explain"}, {"env", "--json"}} {
+		resetRootCmd()
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("%v error: %v", args, err)
+		}
+	}
+
+	// Explaining the environment must not assign ports.
+	store, err := state.NewFileStore(filepath.Join(dir, ".portree"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.PortAssignments) != 0 {
+		t.Errorf("env --explain assigned ports: %v", st.PortAssignments)
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"env"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "run 'portree up' first") {
+		t.Errorf("env without ports error = %v", err)
+	}
+
+	tree, err := git.CurrentWorktree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetPortAssignment(st, tree.Branch, "web", 19150)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"env"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("env error: %v", err)
+	}
+
+	resetRootCmd()
+	rootCmd.SetArgs([]string{"env", "--service", "nope"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), `unknown service "nope"`) {
+		t.Errorf("env --service nope error = %v", err)
+	}
+	resetRootCmd()
+}
+
+func TestPrintEnvExplain(t *testing.T) {
+	var b strings.Builder
+	err := printEnvExplain(&b, []config.EnvVar{
+		{Name: "GREETING", Value: "hello\nworld", Source: ".env", Overrides: []string{".portree.toml: env.GREETING"}},
+		{Name: "PORT", Value: "19100", Source: config.AutoSource},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "NAME       VALUE    SOURCE\n" +
+		"GREETING   hello…   .env (overrides .portree.toml: env.GREETING)\n" +
+		"PORT       19100    portree\n"
+	if b.String() != want {
+		t.Errorf("printEnvExplain() =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	for in, want := range map[string]string{"plain": "plain", "": "''", "it's here": `'it'\''s here'`} {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
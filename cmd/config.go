@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/git"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Validate and inspect the configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config files for errors and unknown keys",
+	Long: `Load .portree.toml, .portree.local.toml, their includes and the selected
+profile, and report syntax errors, unknown keys (with line numbers) and
+invalid settings.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"skipRepoDetection": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+		root, err := git.FindRepoRoot(cwd)
+		if err != nil {
+			return fmt.Errorf("not inside a git repository")
+		}
+
+		profile, _ := cmd.Flags().GetString("profile")
+		if profile == "" {
+			profile = os.Getenv(config.ProfileEnv)
+		}
+		loaded, err := config.LoadProfile(root, profile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Config is valid: %d service(s) from %d file(s)\n", len(loaded.Services), len(loaded.Files))
+		return nil
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the merged configuration",
+	Long: `Print the configuration merged from all config files and the selected
+profile, as TOML.
+
+With --resolved, print the services as they apply to the worktree of a
+branch (the current one unless --branch is given): worktree overrides
+applied, env entries merged, and whether each service is enabled.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolved, _ := cmd.Flags().GetBool("resolved")
+		branch, _ := cmd.Flags().GetString("branch")
+		if branch != "" && !resolved {
+			return fmt.Errorf("--branch requires --resolved")
+		}
+		if !resolved {
+			return cfg.Encode(os.Stdout)
+		}
+		if branch == "" {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("getting current directory: %w", err)
+			}
+			tree, err := git.CurrentWorktree(cwd)
+			if err != nil {
+				return fmt.Errorf("detecting worktree: %w", err)
+			}
+			branch = tree.Branch
+		}
+		return cfg.EncodeResolved(os.Stdout, branch)
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file",
+	Long: `Print a JSON Schema for .portree.toml, for completion and validation in
+editors that use taplo, such as VS Code with Even Better TOML. Point the
+editor at it with a directive on the first line of the file:
+
+  #:schema ` + config.SchemaID,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"skipRepoDetection": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := config.Schema()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
+
+func init() {
+	configShowCmd.Flags().Bool("resolved", false, "Show the services as they apply to one branch")
+	configShowCmd.Flags().String("branch", "", "Branch to resolve for (default: the current worktree's)")
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -16,9 +16,11 @@ Key bindings:
   x           Stop selected service
   r           Restart selected service
   o           Open in browser
+  e           Open the service directory in the editor
   a           Start all services
   X           Stop all services
   l           View logs
+  i           Toggle the request inspector (proxy --capture)
   q           Quit dashboard`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return tui.Run(cfg, repoRoot)
@@ -8,7 +8,10 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/fairy-pitta/portree/internal/cert"
 	"github.com/fairy-pitta/portree/internal/config"
 	"github.com/fairy-pitta/portree/internal/git"
 	"github.com/fairy-pitta/portree/internal/process"
@@ -31,6 +34,7 @@ var doctorCmd = &cobra.Command{
 		var results []checkResult
 
 		results = append(results, checkGit())
+		results = append(results, checkUserConfig())
 
 		cwd, err := os.Getwd()
 		if err != nil {
@@ -54,6 +58,9 @@ var doctorCmd = &cobra.Command{
 				results = append(results, checkStaleState(root))
 				results = append(results, checkStaleWorktrees(root, cwd))
 			}
+			if paths, err := certPathsFor(root, cfgObj); err == nil {
+				results = append(results, checkCerts(paths, time.Now())...)
+			}
 		}
 
 		printResults(results)
@@ -106,6 +113,19 @@ func checkRepo(cwd string) checkResult {
 	return checkResult{name: "inside git repository", ok: true, detail: root}
 }
 
+// checkUserConfig reports where the user config file is looked for, and
+// whether it exists. Errors in it are reported by checkConfig.
+func checkUserConfig() checkResult {
+	path, err := config.UserConfigPath()
+	if err != nil {
+		return checkResult{name: "user config", ok: false, detail: err.Error()}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return checkResult{name: "user config", ok: true, detail: path + " (not found, using defaults)"}
+	}
+	return checkResult{name: "user config", ok: true, detail: path}
+}
+
 func checkConfig(root string) checkResult {
 	cfgPath := filepath.Join(root, config.FileName)
 	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
@@ -121,11 +141,11 @@ func checkConfig(root string) checkResult {
 		return checkResult{name: "config file", ok: false, detail: err.Error()}
 	}
 
-	return checkResult{
-		name:   "config file",
-		ok:     true,
-		detail: fmt.Sprintf("%d service(s) defined", len(cfg.Services)),
+	detail := fmt.Sprintf("%d service(s) defined in %s", len(cfg.Services), strings.Join(cfg.FileLabels(), ", "))
+	if cfg.Profile != "" {
+		detail += fmt.Sprintf(" (profile %q)", cfg.Profile)
 	}
+	return checkResult{name: "config file", ok: true, detail: detail}
 }
 
 func checkPortConflicts(cfg *config.Config) []checkResult {
@@ -139,6 +159,9 @@ func checkPortConflicts(cfg *config.Config) []checkResult {
 	var results []checkResult
 	for _, name := range names {
 		svc := cfg.Services[name]
+		if svc.ProxyPort == 0 {
+			continue
+		}
 		ln, err := net.Listen("tcp", ":"+strconv.Itoa(svc.ProxyPort))
 		if err != nil {
 			results = append(results, checkResult{
@@ -237,6 +260,40 @@ func checkStaleWorktrees(root, cwd string) checkResult {
 	return checkResult{name: "worktree state consistent", ok: true}
 }
 
+// checkCerts reports on the auto-generated HTTPS certificates, if any.
+func checkCerts(paths cert.CertPaths, now time.Time) []checkResult {
+	if _, err := os.Stat(paths.ServerCert); err != nil {
+		return nil // HTTPS never used in this repository
+	}
+
+	ca := cert.Inspect(paths.CACert, paths.CAKey)
+	server := cert.Inspect(paths.ServerCert, paths.ServerKey)
+	results := []checkResult{
+		certCheck("CA certificate valid", ca, now),
+		certCheck("server certificate valid", server, now),
+	}
+	if ca.Err == nil && server.Err == nil && server.Cert.CheckSignatureFrom(ca.Cert) != nil {
+		results[1].ok = false
+		results[1].detail = "not signed by the current CA (run 'portree cert renew')"
+	}
+	return results
+}
+
+func certCheck(name string, info cert.Info, now time.Time) checkResult {
+	switch {
+	case info.Err != nil:
+		return checkResult{name: name, ok: false, detail: info.Err.Error()}
+	case !info.KeyMatches:
+		return checkResult{name: name, ok: false, detail: "private key does not match the certificate"}
+	case info.Remaining(now) <= 0:
+		return checkResult{name: name, ok: false, detail: "expired on " + info.NotAfter.Format("2006-01-02")}
+	case info.Remaining(now) < cert.RenewBefore:
+		return checkResult{name: name, ok: false, detail: fmt.Sprintf("expires %s; it is renewed on the next 'portree proxy start --https'",
+			info.NotAfter.Format("2006-01-02"))}
+	}
+	return checkResult{name: name, ok: true, detail: "expires " + info.NotAfter.Format("2006-01-02")}
+}
+
 func trimNewline(s string) string {
 	if len(s) > 0 && s[len(s)-1] == '\n' {
 		return s[:len(s)-1]
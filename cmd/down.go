@@ -36,9 +36,11 @@ var downCmd = &cobra.Command{
 			return fmt.Errorf("creating state store: %w", err)
 		}
 
+		registry := port.NewRegistry(store, cfg)
+
 		// Handle --prune: remove orphaned state entries.
 		if downPrune {
-			return pruneOrphanedState(store, cwd)
+			return pruneOrphanedState(registry, cwd)
 		}
 
 		if downService != "" {
@@ -47,7 +49,6 @@ var downCmd = &cobra.Command{
 			}
 		}
 
-		registry := port.NewRegistry(store, cfg)
 		mgr := process.NewManager(cfg, store, registry)
 
 		var trees []git.Worktree
@@ -96,8 +97,9 @@ var downCmd = &cobra.Command{
 	},
 }
 
-// pruneOrphanedState removes state entries for branches whose worktrees no longer exist.
-func pruneOrphanedState(store *state.FileStore, cwd string) error {
+// pruneOrphanedState removes state entries and port leases for branches
+// whose worktrees no longer exist.
+func pruneOrphanedState(registry *port.Registry, cwd string) error {
 	trees, err := git.ListWorktrees(cwd)
 	if err != nil {
 		return fmt.Errorf("listing worktrees: %w", err)
@@ -110,28 +112,8 @@ func pruneOrphanedState(store *state.FileStore, cwd string) error {
 		}
 	}
 
-	var pruned []string
-	if err := store.WithLock(func() error {
-		st, e := store.Load()
-		if e != nil {
-			return e
-		}
-
-		for _, branch := range state.OrphanedBranches(st, activeBranches) {
-			pruned = append(pruned, branch)
-			delete(st.Services, branch)
-		}
-
-		// Clean up port assignments for pruned branches.
-		for key := range st.PortAssignments {
-			branch, _ := state.ParsePortKey(key)
-			if !activeBranches[branch] {
-				delete(st.PortAssignments, key)
-			}
-		}
-
-		return store.Save(st)
-	}); err != nil {
+	pruned, err := registry.PruneBranches(activeBranches)
+	if err != nil {
 		return fmt.Errorf("pruning state: %w", err)
 	}
 
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/git"
+	"github.com/fairy-pitta/portree/internal/port"
+	"github.com/fairy-pitta/portree/internal/process"
+	"github.com/fairy-pitta/portree/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Show the environment of a service in the current worktree",
+	Long: `Print the environment variables a service of the current worktree is
+started with: [env], env_file files, worktree overrides and the variables
+portree injects, with ${...} references expanded.
+
+The output can be sourced by a shell:
+
+  eval "$(portree env --service web)"
+
+With --explain, show where each variable came from and which definitions it
+overrides. Nothing is started and no ports are assigned: ports the worktree
+does not have yet are shown as "(assigned on up)", and printing them for a
+shell fails until 'portree up' has run.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+		tree, err := git.CurrentWorktree(cwd)
+		if err != nil {
+			return fmt.Errorf("detecting worktree: %w", err)
+		}
+
+		service, _ := cmd.Flags().GetString("service")
+		if service == "" {
+			names := make([]string, 0, len(cfg.Services))
+			for name := range cfg.Services {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if len(names) > 1 {
+				return fmt.Errorf("--service is required (services: %s)", strings.Join(names, ", "))
+			}
+			service = names[0]
+		}
+
+		store, err := state.NewFileStore(filepath.Join(repoRoot, ".portree"))
+		if err != nil {
+			return fmt.Errorf("creating state store: %w", err)
+		}
+		mgr := process.NewManager(cfg, store, port.NewRegistry(store, cfg))
+		vars, err := mgr.Environment(tree, service)
+		if err != nil {
+			return err
+		}
+
+		explain, _ := cmd.Flags().GetBool("explain")
+		jsonFlag, _ := cmd.Flags().GetBool("json")
+		switch {
+		case jsonFlag:
+			return json.NewEncoder(os.Stdout).Encode(envJSON(vars))
+		case explain:
+			return printEnvExplain(os.Stdout, vars)
+		}
+		for _, v := range vars {
+			if strings.Contains(v.Value, process.UnassignedPort) {
+				return fmt.Errorf("%s needs a port that is not assigned yet; run 'portree up' first, or use --explain", v.Name)
+			}
+		}
+		for _, v := range vars {
+			fmt.Printf("export %s=%s\n", v.Name, shellQuote(v.Value))
+		}
+		return nil
+	},
+}
+
+type envVarJSON struct {
+	Name      string   `json:"name"`
+	Value     string   `json:"value"`
+	Source    string   `json:"source"`
+	Overrides []string `json:"overrides,omitempty"`
+}
+
+func envJSON(vars []config.EnvVar) []envVarJSON {
+	out := make([]envVarJSON, len(vars))
+	for i, v := range vars {
+		out[i] = envVarJSON(v)
+	}
+	return out
+}
+
+func printEnvExplain(w io.Writer, vars []config.EnvVar) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, v := range vars {
+		source := v.Source
+		if len(v.Overrides) > 0 {
+			source += " (overrides " + strings.Join(v.Overrides, ", ") + ")"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Name, displayValue(v.Value), source)
+	}
+	return tw.Flush()
+}
+
+// displayValue shortens v to one line for a table.
+func displayValue(v string) string {
+	if i := strings.IndexAny(v, "\r\n"); i >= 0 {
+		v = v[:i] + "…"
+	}
+	if r := []rune(v); len(r) > 60 {
+		v = string(r[:59]) + "…"
+	}
+	return v
+}
+
+// shellQuote quotes s for a POSIX shell when needed.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\r\n'\"$`\\|&;<>()*?[]#~{}!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func init() {
+	envCmd.Flags().String("service", "", "Service to show (required with more than one service)")
+	envCmd.Flags().Bool("explain", false, "Show where each variable came from")
+	envCmd.Flags().Bool("json", false, "Output as JSON, with sources")
+	rootCmd.AddCommand(envCmd)
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/detect"
+	"github.com/fairy-pitta/portree/internal/git"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Translate a Procfile or compose file into a .portree.toml",
+	Long: `Translate the processes of a Procfile or the services of a docker compose
+file into portree services, with port ranges and proxy ports that do not
+overlap.
+
+The configuration is printed to stdout, so it can be compared with an
+existing .portree.toml; --output writes it to a file instead.`,
+	Annotations: map[string]string{"skipRepoDetection": "true"},
+}
+
+var importProcfileCmd = &cobra.Command{
+	Use:   "procfile <file>",
+	Short: "Import the processes of a Procfile",
+	Long: `Import the processes of a Procfile (such as Procfile.dev) as services that
+run in the Procfile's directory. Ports written into a command (-p 3000,
+--port=3000, 0.0.0.0:3000, PORT=3000) are replaced with $PORT and used as
+the service's proxy port.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{"skipRepoDetection": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		procs, err := detect.ParseProcfile(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		if len(procs) == 0 {
+			return fmt.Errorf("%s: no processes", args[0])
+		}
+		dir, err := importDir(args[0])
+		if err != nil {
+			return err
+		}
+		return writeImport(cmd, args[0], detect.ImportProcfile(procs, dir))
+	},
+}
+
+var importComposeCmd = &cobra.Command{
+	Use:   "compose <file>",
+	Short: "Import the services of a docker compose file",
+	Long: `Import the services of a docker compose file as services that run them with
+'docker compose run', in a compose project named after the worktree slug.
+
+The container port of a service's first ports entry is published on $PORT
+and its published port becomes the proxy port. environment entries become
+service env entries passed into the container, with ${NAME} references
+rewritten as ${env:NAME}, and depends_on is kept: portree starts the
+dependencies first, and compose is told not to.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{"skipRepoDetection": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		compose, err := detect.ParseCompose(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		if len(compose) == 0 {
+			return fmt.Errorf("%s: no services", args[0])
+		}
+		dir, err := importDir(args[0])
+		if err != nil {
+			return err
+		}
+		return writeImport(cmd, args[0], detect.ImportCompose(compose, filepath.Base(args[0]), dir))
+	},
+}
+
+// importDir returns the directory of file relative to the repository root,
+// or to the current directory outside a repository.
+func importDir(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("getting current directory: %w", err)
+	}
+	if r, err := git.FindRepoRoot(root); err == nil {
+		root = r
+	}
+	// Resolve symlinks on both sides, as FindRepoRoot does.
+	dir := filepath.Dir(abs)
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", file, root)
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// writeImport prints the configuration for services or writes it to the
+// --output file.
+func writeImport(cmd *cobra.Command, source string, services []config.InitService) error {
+	for i := range services {
+		services[i].Comments = append([]string{"Imported from " + filepath.ToSlash(source)}, services[i].Comments...)
+	}
+	content, err := config.RenderServices(services)
+	if err != nil {
+		return err
+	}
+
+	output, _ := cmd.Flags().GetString("output")
+	if output == "" || output == "-" {
+		_, err := fmt.Fprint(cmd.OutOrStdout(), content)
+		return err
+	}
+	if force, _ := cmd.Flags().GetBool("force"); !force {
+		if _, err := os.Stat(output); err == nil {
+			return fmt.Errorf("%s already exists; use --force to overwrite it", output)
+		}
+	}
+	if err := os.WriteFile(output, []byte(content), 0600); err != nil {
+		return fmt.Errorf("writing %s: %w", output, err)
+	}
+	fmt.Printf("Wrote %d services to %s\n", len(services), output)
+	return nil
+}
+
+func init() {
+	importCmd.PersistentFlags().StringP("output", "o", "", "Write the configuration to this file instead of stdout")
+	importCmd.PersistentFlags().Bool("force", false, "Overwrite the --output file if it exists")
+	importCmd.AddCommand(importProcfileCmd)
+	importCmd.AddCommand(importComposeCmd)
+	rootCmd.AddCommand(importCmd)
+}
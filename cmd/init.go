@@ -1,18 +1,35 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/detect"
 	"github.com/fairy-pitta/portree/internal/git"
 	"github.com/spf13/cobra"
 )
 
+var (
+	initDetect bool
+	initYes    bool
+)
+
 var initCmd = &cobra.Command{
-	Use:         "init",
-	Short:       "Initialize a .portree.toml configuration file",
-	Long:        "Creates a default .portree.toml in the current git repository root.",
+	Use:   "init",
+	Short: "Initialize a .portree.toml configuration file",
+	Long: `Creates a default .portree.toml in the current git repository root and
+adds .portree.local.toml, which holds personal overrides, to .gitignore.
+
+With --detect, portree looks at the repository (package.json scripts, Vite,
+Next.js, Rails, Django, Go main packages, Procfile and docker compose files)
+and proposes services with commands, directories, port ranges and proxy
+ports. Each proposal is confirmed interactively unless --yes is given.`,
 	Annotations: map[string]string{"skipRepoDetection": "true"},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cwd, err := os.Getwd()
@@ -25,17 +42,150 @@ var initCmd = &cobra.Command{
 			return fmt.Errorf("not inside a git repository")
 		}
 
-		path, err := config.Init(root)
+		var path string
+		if initDetect {
+			path, err = initDetected(cmd, root)
+		} else {
+			path, err = config.Init(root)
+		}
 		if err != nil {
 			return err
 		}
 
 		fmt.Printf("Created %s in %s\n", config.FileName, root)
+		added, err := gitignore(root, config.LocalFileName)
+		if err != nil {
+			return err
+		}
+		if added {
+			fmt.Printf("Added %s to .gitignore\n", config.LocalFileName)
+		}
 		fmt.Printf("Edit the file to configure your services: %s\n", path)
 		return nil
 	},
 }
 
+// gitignore adds name to the .gitignore in root unless a line already
+// ignores it, and reports whether it did.
+func gitignore(root, name string) (bool, error) {
+	path := filepath.Join(root, ".gitignore")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("reading .gitignore: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == name || line == "/"+name {
+			return false, nil
+		}
+	}
+
+	entry := "/" + name + "\n"
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		entry = "\n" + entry
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return false, fmt.Errorf("updating .gitignore: %w", err)
+	}
+	if _, err := f.WriteString(entry); err != nil {
+		_ = f.Close()
+		return false, fmt.Errorf("updating .gitignore: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("updating .gitignore: %w", err)
+	}
+	return true, nil
+}
+
+// initDetected writes a config with the services detect proposes for root
+// and the user accepts, or the default config if there are none.
+func initDetected(cmd *cobra.Command, root string) (string, error) {
+	if _, err := os.Stat(filepath.Join(root, config.FileName)); err == nil {
+		return "", fmt.Errorf("%s already exists", config.FileName)
+	}
+
+	found, err := detect.Detect(root)
+	if err != nil {
+		return "", fmt.Errorf("detecting services: %w", err)
+	}
+	if len(found) == 0 {
+		fmt.Println("No services detected; writing the default configuration.")
+		return config.Init(root)
+	}
+
+	in := bufio.NewReader(cmd.InOrStdin())
+	var services []config.InitService
+	for _, svc := range found {
+		fmt.Printf("\n%s  %s\n", svc.Name, svc.Source)
+		fmt.Printf("  command     %s\n", svc.Command)
+		if svc.Dir != "" {
+			fmt.Printf("  dir         %s\n", svc.Dir)
+		}
+		fmt.Printf("  port_range  %d-%d\n", svc.PortRange.Min, svc.PortRange.Max)
+		if svc.ProxyPort != 0 {
+			fmt.Printf("  proxy_port  %d\n", svc.ProxyPort)
+		}
+		if svc.Note != "" {
+			fmt.Printf("  note        %s\n", svc.Note)
+		}
+
+		if !initYes {
+			ok, err := confirm(in, fmt.Sprintf("Add %s? [Y/n] ", svc.Name))
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		comments := []string{"Detected from " + svc.Source}
+		if svc.Note != "" {
+			comments = append(comments, "TODO: "+svc.Note)
+		}
+		services = append(services, config.InitService{
+			Name:     svc.Name,
+			Comments: comments,
+			ServiceConfig: config.ServiceConfig{
+				Command:   svc.Command,
+				Dir:       svc.Dir,
+				PortRange: svc.PortRange,
+				ProxyPort: svc.ProxyPort,
+			},
+		})
+	}
+	fmt.Println()
+
+	if len(services) == 0 {
+		fmt.Println("No services accepted; writing the default configuration.")
+		return config.Init(root)
+	}
+	return config.InitServices(root, services)
+}
+
+// confirm asks a yes/no question that defaults to yes.
+func confirm(in *bufio.Reader, prompt string) (bool, error) {
+	for {
+		fmt.Print(prompt)
+		line, err := in.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			if errors.Is(err, io.EOF) {
+				fmt.Println()
+				return false, fmt.Errorf("no answer on stdin; use --yes to accept all detected services")
+			}
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "", "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
 func init() {
+	initCmd.Flags().BoolVar(&initDetect, "detect", false, "Propose services detected in the repository")
+	initCmd.Flags().BoolVarP(&initYes, "yes", "y", false, "Accept all detected services without asking (with --detect)")
 	rootCmd.AddCommand(initCmd)
 }
@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/git"
+	"github.com/fairy-pitta/portree/internal/logging"
+	"github.com/fairy-pitta/portree/internal/proxy"
+	"github.com/fairy-pitta/portree/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Browse requests captured by the proxy",
+	Long: `List requests and responses captured by the reverse proxy.
+
+Capture is opt-in: start the proxy with 'portree proxy start --capture'.
+Use the subcommands to show a single exchange, export everything as a HAR
+file, or replay a captured request against another worktree. Cookie and
+Authorization headers are shown redacted; replay sends the originals.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+
+		slug, _ := cmd.Flags().GetString("slug")
+		service, _ := cmd.Flags().GetString("service")
+		jsonFlag, _ := cmd.Flags().GetBool("json")
+		if jsonFlag {
+			exchanges, err := client.Captures(slug, service)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(os.Stdout).Encode(exchanges)
+		}
+
+		exchanges, err := client.CaptureSummaries(slug, service)
+		if err != nil {
+			return err
+		}
+		return printExchangeTable(os.Stdout, exchanges)
+	},
+}
+
+var inspectShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a captured exchange in full",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid capture id %q", args[0])
+		}
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+		ex, err := client.Capture(id)
+		if err != nil {
+			return err
+		}
+
+		jsonFlag, _ := cmd.Flags().GetBool("json")
+		if jsonFlag {
+			return json.NewEncoder(os.Stdout).Encode(ex)
+		}
+		printExchange(os.Stdout, ex)
+		return nil
+	},
+}
+
+var inspectExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export captured exchanges as a HAR file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+		har, err := client.HAR()
+		if err != nil {
+			return err
+		}
+
+		out := io.Writer(os.Stdout)
+		output, _ := cmd.Flags().GetString("output")
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("creating %s: %w", output, err)
+			}
+			defer func() { _ = f.Close() }()
+			out = f
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(har); err != nil {
+			return fmt.Errorf("writing HAR: %w", err)
+		}
+		if output != "" {
+			logging.Info("Exported %d exchange(s) to %s", len(har.Log.Entries), output)
+		}
+		return nil
+	},
+}
+
+var inspectReplayCmd = &cobra.Command{
+	Use:   "replay <id>",
+	Short: "Replay a captured request against another worktree",
+	Long: `Send a captured request again, to the same service of another worktree.
+
+The request is sent directly to the target worktree's backend port with its
+original method, path, headers and body, over https for services with
+backend_tls. Bodies that were truncated during
+capture are replayed truncated.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid capture id %q", args[0])
+		}
+		target, _ := cmd.Flags().GetString("to")
+		if target == "" {
+			return fmt.Errorf("--to <branch> is required")
+		}
+
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+		ex, err := client.CaptureWithCredentials(id)
+		if err != nil {
+			return err
+		}
+		if ex.Service == "" {
+			return fmt.Errorf("capture %d was not routed to a service and cannot be replayed", id)
+		}
+		if ex.RequestBodyTruncated {
+			logging.Warn("request body of capture %d was truncated; replaying the captured prefix only", id)
+		}
+
+		backendPort, err := assignedPort(target, ex.Service)
+		if err != nil {
+			return err
+		}
+
+		host := ""
+		if u, err := url.Parse(ex.URL); err == nil {
+			host = proxy.ReplaceSlugInHost(u.Host, git.BranchSlug(target))
+		}
+
+		paths, err := certPaths()
+		if err != nil {
+			return err
+		}
+		route := proxy.Route{Branch: target, Service: ex.Service, Port: backendPort}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		resp, err := proxy.Replay(ctx, ex, cfg, route, host, proxy.NewBackendTransport(paths.CACert))
+		if err != nil {
+			return fmt.Errorf("replaying request: %w", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		fmt.Printf("%s %s → %s/%s (port %d)\n", ex.Method, ex.URL, target, ex.Service, backendPort)
+		fmt.Printf("%s %s (original: %d)\n\n", resp.Proto, resp.Status, ex.Status)
+		_, err = io.Copy(os.Stdout, resp.Body)
+		return err
+	},
+}
+
+var inspectClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Discard all captured exchanges",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := proxyAdminClient()
+		if err != nil {
+			return err
+		}
+		if err := client.ClearCaptures(); err != nil {
+			return err
+		}
+		logging.Info("Capture buffer cleared.")
+		return nil
+	},
+}
+
+// assignedPort returns the backend port assigned to branch/service in state.
+func assignedPort(branch, service string) (int, error) {
+	store, err := state.NewFileStore(filepath.Join(repoRoot, ".portree"))
+	if err != nil {
+		return 0, fmt.Errorf("creating state store: %w", err)
+	}
+	var port int
+	if err := store.WithLock(func() error {
+		st, e := store.Load()
+		if e != nil {
+			return e
+		}
+		port = state.GetPortAssignment(st, branch, service)
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("loading state: %w", err)
+	}
+	if port == 0 {
+		return 0, fmt.Errorf("no port assigned for %s/%s; run 'portree up' in that worktree first", branch, service)
+	}
+	return port, nil
+}
+
+func printExchangeTable(w io.Writer, exchanges []proxy.Exchange) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tTIME\tSLUG\tSERVICE\tMETHOD\tPATH\tSTATUS\tDURATION")
+	for _, ex := range exchanges {
+		path := ex.URL
+		if u, err := url.Parse(ex.URL); err == nil {
+			path = u.RequestURI()
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			ex.ID, ex.Time.Format("15:04:05"), ex.Slug, ex.Service, ex.Method, path,
+			ex.Status, ex.Duration.Round(time.Millisecond))
+	}
+	return tw.Flush()
+}
+
+func printExchange(w io.Writer, ex proxy.Exchange) {
+	_, _ = fmt.Fprintf(w, "#%d  %s  %s/%s → port %d  (%s)\n\n",
+		ex.ID, ex.Time.Format(time.RFC3339), ex.Slug, ex.Service, ex.BackendPort, ex.Duration.Round(time.Millisecond))
+
+	_, _ = fmt.Fprintf(w, "%s %s %s\n", ex.Method, ex.URL, ex.Proto)
+	printHeaders(w, ex.RequestHeader)
+	printBody(w, ex.RequestBody, ex.RequestBodyTruncated)
+
+	_, _ = fmt.Fprintf(w, "\n%d\n", ex.Status)
+	printHeaders(w, ex.ResponseHeader)
+	printBody(w, ex.ResponseBody, ex.ResponseBodyTruncated)
+}
+
+func printHeaders(w io.Writer, h map[string][]string) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "%s: %s\n", name, strings.Join(h[name], ", "))
+	}
+}
+
+func printBody(w io.Writer, body []byte, truncated bool) {
+	if len(body) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "\n%s\n", body)
+	if truncated {
+		_, _ = fmt.Fprintln(w, "… (truncated)")
+	}
+}
+
+func init() {
+	inspectCmd.Flags().String("slug", "", "Only show exchanges for this branch slug")
+	inspectCmd.Flags().String("service", "", "Only show exchanges for this service")
+	inspectCmd.Flags().Bool("json", false, "Output in JSON format")
+	inspectShowCmd.Flags().Bool("json", false, "Output in JSON format")
+	inspectExportCmd.Flags().StringP("output", "o", "", "Write the HAR file here instead of stdout")
+	inspectReplayCmd.Flags().String("to", "", "Branch whose worktree receives the replayed request")
+
+	inspectCmd.AddCommand(inspectShowCmd)
+	inspectCmd.AddCommand(inspectExportCmd)
+	inspectCmd.AddCommand(inspectReplayCmd)
+	inspectCmd.AddCommand(inspectClearCmd)
+	rootCmd.AddCommand(inspectCmd)
+}
@@ -24,6 +24,9 @@ type lsEntry struct {
 	PID       int    `json:"pid"`
 	URL       string `json:"url,omitempty"`
 	DirectURL string `json:"direct_url,omitempty"`
+	// ExtraPorts maps the names of the service's extra_ports to the ports
+	// assigned in the worktree.
+	ExtraPorts map[string]int `json:"extra_ports,omitempty"`
 }
 
 var lsCmd = &cobra.Command{
@@ -34,7 +37,8 @@ var lsCmd = &cobra.Command{
 Displays a table with worktree branch, service name, allocated port,
 running status, and PID for each service.
 
-Use --json to output the result as a JSON array for scripting and automation.`,
+Use --json to output the result as a JSON array for scripting and automation.
+It includes the ports assigned to each service's extra_ports.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cwd, err := os.Getwd()
 		if err != nil {
@@ -145,16 +149,29 @@ func buildLsEntries(trees []git.Worktree, serviceNames []string, st *state.State
 					e.Status = ss.Status
 				}
 			}
+			if e.Status != state.StatusRunning && c != nil && !c.ServiceEnabled(svcName, tree.Branch) {
+				e.Status = state.StatusDisabled
+			}
 
 			// Build URLs.
 			if proxyRunning && c != nil {
-				if svc, ok := c.Services[svcName]; ok {
+				if svc, ok := c.Services[svcName]; ok && svc.ProxyPort != 0 {
 					e.URL = fmt.Sprintf("%s://%s.localhost:%d", scheme, slug, svc.ProxyPort)
 				}
 			}
 			if e.Port > 0 {
 				e.DirectURL = fmt.Sprintf("http://localhost:%d", e.Port)
 			}
+			if c != nil {
+				for name := range c.Services[svcName].ExtraPorts {
+					if p := state.GetPortAssignment(st, tree.Branch, state.ExtraPortService(svcName, name)); p > 0 {
+						if e.ExtraPorts == nil {
+							e.ExtraPorts = map[string]int{}
+						}
+						e.ExtraPorts[name] = p
+					}
+				}
+			}
 
 			entries = append(entries, e)
 		}
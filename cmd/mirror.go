@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/logging"
+	"github.com/fairy-pitta/portree/internal/proxy"
+	"github.com/spf13/cobra"
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Inspect traffic mirrored between worktrees",
+	Long: `Inspect the results of traffic mirroring.
+
+Start the proxy with 'portree proxy start --mirror main=feature-x' to send
+every request for main to feature-x as well. Responses are compared on
+status, headers and (JSON-aware) body, and recorded in
+.portree/logs/mirror.jsonl.`,
+}
+
+var mirrorReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarize differences between primary and shadow responses",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		results, err := proxy.ReadMirrorLog(mirrorLogPath(filepath.Join(repoRoot, ".portree")))
+		if err != nil {
+			return err
+		}
+
+		since, _ := cmd.Flags().GetDuration("since")
+		if since > 0 {
+			cutoff := time.Now().Add(-since)
+			filtered := results[:0]
+			for _, r := range results {
+				if r.Time.After(cutoff) {
+					filtered = append(filtered, r)
+				}
+			}
+			results = filtered
+		}
+
+		summary := proxy.SummarizeMirror(results)
+
+		jsonFlag, _ := cmd.Flags().GetBool("json")
+		if jsonFlag {
+			return json.NewEncoder(os.Stdout).Encode(summary)
+		}
+
+		if len(results) == 0 {
+			fmt.Println("No mirrored requests recorded.")
+			return nil
+		}
+
+		mismatches := 0
+		for _, s := range summary {
+			mismatches += s.Mismatches
+		}
+		fmt.Printf("%d mirrored request(s), %d mismatch(es)\n\n", len(results), mismatches)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		_, _ = fmt.Fprintln(w, "PRIMARY → SHADOW\tSERVICE\tMETHOD\tPATH\tTOTAL\tMISMATCH\tSTATUS\tHEADERS\tBODY\tERRORS")
+		for _, s := range summary {
+			_, _ = fmt.Fprintf(w, "%s → %s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\n",
+				s.Primary, s.Shadow, s.Service, s.Method, s.Path,
+				s.Total, s.Mismatches, s.StatusDiffs, s.HeaderDiffs, s.BodyDiffs, s.ShadowErrors)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		for _, s := range summary {
+			if len(s.Examples) == 0 {
+				continue
+			}
+			fmt.Printf("\n%s %s (%s → %s):\n", s.Method, s.Path, s.Primary, s.Shadow)
+			for _, ex := range s.Examples {
+				fmt.Printf("  - %s\n", ex)
+			}
+		}
+		return nil
+	},
+}
+
+var mirrorClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Delete recorded mirror results",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := mirrorLogPath(filepath.Join(repoRoot, ".portree"))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s: %w", path, err)
+		}
+		logging.Info("Mirror results cleared.")
+		return nil
+	},
+}
+
+// mirrorLogPath returns the mirror results log inside the state directory.
+func mirrorLogPath(stateDir string) string {
+	return filepath.Join(stateDir, "logs", "mirror.jsonl")
+}
+
+func init() {
+	mirrorReportCmd.Flags().Bool("json", false, "Output in JSON format")
+	mirrorReportCmd.Flags().Duration("since", 0, "Only include requests mirrored within this duration (e.g. 1h)")
+
+	mirrorCmd.AddCommand(mirrorReportCmd)
+	mirrorCmd.AddCommand(mirrorClearCmd)
+	rootCmd.AddCommand(mirrorCmd)
+}
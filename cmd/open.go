@@ -17,7 +17,8 @@ var openService string
 var openCmd = &cobra.Command{
 	Use:   "open",
 	Short: "Open the current worktree's service in a browser",
-	Long: `Open the current worktree's service URL in the default browser.
+	Long: `Open the current worktree's service URL in the default browser, or
+with the command set by the browser key of the config.
 
 The URL is constructed as http://<branch-slug>.localhost:<proxy_port>.
 By default, the first service (alphabetically) is used.
@@ -36,9 +37,9 @@ Use --service to specify a different service.`,
 		// Determine which service to open.
 		svcName := openService
 		if svcName == "" {
-			// Use the first service alphabetically.
-			for name := range cfg.Services {
-				if svcName == "" || name < svcName {
+			// Use the first proxied service alphabetically.
+			for name, svc := range cfg.Services {
+				if svc.ProxyPort != 0 && (svcName == "" || name < svcName) {
 					svcName = name
 				}
 			}
@@ -48,6 +49,9 @@ Use --service to specify a different service.`,
 		if !ok {
 			return fmt.Errorf("unknown service %q", svcName)
 		}
+		if svc.ProxyPort == 0 {
+			return fmt.Errorf("service %q has no proxy_port", svcName)
+		}
 
 		// Determine scheme from proxy state.
 		scheme := "http"
@@ -69,7 +73,7 @@ Use --service to specify a different service.`,
 
 		url := browser.BuildURL(scheme, tree.Slug(), svc.ProxyPort)
 		fmt.Printf("Opening %s ...\n", url)
-		return browser.Open(url)
+		return browser.OpenWith(cfg.Browser, url)
 	},
 }
 
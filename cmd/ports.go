@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fairy-pitta/portree/internal/state"
+	"github.com/spf13/cobra"
+)
+
+type portsEntry struct {
+	Port      int    `json:"port"`
+	Repo      string `json:"repo"`
+	Branch    string `json:"branch"`
+	Service   string `json:"service"`
+	ExtraPort string `json:"extra_port,omitempty"` // name in the service's extra_ports
+	Since     string `json:"since"`
+	Stale     bool   `json:"stale"`
+}
+
+var portsCmd = &cobra.Command{
+	Use:   "ports",
+	Short: "List the ports leased by all repositories",
+	Long: `List the ports portree has assigned in all of your repositories, with the
+repository, branch and service holding each. Every repository records its
+ports in a user-level registry, ~/.local/state/portree/ports.db (or under
+$XDG_STATE_HOME), and skips the ports other repositories hold when it
+allocates, so repositories with overlapping port ranges do not collide.
+
+A lease is stale when its repository no longer assigns the port, for example
+after the repository was deleted or 'portree down --prune' removed the
+branch. Stale leases do not block allocation; --prune removes them.
+
+Use --json to output the result as a JSON array.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"skipRepoDetection": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := state.GlobalStateDir()
+		if err != nil {
+			return err
+		}
+		store, err := state.NewLeaseStore(dir)
+		if err != nil {
+			return err
+		}
+		prune, _ := cmd.Flags().GetBool("prune")
+
+		var entries []portsEntry
+		pruned := 0
+		if err := store.WithLock(func() error {
+			leases, err := store.Load()
+			if err != nil {
+				return err
+			}
+			entries = buildPortsEntries(leases)
+			if !prune {
+				return nil
+			}
+			if !leases.Release(func(p int, _ state.Lease) bool { return !leases.Live(p) }) {
+				return nil
+			}
+			pruned = len(entries) - len(leases.Ports)
+			entries = buildPortsEntries(leases)
+			return store.Save(leases)
+		}); err != nil {
+			return err
+		}
+
+		if jsonFlag, _ := cmd.Flags().GetBool("json"); jsonFlag {
+			return json.NewEncoder(os.Stdout).Encode(entries)
+		}
+		if prune {
+			fmt.Printf("Removed %d stale lease(s)\n", pruned)
+		}
+		if len(entries) == 0 {
+			fmt.Printf("No ports leased (%s)\n", store.Path())
+			return nil
+		}
+		return printPortsTable(entries)
+	},
+}
+
+// buildPortsEntries lists leases by port.
+func buildPortsEntries(leases *state.Leases) []portsEntry {
+	entries := make([]portsEntry, 0, len(leases.Ports))
+	for p, l := range leases.Ports {
+		service, extra, _ := strings.Cut(l.Service, "#")
+		entries = append(entries, portsEntry{
+			Port:      p,
+			Repo:      l.Repo,
+			Branch:    l.Branch,
+			Service:   service,
+			ExtraPort: extra,
+			Since:     l.Since,
+			Stale:     !leases.Live(p),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Port < entries[j].Port })
+	return entries
+}
+
+func printPortsTable(entries []portsEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PORT\tREPOSITORY\tBRANCH\tSERVICE\tSTATUS")
+
+	for _, e := range entries {
+		service := e.Service
+		if e.ExtraPort != "" {
+			service += " (" + e.ExtraPort + ")"
+		}
+		status := "leased"
+		if e.Stale {
+			status = "stale"
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", e.Port, e.Repo, e.Branch, service, status)
+	}
+
+	return w.Flush()
+}
+
+func init() {
+	portsCmd.Flags().Bool("json", false, "Output in JSON format")
+	portsCmd.Flags().Bool("prune", false, "Remove stale leases")
+	rootCmd.AddCommand(portsCmd)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"os"
@@ -8,11 +9,14 @@ import (
 	"path/filepath"
 	"sort"
 	"syscall"
+	"time"
 
 	"github.com/fairy-pitta/portree/internal/cert"
+	"github.com/fairy-pitta/portree/internal/config"
 	"github.com/fairy-pitta/portree/internal/logging"
 	"github.com/fairy-pitta/portree/internal/proxy"
 	"github.com/fairy-pitta/portree/internal/state"
+	"github.com/fairy-pitta/portree/internal/tracing"
 	"github.com/spf13/cobra"
 )
 
@@ -31,8 +35,48 @@ Launches HTTP listeners for each configured proxy_port, routing requests
 based on the Host header subdomain (e.g., feature-auth.localhost:3000).
 The proxy runs until interrupted with Ctrl+C (SIGINT) or SIGTERM.
 
-Use --https to enable HTTPS with auto-generated certificates, or
---cert and --key to provide your own certificate and key files.`,
+Use --https to enable HTTPS with auto-generated certificates (https = true
+in the config makes it the default; --https=false turns it off), or
+--cert and --key to provide your own certificate and key files. With
+auto-generated certificates, each host name (e.g. api.feature-x.localhost)
+gets its own certificate signed by the portree CA, cached in
+.portree/certs/leaf/ and renewed before it expires.
+
+Use --client-ca <file> to require client certificates (mutual TLS) signed by
+the given CA, or --mtls to use the client CA behind 'portree cert client'.
+The subject of the verified certificate is passed to backends in the
+X-Client-Cert-Subject header (see --client-subject-header); clients cannot
+set that header themselves.
+
+Use --capture to record requests and responses into an in-memory ring
+buffer that can be browsed with 'portree inspect'.
+
+Use --mirror primary=shadow (repeatable) to also send every request for the
+primary branch to the shadow branch. The shadow response is discarded, but
+compared with the primary one; differences are summarized by
+'portree mirror report'.
+
+Every request is written to .portree/logs/proxy-access.log as JSON lines
+(--access-log-format json, the default) or in Common Log Format
+(--access-log-format common). Request counts, latency histograms and
+upstream errors per slug and service are served in Prometheus format at
+/metrics on the admin port.
+
+Use --share to make worktrees reachable from other devices on the LAN as
+http://<slug>.<lan-ip>.nip.io:<proxy_port>. Requests that do not come from
+this machine must carry the worktree's share token; print a link with
+'portree share <branch>'. --bind selects the address or interface to listen
+on (default: the first private IPv4 address). With --bind 0.0.0.0 the proxy
+listens on every interface and links use the first private IPv4 address.
+
+Use --otlp-endpoint (or the standard OTEL_EXPORTER_OTLP_ENDPOINT variable)
+to export a span per request over OTLP/HTTP. The proxy continues incoming
+W3C traceparent headers and passes its own span context to the backend.
+
+Edits to .portree.toml are picked up while the proxy runs: new proxy ports
+start listening and unused ones are closed, leaving connections on the other
+ports alone. Send SIGHUP to reload immediately. An invalid file is reported
+and the previous config stays in effect.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		stateDir := filepath.Join(repoRoot, ".portree")
 		store, err := state.NewFileStore(stateDir)
@@ -41,26 +85,50 @@ Use --https to enable HTTPS with auto-generated certificates, or
 		}
 
 		httpsFlag, _ := cmd.Flags().GetBool("https")
+		if !cmd.Flags().Changed("https") {
+			httpsFlag = cfg.HTTPS
+		}
 		certFile, _ := cmd.Flags().GetString("cert")
 		keyFile, _ := cmd.Flags().GetString("key")
+		clientCAFile, _ := cmd.Flags().GetString("client-ca")
+		if mtls, _ := cmd.Flags().GetBool("mtls"); mtls && clientCAFile == "" {
+			paths, err := certPaths()
+			if err != nil {
+				return err
+			}
+			clientCAFile, _ = paths.ClientCA()
+			if _, err := os.Stat(clientCAFile); os.IsNotExist(err) {
+				return fmt.Errorf("no client CA at %s\nRun 'portree cert client <name>' first to create it", clientCAFile)
+			}
+		}
 
 		// Build TLS config if HTTPS is requested.
 		var tlsConfig *tls.Config
-		if httpsFlag || certFile != "" || keyFile != "" {
+		var issuer *cert.Issuer // nil when --cert/--key are given
+		if httpsFlag || certFile != "" || keyFile != "" || clientCAFile != "" {
 			if (certFile != "") != (keyFile != "") {
 				return fmt.Errorf("--cert and --key must be specified together")
 			}
 
 			if certFile == "" {
 				// Auto-generate certificates.
-				certDir := filepath.Join(stateDir, "certs")
-				paths, err := cert.EnsureCerts(certDir)
+				paths, err := certPaths()
 				if err != nil {
+					return err
+				}
+				if err := cert.Ensure(paths); err != nil {
 					return fmt.Errorf("generating certificates: %w", err)
 				}
 				certFile = paths.ServerCert
 				keyFile = paths.ServerKey
-				logging.Verbose("using auto-generated certificates in %s", certDir)
+				logging.Verbose("using auto-generated certificates in %s (CA: %s)", filepath.Dir(paths.ServerCert), paths.CACert)
+
+				// Mint a certificate per server name; the *.localhost
+				// server cert remains the fallback for clients without SNI.
+				issuer, err = cert.NewIssuer(paths, paths.LeafDir())
+				if err != nil {
+					return fmt.Errorf("loading CA: %w", err)
+				}
 			}
 
 			keypair, err := tls.LoadX509KeyPair(certFile, keyFile)
@@ -70,21 +138,135 @@ Use --https to enable HTTPS with auto-generated certificates, or
 			tlsConfig = &tls.Config{
 				Certificates: []tls.Certificate{keypair},
 			}
+			if issuer != nil {
+				tlsConfig.GetCertificate = issuer.GetCertificate
+			}
+
+			if clientCAFile != "" {
+				pool, err := cert.LoadCertPool(clientCAFile)
+				if err != nil {
+					return fmt.Errorf("loading client CA: %w", err)
+				}
+				tlsConfig.ClientCAs = pool
+				tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+
+		accessLogFormat, _ := cmd.Flags().GetString("access-log-format")
+		if !proxy.ValidAccessLogFormat(accessLogFormat) {
+			return fmt.Errorf("invalid --access-log-format %q (want json, common or off)", accessLogFormat)
 		}
 
 		resolver := proxy.NewResolver(cfg, store)
 		server := proxy.NewProxyServer(resolver, tlsConfig)
+		if issuer != nil {
+			// Only mint certificates for worktrees, so that made-up server
+			// names cannot fill the leaf directory.
+			issuer.Allow = func(name string) bool {
+				return name == "localhost" || resolver.KnownSlug(proxy.ParseSlugFromHost(name))
+			}
+		}
 
-		// Collect proxy ports.
-		proxyPorts := map[string]int{}
-		for name, svc := range cfg.Services {
-			proxyPorts[name] = svc.ProxyPort
+		if clientCAFile != "" {
+			header, _ := cmd.Flags().GetString("client-subject-header")
+			if header != "" {
+				server.ForwardClientSubject(header)
+			}
+		}
+
+		// Services with backend_tls serve HTTPS with a certificate from the
+		// portree CA (see 'portree up').
+		if paths, err := certPaths(); err == nil {
+			server.EnableBackendTLS(paths.CACert)
+		}
+
+		var accessLog *proxy.AccessLog
+		if accessLogFormat != proxy.AccessLogOff {
+			accessLog, err = proxy.OpenAccessLog(accessLogPath(stateDir), accessLogFormat)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = accessLog.Close() }()
+			server.EnableAccessLog(accessLog)
+		}
+
+		captureFlag, _ := cmd.Flags().GetBool("capture")
+		if captureFlag {
+			captureSize, _ := cmd.Flags().GetInt("capture-size")
+			bodyLimit, _ := cmd.Flags().GetInt("capture-body-limit")
+			server.EnableCapture(proxy.NewCaptureBuffer(captureSize), bodyLimit)
+		}
+
+		mirrorFlags, _ := cmd.Flags().GetStringArray("mirror")
+		var mirror *proxy.Mirror
+		if len(mirrorFlags) > 0 {
+			rules := map[string]string{}
+			for _, f := range mirrorFlags {
+				primary, shadow, err := proxy.ParseMirrorRule(f)
+				if err != nil {
+					return err
+				}
+				if existing, ok := rules[primary]; ok && existing != shadow {
+					return fmt.Errorf("%s is already mirrored to %s", primary, existing)
+				}
+				rules[primary] = shadow
+			}
+			mirror = proxy.NewMirror(resolver, rules, mirrorLogPath(stateDir), proxy.DefaultMirrorBodyLimit)
+			server.EnableMirror(mirror)
+		}
+
+		shareFlag, _ := cmd.Flags().GetBool("share")
+		bindFlag, _ := cmd.Flags().GetString("bind")
+		if bindFlag != "" && !shareFlag {
+			return fmt.Errorf("--bind requires --share")
+		}
+		var shareAddr string // address in share links
+		if shareFlag {
+			bindAddr, err := proxy.ResolveBindAddress(bindFlag)
+			if err != nil {
+				return err
+			}
+			if shareAddr, err = proxy.ShareAddress(bindAddr); err != nil {
+				return fmt.Errorf("listening on %s: %w", bindAddr, err)
+			}
+			secret, err := proxy.LoadOrCreateShareSecret(shareSecretPath(stateDir))
+			if err != nil {
+				return err
+			}
+			server.EnableSharing(bindAddr, secret)
+			if tlsConfig != nil && issuer == nil {
+				logging.Warn("the HTTPS certificate may not cover nip.io names; LAN devices will see a certificate warning")
+			} else if tlsConfig != nil {
+				logging.Warn("LAN devices must trust the portree CA to avoid certificate warnings (see 'portree cert info')")
+			}
 		}
 
+		otlpEndpoint, _ := cmd.Flags().GetString("otlp-endpoint")
+		tracesURL := tracing.EndpointFromEnv()
+		if otlpEndpoint != "" {
+			tracesURL = tracing.TracesURL(otlpEndpoint)
+		}
+		var exporter *tracing.Exporter
+		if tracesURL != "" {
+			exporter = tracing.NewExporter(tracesURL, "portree-proxy", version)
+			server.EnableTracing(tracing.NewTracer(exporter))
+		}
+
+		// Collect proxy ports.
+		proxyPorts := proxyPortsFor(cfg)
+
 		if err := server.Start(proxyPorts); err != nil {
 			return err
 		}
 
+		adminPortFlag, _ := cmd.Flags().GetInt("admin-port")
+		admin := proxy.NewAdminServer(server, version)
+		adminPort, err := admin.Start(adminPortFlag)
+		if err != nil {
+			_ = server.Stop()
+			return err
+		}
+
 		// Update state.
 		isHTTPS := tlsConfig != nil
 		if err := store.WithLock(func() error {
@@ -96,6 +278,11 @@ Use --https to enable HTTPS with auto-generated certificates, or
 				PID:    os.Getpid(),
 				Status: state.StatusRunning,
 				HTTPS:  isHTTPS,
+
+				AdminPort:  adminPort,
+				AdminToken: admin.Token(),
+				Capture:    captureFlag,
+				ShareAddr:  shareAddr,
 			}
 			return store.Save(st)
 		}); err != nil {
@@ -117,16 +304,71 @@ Use --https to enable HTTPS with auto-generated certificates, or
 
 		fmt.Println("\nAccess your services at:")
 		fmt.Printf("  %s://<branch-slug>.localhost:<proxy_port>\n", scheme)
+		if shareAddr != "" {
+			fmt.Printf("\nShared on the LAN at %s://<branch-slug>.%s.nip.io:<proxy_port>\n", scheme, shareAddr)
+			fmt.Println("Remote requests need a share token; get a link with 'portree share <branch>'.")
+		}
+		fmt.Printf("\nAdmin API: http://127.0.0.1:%d (metrics at /metrics)\n", adminPort)
+		if accessLog != nil {
+			fmt.Printf("Access log: %s\n", accessLogPath(stateDir))
+		}
+		if tracesURL != "" {
+			fmt.Printf("Exporting traces to %s\n", tracesURL)
+		}
+		if captureFlag {
+			fmt.Println("Request capture enabled (browse with 'portree inspect').")
+		}
+		for _, f := range mirrorFlags {
+			primary, shadow, _ := proxy.ParseMirrorRule(f)
+			fmt.Printf("Mirroring %s → %s (see 'portree mirror report').\n", primary, shadow)
+		}
+
+		// Reload the config when the file changes or on SIGHUP; stop on
+		// SIGINT/SIGTERM. Reloads run on this goroutine, one at a time.
+		ctx, cancelWatch := context.WithCancel(context.Background())
+		defer cancelWatch()
+		changed := make(chan struct{}, 1)
+		watcher := config.NewWatcher(time.Second, config.WatchPaths(repoRoot, cfg)...)
+		go watcher.Run(ctx, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
 
-		// Wait for interrupt.
 		sig := make(chan os.Signal, 1)
-		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-		<-sig
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	wait:
+		for {
+			select {
+			case s := <-sig:
+				if s != syscall.SIGHUP {
+					break wait
+				}
+				reloadProxyConfig(resolver, server, watcher)
+			case <-changed:
+				reloadProxyConfig(resolver, server, watcher)
+			}
+		}
+		cancelWatch()
 
 		fmt.Println("\nStopping proxy...")
 		if err := server.Stop(); err != nil {
 			logging.Warn("error stopping proxy server: %v", err)
 		}
+		if err := admin.Stop(); err != nil {
+			logging.Warn("error stopping admin server: %v", err)
+		}
+		if mirror != nil {
+			mirror.Wait()
+		}
+		if exporter != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := exporter.Shutdown(ctx); err != nil {
+				logging.Warn("flushing traces: %v", err)
+			}
+			cancel()
+		}
 
 		if err := store.WithLock(func() error {
 			st, e := store.Load()
@@ -200,8 +442,90 @@ func init() {
 	proxyStartCmd.Flags().Bool("https", false, "Enable HTTPS with auto-generated certificates")
 	proxyStartCmd.Flags().String("cert", "", "Path to TLS certificate file")
 	proxyStartCmd.Flags().String("key", "", "Path to TLS private key file")
+	proxyStartCmd.Flags().String("client-ca", "", "Require client certificates signed by the CA in this PEM file (implies HTTPS)")
+	proxyStartCmd.Flags().Bool("mtls", false, "Require client certificates issued by 'portree cert client' (implies HTTPS)")
+	proxyStartCmd.Flags().String("client-subject-header", "X-Client-Cert-Subject", "Header carrying the verified client certificate subject to backends (empty = none)")
+	proxyStartCmd.Flags().Int("admin-port", 0, "Port for the admin API on 127.0.0.1 (0 = pick a free port)")
+	proxyStartCmd.Flags().Bool("capture", false, "Record requests and responses for 'portree inspect'")
+	proxyStartCmd.Flags().Int("capture-size", proxy.DefaultCaptureSize, "Number of exchanges kept in the capture buffer")
+	proxyStartCmd.Flags().Int("capture-body-limit", proxy.DefaultCaptureBodyLimit, "Maximum body bytes recorded per request and response")
+	proxyStartCmd.Flags().StringArray("mirror", nil, "Mirror traffic as primary=shadow branch (repeatable)")
+	proxyStartCmd.Flags().Bool("share", false, "Also listen on a LAN address, protected by per-worktree share tokens")
+	proxyStartCmd.Flags().String("bind", "", "IP address or interface name to share on (default: first private IPv4 address)")
+	proxyStartCmd.Flags().String("otlp-endpoint", "", "OTLP/HTTP endpoint for request traces (default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	proxyStartCmd.Flags().String("access-log-format", proxy.AccessLogJSON, "Access log format: json, common or off")
 
 	proxyCmd.AddCommand(proxyStartCmd)
 	proxyCmd.AddCommand(proxyStopCmd)
 	rootCmd.AddCommand(proxyCmd)
 }
+
+// proxyAdminClient returns a client for the running proxy's admin API.
+func proxyAdminClient() (*proxy.AdminClient, error) {
+	store, err := state.NewFileStore(filepath.Join(repoRoot, ".portree"))
+	if err != nil {
+		return nil, fmt.Errorf("creating state store: %w", err)
+	}
+
+	var st *state.State
+	if err := store.WithLock(func() error {
+		var e error
+		st, e = store.Load()
+		return e
+	}); err != nil {
+		return nil, fmt.Errorf("loading proxy state: %w", err)
+	}
+
+	if st.Proxy.Status != state.StatusRunning || st.Proxy.AdminPort == 0 {
+		return nil, fmt.Errorf("proxy is not running; start it with 'portree proxy start'")
+	}
+	return proxy.NewAdminClient(st.Proxy.AdminPort, st.Proxy.AdminToken), nil
+}
+
+// proxyPortsFor maps each service in c that has a proxy port to it.
+func proxyPortsFor(c *config.Config) map[string]int {
+	ports := make(map[string]int, len(c.Services))
+	for name, svc := range c.Services {
+		if svc.ProxyPort != 0 {
+			ports[name] = svc.ProxyPort
+		}
+	}
+	return ports
+}
+
+// reloadProxyConfig re-reads the config, with the same profile, and applies
+// it to the running proxy. An invalid file is reported and the previous
+// config stays active. The resolver holds the live config for the request
+// goroutines; the package-level cfg keeps the config the proxy started with.
+func reloadProxyConfig(resolver *proxy.Resolver, server *proxy.ProxyServer, watcher *config.Watcher) {
+	newCfg, err := config.LoadProfile(repoRoot, resolver.Config().Profile)
+	if err != nil {
+		logging.Warn("config reload failed, keeping the previous config: %v", err)
+		return
+	}
+	resolver.SetConfig(newCfg)
+	watcher.SetPaths(config.WatchPaths(repoRoot, newCfg)...)
+
+	added, removed, err := server.Reconcile(proxyPortsFor(newCfg))
+	for _, port := range added {
+		fmt.Printf("  + listening on :%d\n", port)
+	}
+	for _, port := range removed {
+		fmt.Printf("  - stopped listening on :%d\n", port)
+	}
+	if err != nil {
+		logging.Warn("config reloaded, but some proxy ports could not be opened: %v", err)
+		return
+	}
+	logging.Info("Config reloaded.")
+}
+
+// accessLogPath returns the location of the proxy access log.
+func accessLogPath(stateDir string) string {
+	return filepath.Join(stateDir, "logs", "proxy-access.log")
+}
+
+// shareSecretPath returns the file holding the secret share tokens are derived from.
+func shareSecretPath(stateDir string) string {
+	return filepath.Join(stateDir, "share.key")
+}
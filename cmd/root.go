@@ -50,12 +50,19 @@ var rootCmd = &cobra.Command{
 
 		logging.Verbose("repo root: %s", repoRoot)
 
-		cfg, err = config.Load(repoRoot)
+		profile, _ := cmd.Flags().GetString("profile")
+		if profile == "" {
+			profile = os.Getenv(config.ProfileEnv)
+		}
+		cfg, err = config.LoadProfile(repoRoot, profile)
 		if err != nil {
 			return fmt.Errorf("loading config: %w", err)
 		}
 
-		logging.Verbose("loaded config with %d service(s)", len(cfg.Services))
+		logging.Verbose("loaded config with %d service(s) from %v", len(cfg.Services), cfg.Files)
+		if cfg.Profile != "" {
+			logging.Verbose("using profile %q", cfg.Profile)
+		}
 
 		return nil
 	},
@@ -65,6 +72,19 @@ func init() {
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Suppress all non-error output")
 	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+	rootCmd.PersistentFlags().String("profile", "", "Apply the [profiles.<name>] section of the config (default $PORTREE_PROFILE)")
+	_ = rootCmd.RegisterFlagCompletionFunc("profile", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		root, err := git.FindRepoRoot(cwd)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names, _ := config.ProfileNames(root)
+		return names, cobra.ShellCompDirectiveNoFileComp
+	})
 }
 
 // Execute runs the root command.
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fairy-pitta/portree/internal/git"
+	"github.com/fairy-pitta/portree/internal/proxy"
+	"github.com/fairy-pitta/portree/internal/state"
+	"github.com/spf13/cobra"
+	"rsc.io/qr"
+)
+
+var shareCmd = &cobra.Command{
+	Use:   "share [branch]",
+	Short: "Print a LAN link (and QR code) for a worktree",
+	Long: `Print a URL that opens a worktree from another device on the same network,
+such as a phone or a colleague's laptop, together with a QR code.
+
+The proxy must be running with 'portree proxy start --share'. The link
+carries the worktree's share token; after the first visit the token is kept
+in a cookie. Tokens can also be sent as a basic auth password. Delete
+.portree/share.key and restart the proxy to revoke all tokens.
+
+Defaults to the current worktree and the first service (alphabetically).`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stateDir := filepath.Join(repoRoot, ".portree")
+		store, err := state.NewFileStore(stateDir)
+		if err != nil {
+			return fmt.Errorf("creating state store: %w", err)
+		}
+		var st *state.State
+		if err := store.WithLock(func() error {
+			var e error
+			st, e = store.Load()
+			return e
+		}); err != nil {
+			return fmt.Errorf("loading proxy state: %w", err)
+		}
+		if st.Proxy.Status != state.StatusRunning || st.Proxy.ShareAddr == "" {
+			return fmt.Errorf("the proxy is not sharing; start it with 'portree proxy start --share'")
+		}
+
+		var slug string
+		if len(args) == 1 {
+			slug, err = findWorktreeSlug(args[0])
+		} else {
+			var cwd string
+			if cwd, err = os.Getwd(); err == nil {
+				var tree *git.Worktree
+				if tree, err = git.CurrentWorktree(cwd); err == nil {
+					slug = tree.Slug()
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		service, _ := cmd.Flags().GetString("service")
+		if service == "" {
+			names := make([]string, 0, len(cfg.Services))
+			for name, svc := range cfg.Services {
+				if svc.ProxyPort != 0 {
+					names = append(names, name)
+				}
+			}
+			if len(names) == 0 {
+				return fmt.Errorf("no service has a proxy_port")
+			}
+			sort.Strings(names)
+			service = names[0]
+		}
+		svc, ok := cfg.Services[service]
+		if !ok {
+			return fmt.Errorf("unknown service %q", service)
+		}
+		if svc.ProxyPort == 0 {
+			return fmt.Errorf("service %q has no proxy_port", service)
+		}
+
+		secret, err := proxy.LoadOrCreateShareSecret(shareSecretPath(stateDir))
+		if err != nil {
+			return err
+		}
+		token := proxy.ShareToken(secret, slug)
+
+		scheme := "http"
+		if st.Proxy.HTTPS {
+			scheme = "https"
+		}
+		link := url.URL{
+			Scheme:   scheme,
+			Host:     proxy.ShareHost(slug, st.Proxy.ShareAddr) + ":" + strconv.Itoa(svc.ProxyPort),
+			Path:     "/",
+			RawQuery: url.Values{proxy.ShareTokenParam: {token}}.Encode(),
+		}
+
+		fmt.Println(link.String())
+		noQR, _ := cmd.Flags().GetBool("no-qr")
+		if !noQR {
+			fmt.Println()
+			if err := printQR(os.Stdout, link.String()); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("\nToken (basic auth password): %s\n", token)
+		return nil
+	},
+}
+
+// findWorktreeSlug returns the slug of the worktree whose branch or slug is name.
+func findWorktreeSlug(name string) (string, error) {
+	trees, err := git.ListWorktrees(repoRoot)
+	if err != nil {
+		return "", fmt.Errorf("listing worktrees: %w", err)
+	}
+	want := git.BranchSlug(name)
+	var available []string
+	for _, t := range trees {
+		if t.IsBare || t.Branch == "" {
+			continue
+		}
+		if t.Branch == name || t.Slug() == want {
+			return t.Slug(), nil
+		}
+		available = append(available, t.Branch)
+	}
+	return "", fmt.Errorf("no worktree for %q (available: %s)", name, strings.Join(available, ", "))
+}
+
+// printQR renders text as a QR code using Unicode half blocks, two modules
+// per character row. Light modules are drawn, so the code scans on dark
+// terminal backgrounds.
+func printQR(w io.Writer, text string) error {
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return fmt.Errorf("encoding QR code: %w", err)
+	}
+	const quiet = 2
+	light := func(x, y int) bool { return !code.Black(x, y) } // Black is false outside the code
+	var b strings.Builder
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func init() {
+	shareCmd.Flags().String("service", "", "Service to share (default: first service)")
+	shareCmd.Flags().Bool("no-qr", false, "Do not print a QR code")
+	rootCmd.AddCommand(shareCmd)
+}
@@ -3,101 +3,106 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
 
+	"github.com/fairy-pitta/portree/internal/truststore"
 	"github.com/spf13/cobra"
 )
 
 var trustCmd = &cobra.Command{
 	Use:   "trust",
-	Short: "Install the Portree CA certificate into the system trust store",
-	Long: `Install the Portree development CA certificate into the system trust store
-so that browsers and other tools trust HTTPS certificates generated by portree.
-
-On macOS, this uses the security command to add the certificate to the System keychain.
-On Linux, this copies the certificate to /usr/local/share/ca-certificates/ and runs update-ca-certificates.
-
-This command requires sudo/root privileges.
+	Short: "Install the Portree CA certificate into the system and browser trust stores",
+	Long: `Install the Portree development CA certificate into the trust stores found on
+this machine so that browsers and other tools trust HTTPS certificates
+generated by portree:
+
+  - the system store: the System keychain on macOS, or
+    /usr/local/share/ca-certificates (update-ca-certificates) or
+    /etc/pki/ca-trust/source/anchors (update-ca-trust) on Linux
+  - NSS databases used by Firefox profiles and by Chromium on Linux
+    (~/.pki/nssdb), via certutil
+  - the cacerts keystore of the default JVM ($JAVA_HOME or java on PATH),
+    via keytool
+
+The CA is shared by all repositories (unless [tls] local_ca is set), so this
+only has to be done once. Stores that already trust the CA are left alone.
+Use --uninstall to remove the CA again and --dry-run to print the commands
+without running them.
+
+Changing the system store requires sudo/root privileges.
 Run 'portree proxy start --https' first to generate the CA certificate.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		caPath := filepath.Join(repoRoot, ".portree", "certs", "ca.crt")
+		paths, err := certPaths()
+		if err != nil {
+			return err
+		}
+		caPath := paths.CACert
 		if _, err := os.Stat(caPath); os.IsNotExist(err) {
 			return fmt.Errorf("CA certificate not found at %s\nRun 'portree proxy start --https' first to generate certificates", caPath)
 		}
+		ca, err := truststore.LoadCA(caPath)
+		if err != nil {
+			return err
+		}
 
-		switch runtime.GOOS {
-		case "darwin":
-			return trustDarwin(caPath)
-		case "linux":
-			return trustLinux(caPath)
-		default:
-			fmt.Printf("Automatic trust store installation is not supported on %s.\n", runtime.GOOS)
+		uninstall, _ := cmd.Flags().GetBool("uninstall")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		stores, warnings := truststore.Discover(truststore.DefaultEnv())
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+		if len(stores) == 0 {
+			fmt.Println("No supported trust stores found.")
 			fmt.Printf("Please manually install the CA certificate:\n  %s\n", caPath)
 			return nil
 		}
-	},
-}
-
-func trustDarwin(caPath string) error {
-	fmt.Println("Installing CA certificate into macOS System keychain...")
-	fmt.Println("You may be prompted for your password.")
-
-	c := exec.Command("sudo", "security", "add-trusted-cert",
-		"-d", "-r", "trustRoot",
-		"-k", "/Library/Keychains/System.keychain",
-		caPath)
-	c.Stdin = os.Stdin
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-
-	if err := c.Run(); err != nil {
-		return fmt.Errorf("failed to install CA certificate: %w", err)
-	}
-
-	fmt.Println("CA certificate installed successfully.")
-	return nil
-}
 
-func trustLinux(caPath string) error {
-	destDir := "/usr/local/share/ca-certificates/portree"
-	destPath := filepath.Join(destDir, "portree-dev-ca.crt")
-
-	fmt.Println("Installing CA certificate into system trust store...")
-	fmt.Println("You may be prompted for your password.")
-
-	// Create destination directory.
-	mkdirCmd := exec.Command("sudo", "mkdir", "-p", destDir)
-	mkdirCmd.Stdin = os.Stdin
-	mkdirCmd.Stdout = os.Stdout
-	mkdirCmd.Stderr = os.Stderr
-	if err := mkdirCmd.Run(); err != nil {
-		return fmt.Errorf("failed to create directory %s: %w", destDir, err)
-	}
-
-	// Copy CA certificate.
-	cpCmd := exec.Command("sudo", "cp", caPath, destPath)
-	cpCmd.Stdin = os.Stdin
-	cpCmd.Stdout = os.Stdout
-	cpCmd.Stderr = os.Stderr
-	if err := cpCmd.Run(); err != nil {
-		return fmt.Errorf("failed to copy CA certificate: %w", err)
-	}
+		runner := truststore.ExecRunner{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+		actions, err := truststore.Plan(stores, ca, uninstall, runner)
+		if err != nil {
+			return err
+		}
+		if len(actions) == 0 {
+			if uninstall {
+				fmt.Println("The CA certificate is not installed in any trust store.")
+			} else {
+				fmt.Printf("The CA certificate is already trusted by all %d trust store(s):\n  %s\n", len(stores), caPath)
+			}
+			return nil
+		}
 
-	// Update certificate store.
-	updateCmd := exec.Command("sudo", "update-ca-certificates")
-	updateCmd.Stdin = os.Stdin
-	updateCmd.Stdout = os.Stdout
-	updateCmd.Stderr = os.Stderr
-	if err := updateCmd.Run(); err != nil {
-		return fmt.Errorf("failed to update CA certificates: %w", err)
-	}
+		verb := "Installing CA certificate into"
+		if uninstall {
+			verb = "Removing CA certificate from"
+		}
+		if dryRun {
+			fmt.Println("Dry run; the following commands would be run:")
+			for _, a := range actions {
+				fmt.Printf("\n%s %s:\n", verb, a.Store.Name())
+				for _, c := range a.Commands {
+					fmt.Printf("  %s\n", c)
+				}
+			}
+			return nil
+		}
 
-	fmt.Println("CA certificate installed successfully.")
-	return nil
+		for _, a := range actions {
+			fmt.Printf("%s %s...\n", verb, a.Store.Name())
+			if err := truststore.Apply([]truststore.Action{a}, runner); err != nil {
+				return fmt.Errorf("failed to update trust store: %w", err)
+			}
+		}
+		if uninstall {
+			fmt.Println("CA certificate removed.")
+		} else {
+			fmt.Println("CA certificate installed successfully.")
+		}
+		return nil
+	},
 }
 
 func init() {
+	trustCmd.Flags().Bool("uninstall", false, "Remove the CA certificate from the trust stores")
+	trustCmd.Flags().Bool("dry-run", false, "Print the commands that would change the trust stores without running them")
 	rootCmd.AddCommand(trustCmd)
 }
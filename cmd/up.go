@@ -44,6 +44,16 @@ var upCmd = &cobra.Command{
 		registry := port.NewRegistry(store, cfg)
 		mgr := process.NewManager(cfg, store, registry)
 
+		if retention, _ := cfg.LogRetentionDuration(); retention > 0 {
+			removed, err := mgr.PruneLogs(retention)
+			if err != nil {
+				logging.Warn("pruning logs: %v", err)
+			}
+			for _, path := range removed {
+				logging.Verbose("removed old log %s", path)
+			}
+		}
+
 		var trees []git.Worktree
 		if upAll {
 			trees, err = git.ListWorktrees(cwd)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os/exec"
 	"runtime"
+	"strings"
 )
 
 // BuildURL constructs the proxy URL for a service.
@@ -11,6 +12,17 @@ func BuildURL(scheme, slug string, proxyPort int) string {
 	return fmt.Sprintf("%s://%s.localhost:%d", scheme, slug, proxyPort)
 }
 
+// OpenWith opens the given URL with command, such as "firefox" or
+// "open -a Safari", which is split on spaces and given the URL as its last
+// argument. An empty command opens the default browser.
+func OpenWith(command, url string) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return Open(url)
+	}
+	return exec.Command(args[0], append(args[1:], url)...).Start()
+}
+
 // Open opens the given URL in the default browser.
 func Open(url string) error {
 	switch runtime.GOOS {
@@ -0,0 +1,62 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackendPaths returns where the certificate for the backends of the
+// worktree with the given slug is stored.
+func (p CertPaths) BackendPaths(slug string) (certPath, keyPath string) {
+	dir := filepath.Join(p.LeafDir(), "backend")
+	return filepath.Join(dir, slug+".crt"), filepath.Join(dir, slug+".key")
+}
+
+// EnsureBackendCert makes sure a certificate for the dev servers of one
+// worktree exists and returns its paths. It covers localhost,
+// <slug>.localhost, *.<slug>.localhost and the loopback addresses, which is
+// what the proxy and browsers connect to. The CA is created if needed, and
+// the certificate is reissued when it is about to expire or was signed by
+// another CA.
+func EnsureBackendCert(paths CertPaths, slug string) (certPath, keyPath string, err error) {
+	if !dnsName.MatchString(slug) {
+		return "", "", fmt.Errorf("invalid worktree slug %q", slug)
+	}
+	if err := Ensure(paths); err != nil {
+		return "", "", err
+	}
+	caCert, caKey, err := loadCA(paths.CACert, paths.CAKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	certPath, keyPath = paths.BackendPaths(slug)
+	if c, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil &&
+		now.Add(leafRenewBefore).Before(c.Leaf.NotAfter) && c.Leaf.CheckSignatureFrom(caCert) == nil {
+		return certPath, keyPath, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return "", "", fmt.Errorf("creating backend cert directory: %w", err)
+	}
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   slug + ".localhost",
+			Organization: []string{"Portree"},
+		},
+		DNSNames:    []string{"localhost", slug + ".localhost", "*." + slug + ".localhost"},
+		IPAddresses: serverIPs,
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(leafValidity),
+	}
+	if _, err := createLeaf(caCert, caKey, template, certPath, keyPath); err != nil {
+		return "", "", err
+	}
+	return certPath, keyPath, nil
+}
@@ -0,0 +1,67 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureBackendCert(t *testing.T) {
+	dir := t.TempDir()
+	paths := Paths(filepath.Join(dir, "certs")).WithCA(filepath.Join(dir, "ca"))
+
+	certPath, keyPath, err := EnsureBackendCert(paths, "feature-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := readCertificate(paths.CACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, name := range []string{"localhost", "feature-auth.localhost", "api.feature-auth.localhost", "127.0.0.1"} {
+		if _, err := pair.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("certificate not valid for %s: %v", name, err)
+		}
+	}
+	if err := pair.Leaf.VerifyHostname("main.localhost"); err == nil {
+		t.Error("certificate should not be valid for another worktree")
+	}
+
+	// A second call keeps the certificate.
+	if _, _, err := EnsureBackendCert(paths, "feature-auth"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Leaf.Equal(pair.Leaf) {
+		t.Error("certificate should be reused while valid")
+	}
+
+	// After rotating the CA it is reissued.
+	if err := RotateCA(paths); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := EnsureBackendCert(paths, "feature-auth"); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Leaf.Equal(pair.Leaf) {
+		t.Error("certificate should be reissued for a new CA")
+	}
+
+	if _, _, err := EnsureBackendCert(paths, "../evil"); err == nil {
+		t.Error("invalid slug should be rejected")
+	}
+}
@@ -12,7 +12,11 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
+
+	"github.com/fairy-pitta/portree/internal/logging"
+	"github.com/fairy-pitta/portree/internal/state"
 )
 
 // CertPaths holds the file paths for generated certificates and keys.
@@ -23,43 +27,195 @@ type CertPaths struct {
 	ServerKey  string
 }
 
-// EnsureCerts ensures that CA and server certificates exist in dir.
-// If all four files (ca.crt, ca.key, server.crt, server.key) exist, it returns
-// their paths without regenerating. Otherwise, it generates all files.
-func EnsureCerts(dir string) (CertPaths, error) {
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return CertPaths{}, fmt.Errorf("creating cert directory: %w", err)
-	}
+// RenewBefore is how long before expiry EnsureCerts replaces a certificate.
+const RenewBefore = 30 * 24 * time.Hour
+
+// Subject alternative names of the server certificate.
+var (
+	serverDNSNames = []string{"*.localhost", "localhost"}
+	serverIPs      = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+)
 
-	paths := CertPaths{
+// Paths returns the certificate and key paths inside dir, with the CA in
+// the same directory.
+func Paths(dir string) CertPaths {
+	return CertPaths{
 		CACert:     filepath.Join(dir, "ca.crt"),
 		CAKey:      filepath.Join(dir, "ca.key"),
 		ServerCert: filepath.Join(dir, "server.crt"),
 		ServerKey:  filepath.Join(dir, "server.key"),
 	}
+}
+
+// WithCA returns p with the CA certificate and key located in caDir.
+func (p CertPaths) WithCA(caDir string) CertPaths {
+	p.CACert = filepath.Join(caDir, "ca.crt")
+	p.CAKey = filepath.Join(caDir, "ca.key")
+	return p
+}
+
+// LeafDir returns the directory where an Issuer caches leaf certificates
+// next to the server certificate.
+func (p CertPaths) LeafDir() string {
+	return filepath.Join(filepath.Dir(p.ServerCert), "leaf")
+}
+
+// EnsureCerts ensures that valid CA and server certificates exist in dir.
+// See Ensure.
+func EnsureCerts(dir string) (CertPaths, error) {
+	paths := Paths(dir)
+	if err := Ensure(paths); err != nil {
+		return CertPaths{}, err
+	}
+	return paths, nil
+}
+
+// Ensure ensures that valid CA and server certificates exist at paths.
+// Existing files are kept as long as they are usable. The server certificate
+// is reissued, keeping the CA, when it is missing, expires within
+// RenewBefore, does not match its key, was not signed by the CA or has
+// different SANs. The CA itself is only replaced when it is missing,
+// unreadable or about to expire, which also reissues the server certificate.
+// Replacing an existing CA is reported, since the new one has to be trusted
+// again. The CA directory is locked so that concurrent first runs sharing a
+// CA do not each create one.
+func Ensure(paths CertPaths) error {
+	if err := makeDirs(paths); err != nil {
+		return err
+	}
+	return withCALock(paths, func() error { return ensure(paths) })
+}
+
+func ensure(paths CertPaths) error {
+	now := time.Now()
+
+	caCert, caKey, err := loadCA(paths.CACert, paths.CAKey)
+	if err != nil || now.Add(RenewBefore).After(caCert.NotAfter) {
+		reason := "about to expire"
+		if err != nil {
+			reason = err.Error()
+		}
+		existed := fileExists(paths.CACert) || fileExists(paths.CAKey)
+		if caCert, caKey, err = generateCA(paths); err != nil {
+			return err
+		}
+		if existed {
+			logging.Warn("replaced the portree CA at %s (%s); run 'portree trust' again so that browsers accept the new certificates", paths.CACert, reason)
+		}
+	} else if serverCertProblem(paths, caCert, now) == "" {
+		return nil
+	}
+
+	return issueServerCert(paths, caCert, caKey)
+}
+
+// Renew reissues the server certificate, keeping the CA, and removes cached
+// leaf certificates so that they are minted again.
+func Renew(paths CertPaths) error {
+	caCert, caKey, err := loadCA(paths.CACert, paths.CAKey)
+	if err != nil {
+		return err
+	}
+	if err := issueServerCert(paths, caCert, caKey); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(paths.LeafDir()); err != nil {
+		return fmt.Errorf("removing leaf certificates: %w", err)
+	}
+	return nil
+}
+
+// RotateCA replaces the CA with a new one and reissues the server
+// certificate. The new CA has to be trusted again.
+func RotateCA(paths CertPaths) error {
+	if err := makeDirs(paths); err != nil {
+		return err
+	}
+	return withCALock(paths, func() error { return rotateCA(paths) })
+}
+
+func rotateCA(paths CertPaths) error {
+	caCert, caKey, err := generateCA(paths)
+	if err != nil {
+		return err
+	}
+	if err := issueServerCert(paths, caCert, caKey); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(paths.LeafDir()); err != nil {
+		return fmt.Errorf("removing leaf certificates: %w", err)
+	}
+	return nil
+}
 
-	// Check if all files exist.
-	if fileExists(paths.CACert) && fileExists(paths.CAKey) &&
-		fileExists(paths.ServerCert) && fileExists(paths.ServerKey) {
-		return paths, nil
+// withCALock runs fn while holding the lock of the CA directory of paths.
+func withCALock(paths CertPaths, fn func() error) error {
+	return state.WithFileLock(filepath.Join(filepath.Dir(paths.CACert), "ca.lock"), fn)
+}
+
+func makeDirs(paths CertPaths) error {
+	for _, dir := range []string{filepath.Dir(paths.CACert), filepath.Dir(paths.ServerCert)} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("creating cert directory: %w", err)
+		}
 	}
+	return nil
+}
 
-	// Generate CA.
+// serverCertProblem describes why the server certificate needs to be
+// reissued, or returns "" if it is fine.
+func serverCertProblem(paths CertPaths, caCert *x509.Certificate, now time.Time) string {
+	info := Inspect(paths.ServerCert, paths.ServerKey)
+	switch {
+	case info.Err != nil:
+		return info.Err.Error()
+	case !info.KeyMatches:
+		return "key does not match certificate"
+	case now.Add(RenewBefore).After(info.NotAfter):
+		return "expires soon"
+	case info.Cert.CheckSignatureFrom(caCert) != nil:
+		return "not signed by the CA"
+	case !sameSANs(info.Cert):
+		return "SANs differ"
+	}
+	return ""
+}
+
+func sameSANs(c *x509.Certificate) bool {
+	if !slices.Equal(c.DNSNames, serverDNSNames) || len(c.IPAddresses) != len(serverIPs) {
+		return false
+	}
+	for i, ip := range serverIPs {
+		if !ip.Equal(c.IPAddresses[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// generateCA creates and writes a new CA key pair.
+func generateCA(paths CertPaths) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	return newCA(paths.CACert, paths.CAKey, "Portree Dev CA")
+}
+
+// newCA creates a self-signed CA named commonName and writes it to certPath
+// and keyPath.
+func newCA(certPath, keyPath, commonName string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
 	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return CertPaths{}, fmt.Errorf("generating CA key: %w", err)
+		return nil, nil, fmt.Errorf("generating CA key: %w", err)
 	}
 
 	caSerial, err := randomSerial()
 	if err != nil {
-		return CertPaths{}, err
+		return nil, nil, err
 	}
 
 	now := time.Now()
 	caTemplate := &x509.Certificate{
 		SerialNumber: caSerial,
 		Subject: pkix.Name{
-			CommonName:   "Portree Dev CA",
+			CommonName:   commonName,
 			Organization: []string{"Portree"},
 		},
 		NotBefore:             now,
@@ -71,33 +227,44 @@ func EnsureCerts(dir string) (CertPaths, error) {
 
 	caCertDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
 	if err != nil {
-		return CertPaths{}, fmt.Errorf("creating CA certificate: %w", err)
+		return nil, nil, fmt.Errorf("creating CA certificate: %w", err)
 	}
 
 	caCert, err := x509.ParseCertificate(caCertDER)
 	if err != nil {
-		return CertPaths{}, fmt.Errorf("parsing CA certificate: %w", err)
+		return nil, nil, fmt.Errorf("parsing CA certificate: %w", err)
 	}
 
-	// Generate server certificate.
+	if err := writePEM(certPath, "CERTIFICATE", caCertDER, 0644); err != nil {
+		return nil, nil, fmt.Errorf("writing CA cert: %w", err)
+	}
+	if err := writeKeyPEM(keyPath, caKey); err != nil {
+		return nil, nil, fmt.Errorf("writing CA key: %w", err)
+	}
+	return caCert, caKey, nil
+}
+
+// issueServerCert creates and writes the *.localhost server certificate.
+func issueServerCert(paths CertPaths, caCert *x509.Certificate, caKey *ecdsa.PrivateKey) error {
 	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return CertPaths{}, fmt.Errorf("generating server key: %w", err)
+		return fmt.Errorf("generating server key: %w", err)
 	}
 
 	serverSerial, err := randomSerial()
 	if err != nil {
-		return CertPaths{}, err
+		return err
 	}
 
+	now := time.Now()
 	serverTemplate := &x509.Certificate{
 		SerialNumber: serverSerial,
 		Subject: pkix.Name{
 			CommonName:   "localhost",
 			Organization: []string{"Portree"},
 		},
-		DNSNames:    []string{"*.localhost", "localhost"},
-		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:    serverDNSNames,
+		IPAddresses: serverIPs,
 		NotBefore:   now,
 		NotAfter:    now.Add(365 * 24 * time.Hour),
 		KeyUsage:    x509.KeyUsageDigitalSignature,
@@ -106,24 +273,16 @@ func EnsureCerts(dir string) (CertPaths, error) {
 
 	serverCertDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
 	if err != nil {
-		return CertPaths{}, fmt.Errorf("creating server certificate: %w", err)
+		return fmt.Errorf("creating server certificate: %w", err)
 	}
 
-	// Write files.
-	if err := writePEM(paths.CACert, "CERTIFICATE", caCertDER, 0644); err != nil {
-		return CertPaths{}, fmt.Errorf("writing CA cert: %w", err)
-	}
-	if err := writeKeyPEM(paths.CAKey, caKey); err != nil {
-		return CertPaths{}, fmt.Errorf("writing CA key: %w", err)
-	}
 	if err := writePEM(paths.ServerCert, "CERTIFICATE", serverCertDER, 0644); err != nil {
-		return CertPaths{}, fmt.Errorf("writing server cert: %w", err)
+		return fmt.Errorf("writing server cert: %w", err)
 	}
 	if err := writeKeyPEM(paths.ServerKey, serverKey); err != nil {
-		return CertPaths{}, fmt.Errorf("writing server key: %w", err)
+		return fmt.Errorf("writing server key: %w", err)
 	}
-
-	return paths, nil
+	return nil
 }
 
 func fileExists(path string) bool {
@@ -1,12 +1,18 @@
 package cert
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
+	"math/big"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEnsureCerts_GeneratesValidCA(t *testing.T) {
@@ -178,6 +184,24 @@ func TestEnsureCerts_RegeneratesOnMissing(t *testing.T) {
 	}
 }
 
+func TestEnsureCerts_ReplacesCorruptCA(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := EnsureCerts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paths.CACert, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := EnsureCerts(dir); err != nil {
+		t.Fatalf("EnsureCerts() with a corrupt CA error: %v", err)
+	}
+	if _, _, err := loadCA(paths.CACert, paths.CAKey); err != nil {
+		t.Errorf("CA should be regenerated: %v", err)
+	}
+}
+
 func TestEnsureCerts_KeyFilePermissions(t *testing.T) {
 	dir := t.TempDir()
 	paths, err := EnsureCerts(dir)
@@ -196,3 +220,203 @@ func TestEnsureCerts_KeyFilePermissions(t *testing.T) {
 		}
 	}
 }
+
+// writeServerCert replaces the server certificate in paths with one signed by
+// the CA that has the given expiry and DNS names.
+func writeServerCert(t *testing.T, paths CertPaths, notAfter time.Time, dnsNames []string) {
+	t.Helper()
+	caCert, caKey, err := loadCA(paths.CACert, paths.CAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		DNSNames:     dnsNames,
+		IPAddresses:  serverIPs,
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writePEM(paths.ServerCert, "CERTIFICATE", der, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKeyPEM(paths.ServerKey, key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnsureCerts_RenewsServerCert(t *testing.T) {
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		dnsNames []string
+		renew    bool
+	}{
+		{"valid", time.Now().Add(200 * 24 * time.Hour), serverDNSNames, false},
+		{"expires soon", time.Now().Add(10 * 24 * time.Hour), serverDNSNames, true},
+		{"expired", time.Now().Add(-time.Hour), serverDNSNames, true},
+		{"SANs differ", time.Now().Add(200 * 24 * time.Hour), []string{"localhost"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			paths, err := EnsureCerts(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			caBefore, _ := os.ReadFile(paths.CACert)
+			writeServerCert(t, paths, tt.notAfter, tt.dnsNames)
+
+			if _, err := EnsureCerts(dir); err != nil {
+				t.Fatalf("EnsureCerts() error: %v", err)
+			}
+			info := Inspect(paths.ServerCert, paths.ServerKey)
+			if info.Err != nil || !info.KeyMatches {
+				t.Fatalf("Inspect() = %+v", info)
+			}
+			renewed := info.Cert.SerialNumber.Cmp(big.NewInt(42)) != 0
+			if renewed != tt.renew {
+				t.Errorf("renewed = %v, want %v", renewed, tt.renew)
+			}
+			if caAfter, _ := os.ReadFile(paths.CACert); string(caAfter) != string(caBefore) {
+				t.Error("renewing the server cert should keep the CA")
+			}
+		})
+	}
+}
+
+func TestEnsureCerts_RenewsOnKeyMismatch(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := EnsureCerts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pair the server cert with the CA key.
+	caKey, _ := os.ReadFile(paths.CAKey)
+	if err := os.WriteFile(paths.ServerKey, caKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if info := Inspect(paths.ServerCert, paths.ServerKey); info.KeyMatches {
+		t.Fatal("Inspect() should detect the mismatched key")
+	}
+
+	if _, err := EnsureCerts(dir); err != nil {
+		t.Fatal(err)
+	}
+	if info := Inspect(paths.ServerCert, paths.ServerKey); !info.KeyMatches {
+		t.Error("EnsureCerts should reissue a server cert whose key does not match")
+	}
+}
+
+func TestEnsureConcurrentSharedCA(t *testing.T) {
+	caDir := filepath.Join(t.TempDir(), "ca")
+	repos := make([]CertPaths, 16)
+	for i := range repos {
+		repos[i] = Paths(t.TempDir()).WithCA(caDir)
+	}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, len(repos))
+	for _, paths := range repos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- Ensure(paths)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Ensure() error: %v", err)
+		}
+	}
+
+	// Every server certificate must be signed by the one CA left on disk.
+	ca, err := readCertificate(filepath.Join(caDir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, paths := range repos {
+		info := Inspect(paths.ServerCert, paths.ServerKey)
+		if info.Err != nil || info.Cert.CheckSignatureFrom(ca) != nil {
+			t.Errorf("server cert in %s is not signed by the shared CA", paths.ServerCert)
+		}
+	}
+}
+
+func TestEnsureWithSeparateCA(t *testing.T) {
+	caDir := filepath.Join(t.TempDir(), "ca")
+	repoA := Paths(t.TempDir()).WithCA(caDir)
+	repoB := Paths(t.TempDir()).WithCA(caDir)
+
+	if err := Ensure(repoA); err != nil {
+		t.Fatalf("Ensure() error: %v", err)
+	}
+	if err := Ensure(repoB); err != nil {
+		t.Fatalf("Ensure() error: %v", err)
+	}
+	if fileExists(filepath.Join(filepath.Dir(repoA.ServerCert), "ca.crt")) {
+		t.Error("the CA should not be written next to the server cert")
+	}
+
+	ca := Inspect(repoA.CACert, repoA.CAKey)
+	for _, p := range []CertPaths{repoA, repoB} {
+		server := Inspect(p.ServerCert, p.ServerKey)
+		if err := server.Cert.CheckSignatureFrom(ca.Cert); err != nil {
+			t.Errorf("%s not signed by the shared CA: %v", p.ServerCert, err)
+		}
+	}
+}
+
+func TestRenewAndRotateCA(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := EnsureCerts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := NewIssuer(paths, filepath.Join(dir, "leaf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Certificate("main.localhost"); err != nil {
+		t.Fatal(err)
+	}
+	ca := Inspect(paths.CACert, paths.CAKey)
+	server := Inspect(paths.ServerCert, paths.ServerKey)
+
+	if err := Renew(paths); err != nil {
+		t.Fatalf("Renew() error: %v", err)
+	}
+	renewed := Inspect(paths.ServerCert, paths.ServerKey)
+	if renewed.Cert.SerialNumber.Cmp(server.Cert.SerialNumber) == 0 {
+		t.Error("Renew() should reissue the server cert")
+	}
+	if Inspect(paths.CACert, paths.CAKey).Cert.SerialNumber.Cmp(ca.Cert.SerialNumber) != 0 {
+		t.Error("Renew() should keep the CA")
+	}
+	if fileExists(filepath.Join(dir, "leaf")) {
+		t.Error("Renew() should remove cached leaf certificates")
+	}
+
+	if err := RotateCA(paths); err != nil {
+		t.Fatalf("RotateCA() error: %v", err)
+	}
+	rotated := Inspect(paths.CACert, paths.CAKey)
+	if rotated.Cert.SerialNumber.Cmp(ca.Cert.SerialNumber) == 0 {
+		t.Error("RotateCA() should replace the CA")
+	}
+	if err := Inspect(paths.ServerCert, paths.ServerKey).Cert.CheckSignatureFrom(rotated.Cert); err != nil {
+		t.Errorf("server cert should be signed by the new CA: %v", err)
+	}
+}
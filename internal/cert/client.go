@@ -0,0 +1,84 @@
+package cert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// clientValidity is how long client certificates are valid.
+const clientValidity = 365 * 24 * time.Hour
+
+// clientName matches the names client certificates can be issued for. It
+// also keeps names safe to use as file names.
+var clientName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+// ClientCA returns the paths of the CA that signs client certificates for
+// 'portree proxy start --mtls'. It lives next to the server CA.
+func (p CertPaths) ClientCA() (certPath, keyPath string) {
+	dir := filepath.Dir(p.CACert)
+	return filepath.Join(dir, "client-ca.crt"), filepath.Join(dir, "client-ca.key")
+}
+
+// ClientPaths returns where the client certificate for name is stored.
+func (p CertPaths) ClientPaths(name string) (certPath, keyPath string) {
+	dir := filepath.Join(filepath.Dir(p.ServerCert), "client")
+	return filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+}
+
+// IssueClientCert issues a client certificate with the common name name,
+// signed by the client CA, which is created first if needed. An existing
+// certificate for name is replaced.
+func IssueClientCert(paths CertPaths, name string) (certPath, keyPath string, err error) {
+	if !clientName.MatchString(name) {
+		return "", "", fmt.Errorf("invalid client name %q (use letters, digits, '.', '_', '@' and '-')", name)
+	}
+
+	caCertPath, caKeyPath := paths.ClientCA()
+	caCert, caKey, err := loadCA(caCertPath, caKeyPath)
+	if err != nil {
+		if err := os.MkdirAll(filepath.Dir(caCertPath), 0700); err != nil {
+			return "", "", fmt.Errorf("creating CA directory: %w", err)
+		}
+		if caCert, caKey, err = newCA(caCertPath, caKeyPath, "Portree Client CA"); err != nil {
+			return "", "", err
+		}
+	}
+
+	certPath, keyPath = paths.ClientPaths(name)
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return "", "", fmt.Errorf("creating client cert directory: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   name,
+			Organization: []string{"Portree"},
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(clientValidity),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if _, err := createLeaf(caCert, caKey, template, certPath, keyPath); err != nil {
+		return "", "", err
+	}
+	return certPath, keyPath, nil
+}
+
+// LoadCertPool reads the PEM certificates in path into a pool, e.g. to
+// verify client certificates.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,55 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+)
+
+func TestIssueClientCert(t *testing.T) {
+	dir := t.TempDir()
+	paths := Paths(filepath.Join(dir, "certs")).WithCA(filepath.Join(dir, "ca"))
+
+	certPath, keyPath, err := IssueClientCert(paths, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "certs", "client", "alice@example.com.crt"); certPath != want {
+		t.Errorf("certPath = %s, want %s", certPath, want)
+	}
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath, _ := paths.ClientCA()
+	if caPath != filepath.Join(dir, "ca", "client-ca.crt") {
+		t.Errorf("ClientCA() = %s", caPath)
+	}
+	roots, err := LoadCertPool(caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pair.Leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		t.Errorf("client certificate does not verify: %v", err)
+	}
+	if pair.Leaf.Subject.CommonName != "alice@example.com" {
+		t.Errorf("CommonName = %q", pair.Leaf.Subject.CommonName)
+	}
+
+	// The client CA is reused for further certificates.
+	if _, _, err := IssueClientCert(paths, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadCertPool(caPath)
+	if err != nil || !again.Equal(roots) {
+		t.Errorf("client CA should be kept, err = %v", err)
+	}
+
+	if _, _, err := IssueClientCert(paths, "a/b"); err == nil {
+		t.Error("names with slashes should be rejected")
+	}
+}
@@ -0,0 +1,87 @@
+package cert
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GlobalCADir returns the user-level CA directory shared by all
+// repositories: $XDG_DATA_HOME/portree/ca, or ~/.local/share/portree/ca
+// when XDG_DATA_HOME is not set.
+func GlobalCADir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "portree", "ca"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("locating home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "portree", "ca"), nil
+}
+
+// RepoPaths returns the certificate paths of the repository whose state
+// directory is stateDir: the server certificate in <stateDir>/certs and the
+// CA in GlobalCADir, or next to the server certificate with localCA.
+func RepoPaths(stateDir string, localCA bool) (CertPaths, error) {
+	paths := Paths(filepath.Join(stateDir, "certs"))
+	if localCA {
+		return paths, nil
+	}
+	caDir, err := GlobalCADir()
+	if err != nil {
+		return CertPaths{}, err
+	}
+	return paths.WithCA(caDir), nil
+}
+
+// Fingerprint returns the hex SHA-256 fingerprint of the certificate at path.
+func Fingerprint(path string) (string, error) {
+	c, err := readCertificate(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(c.Raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SHA1Fingerprint returns the hex SHA-1 fingerprint of the certificate at
+// path, as used by the macOS security tool.
+func SHA1Fingerprint(path string) (string, error) {
+	c, err := readCertificate(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(c.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:])), nil
+}
+
+// IsTrusted reports whether the system trust store trusts the CA
+// certificate at path.
+func IsTrusted(path string) (bool, error) {
+	c, err := readCertificate(path)
+	if err != nil {
+		return false, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return false, fmt.Errorf("loading system trust store: %w", err)
+	}
+	return trustedBy(c, roots), nil
+}
+
+func trustedBy(c *x509.Certificate, roots *x509.CertPool) bool {
+	if roots == nil {
+		return false
+	}
+	_, err := c.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err == nil
+}
@@ -0,0 +1,46 @@
+package cert
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobalCADir(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+	if got, err := GlobalCADir(); err != nil || got != filepath.Join("/data", "portree", "ca") {
+		t.Errorf("GlobalCADir() = %q, %v", got, err)
+	}
+
+	home := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", "relative/ignored")
+	t.Setenv("HOME", home)
+	if got, err := GlobalCADir(); err != nil || got != filepath.Join(home, ".local", "share", "portree", "ca") {
+		t.Errorf("GlobalCADir() = %q, %v", got, err)
+	}
+}
+
+func TestTrustedBy(t *testing.T) {
+	paths, err := EnsureCerts(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := readCertificate(paths.CACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trustedBy(ca, x509.NewCertPool()) {
+		t.Error("CA should not be trusted by an empty pool")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	if !trustedBy(ca, pool) {
+		t.Error("CA should be trusted once it is in the pool")
+	}
+
+	fp, err := Fingerprint(paths.CACert)
+	if err != nil || len(fp) != 64 {
+		t.Errorf("Fingerprint() = %q, %v", fp, err)
+	}
+}
@@ -0,0 +1,44 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Info describes a certificate on disk.
+type Info struct {
+	Path       string
+	Cert       *x509.Certificate // nil if Err is set
+	NotAfter   time.Time
+	KeyMatches bool  // whether the key file holds the certificate's private key
+	Err        error // the certificate or key could not be read
+}
+
+// Inspect reads the certificate at certPath and checks it against the
+// private key at keyPath.
+func Inspect(certPath, keyPath string) Info {
+	info := Info{Path: certPath}
+	c, err := readCertificate(certPath)
+	if err != nil {
+		info.Err = fmt.Errorf("reading %s: %w", certPath, err)
+		return info
+	}
+	info.Cert = c
+	info.NotAfter = c.NotAfter
+
+	if _, err := os.Stat(keyPath); err != nil {
+		info.Err = fmt.Errorf("reading %s: %w", keyPath, err)
+		return info
+	}
+	_, err = tls.LoadX509KeyPair(certPath, keyPath)
+	info.KeyMatches = err == nil
+	return info
+}
+
+// Remaining returns how long the certificate stays valid after now.
+func (i Info) Remaining(now time.Time) time.Duration {
+	return i.NotAfter.Sub(now)
+}
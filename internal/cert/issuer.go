@@ -0,0 +1,239 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// leafValidity is how long certificates minted by an Issuer are valid.
+	leafValidity = 90 * 24 * time.Hour
+	// leafRenewBefore is how long before expiry a leaf is replaced.
+	leafRenewBefore = 30 * 24 * time.Hour
+	// maxCachedLeaves bounds the leaves an Issuer keeps in memory; the
+	// oldest entries are evicted first.
+	maxCachedLeaves = 256
+)
+
+// dnsName matches the host names an Issuer will mint certificates for. It
+// also keeps names safe to use as file names in the leaf directory.
+var dnsName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// Issuer mints a leaf certificate per TLS server name (SNI), signed by the
+// portree CA. Leaves are cached in memory and on disk, and replaced when they
+// are about to expire or were signed by a different CA.
+type Issuer struct {
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	dir    string
+
+	// Allow decides which server names get a certificate. Names it rejects,
+	// and handshakes without SNI, fall back to tls.Config.Certificates.
+	// nil allows every valid DNS name. It is not consulted for names whose
+	// leaf is already cached in memory.
+	Allow func(name string) bool
+
+	mu    sync.Mutex
+	cache map[string]*tls.Certificate
+	order []string // cached names, oldest first
+	now   func() time.Time
+}
+
+// NewIssuer loads the CA in paths and returns an Issuer that stores its
+// leaf certificates in leafDir.
+func NewIssuer(paths CertPaths, leafDir string) (*Issuer, error) {
+	caCert, caKey, err := loadCA(paths.CACert, paths.CAKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(leafDir, 0700); err != nil {
+		return nil, fmt.Errorf("creating leaf cert directory: %w", err)
+	}
+	return &Issuer{
+		caCert: caCert,
+		caKey:  caKey,
+		dir:    leafDir,
+		cache:  map[string]*tls.Certificate{},
+		now:    time.Now,
+	}, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (i *Issuer) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" || !dnsName.MatchString(name) {
+		return nil, nil
+	}
+	if c := i.cached(name); c != nil {
+		return c, nil
+	}
+	if i.Allow != nil && !i.Allow(name) {
+		return nil, nil
+	}
+	return i.Certificate(name)
+}
+
+// cached returns the usable leaf cached in memory for name, or nil.
+func (i *Issuer) cached(name string) *tls.Certificate {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if c := i.cache[name]; c != nil && i.usable(c) {
+		return c
+	}
+	return nil
+}
+
+// Certificate returns a valid leaf certificate for name, loading it from
+// disk or minting a new one as needed.
+func (i *Issuer) Certificate(name string) (*tls.Certificate, error) {
+	if !dnsName.MatchString(name) {
+		return nil, fmt.Errorf("invalid certificate name %q", name)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if c := i.cache[name]; c != nil && i.usable(c) {
+		return c, nil
+	}
+
+	certPath, keyPath := i.leafPaths(name)
+	if c, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil && i.usable(&c) {
+		i.store(name, &c)
+		return &c, nil
+	}
+
+	c, err := i.issue(name)
+	if err != nil {
+		return nil, err
+	}
+	i.store(name, c)
+	return c, nil
+}
+
+// store caches c for name, evicting the oldest entries beyond
+// maxCachedLeaves. The caller holds i.mu.
+func (i *Issuer) store(name string, c *tls.Certificate) {
+	if _, ok := i.cache[name]; !ok {
+		i.order = append(i.order, name)
+	}
+	i.cache[name] = c
+	for len(i.order) > maxCachedLeaves {
+		delete(i.cache, i.order[0])
+		i.order = i.order[1:]
+	}
+}
+
+func (i *Issuer) leafPaths(name string) (certPath, keyPath string) {
+	return filepath.Join(i.dir, name+".crt"), filepath.Join(i.dir, name+".key")
+}
+
+// usable reports whether c was signed by the current CA and is not close
+// to expiry.
+func (i *Issuer) usable(c *tls.Certificate) bool {
+	if c.Leaf == nil {
+		return false
+	}
+	if i.now().Add(leafRenewBefore).After(c.Leaf.NotAfter) {
+		return false
+	}
+	return c.Leaf.CheckSignatureFrom(i.caCert) == nil
+}
+
+// issue mints and stores a leaf certificate for name.
+func (i *Issuer) issue(name string) (*tls.Certificate, error) {
+	now := i.now()
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   name,
+			Organization: []string{"Portree"},
+		},
+		DNSNames:  []string{name},
+		NotBefore: now.Add(-time.Hour), // tolerate small clock skew
+		NotAfter:  now.Add(leafValidity),
+	}
+	certPath, keyPath := i.leafPaths(name)
+	return createLeaf(i.caCert, i.caKey, template, certPath, keyPath)
+}
+
+// createLeaf signs a certificate for template with the CA, writes it and its
+// new key to certPath and keyPath, and returns the pair. Certificates are
+// for servers unless template sets ExtKeyUsage.
+func createLeaf(caCert *x509.Certificate, caKey *ecdsa.PrivateKey, template *x509.Certificate, certPath, keyPath string) (*tls.Certificate, error) {
+	name := template.Subject.CommonName
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating leaf key: %w", err)
+	}
+	if template.SerialNumber, err = randomSerial(); err != nil {
+		return nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if len(template.ExtKeyUsage) == 0 {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate for %s: %w", name, err)
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return nil, fmt.Errorf("writing certificate for %s: %w", name, err)
+	}
+	if err := writeKeyPEM(keyPath, key); err != nil {
+		return nil, fmt.Errorf("writing key for %s: %w", name, err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate for %s: %w", name, err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// loadCA reads the CA certificate and its EC private key.
+func loadCA(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caCert, err := readCertificate(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading CA cert: %w", err)
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading CA key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("reading CA key: no PEM data in %s", keyPath)
+	}
+	caKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CA key: %w", err)
+	}
+	return caCert, caKey, nil
+}
+
+// readCertificate parses the first PEM certificate in path.
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate in " + path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
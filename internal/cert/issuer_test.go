@@ -0,0 +1,136 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestIssuer(t *testing.T) (*Issuer, CertPaths) {
+	t.Helper()
+	dir := t.TempDir()
+	paths, err := EnsureCerts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := NewIssuer(paths, filepath.Join(dir, "leaf"))
+	if err != nil {
+		t.Fatalf("NewIssuer() error: %v", err)
+	}
+	return issuer, paths
+}
+
+func TestIssuerCertificate(t *testing.T) {
+	issuer, paths := newTestIssuer(t)
+
+	c, err := issuer.GetCertificate(&tls.ClientHelloInfo{ServerName: "API.Feature-X.localhost"})
+	if err != nil || c == nil {
+		t.Fatalf("GetCertificate() = %v, %v", c, err)
+	}
+
+	// The leaf must verify against the CA for the multi-level name.
+	ca, err := readCertificate(paths.CACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if _, err := c.Leaf.Verify(x509.VerifyOptions{DNSName: "api.feature-x.localhost", Roots: roots}); err != nil {
+		t.Errorf("leaf does not verify: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(issuer.dir, "api.feature-x.localhost.crt")); err != nil {
+		t.Errorf("leaf should be persisted: %v", err)
+	}
+
+	again, err := issuer.Certificate("api.feature-x.localhost")
+	if err != nil || again != c {
+		t.Error("second lookup should hit the cache")
+	}
+}
+
+func TestIssuerLoadsFromDisk(t *testing.T) {
+	issuer, paths := newTestIssuer(t)
+	first, err := issuer.Certificate("main.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, err := NewIssuer(paths, issuer.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := fresh.Certificate("main.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Leaf.SerialNumber.Cmp(second.Leaf.SerialNumber) != 0 {
+		t.Error("a new Issuer should reuse the leaf stored on disk")
+	}
+}
+
+func TestIssuerRenewsBeforeExpiry(t *testing.T) {
+	issuer, _ := newTestIssuer(t)
+	first, err := issuer.Certificate("main.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer.now = func() time.Time { return time.Now().Add(leafValidity - leafRenewBefore + time.Hour) }
+	second, err := issuer.Certificate("main.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Leaf.SerialNumber.Cmp(second.Leaf.SerialNumber) == 0 {
+		t.Error("a leaf close to expiry should be renewed")
+	}
+}
+
+func TestIssuerGetCertificateFallback(t *testing.T) {
+	issuer, _ := newTestIssuer(t)
+	issuer.Allow = func(name string) bool { return name != "evil.example.com" }
+
+	for _, name := range []string{"", "evil.example.com", "../escape", "bad_name.localhost"} {
+		c, err := issuer.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		if c != nil || err != nil {
+			t.Errorf("GetCertificate(%q) = %v, %v, want nil, nil to use the fallback", name, c, err)
+		}
+	}
+}
+
+func TestIssuerSkipsAllowForCachedLeaves(t *testing.T) {
+	issuer, _ := newTestIssuer(t)
+	calls := 0
+	issuer.Allow = func(string) bool { calls++; return true }
+
+	hello := &tls.ClientHelloInfo{ServerName: "feature-x.localhost"}
+	for range 3 {
+		if c, err := issuer.GetCertificate(hello); c == nil || err != nil {
+			t.Fatalf("GetCertificate() = %v, %v", c, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Allow called %d times, want 1 (only before the leaf is cached)", calls)
+	}
+}
+
+func TestIssuerCacheIsBounded(t *testing.T) {
+	issuer, _ := newTestIssuer(t)
+	first, err := issuer.Certificate("n0.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n <= maxCachedLeaves; n++ {
+		issuer.store(fmt.Sprintf("n%d.localhost", n), first)
+	}
+	if len(issuer.cache) != maxCachedLeaves || len(issuer.order) != maxCachedLeaves {
+		t.Errorf("cache holds %d (%d ordered) leaves, want %d", len(issuer.cache), len(issuer.order), maxCachedLeaves)
+	}
+	if _, ok := issuer.cache["n0.localhost"]; ok {
+		t.Error("the oldest leaf should have been evicted")
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
-
-	"github.com/BurntSushi/toml"
+	"strconv"
+	"strings"
 )
 
 const FileName = ".portree.toml"
@@ -15,15 +16,105 @@ const FileName = ".portree.toml"
 type Config struct {
 	Services  map[string]ServiceConfig `toml:"services"`
 	Env       map[string]string        `toml:"env"`
+	EnvFile   []string                 `toml:"env_file"` // relative to the worktree root
 	Worktrees map[string]WTOverride    `toml:"worktrees"`
+	TLS       TLSConfig                `toml:"tls"`
+	Defaults  Defaults                 `toml:"defaults"`
+
+	// Personal preferences, usually set in the user config file; see
+	// UserConfigPath.
+	Preferences
+
+	// Set by Load rather than read from the file.
+	Profile     string            `toml:"-"` // selected profile, "" = none
+	Files       []string          `toml:"-"` // files merged, in order
+	IncludeDirs []string          `toml:"-"` // directories searched by glob includes
+	Sources     map[string]string `toml:"-"` // dotted key -> file; see Source
+
+	worktreeOrder []string                  // [worktrees] keys in the order they were read
+	branchRegexps map[string]*regexp.Regexp // compiled "~" branch patterns
+}
+
+// Preferences are settings that belong to a person rather than a
+// repository. A repository's config may still set them.
+type Preferences struct {
+	// HTTPS makes 'portree proxy start' serve HTTPS without --https.
+	HTTPS bool `toml:"https"`
+	// Editor is the command the dashboard opens a worktree with, such as
+	// "code" or "nvim"; $VISUAL or $EDITOR when empty.
+	Editor string `toml:"editor"`
+	// Browser is the command URLs are opened with, such as "firefox" or
+	// "open -a Safari"; the system default when empty.
+	Browser string `toml:"browser"`
+	// LogRetention makes 'portree up' remove logs not written to for this
+	// long, such as "7d" or "12h". Empty keeps them.
+	LogRetention string `toml:"log_retention"`
+	// Theme is the dashboard color theme: "auto" (the default), "dark" or
+	// "light".
+	Theme string `toml:"theme"`
+}
+
+// Defaults holds templates that apply to every service.
+type Defaults struct {
+	// Service is deep-merged under each service, which overrides its keys.
+	Service ServiceConfig `toml:"service"`
+}
+
+// TLSConfig controls the certificates used by 'portree proxy start --https'.
+type TLSConfig struct {
+	// LocalCA keeps a CA for this repository in .portree/certs instead of
+	// the user-level CA shared by all repositories.
+	LocalCA bool `toml:"local_ca"`
 }
 
 // ServiceConfig defines a single service within a worktree.
 type ServiceConfig struct {
-	Command   string    `toml:"command"`
-	Dir       string    `toml:"dir"`
-	PortRange PortRange `toml:"port_range"`
-	ProxyPort int       `toml:"proxy_port"`
+	Command   string            `toml:"command"`
+	Dir       string            `toml:"dir"`
+	Env       map[string]string `toml:"env"`
+	EnvFile   []string          `toml:"env_file"` // relative to Dir in the worktree
+	PortRange PortRange         `toml:"port_range"`
+	ProxyPort int               `toml:"proxy_port"` // 0 = not proxied
+	// ExtraPorts are further ports the service needs in each worktree, such
+	// as for HMR or a debugger, keyed by name. They are allocated like the
+	// main port and injected as PT_<SERVICE>_<NAME>_PORT.
+	ExtraPorts map[string]PortRange `toml:"extra_ports"`
+	// DependsOn names services that are started before this one when they
+	// are started together; see Config.StartOrder.
+	DependsOn []string `toml:"depends_on"`
+	// BackendTLS gives the service a certificate signed by the portree CA
+	// (PT_TLS_CERT, PT_TLS_KEY, PT_CA_CERT) and makes the proxy connect to
+	// it over HTTPS.
+	BackendTLS bool `toml:"backend_tls"`
+	// Enabled, OnlyBranches and ExceptBranches choose the worktrees the
+	// service runs in; see Config.ServiceEnabled. Enabled defaults to true.
+	Enabled        *bool    `toml:"enabled"`
+	OnlyBranches   []string `toml:"only_branches"`
+	ExceptBranches []string `toml:"except_branches"`
+
+	Proxy ProxyOptions `toml:"proxy"`
+}
+
+// ProxyOptions adjusts how the reverse proxy forwards requests to a service.
+// Header values may contain the placeholders {slug}, {branch}, {service},
+// {host} (the proxied Host) and {port} (the backend port).
+type ProxyOptions struct {
+	RequestHeaders        map[string]string `toml:"request_headers"`
+	RemoveRequestHeaders  []string          `toml:"remove_request_headers"`
+	ResponseHeaders       map[string]string `toml:"response_headers"`
+	RemoveResponseHeaders []string          `toml:"remove_response_headers"`
+
+	// XForwarded adds X-Forwarded-Proto, X-Forwarded-For and X-Forwarded-Port.
+	XForwarded bool `toml:"x_forwarded"`
+	// RewriteLocation turns redirects to the backend's own address into
+	// redirects to the proxied host.
+	RewriteLocation bool `toml:"rewrite_location"`
+	// RewriteCookieDomain points the Domain attribute of cookies set by the
+	// backend at the proxied host.
+	RewriteCookieDomain bool `toml:"rewrite_cookie_domain"`
+	// CORS answers preflights and adds CORS headers for requests whose
+	// Origin is a sibling service of the same worktree.
+	CORS bool `toml:"cors"`
 }
 
 // PortRange defines the range of ports available for allocation.
@@ -32,7 +123,9 @@ type PortRange struct {
 	Max int `toml:"max"`
 }
 
-// WTOverride defines per-worktree overrides.
+// WTOverride defines per-worktree overrides. Its key in [worktrees] is a
+// branch name, a glob such as "release/*", or a regular expression prefixed
+// with "~"; see Config.WorktreeKeys.
 type WTOverride struct {
 	Services map[string]WTServiceOverride `toml:"services"`
 }
@@ -42,6 +135,8 @@ type WTServiceOverride struct {
 	Command string            `toml:"command,omitempty"`
 	Port    int               `toml:"port,omitempty"`
 	Env     map[string]string `toml:"env,omitempty"`
+	EnvFile []string          `toml:"env_file,omitempty"` // relative to the service dir
+	Enabled *bool             `toml:"enabled,omitempty"`  // overrides the service's setting
 }
 
 // DefaultConfig returns a default configuration with a single frontend service.
@@ -63,38 +158,6 @@ func DefaultConfig() *Config {
 	}
 }
 
-// Load reads and parses the config file from the given repo root.
-func Load(repoRoot string) (*Config, error) {
-	path := filepath.Join(repoRoot, FileName)
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("%s not found in %s; run 'portree init' first", FileName, repoRoot)
-		}
-		return nil, fmt.Errorf("reading config: %w", err)
-	}
-
-	var cfg Config
-	if err := toml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("parsing %s: %w", FileName, err)
-	}
-
-	if cfg.Services == nil {
-		cfg.Services = map[string]ServiceConfig{}
-	}
-	if cfg.Env == nil {
-		cfg.Env = map[string]string{}
-	}
-	if cfg.Worktrees == nil {
-		cfg.Worktrees = map[string]WTOverride{}
-	}
-
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
-	}
-	return &cfg, nil
-}
-
 // Validate checks the configuration for errors.
 func (c *Config) Validate() error {
 	if len(c.Services) == 0 {
@@ -113,22 +176,55 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("service %q: port_range.min (%d) must be <= port_range.max (%d)",
 				name, svc.PortRange.Min, svc.PortRange.Max)
 		}
-		if svc.ProxyPort <= 0 {
+		if svc.ProxyPort < 0 {
 			return fmt.Errorf("service %q: proxy_port must be positive", name)
 		}
-		if existing, ok := proxyPorts[svc.ProxyPort]; ok {
+		if existing, ok := proxyPorts[svc.ProxyPort]; ok && svc.ProxyPort != 0 {
 			return fmt.Errorf("services %q and %q have the same proxy_port %d", existing, name, svc.ProxyPort)
 		}
 		proxyPorts[svc.ProxyPort] = name
+		if err := svc.Proxy.validate(); err != nil {
+			return fmt.Errorf("service %q: proxy: %w", name, err)
+		}
+		for _, p := range svc.OnlyBranches {
+			if err := validateBranchPattern(p); err != nil {
+				return fmt.Errorf("service %q: only_branches: %w", name, err)
+			}
+		}
+		for _, p := range svc.ExceptBranches {
+			if err := validateBranchPattern(p); err != nil {
+				return fmt.Errorf("service %q: except_branches: %w", name, err)
+			}
+		}
+		for _, dep := range svc.DependsOn {
+			if _, ok := c.Services[dep]; !ok {
+				return fmt.Errorf("service %q: depends_on references unknown service %q", name, dep)
+			}
+		}
+		if err := c.validateExtraPorts(name); err != nil {
+			return fmt.Errorf("service %q: extra_ports: %w", name, err)
+		}
+	}
+	if cycle := c.dependencyCycle(); cycle != nil {
+		return fmt.Errorf("services depend on each other: %s", strings.Join(cycle, " -> "))
+	}
+	if err := c.Preferences.validate(); err != nil {
+		return err
 	}
 
 	// Validate per-worktree port overrides are within range
 	for wtName, wt := range c.Worktrees {
+		if err := validateBranchPattern(wtName); err != nil {
+			return fmt.Errorf("worktree %w", err)
+		}
 		for svcName, svcOverride := range wt.Services {
 			svc, ok := c.Services[svcName]
 			if !ok {
 				return fmt.Errorf("worktree %q references unknown service %q", wtName, svcName)
 			}
+			if svcOverride.Port != 0 && worktreeKind(wtName) != worktreeExact {
+				return fmt.Errorf("worktree %q service %q: port can only be fixed for a single branch, not a pattern", wtName, svcName)
+			}
 			if svcOverride.Port != 0 && (svcOverride.Port < svc.PortRange.Min || svcOverride.Port > svc.PortRange.Max) {
 				return fmt.Errorf("worktree %q service %q port %d is outside range [%d, %d]",
 					wtName, svcName, svcOverride.Port, svc.PortRange.Min, svc.PortRange.Max)
@@ -136,12 +232,16 @@ func (c *Config) Validate() error {
 		}
 	}
 
-	// Check for port range overlaps between services.
-	svcNames := make([]string, 0, len(c.Services))
-	for name := range c.Services {
-		svcNames = append(svcNames, name)
+	// Check for port variables and port range overlaps between services.
+	svcNames := sortedServiceNames(c.Services)
+	portVars := make(map[string]string, len(svcNames))
+	for _, name := range svcNames {
+		v := PortVar(name)
+		if other, ok := portVars[v]; ok {
+			return fmt.Errorf("services %q and %q would both use the variable %s", other, name, v)
+		}
+		portVars[v] = name
 	}
-	sort.Strings(svcNames)
 	for i := 0; i < len(svcNames); i++ {
 		for j := i + 1; j < len(svcNames); j++ {
 			a := c.Services[svcNames[i]]
@@ -156,20 +256,92 @@ func (c *Config) Validate() error {
 	return nil
 }
 
-// Init creates a default .portree.toml file in the given directory.
-func Init(dir string) (string, error) {
-	path := filepath.Join(dir, FileName)
-	if _, err := os.Stat(path); err == nil {
-		return path, fmt.Errorf("%s already exists", FileName)
+var extraPortName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// validateExtraPorts checks the extra_ports of service: their names must
+// make valid variable names that no other port variable uses, and their
+// ranges must not overlap a port_range, another extra port or a
+// proxy_port.
+func (c *Config) validateExtraPorts(service string) error {
+	extras := c.Services[service].ExtraPorts
+	others := sortedServiceNames(c.Services)
+	for _, name := range sortedExtraNames(extras) {
+		r := extras[name]
+		if !extraPortName.MatchString(name) {
+			return fmt.Errorf("%q: names may only contain letters, digits and underscores", name)
+		}
+		if r.Min <= 0 || r.Max <= 0 || r.Min > r.Max {
+			return fmt.Errorf("%s: want 0 < min <= max, got [%d, %d]", name, r.Min, r.Max)
+		}
+		v := ExtraPortVar(service, name)
+		for _, other := range others {
+			svc := c.Services[other]
+			if v == PortVar(other) {
+				return fmt.Errorf("%s: %s is also the port variable of service %q", name, v, other)
+			}
+			if r.Min <= svc.PortRange.Max && svc.PortRange.Min <= r.Max {
+				return fmt.Errorf("%s: [%d, %d] overlaps the port_range of service %q", name, r.Min, r.Max, other)
+			}
+			if svc.ProxyPort != 0 && r.Min <= svc.ProxyPort && svc.ProxyPort <= r.Max {
+				return fmt.Errorf("%s: [%d, %d] contains the proxy_port %d of service %q", name, r.Min, r.Max, svc.ProxyPort, other)
+			}
+			for _, otherName := range sortedExtraNames(svc.ExtraPorts) {
+				if other == service && otherName == name {
+					continue
+				}
+				if v == ExtraPortVar(other, otherName) {
+					return fmt.Errorf("%s: %s is also the variable of extra port %q of service %q", name, v, otherName, other)
+				}
+				o := svc.ExtraPorts[otherName]
+				if r.Min <= o.Max && o.Min <= r.Max {
+					return fmt.Errorf("%s: [%d, %d] overlaps extra port %q of service %q", name, r.Min, r.Max, otherName, other)
+				}
+			}
+		}
 	}
+	return nil
+}
 
-	content := `# portree - Git Worktree Server Manager configuration
+func sortedServiceNames(services map[string]ServiceConfig) []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedExtraNames(extras map[string]PortRange) []string {
+	names := make([]string, 0, len(extras))
+	for name := range extras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PortVar is the variable that holds the port of service:
+// PT_<SERVICE>_PORT.
+func PortVar(service string) string {
+	return "PT_" + strings.ToUpper(service) + "_PORT"
+}
+
+// ExtraPortVar is the variable that holds the extra port name of service:
+// PT_<SERVICE>_<NAME>_PORT.
+func ExtraPortVar(service, name string) string {
+	return "PT_" + strings.ToUpper(service) + "_" + strings.ToUpper(name) + "_PORT"
+}
+
+const initHeader = `#:schema ` + SchemaID + `
+# portree - Git Worktree Server Manager configuration
 # See: https://github.com/fairy-pitta/portree
 
 # --- Service definitions ---
 # Define services to run per worktree.
 # Each service has its own command, directory, port range, and proxy port.
+`
 
+const initExampleServices = `
 [services.frontend]
 command = "pnpm run dev"
 dir = "frontend"                        # relative to worktree root (empty = root)
@@ -181,11 +353,20 @@ command = "source .venv/bin/activate && python manage.py runserver 0.0.0.0:$PORT
 dir = "backend"
 port_range = { min = 8100, max = 8199 }
 proxy_port = 8000
+`
 
+const initFooter = `
 # --- Global environment variables ---
 [env]
 # NODE_ENV = "development"
 
+# --- Personal overrides ---
+# Put personal tweaks in .portree.local.toml ('portree init' adds it to
+# .gitignore); it is merged over this file. Shared fragments can be pulled in with
+#   include = ["services/*.toml"]
+# and [profiles.<name>] sections are applied with --profile <name> or
+# PORTREE_PROFILE=<name>.
+
 # --- Per-worktree overrides (optional) ---
 # [worktrees.main]
 # services.frontend.port = 3100       # fixed port
@@ -194,6 +375,82 @@ proxy_port = 8000
 # services.backend.command = "source .venv/bin/activate && python manage.py runserver --settings=myapp.settings_auth 0.0.0.0:$PORT"
 # services.backend.env = { DEBUG = "1" }
 `
+
+// Init creates a default .portree.toml file in the given directory.
+func Init(dir string) (string, error) {
+	return writeInit(dir, initHeader+initExampleServices+initFooter)
+}
+
+// InitService is a service written by InitServices.
+type InitService struct {
+	Name     string
+	Comments []string // written above the service table
+	ServiceConfig
+}
+
+// InitServices creates a .portree.toml file in the given directory that
+// defines the given services instead of the examples written by Init.
+func InitServices(dir string, services []InitService) (string, error) {
+	content, err := RenderServices(services)
+	if err != nil {
+		return "", err
+	}
+	return writeInit(dir, content)
+}
+
+// RenderServices returns a .portree.toml that defines the given services,
+// in order, like the file written by Init. It fails if the services do not
+// pass Validate.
+func RenderServices(services []InitService) (string, error) {
+	cfg := &Config{Services: make(map[string]ServiceConfig, len(services))}
+	var b strings.Builder
+	b.WriteString(initHeader)
+	for _, svc := range services {
+		cfg.Services[svc.Name] = svc.ServiceConfig
+		b.WriteString("\n")
+		for _, c := range svc.Comments {
+			fmt.Fprintf(&b, "# %s\n", c)
+		}
+		fmt.Fprintf(&b, "[%s]\n", joinKey("services", svc.Name))
+		fmt.Fprintf(&b, "command = %s\n", strconv.Quote(svc.Command))
+		if svc.Dir != "" {
+			fmt.Fprintf(&b, "dir = %s\n", strconv.Quote(svc.Dir))
+		}
+		fmt.Fprintf(&b, "port_range = { min = %d, max = %d }\n", svc.PortRange.Min, svc.PortRange.Max)
+		if svc.ProxyPort != 0 {
+			fmt.Fprintf(&b, "proxy_port = %d\n", svc.ProxyPort)
+		}
+		if len(svc.DependsOn) > 0 {
+			deps := make([]string, len(svc.DependsOn))
+			for i, d := range svc.DependsOn {
+				deps[i] = strconv.Quote(d)
+			}
+			fmt.Fprintf(&b, "depends_on = [%s]\n", strings.Join(deps, ", "))
+		}
+		if len(svc.Env) > 0 {
+			keys := make([]string, 0, len(svc.Env))
+			for k := range svc.Env {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fmt.Fprintf(&b, "\n[%s]\n", joinKey(joinKey("services", svc.Name), "env"))
+			for _, k := range keys {
+				fmt.Fprintf(&b, "%s = %s\n", joinKey("", k), strconv.Quote(svc.Env[k]))
+			}
+		}
+	}
+	b.WriteString(initFooter)
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func writeInit(dir, content string) (string, error) {
+	path := filepath.Join(dir, FileName)
+	if _, err := os.Stat(path); err == nil {
+		return path, fmt.Errorf("%s already exists", FileName)
+	}
 	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
 		return "", fmt.Errorf("writing %s: %w", FileName, err)
 	}
@@ -201,39 +458,76 @@ proxy_port = 8000
 }
 
 // CommandForBranch returns the command for a given service and branch,
-// checking for per-worktree overrides.
-func (c *Config) CommandForBranch(service, branch string) string {
-	if wt, ok := c.Worktrees[branch]; ok {
-		if svc, ok := wt.Services[service]; ok && svc.Command != "" {
-			return svc.Command
+// checking for per-worktree overrides, with ${...} references expanded
+// (see Vars). Unknown names are left for the shell.
+func (c *Config) CommandForBranch(service, branch string, vars Vars) (string, error) {
+	command := c.Services[service].Command
+	for _, o := range c.serviceOverrides(service, branch) {
+		if o.Command != "" {
+			command = o.Command
 		}
 	}
-	return c.Services[service].Command
+	e, err := c.expander(service, branch, vars)
+	if err != nil {
+		return "", fmt.Errorf("service %q: %w", service, err)
+	}
+	expanded, err := e.expand(command, keepUnknown)
+	if err != nil {
+		return "", fmt.Errorf("service %q: command: %w", service, err)
+	}
+	return expanded, nil
 }
 
-// EnvForBranch returns merged environment variables for a given service and branch.
-// Priority: worktree service env > global env
-func (c *Config) EnvForBranch(service, branch string) map[string]string {
-	merged := make(map[string]string, len(c.Env))
-	for k, v := range c.Env {
-		merged[k] = v
+// DirForBranch returns the service's working directory relative to the
+// worktree root, with ${...} references expanded. The references cannot
+// name variables that come from env files.
+func (c *Config) DirForBranch(service, branch string, vars Vars) (string, error) {
+	dir, err := c.inlineExpander(service, branch, vars).expand(c.Services[service].Dir, rejectUnknown)
+	if err != nil {
+		return "", fmt.Errorf("service %q: dir: %w", service, err)
 	}
-	if wt, ok := c.Worktrees[branch]; ok {
-		if svc, ok := wt.Services[service]; ok {
-			for k, v := range svc.Env {
-				merged[k] = v
-			}
-		}
+	return dir, nil
+}
+
+// EnvForBranch returns merged environment variables for a given service and
+// branch, with ${...} references expanded. Entries may refer to each other.
+// Env files are read from vars.WorktreePath; see collectEnv for the
+// precedence.
+func (c *Config) EnvForBranch(service, branch string, vars Vars) (map[string]string, error) {
+	explained, err := c.explainEnv(service, branch, vars)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]string, len(explained))
+	for _, v := range explained {
+		merged[v.Name] = v.Value
 	}
-	return merged
+	return merged, nil
 }
 
 // FixedPortForBranch returns the fixed port for a branch+service, or 0 if none.
 func (c *Config) FixedPortForBranch(service, branch string) int {
-	if wt, ok := c.Worktrees[branch]; ok {
-		if svc, ok := wt.Services[service]; ok {
-			return svc.Port
+	port := 0
+	for _, o := range c.serviceOverrides(service, branch) {
+		if o.Port != 0 {
+			port = o.Port
 		}
 	}
-	return 0
+	return port
+}
+
+func (o ProxyOptions) validate() error {
+	names := append(append([]string{}, o.RemoveRequestHeaders...), o.RemoveResponseHeaders...)
+	for name := range o.RequestHeaders {
+		names = append(names, name)
+	}
+	for name := range o.ResponseHeaders {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	return nil
 }
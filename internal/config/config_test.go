@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -65,9 +66,16 @@ func TestValidate(t *testing.T) {
 			svc.PortRange = PortRange{Min: 4000, Max: 3000}
 			c.Services["web"] = svc
 		}, "must be <="},
-		{"zero proxy port", func(c *Config) {
+		{"services without proxy port", func(c *Config) {
+			c.Services["worker"] = ServiceConfig{Command: "bin/worker", PortRange: PortRange{Min: 9100, Max: 9199}}
+			c.Services["mailer"] = ServiceConfig{Command: "bin/mailer", PortRange: PortRange{Min: 9200, Max: 9299}}
+		}, ""},
+		{"same port variable", func(c *Config) {
+			c.Services["WEB"] = ServiceConfig{Command: "bin/web", PortRange: PortRange{Min: 9100, Max: 9199}, ProxyPort: 9000}
+		}, `services "WEB" and "web" would both use the variable PT_WEB_PORT`},
+		{"negative proxy port", func(c *Config) {
 			svc := c.Services["web"]
-			svc.ProxyPort = 0
+			svc.ProxyPort = -1
 			c.Services["web"] = svc
 		}, "proxy_port must be positive"},
 		{"duplicate proxy port", func(c *Config) {
@@ -91,6 +99,11 @@ func TestValidate(t *testing.T) {
 				},
 			}
 		}, "outside range"},
+		{"bad proxy header name", func(c *Config) {
+			svc := c.Services["web"]
+			svc.Proxy.RequestHeaders = map[string]string{"X Bad": "1"}
+			c.Services["web"] = svc
+		}, "invalid header name"},
 	}
 
 	for _, tt := range tests {
@@ -134,21 +147,21 @@ func TestCommandForBranch(t *testing.T) {
 	}
 
 	t.Run("no override", func(t *testing.T) {
-		got := cfg.CommandForBranch("web", "main")
+		got, _ := cfg.CommandForBranch("web", "main", Vars{})
 		if got != "npm start" {
 			t.Errorf("CommandForBranch() = %q, want %q", got, "npm start")
 		}
 	})
 
 	t.Run("override exists", func(t *testing.T) {
-		got := cfg.CommandForBranch("web", "feature/auth")
+		got, _ := cfg.CommandForBranch("web", "feature/auth", Vars{})
 		if got != "npm run dev:auth" {
 			t.Errorf("CommandForBranch() = %q, want %q", got, "npm run dev:auth")
 		}
 	})
 
 	t.Run("override empty command falls back", func(t *testing.T) {
-		got := cfg.CommandForBranch("web", "feature/empty")
+		got, _ := cfg.CommandForBranch("web", "feature/empty", Vars{})
 		if got != "npm start" {
 			t.Errorf("CommandForBranch() = %q, want %q", got, "npm start")
 		}
@@ -174,7 +187,7 @@ func TestEnvForBranch(t *testing.T) {
 	}
 
 	t.Run("global only", func(t *testing.T) {
-		env := cfg.EnvForBranch("web", "main")
+		env, _ := cfg.EnvForBranch("web", "main", Vars{})
 		if env["NODE_ENV"] != "development" {
 			t.Errorf("expected NODE_ENV=development, got %q", env["NODE_ENV"])
 		}
@@ -184,7 +197,7 @@ func TestEnvForBranch(t *testing.T) {
 	})
 
 	t.Run("merge with override", func(t *testing.T) {
-		env := cfg.EnvForBranch("web", "feature/auth")
+		env, _ := cfg.EnvForBranch("web", "feature/auth", Vars{})
 		if env["NODE_ENV"] != "development" {
 			t.Errorf("expected NODE_ENV=development, got %q", env["NODE_ENV"])
 		}
@@ -197,7 +210,7 @@ func TestEnvForBranch(t *testing.T) {
 	})
 
 	t.Run("returns copy", func(t *testing.T) {
-		env := cfg.EnvForBranch("web", "main")
+		env, _ := cfg.EnvForBranch("web", "main", Vars{})
 		env["NODE_ENV"] = "production"
 		if cfg.Env["NODE_ENV"] != "development" {
 			t.Error("EnvForBranch did not return a copy; original was mutated")
@@ -210,7 +223,7 @@ func TestEnvForBranch(t *testing.T) {
 			Env:       map[string]string{},
 			Worktrees: map[string]WTOverride{},
 		}
-		env := emptyCfg.EnvForBranch("web", "main")
+		env, _ := emptyCfg.EnvForBranch("web", "main", Vars{})
 		if len(env) != 0 {
 			t.Errorf("expected empty env, got %v", env)
 		}
@@ -324,6 +337,34 @@ proxy_port = 3000
 		}
 	})
 
+	t.Run("proxy options", func(t *testing.T) {
+		dir := t.TempDir()
+		tomlContent := `
+[services.web]
+command = "npm start"
+port_range = { min = 3100, max = 3199 }
+proxy_port = 3000
+
+[services.web.proxy]
+request_headers = { Origin = "http://localhost:{port}" }
+remove_response_headers = ["Server"]
+rewrite_location = true
+cors = true
+`
+		if err := os.WriteFile(filepath.Join(dir, FileName), []byte(tomlContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(dir)
+		if err != nil {
+			t.Fatalf("Load() error: %v", err)
+		}
+		opts := cfg.Services["web"].Proxy
+		if opts.RequestHeaders["Origin"] != "http://localhost:{port}" || len(opts.RemoveResponseHeaders) != 1 ||
+			!opts.RewriteLocation || !opts.CORS || opts.XForwarded {
+			t.Errorf("loaded proxy options = %+v", opts)
+		}
+	})
+
 	t.Run("file not found", func(t *testing.T) {
 		dir := t.TempDir()
 		_, err := Load(dir)
@@ -367,3 +408,130 @@ func TestInitThenLoad(t *testing.T) {
 		t.Error("loaded config has no services")
 	}
 }
+
+func TestInitServices(t *testing.T) {
+	dir := t.TempDir()
+
+	services := []InitService{
+		{
+			Name:     "web",
+			Comments: []string{"Detected from Vite (apps/web/package.json)"},
+			ServiceConfig: ServiceConfig{
+				Command:   `pnpm run dev --port $PORT --base "/"`,
+				Dir:       "apps/web",
+				PortRange: PortRange{Min: 3100, Max: 3199},
+				ProxyPort: 3000,
+			},
+		},
+		{
+			Name:          "mail",
+			ServiceConfig: ServiceConfig{Command: "docker compose --project-name ${slug} run mail", PortRange: PortRange{Min: 8100, Max: 8199}, ProxyPort: 8000},
+		},
+		{
+			Name:          "worker",
+			ServiceConfig: ServiceConfig{Command: "bin/worker", PortRange: PortRange{Min: 8200, Max: 8299}},
+		},
+	}
+	path, err := InitServices(dir, services)
+	if err != nil {
+		t.Fatalf("InitServices() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# Detected from Vite (apps/web/package.json)\n[services.web]\n") {
+		t.Errorf("InitServices() file missing the comment above [services.web]:\n%s", data)
+	}
+	if strings.Contains(string(data), "[services.frontend]") {
+		t.Error("InitServices() file contains the example services")
+	}
+	if !strings.Contains(string(data), "[services.worker]\ncommand = \"bin/worker\"\nport_range = { min = 8200, max = 8299 }\n\n") {
+		t.Errorf("InitServices() file should omit the proxy_port of worker:\n%s", data)
+	}
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() after InitServices() error: %v", err)
+	}
+	for _, svc := range services {
+		if !reflect.DeepEqual(cfg.Services[svc.Name], svc.ServiceConfig) {
+			t.Errorf("loaded %s = %+v, want %+v", svc.Name, cfg.Services[svc.Name], svc.ServiceConfig)
+		}
+	}
+
+	if _, err := InitServices(t.TempDir(), []InitService{{Name: "web"}}); err == nil {
+		t.Error("InitServices() with an invalid service expected error, got nil")
+	}
+	if _, err := InitServices(dir, services); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("InitServices() second call error = %v, want already exists", err)
+	}
+}
+
+func TestValidateExtraPorts(t *testing.T) {
+	tests := []struct {
+		name   string
+		extras map[string]PortRange
+		want   string
+	}{
+		{"valid", map[string]PortRange{"hmr": {Min: 24600, Max: 24699}, "inspect_2": {Min: 9229, Max: 9299}}, ""},
+		{"bad name", map[string]PortRange{"hmr-ws": {Min: 24600, Max: 24699}}, "names may only contain"},
+		{"empty range", map[string]PortRange{"hmr": {}}, "want 0 < min <= max"},
+		{"inverted range", map[string]PortRange{"hmr": {Min: 24699, Max: 24600}}, "want 0 < min <= max"},
+		{"variable clash", map[string]PortRange{"api": {Min: 24600, Max: 24699}}, `PT_FRONTEND_API_PORT is also the port variable of service "frontend_api"`},
+		{"extra variable clash", map[string]PortRange{"hmr": {Min: 24600, Max: 24699}, "HMR": {Min: 24700, Max: 24799}},
+			`HMR: PT_FRONTEND_HMR_PORT is also the variable of extra port "hmr" of service "frontend"`},
+		{"own port range", map[string]PortRange{"hmr": {Min: 3150, Max: 3160}}, `overlaps the port_range of service "frontend"`},
+		{"other port range", map[string]PortRange{"hmr": {Min: 8199, Max: 8299}}, `overlaps the port_range of service "frontend_api"`},
+		{"proxy port", map[string]PortRange{"hmr": {Min: 7990, Max: 8010}}, `contains the proxy_port 8000 of service "frontend_api"`},
+		{"other extra port", map[string]PortRange{"hmr": {Min: 24600, Max: 24699}, "ws": {Min: 24650, Max: 24660}},
+			`hmr: [24600, 24699] overlaps extra port "ws" of service "frontend"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			svc := cfg.Services["frontend"]
+			svc.ExtraPorts = tt.extras
+			cfg.Services["frontend"] = svc
+			cfg.Services["frontend_api"] = ServiceConfig{
+				Command:   "go run .",
+				PortRange: PortRange{Min: 8100, Max: 8199},
+				ProxyPort: 8000,
+			}
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("extra port of another service", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Services["frontend_api"] = ServiceConfig{
+			Command:    "go run .",
+			PortRange:  PortRange{Min: 8100, Max: 8199},
+			ProxyPort:  8000,
+			ExtraPorts: map[string]PortRange{"debug": {Min: 2345, Max: 2399}},
+		}
+		svc := cfg.Services["frontend"]
+		svc.ExtraPorts = map[string]PortRange{"api_debug": {Min: 9229, Max: 9299}}
+		cfg.Services["frontend"] = svc
+		want := `PT_FRONTEND_API_DEBUG_PORT is also the variable of extra port "debug" of service "frontend_api"`
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want %q", err, want)
+		}
+
+		svc.ExtraPorts = map[string]PortRange{"inspect": {Min: 2300, Max: 2350}}
+		cfg.Services["frontend"] = svc
+		want = `inspect: [2300, 2350] overlaps extra port "debug" of service "frontend_api"`
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want %q", err, want)
+		}
+	})
+}
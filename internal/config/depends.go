@@ -0,0 +1,79 @@
+package config
+
+import "sort"
+
+// StartOrder returns names, a subset of the services, ordered so that each
+// service comes after the ones it depends on. Services that do not depend
+// on each other keep the order of names. Dependencies that are not in names
+// are ignored.
+func (c *Config) StartOrder(names []string) []string {
+	included := make(map[string]bool, len(names))
+	for _, name := range names {
+		included[name] = true
+	}
+	ordered := make([]string, 0, len(names))
+	done := make(map[string]bool, len(names))
+	var visit func(name string)
+	visit = func(name string) {
+		if done[name] {
+			return
+		}
+		done[name] = true // also guards against cycles, which Validate rejects
+		for _, dep := range c.Services[name].DependsOn {
+			if included[dep] {
+				visit(dep)
+			}
+		}
+		ordered = append(ordered, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return ordered
+}
+
+// dependencyCycle returns a depends_on cycle, starting and ending with the
+// same service, or nil if there is none.
+func (c *Config) dependencyCycle() []string {
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int, len(names))
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch marks[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+		marks[name] = visiting
+		path = append(path, name)
+		for _, dep := range c.Services[name].DependsOn {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		marks[name] = visited
+		return nil
+	}
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
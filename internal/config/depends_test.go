@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStartOrder(t *testing.T) {
+	cfg := &Config{Services: map[string]ServiceConfig{
+		"web":    {DependsOn: []string{"api"}},
+		"api":    {DependsOn: []string{"db", "cache"}},
+		"db":     {},
+		"cache":  {},
+		"worker": {DependsOn: []string{"db"}},
+	}}
+	for _, tt := range []struct {
+		names, want []string
+	}{
+		{[]string{"api", "cache", "db", "web", "worker"}, []string{"db", "cache", "api", "web", "worker"}},
+		{[]string{"web", "worker"}, []string{"web", "worker"}}, // dependencies outside names are ignored
+		{[]string{"worker", "db"}, []string{"db", "worker"}},
+	} {
+		if got := cfg.StartOrder(tt.names); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("StartOrder(%v) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestValidateDependsOn(t *testing.T) {
+	svc := func(port int, deps ...string) ServiceConfig {
+		return ServiceConfig{Command: "x", PortRange: PortRange{Min: port + 100, Max: port + 199}, ProxyPort: port, DependsOn: deps}
+	}
+	for _, tt := range []struct {
+		services map[string]ServiceConfig
+		want     string
+	}{
+		{map[string]ServiceConfig{"web": svc(3000, "api")}, `service "web": depends_on references unknown service "api"`},
+		{map[string]ServiceConfig{"web": svc(3000, "web")}, "services depend on each other: web -> web"},
+		{
+			map[string]ServiceConfig{"a": svc(3000, "b"), "b": svc(4000, "c"), "c": svc(5000, "a")},
+			"services depend on each other: a -> b -> c -> a",
+		},
+	} {
+		err := (&Config{Services: tt.services}).Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate() error = %v, want %q", err, tt.want)
+		}
+	}
+}
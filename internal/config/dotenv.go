@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// dotenvEntry is one assignment of a .env file.
+type dotenvEntry struct {
+	Key   string
+	Value string // with a literal ${ written as $${, see expander
+}
+
+var dotenvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// readDotenv parses the .env file at path. It returns (nil, nil) if the file
+// does not exist.
+func readDotenv(path string) ([]dotenvEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDotenv(string(data))
+}
+
+// parseDotenv parses KEY=value lines as written by most dotenv libraries:
+//
+//   - blank lines and lines starting with # are ignored, as is a leading
+//     "export ";
+//   - unquoted values are trimmed and end at " #";
+//   - 'single-quoted' values are taken literally and may span lines;
+//   - "double-quoted" values may span lines and understand the escapes \n,
+//     \r, \t, \", \\ and \$.
+//
+// Unquoted and double-quoted values may contain ${...} references, which are
+// expanded like those in .portree.toml; single-quoted ones are not.
+func parseDotenv(src string) ([]dotenvEntry, error) {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	var entries []dotenvEntry
+	line := 1
+	for len(src) > 0 {
+		start := line
+		var raw string
+		raw, src = cutLine(src)
+		line++
+
+		s := strings.TrimLeft(raw, " \t")
+		if strings.TrimSpace(s) == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		s = strings.TrimPrefix(s, "export ")
+		key, rest, ok := strings.Cut(s, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !dotenvKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=value", start)
+		}
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		switch {
+		case strings.HasPrefix(rest, "'"), strings.HasPrefix(rest, `"`):
+			quote := rest[0]
+			body := rest[1:]
+			// Quoted values may continue on the following lines.
+			for {
+				if end := closingQuote(body, quote); end >= 0 {
+					if tail := strings.TrimSpace(body[end+1:]); tail != "" && !strings.HasPrefix(tail, "#") {
+						return nil, fmt.Errorf("line %d: unexpected %q after the closing quote", start, tail)
+					}
+					body = body[:end]
+					break
+				}
+				if src == "" {
+					return nil, fmt.Errorf("line %d: unterminated %c quote", start, quote)
+				}
+				raw, src = cutLine(src)
+				line++
+				body += "\n" + raw
+			}
+			if quote == '\'' {
+				value = strings.ReplaceAll(body, "${", "$${")
+			} else {
+				value = unescapeDotenv(body)
+			}
+		default:
+			if i := strings.Index(rest, " #"); i >= 0 {
+				rest = rest[:i]
+			}
+			value = strings.TrimSpace(rest)
+		}
+		entries = append(entries, dotenvEntry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+func cutLine(s string) (line, rest string) {
+	line, rest, _ = strings.Cut(s, "\n")
+	return line, rest
+}
+
+// closingQuote returns the index of the unescaped quote that ends s, or -1.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDotenv(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '$':
+			if strings.HasPrefix(s[i+1:], "{") {
+				b.WriteString("$$") // keep it out of expansion
+			} else {
+				b.WriteByte('$')
+			}
+		case '"', '\\':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
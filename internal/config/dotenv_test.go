@@ -0,0 +1,56 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	src := `# comment
+PLAIN=value
+export EXPORTED = spaced value   # trailing comment
+HASH=a#b
+EMPTY=
+SINGLE='literal ${HOME} \n'
+DOUBLE="line1\nline2 \"q\" \${not} ${PORT}"
+MULTI="first
+second"
+SINGLE_MULTI='a
+  b'
+CRLF=x` + "\r\n" + `DOTTED.KEY=1
+`
+	got, err := parseDotenv(src)
+	if err != nil {
+		t.Fatalf("parseDotenv() error: %v", err)
+	}
+	want := []dotenvEntry{
+		{"PLAIN", "value"},
+		{"EXPORTED", "spaced value"},
+		{"HASH", "a#b"},
+		{"EMPTY", ""},
+		{"SINGLE", `literal $${HOME} \n`},
+		{"DOUBLE", "line1\nline2 \"q\" $${not} ${PORT}"},
+		{"MULTI", "first\nsecond"},
+		{"SINGLE_MULTI", "a\n  b"},
+		{"CRLF", "x"},
+		{"DOTTED.KEY", "1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDotenv() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"A=1\nnot an assignment": "line 2: expected KEY=value",
+		"A=1\n1BAD=x":            "line 2: expected KEY=value",
+		"A=\"open\n\nstill open": `line 1: unterminated " quote`,
+		"A='x' y":                `line 1: unexpected "y" after the closing quote`,
+	} {
+		_, err := parseDotenv(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseDotenv(%q) error = %v, want %q", src, err, want)
+		}
+	}
+}
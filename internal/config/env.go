@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AutoSource is the EnvVar.Source of the variables in Vars.Auto.
+const AutoSource = "portree"
+
+// EnvVar is a variable of a service's environment and where it was set.
+type EnvVar struct {
+	Name   string
+	Value  string
+	Source string
+	// Overrides lists the sources of lower-precedence definitions of the
+	// same variable, most recent first.
+	Overrides []string
+}
+
+// ExplainEnv returns the environment of the service in the worktree of
+// branch, sorted by name: the variables of EnvForBranch followed by those
+// in vars.Auto, which the service process also receives and which take
+// precedence.
+func (c *Config) ExplainEnv(service, branch string, vars Vars) ([]EnvVar, error) {
+	vs, err := c.explainEnv(service, branch, vars)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]int, len(vs))
+	for i, v := range vs {
+		byName[v.Name] = i
+	}
+	for name, value := range vars.Auto {
+		if i, ok := byName[name]; ok {
+			v := &vs[i]
+			v.Overrides = append([]string{v.Source}, v.Overrides...)
+			v.Value, v.Source = value, AutoSource
+			continue
+		}
+		vs = append(vs, EnvVar{Name: name, Value: value, Source: AutoSource})
+	}
+	sort.Slice(vs, func(i, j int) bool { return vs[i].Name < vs[j].Name })
+	return vs, nil
+}
+
+func (c *Config) explainEnv(service, branch string, vars Vars) ([]EnvVar, error) {
+	e, err := c.expander(service, branch, vars)
+	if err != nil {
+		return nil, fmt.Errorf("service %q: %w", service, err)
+	}
+	names := make([]string, 0, len(e.env))
+	for k := range e.env {
+		names = append(names, k)
+	}
+	sort.Strings(names) // report errors deterministically
+	vs := make([]EnvVar, 0, len(names))
+	for _, k := range names {
+		v, err := e.envValue(k)
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", service, err)
+		}
+		vs = append(vs, EnvVar{Name: k, Value: v, Source: e.layers.sources[k], Overrides: e.layers.overrides[k]})
+	}
+	return vs, nil
+}
+
+// envLayers accumulates env entries in order of increasing precedence.
+type envLayers struct {
+	values    map[string]string
+	sources   map[string]string
+	overrides map[string][]string
+	fromFile  map[string]bool // entries whose value was read from an env file
+}
+
+func newEnvLayers() *envLayers {
+	return &envLayers{
+		values:    map[string]string{},
+		sources:   map[string]string{},
+		overrides: map[string][]string{},
+		fromFile:  map[string]bool{},
+	}
+}
+
+func (l *envLayers) set(key, value, source string) {
+	if old, ok := l.sources[key]; ok {
+		l.overrides[key] = append([]string{old}, l.overrides[key]...)
+	}
+	l.values[key] = value
+	l.sources[key] = source
+	delete(l.fromFile, key)
+}
+
+// setTable adds the entries of an env table found at the dotted key prefix.
+func (c *Config) setTable(l *envLayers, env map[string]string, prefix string) {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := joinKey(prefix, k)
+		file := c.Source(key)
+		if file == "" {
+			file = FileName
+		}
+		l.set(k, env[k], file+": "+key)
+	}
+}
+
+// setFiles adds the entries of the env files, resolved against dir, in order.
+// Files that do not exist are skipped.
+func setFiles(l *envLayers, files []string, dir, worktree string) error {
+	for _, f := range files {
+		path := f
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, f)
+		}
+		label := path
+		if rel, err := filepath.Rel(worktree, path); err == nil && !strings.HasPrefix(rel, "..") {
+			label = filepath.ToSlash(rel)
+		}
+		entries, err := readDotenv(path)
+		if err != nil {
+			return fmt.Errorf("env_file %s: %w", label, err)
+		}
+		for _, e := range entries {
+			l.set(e.Key, e.Value, label)
+			l.fromFile[e.Key] = true
+		}
+	}
+	return nil
+}
+
+// collectEnv collects the env entries of the service in the worktree of
+// branch, unexpanded, in order of increasing precedence:
+//
+//  1. the top-level env_file files, relative to the worktree root;
+//  2. [env];
+//  3. the service's env_file files, relative to its dir in the worktree;
+//  4. the service's env;
+//  5. the env_file files of the matching worktree overrides, also relative
+//     to the dir;
+//  6. the env of the matching worktree overrides.
+//
+// Within a list of files, later files win; overrides apply in the order of
+// WorktreeKeys. Env files are only read when
+// worktree is set.
+func (c *Config) collectEnv(service, branch, worktree, dir string) (*envLayers, error) {
+	l := newEnvLayers()
+	overrides := c.serviceOverrides(service, branch)
+
+	serviceDir := filepath.Join(worktree, dir)
+	if worktree != "" {
+		if err := setFiles(l, c.EnvFile, worktree, worktree); err != nil {
+			return nil, err
+		}
+	}
+	c.setTable(l, c.Env, "env")
+	if worktree != "" {
+		if err := setFiles(l, c.Services[service].EnvFile, serviceDir, worktree); err != nil {
+			return nil, err
+		}
+	}
+	c.setTable(l, c.Services[service].Env, joinKey(joinKey("services", service), "env"))
+	if worktree != "" {
+		for _, o := range overrides {
+			if err := setFiles(l, o.EnvFile, serviceDir, worktree); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, o := range overrides {
+		c.setTable(l, o.Env, o.key+".env")
+	}
+	return l, nil
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvFiles(t *testing.T) {
+	wt := t.TempDir()
+	writeFiles(t, wt, map[string]string{
+		".env":               "SHARED=root\nNODE_ENV=production\nROOT_ONLY=1\n",
+		"apps/web/.env":      "NODE_ENV=test\nDB_NAME=app_${slug}\nSECRET='p4$${x}'\n",
+		"apps/web/.env.auth": "DB_NAME=auth\n",
+	})
+	cfg := &Config{
+		Services: map[string]ServiceConfig{
+			"web": {Command: "npm run dev -- ${DB_NAME}", Dir: "apps/${service}", EnvFile: []string{".env", ".env.local"}},
+		},
+		EnvFile: []string{".env"},
+		Env:     map[string]string{"NODE_ENV": "development", "SHARED": "config"},
+		Worktrees: map[string]WTOverride{
+			"feature/auth": {Services: map[string]WTServiceOverride{
+				"web": {EnvFile: []string{".env.auth"}, Env: map[string]string{"SHARED": "override"}},
+			}},
+		},
+	}
+	vars := Vars{Slug: "main", WorktreePath: wt, Auto: map[string]string{"PORT": "3100"}}
+
+	env, err := cfg.EnvForBranch("web", "main", vars)
+	if err != nil {
+		t.Fatalf("EnvForBranch() error: %v", err)
+	}
+	want := map[string]string{
+		"SHARED":    "config",
+		"NODE_ENV":  "test", // the service's .env beats [env]
+		"ROOT_ONLY": "1",
+		"DB_NAME":   "app_main",
+		"SECRET":    "p4$${x}",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("EnvForBranch(main) = %v, want %v", env, want)
+	}
+	if cmd, _ := cfg.CommandForBranch("web", "main", vars); cmd != "npm run dev -- app_main" {
+		t.Errorf("CommandForBranch() = %q, env file entries should be available", cmd)
+	}
+
+	vars.Slug = "feature-auth"
+	explained, err := cfg.ExplainEnv("web", "feature/auth", vars)
+	if err != nil {
+		t.Fatalf("ExplainEnv() error: %v", err)
+	}
+	got := map[string]EnvVar{}
+	for _, v := range explained {
+		got[v.Name] = v
+	}
+	for name, want := range map[string]EnvVar{
+		"DB_NAME":  {Name: "DB_NAME", Value: "auth", Source: "apps/web/.env.auth", Overrides: []string{"apps/web/.env"}},
+		"SHARED":   {Name: "SHARED", Value: "override", Source: `.portree.toml: worktrees."feature/auth".services.web.env.SHARED`, Overrides: []string{".portree.toml: env.SHARED", ".env"}},
+		"NODE_ENV": {Name: "NODE_ENV", Value: "test", Source: "apps/web/.env", Overrides: []string{".portree.toml: env.NODE_ENV", ".env"}},
+		"PORT":     {Name: "PORT", Value: "3100", Source: AutoSource},
+	} {
+		if !reflect.DeepEqual(got[name], want) {
+			t.Errorf("ExplainEnv()[%s] = %+v, want %+v", name, got[name], want)
+		}
+	}
+	if explained[0].Name != "DB_NAME" || explained[len(explained)-1].Name != "SHARED" {
+		t.Errorf("ExplainEnv() not sorted: %v", explained)
+	}
+
+	// Without a worktree path, files are not read.
+	env, err = cfg.EnvForBranch("web", "main", Vars{})
+	if err != nil || len(env) != 2 {
+		t.Errorf("EnvForBranch() without worktree = %v, %v", env, err)
+	}
+}
+
+func TestServiceEnv(t *testing.T) {
+	wt := t.TempDir()
+	writeFiles(t, wt, map[string]string{".env": "LEVEL=file\nFROM_FILE=1\n"})
+	cfg := &Config{
+		Services: map[string]ServiceConfig{
+			"web": {Command: "x", EnvFile: []string{".env"}, Env: map[string]string{"LEVEL": "service", "URL": "http://localhost:${PORT}"}},
+			"api": {Command: "x"},
+		},
+		Env: map[string]string{"LEVEL": "global"},
+		Worktrees: map[string]WTOverride{
+			"main": {Services: map[string]WTServiceOverride{"web": {Env: map[string]string{"URL": "override"}}}},
+		},
+	}
+	vars := Vars{WorktreePath: wt, Auto: map[string]string{"PORT": "3100"}}
+
+	for branch, want := range map[string]map[string]string{
+		"dev":  {"LEVEL": "service", "FROM_FILE": "1", "URL": "http://localhost:3100"},
+		"main": {"LEVEL": "service", "FROM_FILE": "1", "URL": "override"},
+	} {
+		if env, err := cfg.EnvForBranch("web", branch, vars); err != nil || !reflect.DeepEqual(env, want) {
+			t.Errorf("EnvForBranch(web, %s) = %v, %v; want %v", branch, env, err, want)
+		}
+	}
+	if env, _ := cfg.EnvForBranch("api", "dev", vars); env["LEVEL"] != "global" {
+		t.Errorf("EnvForBranch(api) = %v, the env of web should not apply", env)
+	}
+
+	vs, _ := cfg.ExplainEnv("web", "dev", vars)
+	for _, v := range vs {
+		if v.Name == "LEVEL" && v.Source != FileName+": services.web.env.LEVEL" {
+			t.Errorf("ExplainEnv()[LEVEL].Source = %q", v.Source)
+		}
+	}
+}
+
+func TestEnvFileReferences(t *testing.T) {
+	t.Setenv("PT_TEST_HOME", "/home/dev")
+	wt := t.TempDir()
+	writeFiles(t, wt, map[string]string{".env": `CACHE=${PT_TEST_HOME}/cache
+SECRET=${VAULT_TOKEN}
+URL=http://localhost:${PORT}
+`})
+	cfg := &Config{
+		Services: map[string]ServiceConfig{"web": {Command: "x", Env: map[string]string{"DIR": "${CACHE}/web"}}},
+		EnvFile:  []string{".env"},
+	}
+	env, err := cfg.EnvForBranch("web", "main", Vars{WorktreePath: wt, Auto: map[string]string{"PORT": "3100"}})
+	if err != nil {
+		t.Fatalf("EnvForBranch() error: %v", err)
+	}
+	want := map[string]string{
+		"CACHE":  "/home/dev/cache",
+		"SECRET": "${VAULT_TOKEN}",
+		"URL":    "http://localhost:3100",
+		"DIR":    "/home/dev/cache/web",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("EnvForBranch() = %v, want %v", env, want)
+	}
+
+	// Entries in the config itself stay strict.
+	cfg.Services["web"] = ServiceConfig{Command: "x", Env: map[string]string{"DIR": "${PT_TEST_HOME}"}}
+	if _, err := cfg.EnvForBranch("web", "main", Vars{WorktreePath: wt}); err == nil || !strings.Contains(err.Error(), "unknown variable ${PT_TEST_HOME}") {
+		t.Errorf("EnvForBranch() error = %v, want an unknown variable error", err)
+	}
+}
+
+func TestEnvFileErrors(t *testing.T) {
+	wt := t.TempDir()
+	writeFiles(t, wt, map[string]string{".env": "OK=1\nbroken\n"})
+	cfg := &Config{
+		Services: map[string]ServiceConfig{"web": {Command: "x"}},
+		EnvFile:  []string{".env"},
+	}
+	_, err := cfg.EnvForBranch("web", "main", Vars{WorktreePath: wt})
+	if err == nil || !strings.Contains(err.Error(), `service "web": env_file .env: line 2: expected KEY=value`) {
+		t.Errorf("EnvForBranch() error = %v", err)
+	}
+}
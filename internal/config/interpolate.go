@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Vars holds the values that ${...} references in command, dir and env can
+// use, in addition to the entries of [env] and ${env:NAME} for the
+// environment portree runs in.
+type Vars struct {
+	Slug         string
+	WorktreePath string
+	// Auto holds the variables portree injects into the service process,
+	// such as PORT, PT_BRANCH and PT_<SERVICE>_PORT.
+	Auto map[string]string
+}
+
+// refName matches the name part of a ${...} reference.
+var refName = regexp.MustCompile(`^(env:)?[A-Za-z_][A-Za-z0-9_]*$`)
+
+// expander resolves ${...} references for one service of one worktree.
+//
+// A reference is ${name} or ${name:-default}; the default is used when the
+// name is unset or empty and may itself contain references. Names are, in
+// order of precedence: slug, branch, service and worktree_path; the
+// variables in Vars.Auto; the service's merged env entries; and env:NAME for
+// the environment. $${ produces a literal ${.
+type expander struct {
+	service string
+	branch  string
+	vars    Vars
+	layers  *envLayers
+	env     map[string]string // merged, unexpanded env entries
+	done    map[string]string // expanded env entries
+	stack   []string          // env entries being expanded, for cycle errors
+}
+
+// expander returns an expander that knows all env entries of the service,
+// including those of env files when vars.WorktreePath is set.
+func (c *Config) expander(service, branch string, vars Vars) (*expander, error) {
+	var dir string
+	if vars.WorktreePath != "" {
+		var err error
+		dir, err = c.inlineExpander(service, branch, vars).expand(c.Services[service].Dir, rejectUnknown)
+		if err != nil {
+			return nil, fmt.Errorf("dir: %w", err)
+		}
+	}
+	l, err := c.collectEnv(service, branch, vars.WorktreePath, dir)
+	if err != nil {
+		return nil, err
+	}
+	return newExpander(service, branch, vars, l), nil
+}
+
+// inlineExpander returns an expander that only knows the env entries written
+// in the config itself.
+func (c *Config) inlineExpander(service, branch string, vars Vars) *expander {
+	l, _ := c.collectEnv(service, branch, "", "") // cannot fail without files
+	return newExpander(service, branch, vars, l)
+}
+
+func newExpander(service, branch string, vars Vars, l *envLayers) *expander {
+	return &expander{
+		service: service,
+		branch:  branch,
+		vars:    vars,
+		layers:  l,
+		env:     l.values,
+		done:    map[string]string{},
+	}
+}
+
+// unknownRefs says what expand does with references to unknown names.
+type unknownRefs int
+
+const (
+	// keepUnknown leaves them as they are, so that a shell can still expand
+	// them in commands.
+	keepUnknown unknownRefs = iota
+	// rejectUnknown makes them an error, as in env and dir.
+	rejectUnknown
+	// environUnknown looks them up in the environment portree runs in and
+	// leaves them as they are if unset, like dotenv loaders do for values
+	// in env files.
+	environUnknown
+)
+
+// expand resolves the references in s, treating unknown names as unknown
+// says.
+func (e *expander) expand(s string, unknown unknownRefs) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			b.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "${"):
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated reference in %q", s)
+			}
+			ref := s[i+2 : end]
+			v, err := e.resolve(ref, unknown)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i = end + 1
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the } that closes a reference whose
+// body starts at start, allowing nested references in defaults.
+func closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func (e *expander) resolve(ref string, unknown unknownRefs) (string, error) {
+	name, def, hasDefault := strings.Cut(ref, ":-")
+	if !refName.MatchString(name) {
+		return "", fmt.Errorf("invalid reference ${%s}", ref)
+	}
+	v, ok, err := e.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	if !ok && unknown == environUnknown {
+		v, ok = os.LookupEnv(name)
+	}
+	switch {
+	case hasDefault && v == "":
+		return e.expand(def, unknown)
+	case ok:
+		return v, nil
+	case unknown == rejectUnknown:
+		return "", fmt.Errorf("unknown variable ${%s} (use ${%s:-default} to allow it to be unset)", name, name)
+	}
+	return "${" + ref + "}", nil
+}
+
+func (e *expander) lookup(name string) (string, bool, error) {
+	if n, ok := strings.CutPrefix(name, "env:"); ok {
+		v, ok := os.LookupEnv(n)
+		return v, ok, nil
+	}
+	switch name {
+	case "slug":
+		return e.vars.Slug, true, nil
+	case "branch":
+		return e.branch, true, nil
+	case "service":
+		return e.service, true, nil
+	case "worktree_path":
+		return e.vars.WorktreePath, true, nil
+	}
+	if v, ok := e.vars.Auto[name]; ok {
+		return v, true, nil
+	}
+	if _, ok := e.env[name]; ok {
+		v, err := e.envValue(name)
+		return v, true, err
+	}
+	return "", false, nil
+}
+
+// envValue returns the expanded value of the env entry name. Entries from
+// env files may also refer to the environment portree runs in, and keep
+// references to unknown names.
+func (e *expander) envValue(name string) (string, error) {
+	if v, ok := e.done[name]; ok {
+		return v, nil
+	}
+	for i, n := range e.stack {
+		if n == name {
+			return "", fmt.Errorf("env reference cycle: %s", strings.Join(append(e.stack[i:], name), " -> "))
+		}
+	}
+	unknown := rejectUnknown
+	if e.layers.fromFile[name] {
+		unknown = environUnknown
+	}
+	e.stack = append(e.stack, name)
+	v, err := e.expand(e.env[name], unknown)
+	e.stack = e.stack[:len(e.stack)-1]
+	if err != nil {
+		if len(e.stack) == 0 {
+			err = fmt.Errorf("env %s: %w", name, err)
+		}
+		return "", err
+	}
+	e.done[name] = v
+	return v, nil
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func interpolationConfig(env map[string]string) *Config {
+	return &Config{
+		Services: map[string]ServiceConfig{
+			"web": {Command: "npm run dev -- --port ${PORT} --api http://localhost:${PT_API_PORT}", Dir: "apps/${service}"},
+		},
+		Env: env,
+		Worktrees: map[string]WTOverride{
+			"feature/auth": {
+				Services: map[string]WTServiceOverride{
+					"web": {
+						Command: "npm run dev:${slug} # $HOME ${UNKNOWN} $${literal}",
+						Env:     map[string]string{"DB_NAME": "app_${slug}"},
+					},
+				},
+			},
+		},
+	}
+}
+
+var testVars = Vars{
+	Slug:         "feature-auth",
+	WorktreePath: "/src/app/.worktrees/feature-auth",
+	Auto:         map[string]string{"PORT": "3100", "PT_API_PORT": "8100"},
+}
+
+func TestCommandInterpolation(t *testing.T) {
+	cfg := interpolationConfig(nil)
+
+	got, err := cfg.CommandForBranch("web", "main", testVars)
+	if err != nil || got != "npm run dev -- --port 3100 --api http://localhost:8100" {
+		t.Errorf("CommandForBranch(main) = %q, %v", got, err)
+	}
+
+	// Unknown names and $VAR are left for the shell; $${ escapes.
+	got, err = cfg.CommandForBranch("web", "feature/auth", testVars)
+	if err != nil || got != "npm run dev:feature-auth # $HOME ${UNKNOWN} ${literal}" {
+		t.Errorf("CommandForBranch(feature/auth) = %q, %v", got, err)
+	}
+
+	dir, err := cfg.DirForBranch("web", "main", testVars)
+	if err != nil || dir != "apps/web" {
+		t.Errorf("DirForBranch() = %q, %v", dir, err)
+	}
+}
+
+func TestEnvInterpolation(t *testing.T) {
+	t.Setenv("PORTREE_TEST_HOME", "/home/me")
+	cfg := interpolationConfig(map[string]string{
+		"API_URL":   "http://localhost:${PT_API_PORT}",
+		"CACHE_DIR": "${env:PORTREE_TEST_HOME}/.cache/${slug}",
+		"DB_URL":    "postgres://localhost/${DB_NAME}",
+		"DB_NAME":   "app",
+		"LOG_LEVEL": "${PORTREE_LOG_LEVEL:-${DEFAULT_LEVEL:-info}}",
+		"ROOT":      "${worktree_path}",
+		"BRANCH":    "${branch}",
+	})
+
+	env, err := cfg.EnvForBranch("web", "feature/auth", testVars)
+	if err != nil {
+		t.Fatalf("EnvForBranch() error: %v", err)
+	}
+	for k, want := range map[string]string{
+		"API_URL":   "http://localhost:8100",
+		"CACHE_DIR": "/home/me/.cache/feature-auth",
+		"DB_URL":    "postgres://localhost/app_feature-auth", // uses the worktree's DB_NAME
+		"LOG_LEVEL": "info",
+		"ROOT":      testVars.WorktreePath,
+		"BRANCH":    "feature/auth",
+	} {
+		if env[k] != want {
+			t.Errorf("env[%s] = %q, want %q", k, env[k], want)
+		}
+	}
+	if cfg.Env["API_URL"] != "http://localhost:${PT_API_PORT}" {
+		t.Error("EnvForBranch should not modify the config")
+	}
+}
+
+func TestInterpolationErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "cycle",
+			env:  map[string]string{"A": "${B}", "B": "x${C}", "C": "${A}"},
+			want: "env reference cycle: A -> B -> C -> A",
+		},
+		{
+			name: "self reference",
+			env:  map[string]string{"PATH_EXTRA": "${PATH_EXTRA}:/bin"},
+			want: "env reference cycle: PATH_EXTRA -> PATH_EXTRA",
+		},
+		{
+			name: "unknown",
+			env:  map[string]string{"URL": "${HOST}:80"},
+			want: `env URL: unknown variable ${HOST}`,
+		},
+		{
+			name: "unterminated",
+			env:  map[string]string{"URL": "${HOST"},
+			want: `env URL: unterminated reference in "${HOST"`,
+		},
+		{
+			name: "invalid",
+			env:  map[string]string{"URL": "${not valid}"},
+			want: "invalid reference ${not valid}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := interpolationConfig(tt.env)
+			_, err := cfg.EnvForBranch("web", "main", testVars)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("EnvForBranch() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	cfg := interpolationConfig(nil)
+	cfg.Services["web"] = ServiceConfig{Command: "x", Dir: "${nope}"}
+	if _, err := cfg.DirForBranch("web", "main", testVars); err == nil || !strings.Contains(err.Error(), `service "web": dir: unknown variable ${nope}`) {
+		t.Errorf("DirForBranch() error = %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// fileConfig is what a single config file may contain: the Config fields,
+// includes and profiles, which hold Config fields too.
+type fileConfig struct {
+	Config
+	Include  any               `toml:"include"`
+	Profiles map[string]Config `toml:"profiles"`
+}
+
+// checkKeys decodes the config file data, labelled label, into v, a pointer
+// to fileConfig or userFileConfig, and reports keys that do not belong
+// there, with their line numbers and a suggestion where a known key is
+// spelled similarly.
+func checkKeys(label string, data []byte, v any) error {
+	md, err := toml.Decode(string(data), v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", label, err)
+	}
+	undecoded := md.Undecoded()
+	if len(undecoded) == 0 {
+		return nil
+	}
+
+	lines := keyLines(data)
+	reported := map[string]bool{}
+	var errs []error
+	for _, k := range undecoded {
+		key, suggestion := unknownPart(reflect.TypeOf(v).Elem(), k)
+		if reported[key.String()] {
+			continue
+		}
+		reported[key.String()] = true
+		msg := fmt.Sprintf("%s:%d: unknown key %s", label, keyLine(lines, k), key)
+		if suggestion != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", suggestion)
+		}
+		errs = append(errs, errors.New(msg))
+	}
+	return errors.Join(errs...)
+}
+
+// keyLine returns the line where key, or failing that the longest prefix of
+// it, is defined, or 0 if none is found.
+func keyLine(lines map[string]int, key toml.Key) int {
+	for n := len(key); n > 0; n-- {
+		if line, ok := lines[key[:n].String()]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+var (
+	keyPart    = `(?:[A-Za-z0-9_-]+|"(?:[^"\\]|\\.)*"|'[^']*')`
+	dottedKey  = keyPart + `(?:\s*\.\s*` + keyPart + `)*`
+	headerLine = regexp.MustCompile(`^\[\[?\s*(` + dottedKey + `)\s*\]\]?`)
+	keyValue   = regexp.MustCompile(`^(` + dottedKey + `)\s*=`)
+	keyParts   = regexp.MustCompile(keyPart)
+)
+
+// keyLines maps the keys defined by table headers and key/value lines of
+// a TOML document to the line they first appear on. Keys inside inline
+// tables are not listed; keyLine falls back to the line of their table.
+func keyLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	var table toml.Key
+	inString := false
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Count(line, `"""`)%2 == 1 || strings.Count(line, `'''`)%2 == 1 {
+			inString = !inString
+			if !inString {
+				continue // the end of a multi-line string
+			}
+		} else if inString {
+			continue
+		}
+		if m := headerLine.FindStringSubmatch(line); m != nil {
+			table = splitKey(m[1])
+			if _, ok := lines[table.String()]; !ok {
+				lines[table.String()] = i + 1
+			}
+			continue
+		}
+		if m := keyValue.FindStringSubmatch(line); m != nil {
+			key := append(append(toml.Key{}, table...), splitKey(m[1])...)
+			if _, ok := lines[key.String()]; !ok {
+				lines[key.String()] = i + 1
+			}
+		}
+	}
+	return lines
+}
+
+// splitKey splits a dotted TOML key into its unquoted parts.
+func splitKey(s string) toml.Key {
+	var key toml.Key
+	for _, part := range keyParts.FindAllString(s, -1) {
+		switch part[0] {
+		case '"':
+			if u, err := strconv.Unquote(part); err == nil {
+				part = u
+			}
+		case '\'':
+			part = part[1 : len(part)-1]
+		}
+		key = append(key, part)
+	}
+	return key
+}
+
+// unknownPart shortens key to its first part that type t does not know,
+// and suggests the known key closest to that part, if one is close enough
+// to be a typo.
+func unknownPart(t reflect.Type, key toml.Key) (toml.Key, string) {
+	for i, part := range key {
+		next := keyType(t, part)
+		if next != nil {
+			t = next
+			continue
+		}
+		best, bestDist := "", 3
+		if t.Kind() == reflect.Struct {
+			for _, f := range tomlFields(t) {
+				if d := editDistance(strings.ToLower(part), f.name); d < bestDist {
+					best, bestDist = f.name, d
+				}
+			}
+		}
+		return key[:i+1], best
+	}
+	return key, ""
+}
+
+// keyType returns the type of the value at key in a value of type t, or
+// nil if t has no such key.
+func keyType(t reflect.Type, key string) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem()
+	case reflect.Struct:
+		for _, f := range tomlFields(t) {
+			if f.name == key {
+				return f.Type
+			}
+		}
+	}
+	return nil
+}
+
+// tomlField is a struct field with the key it is decoded from.
+type tomlField struct {
+	name string
+	reflect.StructField
+}
+
+// tomlFields returns the fields of struct type t that TOML keys decode
+// into, including those of embedded structs, in declaration order. Their
+// Index is relative to t.
+func tomlFields(t reflect.Type) []tomlField {
+	var fields []tomlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, sub := range tomlFields(f.Type) {
+				sub.Index = append([]int{i}, sub.Index...)
+				fields = append(fields, sub)
+			}
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, tomlField{name: name, StructField: f})
+	}
+	return fields
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		FileName: `include = ["extra.toml"]
+
+[services.web]
+command = "npm run dev"
+port_ranges = { min = 3100, max = 3199 }
+proxyport = 3000
+proxy = { cors = true, xforwarded = true }
+
+[servics.api]
+command = "x"
+
+[worktrees."feature/x".services.web]
+comand = """
+multi
+line"""
+
+[profiles.ci]
+services.web.envfile = [".env.ci"]
+`,
+		"extra.toml": "[env]\nA = \"1\"\n\n[tls]\nlocalca = true\n",
+	})
+	_, err := Load(dir)
+	if err == nil {
+		t.Fatal("Load() accepted unknown keys")
+	}
+	want := []string{
+		".portree.toml:5: unknown key services.web.port_ranges (did you mean port_range?)",
+		".portree.toml:6: unknown key services.web.proxyport (did you mean proxy_port?)",
+		".portree.toml:7: unknown key services.web.proxy.xforwarded (did you mean x_forwarded?)",
+		".portree.toml:9: unknown key servics (did you mean services?)",
+		`.portree.toml:13: unknown key worktrees."feature/x".services.web.comand (did you mean command?)`,
+		".portree.toml:18: unknown key profiles.ci.services.web.envfile (did you mean env_file?)",
+	}
+	if got := strings.Split(err.Error(), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Load() error =\n%v\nwant\n%s", err, strings.Join(want, "\n"))
+	}
+
+	writeFiles(t, dir, map[string]string{FileName: "include = [\"extra.toml\"]\n\n[services.web]\ncommand = \"x\"\n"})
+	if _, err := Load(dir); err == nil || err.Error() != "extra.toml:5: unknown key tls.localca (did you mean local_ca?)" {
+		t.Errorf("Load() error = %v, want the unknown key of the included file", err)
+	}
+}
@@ -0,0 +1,417 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LocalFileName is a personal, git-ignored file that is deep-merged over
+// FileName.
+const LocalFileName = ".portree.local.toml"
+
+// ProfileEnv names the environment variable that selects a profile when
+// none is given explicitly.
+const ProfileEnv = "PORTREE_PROFILE"
+
+// Load reads the configuration of the repository at repoRoot, applying the
+// profile named by $PORTREE_PROFILE, if any. See LoadProfile.
+func Load(repoRoot string) (*Config, error) {
+	return LoadProfile(repoRoot, os.Getenv(ProfileEnv))
+}
+
+// LoadProfile reads the configuration of the repository at repoRoot.
+//
+// The result is built in layers, each deep-merged over the previous one:
+// tables are merged key by key, while other values (including arrays)
+// replace what was there.
+//
+//  1. The user config file (see UserConfigPath), if it exists.
+//  2. .portree.toml. Files listed in its include array (glob patterns
+//     relative to the including file) are merged first, in order, so the
+//     including file has the last word.
+//  3. .portree.local.toml, if it exists, with its own includes.
+//  4. The [profiles.<profile>] table, if profile is not empty.
+//
+// Finally, the [defaults.service] table is merged under every service.
+//
+// Config.Sources records which file each value came from.
+func LoadProfile(repoRoot, profile string) (*Config, error) {
+	path := filepath.Join(repoRoot, FileName)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s not found in %s; run 'portree init' first", FileName, repoRoot)
+		}
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	l := &loader{root: repoRoot, sources: map[string]string{}, loading: map[string]bool{}}
+	tree := map[string]any{}
+	if user, err := UserConfigPath(); err == nil {
+		if _, err := os.Stat(user); err == nil {
+			if err := l.mergeUserFile(tree, user); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := l.mergeFile(tree, path); err != nil {
+		return nil, err
+	}
+	local := filepath.Join(repoRoot, LocalFileName)
+	if _, err := os.Stat(local); err == nil {
+		if err := l.mergeFile(tree, local); err != nil {
+			return nil, err
+		}
+	}
+
+	profiles, _ := tree["profiles"].(map[string]any)
+	delete(tree, "profiles")
+	if profile != "" {
+		p, ok := profiles[profile].(map[string]any)
+		if !ok {
+			return nil, unknownProfile(profile, profiles)
+		}
+		prefix := joinKey("profiles", profile) + "."
+		l.merge(tree, p, "", func(key string) string {
+			return l.sources[prefix+key] + " [profile " + profile + "]"
+		})
+	}
+	for key := range l.sources {
+		if key == "profiles" || strings.HasPrefix(key, "profiles.") {
+			delete(l.sources, key)
+		}
+	}
+	l.applyDefaults(tree)
+
+	// Round-trip the merged tree through TOML to decode it into Config.
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(tree); err != nil {
+		return nil, fmt.Errorf("merging config: %w", err)
+	}
+	var cfg Config
+	if _, err := toml.Decode(buf.String(), &cfg); err != nil {
+		return nil, fmt.Errorf("merging config: %w", err)
+	}
+	cfg.Profile = profile
+	cfg.Files = l.files
+	cfg.IncludeDirs = l.dirs
+	cfg.Sources = l.sources
+	cfg.worktreeOrder = append(l.worktrees, l.profileWorktrees[profile]...)
+
+	if cfg.Services == nil {
+		cfg.Services = map[string]ServiceConfig{}
+	}
+	if cfg.Env == nil {
+		cfg.Env = map[string]string{}
+	}
+	if cfg.Worktrees == nil {
+		cfg.Worktrees = map[string]WTOverride{}
+	}
+
+	cfg.compileBranchPatterns()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Source returns the file that set key, a dotted path such as
+// "services.web.command" or `worktrees."feature/auth".services.web.env.DEBUG`.
+// Values from a profile are labelled "<file> [profile <name>]". It returns
+// "" for keys that no file set.
+func (c *Config) Source(key string) string {
+	for {
+		if s, ok := c.Sources[key]; ok {
+			return s
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return ""
+		}
+		key = key[:i]
+	}
+}
+
+// ProfileNames returns the profiles defined in the repository at repoRoot,
+// sorted.
+func ProfileNames(repoRoot string) ([]string, error) {
+	l := &loader{root: repoRoot, sources: map[string]string{}, loading: map[string]bool{}}
+	tree := map[string]any{}
+	for _, name := range []string{FileName, LocalFileName} {
+		path := filepath.Join(repoRoot, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := l.mergeFile(tree, path); err != nil {
+			return nil, err
+		}
+	}
+	profiles, _ := tree["profiles"].(map[string]any)
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func unknownProfile(name string, profiles map[string]any) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("profile %q not found: no [profiles] defined", name)
+	}
+	names := make([]string, 0, len(profiles))
+	for n := range profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(names, ", "))
+}
+
+// WatchPaths returns the files whose changes should reload cfg: the main,
+// local and user config files, whether or not they exist yet, every
+// included file, and the directories searched by glob includes, so that
+// files added to or removed from them are noticed.
+func WatchPaths(repoRoot string, cfg *Config) []string {
+	paths := Paths(repoRoot)
+	seen := map[string]bool{}
+	for _, p := range paths {
+		seen[p] = true
+	}
+	if cfg != nil {
+		for _, p := range slices.Concat(cfg.Files, cfg.IncludeDirs) {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
+
+// loader merges config files into a generic TOML tree.
+type loader struct {
+	root    string
+	files   []string          // files read, in merge order
+	dirs    []string          // directories searched by glob includes
+	sources map[string]string // dotted key -> file label
+	loading map[string]bool   // files being merged, to detect include cycles
+
+	// [worktrees] keys in the order they first appear, in merge order, and
+	// those of each profile.
+	worktrees        []string
+	profileWorktrees map[string][]string
+}
+
+// mergeFile merges the file at path, preceded by its includes, into dst.
+func (l *loader) mergeFile(dst map[string]any, path string) error {
+	label := l.label(path)
+	if l.loading[path] {
+		return fmt.Errorf("%s: include cycle", label)
+	}
+	l.loading[path] = true
+	defer delete(l.loading, path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", label, err)
+	}
+	var tree map[string]any
+	md, err := toml.Decode(string(data), &tree)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", label, err)
+	}
+	if err := checkKeys(label, data, &fileConfig{}); err != nil {
+		return err
+	}
+
+	includes, err := includePatterns(tree["include"])
+	if err != nil {
+		return fmt.Errorf("%s: %w", label, err)
+	}
+	delete(tree, "include")
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: include %q: %w", label, pattern, err)
+		}
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			return fmt.Errorf("%s: include %q: file not found", label, l.label(pattern))
+		}
+		if hasGlobMeta(pattern) {
+			l.addGlobDirs(pattern, matches)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if err := l.mergeFile(dst, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	l.files = append(l.files, path)
+	l.merge(dst, tree, "", func(string) string { return label })
+	l.recordWorktrees(md.Keys())
+	return nil
+}
+
+// addGlobDirs records the directories in which files matching pattern may
+// appear: the deepest directory of pattern without glob metacharacters and
+// the directories of its current matches.
+func (l *loader) addGlobDirs(pattern string, matches []string) {
+	dir := filepath.Dir(pattern)
+	for hasGlobMeta(dir) {
+		dir = filepath.Dir(dir)
+	}
+	dirs := []string{dir}
+	for _, m := range matches {
+		dirs = append(dirs, filepath.Dir(m))
+	}
+	for _, d := range dirs {
+		if !slices.Contains(l.dirs, d) {
+			l.dirs = append(l.dirs, d)
+		}
+	}
+}
+
+// mergeUserFile merges the user config file at path into dst. It may only
+// hold the keys of userFileConfig, and cannot include other files.
+func (l *loader) mergeUserFile(dst map[string]any, path string) error {
+	label := l.label(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", label, err)
+	}
+	var tree map[string]any
+	if _, err := toml.Decode(string(data), &tree); err != nil {
+		return fmt.Errorf("parsing %s: %w", label, err)
+	}
+	if err := checkKeys(label, data, &userFileConfig{}); err != nil {
+		return err
+	}
+	l.files = append(l.files, path)
+	l.merge(dst, tree, "", func(string) string { return label })
+	return nil
+}
+
+// recordWorktrees notes the order of the [worktrees] keys among keys, which
+// precedence between patterns depends on.
+func (l *loader) recordWorktrees(keys []toml.Key) {
+	for _, k := range keys {
+		switch {
+		case len(k) >= 2 && k[0] == "worktrees":
+			l.worktrees = appendNew(l.worktrees, k[1])
+		case len(k) >= 4 && k[0] == "profiles" && k[2] == "worktrees":
+			if l.profileWorktrees == nil {
+				l.profileWorktrees = map[string][]string{}
+			}
+			l.profileWorktrees[k[1]] = appendNew(l.profileWorktrees[k[1]], k[3])
+		}
+	}
+}
+
+func appendNew(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// merge deep-merges src into dst, recording the origin of every value set.
+func (l *loader) merge(dst, src map[string]any, prefix string, origin func(key string) string) {
+	for k, v := range src {
+		key := joinKey(prefix, k)
+		if table, ok := v.(map[string]any); ok {
+			sub, ok := dst[k].(map[string]any)
+			if !ok {
+				l.forget(key)
+				sub = map[string]any{}
+				dst[k] = sub
+			}
+			l.merge(sub, table, key, origin)
+			continue
+		}
+		l.forget(key)
+		dst[k] = v
+		l.sources[key] = origin(key)
+	}
+}
+
+// forget drops the recorded origins of key and everything below it.
+func (l *loader) forget(key string) {
+	for k := range l.sources {
+		if k == key || strings.HasPrefix(k, key+".") {
+			delete(l.sources, k)
+		}
+	}
+}
+
+// label names path for messages and Sources; see displayPath.
+func (l *loader) label(path string) string {
+	return displayPath(l.root, path)
+}
+
+// displayPath shortens path for display: relative to the repository root
+// when it is inside it, or to the home directory as "~/...".
+func displayPath(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return "~/" + filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
+
+func includePatterns(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		patterns := make([]string, 0, len(v))
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("include must be a list of strings")
+			}
+			patterns = append(patterns, s)
+		}
+		return patterns, nil
+	}
+	return nil, fmt.Errorf("include must be a list of strings")
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// joinKey appends k to the dotted key prefix, quoting it as TOML does when
+// it is not a bare key.
+func joinKey(prefix, k string) string {
+	if !bareKey.MatchString(k) {
+		k = strconv.Quote(k)
+	}
+	if prefix == "" {
+		return k
+	}
+	return prefix + "." + k
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const layeredMain = `
+include = ["services/*.toml"]
+
+[services.web]
+command = "npm run dev"
+port_range = { min = 3100, max = 3199 }
+proxy_port = 3000
+
+[env]
+NODE_ENV = "development"
+LOG_LEVEL = "info"
+
+[profiles.e2e.services.web]
+command = "npm run preview"
+
+[profiles.e2e.env]
+CI = "1"
+`
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		FileName: layeredMain,
+		"services/api.toml": `
+[services.api]
+command = "go run ./cmd/api"
+port_range = { min = 8100, max = 8199 }
+proxy_port = 8000
+`,
+		"services/worker.toml": `
+[services.worker]
+command = "go run ./cmd/worker"
+port_range = { min = 9100, max = 9199 }
+proxy_port = 9000
+
+[env]
+LOG_LEVEL = "debug" # overridden by the including file
+`,
+		LocalFileName: `
+[services.web]
+command = "pnpm dev"
+port_range = { max = 3150 }
+
+[worktrees."feature/x".services.api]
+env = { DEBUG = "1" }
+`,
+	})
+
+	cfg, err := LoadProfile(dir, "")
+	if err != nil {
+		t.Fatalf("LoadProfile() error: %v", err)
+	}
+
+	if len(cfg.Services) != 3 {
+		t.Errorf("services = %v, want web, api and worker", cfg.Services)
+	}
+	web := cfg.Services["web"]
+	if web.Command != "pnpm dev" || web.PortRange != (PortRange{Min: 3100, Max: 3150}) || web.ProxyPort != 3000 {
+		t.Errorf("web = %+v, want the local command and max port merged over the main file", web)
+	}
+	if cfg.Env["LOG_LEVEL"] != "info" {
+		t.Errorf("LOG_LEVEL = %q, the including file should win over its includes", cfg.Env["LOG_LEVEL"])
+	}
+	if cfg.Worktrees["feature/x"].Services["api"].Env["DEBUG"] != "1" {
+		t.Errorf("worktrees = %+v", cfg.Worktrees)
+	}
+
+	wantFiles := []string{
+		filepath.Join(dir, "services", "api.toml"),
+		filepath.Join(dir, "services", "worker.toml"),
+		filepath.Join(dir, FileName),
+		filepath.Join(dir, LocalFileName),
+	}
+	if !reflect.DeepEqual(cfg.Files, wantFiles) {
+		t.Errorf("Files = %v, want %v", cfg.Files, wantFiles)
+	}
+	if want := []string{filepath.Join(dir, "services")}; !reflect.DeepEqual(cfg.IncludeDirs, want) {
+		t.Errorf("IncludeDirs = %v, want %v", cfg.IncludeDirs, want)
+	}
+
+	for key, want := range map[string]string{
+		"services.web.command":                           LocalFileName,
+		"services.web.port_range.min":                    FileName,
+		"services.web.port_range.max":                    LocalFileName,
+		"services.api.proxy_port":                        "services/api.toml",
+		"env.LOG_LEVEL":                                  FileName,
+		`worktrees."feature/x".services.api.env.DEBUG`:   LocalFileName,
+		`worktrees."feature/x".services.api.env.DEBUG.x`: LocalFileName, // falls back to the parent
+		"env.MISSING":                                    "",
+	} {
+		if got := cfg.Source(key); got != want {
+			t.Errorf("Source(%s) = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := cfg.Sources["profiles.e2e.env.CI"]; ok {
+		t.Error("profile values should not be reported unless the profile is selected")
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		FileName: strings.Replace(layeredMain, `include = ["services/*.toml"]`, "", 1),
+		LocalFileName: `
+[profiles.mine.env]
+EDITOR = "vim"
+`,
+	})
+
+	cfg, err := LoadProfile(dir, "e2e")
+	if err != nil {
+		t.Fatalf("LoadProfile(e2e) error: %v", err)
+	}
+	if cfg.Profile != "e2e" || cfg.Services["web"].Command != "npm run preview" || cfg.Env["CI"] != "1" {
+		t.Errorf("profile not applied: profile=%q web=%+v env=%v", cfg.Profile, cfg.Services["web"], cfg.Env)
+	}
+	if got := cfg.Source("services.web.command"); got != FileName+" [profile e2e]" {
+		t.Errorf("Source(services.web.command) = %q", got)
+	}
+
+	// Profiles can be defined in the local file too.
+	cfg, err = LoadProfile(dir, "mine")
+	if err != nil || cfg.Env["EDITOR"] != "vim" || cfg.Source("env.EDITOR") != LocalFileName+" [profile mine]" {
+		t.Errorf("LoadProfile(mine) = %v, %v", cfg, err)
+	}
+
+	t.Setenv(ProfileEnv, "e2e")
+	if cfg, err := Load(dir); err != nil || cfg.Profile != "e2e" {
+		t.Errorf("Load() with %s = %v, %v", ProfileEnv, cfg, err)
+	}
+
+	_, err = LoadProfile(dir, "nope")
+	if err == nil || !strings.Contains(err.Error(), "available: e2e, mine") {
+		t.Errorf("LoadProfile(nope) error = %v", err)
+	}
+
+	names, err := ProfileNames(dir)
+	if err != nil || !reflect.DeepEqual(names, []string{"e2e", "mine"}) {
+		t.Errorf("ProfileNames() = %v, %v", names, err)
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "missing file",
+			files: map[string]string{FileName: `include = ["extra.toml"]`},
+			want:  `include "extra.toml": file not found`,
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				FileName: `include = ["a.toml"]`,
+				"a.toml": `include = ["b.toml"]`,
+				"b.toml": `include = ["a.toml"]`,
+			},
+			want: "a.toml: include cycle",
+		},
+		{
+			name:  "not strings",
+			files: map[string]string{FileName: `include = [1]`},
+			want:  "include must be a list of strings",
+		},
+		{
+			name: "invalid included file",
+			files: map[string]string{
+				FileName:   `include = ["bad.toml"]`,
+				"bad.toml": "{{",
+			},
+			want: "parsing bad.toml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			_, err := Load(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchPaths(t *testing.T) {
+	cfg := &Config{
+		Files:       []string{"/repo/services/api.toml", "/repo/" + FileName},
+		IncludeDirs: []string{"/repo/services"},
+	}
+	got := WatchPaths("/repo", cfg)
+	want := []string{"/repo/" + FileName, "/repo/" + LocalFileName,
+		filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "portree", "config.toml"), "/repo/services/api.toml",
+		"/repo/services"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WatchPaths() = %v, want %v", got, want)
+	}
+}
+
+func TestWatchPathsNoticesNewIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		FileName: `include = ["services/*.toml"]`,
+		"services/api.toml": `
+[services.api]
+command = "go run ./cmd/api"
+port_range = { min = 8100, max = 8199 }
+proxy_port = 8000
+`,
+	})
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(time.Second, WatchPaths(dir, cfg)...)
+
+	writeFiles(t, dir, map[string]string{"services/web.toml": "[env]\nB = \"1\"\n"})
+	if !w.Changed() {
+		t.Error("a new file matching a glob include was not noticed")
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// SchemaID is where the JSON Schema of the config file is published.
+const SchemaID = "https://raw.githubusercontent.com/fairy-pitta/portree/main/schema/portree.schema.json"
+
+// schemaDocs describes the config keys in the JSON Schema, by type and key.
+var schemaDocs = map[string]string{
+	"fileConfig.include":  "Config files to merge before this one: glob patterns relative to this file.",
+	"fileConfig.profiles": "Named sets of overrides, applied with --profile <name> or PORTREE_PROFILE=<name>.",
+
+	"Config.services":  "Services to run in every worktree.",
+	"Config.env":       "Environment variables for all services.",
+	"Config.env_file":  "Dotenv files for all services, relative to the worktree root. Missing files are skipped.",
+	"Config.worktrees": `Overrides for the worktrees of matching branches. Keys are branch names, globs such as "release/*" or regular expressions prefixed with "~".`,
+	"Config.tls":       "Certificates used by 'portree proxy start --https'.",
+	"Config.defaults":  "Templates that apply to every service.",
+
+	"Config.https":         "Serve HTTPS from 'portree proxy start' without --https.",
+	"Config.editor":        `Command the dashboard opens worktrees with, such as "code" or "nvim". Defaults to $VISUAL or $EDITOR.`,
+	"Config.browser":       `Command URLs are opened with, such as "firefox" or "open -a Safari". Defaults to the system browser.`,
+	"Config.log_retention": `Make 'portree up' remove logs not written to for this long, such as "7d" or "12h".`,
+	"Config.theme":         "Dashboard color theme.",
+
+	"Defaults.service": "Settings every service inherits unless it sets them itself. Tables are merged key by key.",
+
+	"ServiceConfig.command":         "Shell command that starts the service. It should listen on $PORT.",
+	"ServiceConfig.dir":             "Working directory, relative to the worktree root.",
+	"ServiceConfig.env":             "Environment variables for this service.",
+	"ServiceConfig.env_file":        "Dotenv files for this service, relative to dir in the worktree.",
+	"ServiceConfig.port_range":      "Range the service's port is allocated from in each worktree.",
+	"ServiceConfig.proxy_port":      "Port the reverse proxy listens on for this service; omit it for services the proxy does not reach.",
+	"ServiceConfig.extra_ports":     "Further ports the service needs in each worktree, such as for HMR or a debugger, keyed by name. Each is allocated from its range and injected as PT_<SERVICE>_<NAME>_PORT.",
+	"ServiceConfig.depends_on":      "Services started before this one.",
+	"ServiceConfig.backend_tls":     "Serve HTTPS with a certificate from the portree CA; the proxy connects over TLS.",
+	"ServiceConfig.enabled":         "Set to false to run the service only where a worktree override enables it.",
+	"ServiceConfig.only_branches":   "Run the service only in worktrees whose branch matches one of these patterns.",
+	"ServiceConfig.except_branches": "Never run the service in worktrees whose branch matches one of these patterns.",
+	"ServiceConfig.proxy":           "How the reverse proxy forwards requests to the service.",
+
+	"ProxyOptions.request_headers":         "Headers to set on requests to the service. Values may use {slug}, {branch}, {service}, {host} and {port}.",
+	"ProxyOptions.remove_request_headers":  "Headers to remove from requests to the service.",
+	"ProxyOptions.response_headers":        "Headers to set on responses. Values may use {slug}, {branch}, {service}, {host} and {port}.",
+	"ProxyOptions.remove_response_headers": "Headers to remove from responses.",
+	"ProxyOptions.x_forwarded":             "Add X-Forwarded-Proto, X-Forwarded-For and X-Forwarded-Port.",
+	"ProxyOptions.rewrite_location":        "Rewrite redirects to the service's own address to the proxied host.",
+	"ProxyOptions.rewrite_cookie_domain":   "Set the Domain of cookies from the service to the proxied host.",
+	"ProxyOptions.cors":                    "Answer preflights and add CORS headers for other services of the same worktree.",
+
+	"PortRange.min": "Lowest port.",
+	"PortRange.max": "Highest port.",
+
+	"WTOverride.services": "Per-service overrides.",
+
+	"WTServiceOverride.command":  "Command to run instead of the service's.",
+	"WTServiceOverride.port":     "Fixed port, within the service's port_range. Only under an exact branch name.",
+	"WTServiceOverride.env":      "Environment variables merged over the service's.",
+	"WTServiceOverride.env_file": "Dotenv files loaded after the service's, relative to its dir.",
+	"WTServiceOverride.enabled":  "Whether the service runs in these worktrees.",
+
+	"TLSConfig.local_ca": "Keep a CA for this repository in .portree/certs instead of the user-level CA.",
+}
+
+// portKeys are the integer keys that hold TCP ports.
+var portKeys = map[string]bool{
+	"ServiceConfig.proxy_port": true,
+	"PortRange.min":            true,
+	"PortRange.max":            true,
+	"WTServiceOverride.port":   true,
+}
+
+// Schema returns a JSON Schema (draft-07) for the config files, generated
+// from the Config types, for editors such as those based on taplo.
+func Schema() ([]byte, error) {
+	defs := map[string]any{}
+	root := objectSchema(reflect.TypeOf(fileConfig{}), defs)
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["$id"] = SchemaID
+	root["title"] = "portree configuration (.portree.toml)"
+	root["definitions"] = defs
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// objectSchema describes struct type t, whose other struct types are added
+// to defs.
+func objectSchema(t reflect.Type, defs map[string]any) map[string]any {
+	props := map[string]any{}
+	for _, f := range tomlFields(t) {
+		s := typeSchema(f.Type, defs)
+		key := t.Name() + "." + f.name
+		switch {
+		case key == "fileConfig.include":
+			s = map[string]any{"oneOf": []any{
+				map[string]any{"type": "string"},
+				map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			}}
+		case portKeys[key]:
+			s["minimum"], s["maximum"] = 1, 65535
+		case key == "Config.theme":
+			s["enum"] = themes
+		}
+		if doc, ok := schemaDocs[key]; ok {
+			s["description"] = doc
+		}
+		props[f.name] = s
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema describes a value of type t.
+func typeSchema(t reflect.Type, defs map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // placeholder for recursive types
+			defs[t.Name()] = objectSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/definitions/" + t.Name()}
+	}
+	return map[string]any{}
+}
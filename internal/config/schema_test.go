@@ -0,0 +1,60 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaFileUpToDate(t *testing.T) {
+	want, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join("..", "..", "schema", "portree.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("schema/portree.schema.json is out of date; run 'make schema'")
+	}
+}
+
+func TestSchemaCoversConfig(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties  map[string]any `json:"properties"`
+		Definitions map[string]struct {
+			Properties map[string]struct {
+				Description string `json:"description"`
+			} `json:"properties"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"include", "profiles", "services", "env", "env_file", "worktrees", "tls"} {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("schema has no top-level %q", key)
+		}
+	}
+	for _, typ := range []any{ServiceConfig{}, ProxyOptions{}, PortRange{}, WTOverride{}, WTServiceOverride{}, TLSConfig{}} {
+		rt := reflect.TypeOf(typ)
+		def, ok := schema.Definitions[rt.Name()]
+		if !ok {
+			t.Errorf("schema has no definition of %s", rt.Name())
+			continue
+		}
+		for _, f := range tomlFields(rt) {
+			if def.Properties[f.name].Description == "" {
+				t.Errorf("schema: %s.%s has no description", rt.Name(), f.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ResolvedService is a service as it applies to the worktree of a branch.
+type ResolvedService struct {
+	ServiceConfig
+	Port int `toml:"port"` // fixed port, 0 if allocated from PortRange
+}
+
+// Resolve returns the services as they apply to the worktree of branch,
+// with the matching [worktrees] overrides applied: the strongest command,
+// the env and env_file entries merged in order, the fixed port, and whether
+// the service is enabled. ${...} references are left unexpanded, and env
+// files are not read; 'portree env --explain' shows the final environment.
+func (c *Config) Resolve(branch string) map[string]ResolvedService {
+	resolved := make(map[string]ResolvedService, len(c.Services))
+	for name, svc := range c.Services {
+		r := ResolvedService{ServiceConfig: svc, Port: c.FixedPortForBranch(name, branch)}
+		r.Env = make(map[string]string, len(svc.Env))
+		for k, v := range svc.Env {
+			r.Env[k] = v
+		}
+		r.EnvFile = append([]string(nil), svc.EnvFile...)
+		for _, o := range c.serviceOverrides(name, branch) {
+			if o.Command != "" {
+				r.Command = o.Command
+			}
+			for k, v := range o.Env {
+				r.Env[k] = v
+			}
+			r.EnvFile = append(r.EnvFile, o.EnvFile...)
+		}
+		enabled := c.ServiceEnabled(name, branch)
+		r.Enabled = &enabled
+		r.OnlyBranches, r.ExceptBranches = nil, nil
+		resolved[name] = r
+	}
+	return resolved
+}
+
+// Encode writes the merged configuration as TOML, leaving out unset keys.
+func (c *Config) Encode(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# Merged from %s\n", c.fileList()); err != nil {
+		return err
+	}
+	return encodeTOML(w, tomlTree(reflect.ValueOf(*c)))
+}
+
+// EncodeResolved writes the configuration that applies to the worktree of
+// branch as TOML: the top-level settings and the services as returned by
+// Resolve.
+func (c *Config) EncodeResolved(w io.Writer, branch string) error {
+	keys := c.WorktreeKeys(branch)
+	for i, k := range keys {
+		keys[i] = joinKey("", k)
+	}
+	if len(keys) == 0 {
+		keys = []string{"none"}
+	}
+	if _, err := fmt.Fprintf(w, "# Resolved for branch %s from %s\n# [worktrees] keys applied: %s\n",
+		branch, c.fileList(), strings.Join(keys, ", ")); err != nil {
+		return err
+	}
+	top := *c
+	top.Services, top.Worktrees = nil, nil
+	tree, _ := tomlTree(reflect.ValueOf(top)).(map[string]any)
+	if tree == nil {
+		tree = map[string]any{}
+	}
+	if services, ok := tomlTree(reflect.ValueOf(c.Resolve(branch))).(map[string]any); ok {
+		tree["services"] = services
+	}
+	return encodeTOML(w, tree)
+}
+
+func encodeTOML(w io.Writer, v any) error {
+	enc := toml.NewEncoder(w)
+	enc.Indent = ""
+	return enc.Encode(v)
+}
+
+func (c *Config) fileList() string {
+	if len(c.Files) == 0 {
+		return FileName
+	}
+	list := strings.Join(c.FileLabels(), ", ")
+	if c.Profile != "" {
+		list += " with profile " + c.Profile
+	}
+	return list
+}
+
+// FileLabels returns Files for display: relative to the repository root,
+// or to the home directory for files such as the user config.
+func (c *Config) FileLabels() []string {
+	// The main config file is merged last among its includes; its
+	// directory is the repository root.
+	root := ""
+	for _, f := range c.Files {
+		if filepath.Base(f) == FileName {
+			root = filepath.Dir(f)
+			break
+		}
+	}
+	files := make([]string, len(c.Files))
+	for i, f := range c.Files {
+		files[i] = displayPath(root, f)
+	}
+	return files
+}
+
+// tomlTree converts v into the values the TOML encoder writes, keyed like
+// the config file, leaving out zero values. It returns nil for a value that
+// is left out entirely.
+func tomlTree(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if k := v.Elem().Kind(); k != reflect.Struct && k != reflect.Map && k != reflect.Slice {
+			return v.Elem().Interface() // set explicitly, even if false
+		}
+		return tomlTree(v.Elem())
+	case reflect.Struct:
+		m := map[string]any{}
+		for _, f := range tomlFields(v.Type()) {
+			if sub := tomlTree(v.FieldByIndex(f.Index)); sub != nil {
+				m[f.name] = sub
+			}
+		}
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	case reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+		m := map[string]any{}
+		iter := v.MapRange()
+		for iter.Next() {
+			sub := tomlTree(iter.Value())
+			if sub == nil {
+				sub = map[string]any{} // keep the key, e.g. a service with no settings
+			}
+			m[iter.Key().String()] = sub
+		}
+		return m
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return nil
+		}
+		return v.Interface()
+	}
+	if v.IsZero() {
+		return nil
+	}
+	return v.Interface()
+}
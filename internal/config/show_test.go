@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{FileName: patternConfig + `
+[services.api]
+command = "go run ."
+port_range = { min = 8100, max = 8199 }
+proxy_port = 8000
+env = { LEVEL = "service" }
+env_file = [".env"]
+except_branches = ["release/*"]
+
+[worktrees."release/2.0".services.api]
+env_file = [".env.release"]
+`})
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := cfg.Resolve("release/2.0")
+	web, api := resolved["web"], resolved["api"]
+	if web.Command != "npm run preview" || web.Port != 3150 || *web.Enabled != true {
+		t.Errorf("Resolve()[web] = %+v", web)
+	}
+	if web.Env["CHANNEL"] != "exact" || web.Env["LEVEL"] != "regex2" {
+		t.Errorf("Resolve()[web].Env = %v", web.Env)
+	}
+	if *api.Enabled || api.ExceptBranches != nil || strings.Join(api.EnvFile, ",") != ".env,.env.release" {
+		t.Errorf("Resolve()[api] = %+v", api)
+	}
+	if cfg.Services["api"].EnvFile[0] != ".env" || len(cfg.Services["api"].EnvFile) != 1 {
+		t.Errorf("Resolve() modified the config: %v", cfg.Services["api"].EnvFile)
+	}
+
+	var b strings.Builder
+	if err := cfg.EncodeResolved(&b, "release/2.0"); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# Resolved for branch release/2.0 from .portree.toml\n",
+		`# [worktrees] keys applied: "~^release/", "~^(hotfix|release)/", "release/*", "release/2.*", "release/2.0"`,
+		"[services.api]\ncommand = \"go run .\"\nenabled = false\nenv_file = [\".env\", \".env.release\"]\n",
+		"[services.web]\ncommand = \"npm run preview\"\nenabled = true\nport = 3150\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("EncodeResolved() output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\n[worktrees") {
+		t.Errorf("EncodeResolved() output contains [worktrees]:\n%s", out)
+	}
+
+	b.Reset()
+	if err := cfg.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "except_branches = [\"release/*\"]") || !strings.Contains(b.String(), `[worktrees."release/2.0".services.api]`) {
+		t.Errorf("Encode() output:\n%s", b.String())
+	}
+	if strings.Contains(b.String(), `dir = ""`) {
+		t.Errorf("Encode() wrote unset keys:\n%s", b.String())
+	}
+}
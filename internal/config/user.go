@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserConfigPath returns the user config file, merged under the config of
+// every repository: $XDG_CONFIG_HOME/portree/config.toml, or
+// ~/.config/portree/config.toml when XDG_CONFIG_HOME is not set.
+func UserConfigPath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "portree", "config.toml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("locating home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "portree", "config.toml"), nil
+}
+
+// userFileConfig is what the user config file may contain: preferences,
+// environment variables for all services of all repositories, and the
+// service template.
+type userFileConfig struct {
+	Preferences
+	Env      map[string]string `toml:"env"`
+	Defaults Defaults          `toml:"defaults"`
+}
+
+// themes are the accepted values of Preferences.Theme.
+var themes = []string{"auto", "dark", "light"}
+
+func (p Preferences) validate() error {
+	if _, err := p.LogRetentionDuration(); err != nil {
+		return err
+	}
+	if p.Theme != "" && !slices.Contains(themes, p.Theme) {
+		return fmt.Errorf("theme %q: must be one of %s", p.Theme, strings.Join(themes, ", "))
+	}
+	return nil
+}
+
+// LogRetentionDuration parses LogRetention, a Go duration such as "12h" or
+// a number of days such as "7d". It returns 0 when LogRetention is empty.
+func (p Preferences) LogRetentionDuration() (time.Duration, error) {
+	if p.LogRetention == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(p.LogRetention, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(p.LogRetention); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("log_retention %q: want a duration such as \"7d\" or \"12h\"", p.LogRetention)
+}
+
+// applyDefaults deep-merges the [defaults.service] table of tree under
+// every service: tables are merged key by key, and the keys a service sets,
+// arrays included, win over the template's.
+func (l *loader) applyDefaults(tree map[string]any) {
+	defaults, _ := tree["defaults"].(map[string]any)
+	template, _ := defaults["service"].(map[string]any)
+	services, _ := tree["services"].(map[string]any)
+	if len(template) == 0 {
+		return
+	}
+	for name, svc := range services {
+		if table, ok := svc.(map[string]any); ok {
+			l.inherit(table, template, joinKey("services", name), "defaults.service")
+		}
+	}
+}
+
+// inherit copies the values of src at key from that dst lacks into dst at
+// key, with their recorded origins.
+func (l *loader) inherit(dst, src map[string]any, key, from string) {
+	for k, v := range src {
+		if table, ok := v.(map[string]any); ok {
+			sub, exists := dst[k]
+			if !exists {
+				sub = map[string]any{}
+				dst[k] = sub
+			}
+			if sub, ok := sub.(map[string]any); ok {
+				l.inherit(sub, table, joinKey(key, k), joinKey(from, k))
+			}
+			continue
+		}
+		if _, ok := dst[k]; ok {
+			continue
+		}
+		dst[k] = v
+		l.sources[joinKey(key, k)] = l.sources[joinKey(from, k)] + " [defaults.service]"
+	}
+}
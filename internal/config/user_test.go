@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain points XDG_CONFIG_HOME at an empty directory, so that a user
+// config file on the machine running the tests is not loaded.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "portree-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setUserConfig writes content to the user config file of the test.
+func setUserConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	writeFiles(t, dir, map[string]string{"portree/config.toml": content})
+	return filepath.Join(dir, "portree", "config.toml")
+}
+
+func TestUserConfigPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got, _ := UserConfigPath(); got != "/xdg/portree/config.toml" {
+		t.Errorf("UserConfigPath() = %q", got)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/me")
+	if got, _ := UserConfigPath(); got != "/home/me/.config/portree/config.toml" {
+		t.Errorf("UserConfigPath() without XDG_CONFIG_HOME = %q", got)
+	}
+}
+
+func TestLoadUserConfig(t *testing.T) {
+	user := setUserConfig(t, `
+https = true
+editor = "code"
+theme = "light"
+
+[env]
+TZ = "UTC"
+LOG_LEVEL = "debug"
+`)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{FileName: layeredMain})
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.HTTPS || cfg.Editor != "code" || cfg.Theme != "light" {
+		t.Errorf("Preferences = %+v", cfg.Preferences)
+	}
+	if cfg.Env["TZ"] != "UTC" {
+		t.Errorf("Env[TZ] = %q, want the user config's", cfg.Env["TZ"])
+	}
+	if cfg.Env["LOG_LEVEL"] != "info" {
+		t.Errorf("Env[LOG_LEVEL] = %q, want the repository's", cfg.Env["LOG_LEVEL"])
+	}
+	if want := []string{user, filepath.Join(dir, FileName)}; !reflect.DeepEqual(cfg.Files, want) {
+		t.Errorf("Files = %v, want %v", cfg.Files, want)
+	}
+	if got := cfg.Source("env.TZ"); got != user {
+		t.Errorf("Source(env.TZ) = %q, want %q", got, user)
+	}
+}
+
+func TestLoadUserConfigRejectsRepoKeys(t *testing.T) {
+	setUserConfig(t, `
+[services.web]
+command = "npm start"
+`)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{FileName: layeredMain})
+
+	_, err := Load(dir)
+	if err == nil || !strings.Contains(err.Error(), "config.toml:2: unknown key services") {
+		t.Errorf("Load() error = %v, want the services key rejected", err)
+	}
+}
+
+func TestLoadDefaultsService(t *testing.T) {
+	setUserConfig(t, `
+[defaults.service]
+command = "make dev"
+env_file = [".env"]
+
+[defaults.service.env]
+TZ = "UTC"
+DEBUG = "0"
+
+[defaults.service.proxy]
+x_forwarded = true
+`)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{FileName: `
+[services.web]
+command = "npm run dev"
+port_range = { min = 3100, max = 3199 }
+proxy_port = 3000
+env = { DEBUG = "1" }
+
+[services.api]
+port_range = { min = 8100, max = 8199 }
+proxy_port = 8000
+env_file = [".env.api"]
+`})
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web, api := cfg.Services["web"], cfg.Services["api"]
+	if web.Command != "npm run dev" || api.Command != "make dev" {
+		t.Errorf("commands = %q, %q", web.Command, api.Command)
+	}
+	if want := map[string]string{"TZ": "UTC", "DEBUG": "1"}; !reflect.DeepEqual(web.Env, want) {
+		t.Errorf("web env = %v, want %v", web.Env, want)
+	}
+	if !reflect.DeepEqual(web.EnvFile, []string{".env"}) || !reflect.DeepEqual(api.EnvFile, []string{".env.api"}) {
+		t.Errorf("env_file = %v, %v", web.EnvFile, api.EnvFile)
+	}
+	if !web.Proxy.XForwarded || !api.Proxy.XForwarded {
+		t.Error("proxy.x_forwarded not inherited")
+	}
+	if got := cfg.Source("services.api.command"); !strings.HasSuffix(got, "config.toml [defaults.service]") {
+		t.Errorf("Source(services.api.command) = %q", got)
+	}
+	if got := cfg.Source("services.web.env.DEBUG"); got != FileName {
+		t.Errorf("Source(services.web.env.DEBUG) = %q, want %q", got, FileName)
+	}
+}
+
+func TestLogRetentionDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"week", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Preferences{LogRetention: tt.in}.LogRetentionDuration()
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("LogRetentionDuration(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestValidateTheme(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Theme = "solarized"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `theme "solarized"`) {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
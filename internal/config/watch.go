@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Paths returns the files that make up the configuration of the repository
+// at repoRoot, including the user config file. Changes to any of them should
+// trigger a reload.
+func Paths(repoRoot string) []string {
+	paths := []string{filepath.Join(repoRoot, FileName), filepath.Join(repoRoot, LocalFileName)}
+	if user, err := UserConfigPath(); err == nil {
+		paths = append(paths, user)
+	}
+	return paths
+}
+
+// fileStamp is what the Watcher compares between polls. Comparing size as
+// well as mtime catches quick successive writes on filesystems with coarse
+// timestamps.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func stat(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// Watcher polls a set of files for changes. Polling (rather than inotify or
+// kqueue) keeps it portable and copes with editors that save by renaming a
+// temporary file over the original.
+type Watcher struct {
+	interval time.Duration
+	paths    []string
+
+	mu     sync.Mutex
+	stamps []fileStamp
+}
+
+// NewWatcher returns a Watcher for paths, taking their current state as the
+// baseline.
+func NewWatcher(interval time.Duration, paths ...string) *Watcher {
+	w := &Watcher{interval: interval, paths: paths, stamps: make([]fileStamp, len(paths))}
+	for i, p := range paths {
+		w.stamps[i] = stat(p)
+	}
+	return w
+}
+
+// SetPaths replaces the watched files. Files that were already watched keep
+// their baseline; new ones start from their current state.
+func (w *Watcher) SetPaths(paths ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old := make(map[string]fileStamp, len(w.paths))
+	for i, p := range w.paths {
+		old[p] = w.stamps[i]
+	}
+	w.paths = paths
+	w.stamps = make([]fileStamp, len(paths))
+	for i, p := range paths {
+		if s, ok := old[p]; ok {
+			w.stamps[i] = s
+		} else {
+			w.stamps[i] = stat(p)
+		}
+	}
+}
+
+// Changed reports whether any watched file was created, modified or removed
+// since the previous call (or since NewWatcher).
+func (w *Watcher) Changed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed := false
+	for i, p := range w.paths {
+		if s := stat(p); s != w.stamps[i] {
+			w.stamps[i] = s
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Run calls onChange after each poll that detects a change, until ctx is
+// cancelled.
+func (w *Watcher) Run(ctx context.Context, onChange func()) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.Changed() {
+				onChange()
+			}
+		}
+	}
+}
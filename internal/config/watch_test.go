@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	w := NewWatcher(time.Second, path)
+
+	if w.Changed() {
+		t.Error("missing file should not count as a change")
+	}
+
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Changed() {
+		t.Error("creating the file should be a change")
+	}
+	if w.Changed() {
+		t.Error("Changed() should reset after reporting")
+	}
+
+	if err := os.WriteFile(path, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Changed() {
+		t.Error("rewriting the file should be a change")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Changed() {
+		t.Error("removing the file should be a change")
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	w := NewWatcher(10*time.Millisecond, path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go w.Run(ctx, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run() did not report the change")
+	}
+}
+
+func TestWatcherSetPaths(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.toml")
+	b := filepath.Join(dir, "b.toml")
+	if err := os.WriteFile(a, []byte("x = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher(time.Hour, a)
+	if err := os.WriteFile(a, []byte("x = 22"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a keeps its old baseline, so its change is still reported.
+	w.SetPaths(a, b)
+	if !w.Changed() {
+		t.Error("Changed() = false, want the pending change to a")
+	}
+	if err := os.WriteFile(b, []byte("y = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Changed() {
+		t.Error("Changed() = false after creating the newly watched b")
+	}
+	if w.Changed() {
+		t.Error("Changed() = true without further changes")
+	}
+}
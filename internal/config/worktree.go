@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of [worktrees] keys, in increasing order of precedence.
+const (
+	worktreeRegexp = iota // "~<regexp>", matched anywhere in the branch name
+	worktreeGlob          // a path.Match pattern such as "release/*"
+	worktreeExact         // a branch name
+)
+
+func worktreeKind(key string) int {
+	switch {
+	case strings.HasPrefix(key, "~"):
+		return worktreeRegexp
+	case strings.ContainsAny(key, "*?["):
+		return worktreeGlob
+	}
+	return worktreeExact
+}
+
+// validateBranchPattern checks that a glob or regexp branch pattern, as used
+// for [worktrees] keys, compiles.
+func validateBranchPattern(pattern string) error {
+	switch worktreeKind(pattern) {
+	case worktreeRegexp:
+		if _, err := regexp.Compile(pattern[1:]); err != nil {
+			return fmt.Errorf("%q: invalid regular expression: %w", pattern, err)
+		}
+	case worktreeGlob:
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%q: invalid pattern: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// compileBranchPatterns compiles the regular expressions among the
+// [worktrees] keys, only_branches and except_branches once, for
+// matchBranch. Invalid ones are left for Validate to report.
+func (c *Config) compileBranchPatterns() {
+	c.branchRegexps = map[string]*regexp.Regexp{}
+	add := func(patterns ...string) {
+		for _, p := range patterns {
+			if worktreeKind(p) != worktreeRegexp {
+				continue
+			}
+			if re, err := regexp.Compile(p[1:]); err == nil {
+				c.branchRegexps[p] = re
+			}
+		}
+	}
+	for k := range c.Worktrees {
+		add(k)
+	}
+	for _, svc := range c.Services {
+		add(svc.OnlyBranches...)
+		add(svc.ExceptBranches...)
+	}
+}
+
+// matchBranch reports whether branch matches a branch name, glob or
+// "~"-prefixed regular expression.
+func (c *Config) matchBranch(key, branch string) bool {
+	switch worktreeKind(key) {
+	case worktreeRegexp:
+		re, ok := c.branchRegexps[key]
+		if !ok {
+			// Not compiled by Load, as in configs built by hand.
+			var err error
+			if re, err = regexp.Compile(key[1:]); err != nil {
+				return false
+			}
+		}
+		return re.MatchString(branch)
+	case worktreeGlob:
+		ok, _ := path.Match(key, branch)
+		return ok
+	}
+	return key == branch
+}
+
+// WorktreeKeys returns the [worktrees] keys that apply to branch, in
+// increasing order of precedence: regular expressions, then globs, then the
+// exact branch name. Keys of the same kind apply in the order they first
+// appear in the config files, so later ones win.
+func (c *Config) WorktreeKeys(branch string) []string {
+	var keys []string
+	order := c.worktreeKeyOrder()
+	for kind := worktreeRegexp; kind <= worktreeExact; kind++ {
+		for _, k := range order {
+			if worktreeKind(k) == kind && c.matchBranch(k, branch) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+// worktreeKeyOrder returns the keys of c.Worktrees in the order they were
+// read, followed by any others (for configs not built by Load) sorted.
+func (c *Config) worktreeKeyOrder() []string {
+	keys := make([]string, 0, len(c.Worktrees))
+	seen := make(map[string]bool, len(c.Worktrees))
+	for _, k := range c.worktreeOrder {
+		if _, ok := c.Worktrees[k]; ok && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	var rest []string
+	for k := range c.Worktrees {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// serviceOverride is the [worktrees."<key>".services.<name>] table of one
+// matching key.
+type serviceOverride struct {
+	key string // dotted key of the table, for Sources
+	WTServiceOverride
+}
+
+// serviceOverrides returns the overrides of service that apply to branch,
+// in increasing order of precedence.
+func (c *Config) serviceOverrides(service, branch string) []serviceOverride {
+	var overrides []serviceOverride
+	for _, k := range c.WorktreeKeys(branch) {
+		if svc, ok := c.Worktrees[k].Services[service]; ok {
+			key := joinKey(joinKey(joinKey("worktrees", k), "services"), service)
+			overrides = append(overrides, serviceOverride{key: key, WTServiceOverride: svc})
+		}
+	}
+	return overrides
+}
+
+// ServiceEnabled reports whether service runs in the worktree of branch.
+// A service is enabled unless it sets enabled = false, has only_branches
+// that branch does not match, or has except_branches that it does; the
+// enabled setting of the strongest matching [worktrees] override, if any,
+// has the last word. Patterns are written like [worktrees] keys.
+func (c *Config) ServiceEnabled(service, branch string) bool {
+	svc, ok := c.Services[service]
+	if !ok {
+		return false
+	}
+	enabled := svc.Enabled == nil || *svc.Enabled
+	if len(svc.OnlyBranches) > 0 && !c.matchAnyBranch(svc.OnlyBranches, branch) {
+		enabled = false
+	}
+	if c.matchAnyBranch(svc.ExceptBranches, branch) {
+		enabled = false
+	}
+	for _, o := range c.serviceOverrides(service, branch) {
+		if o.Enabled != nil {
+			enabled = *o.Enabled
+		}
+	}
+	return enabled
+}
+
+func (c *Config) matchAnyBranch(patterns []string, branch string) bool {
+	for _, p := range patterns {
+		if c.matchBranch(p, branch) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const patternConfig = `
+[services.web]
+command = "npm run dev"
+port_range = { min = 3100, max = 3199 }
+proxy_port = 3000
+
+[worktrees."~^release/"]
+services.web = { command = "npm run build:regex", env = { CHANNEL = "regex", LEVEL = "regex" } }
+
+[worktrees."release/*"]
+services.web = { command = "npm run preview", env = { CHANNEL = "glob" } }
+
+[worktrees."release/2.*"]
+services.web = { env = { CHANNEL = "glob2" } }
+
+[worktrees."release/2.0"]
+services.web = { port = 3150, env = { CHANNEL = "exact" } }
+
+[worktrees."~^(hotfix|release)/"]
+services.web = { env = { LEVEL = "regex2" } }
+`
+
+func TestWorktreePatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{FileName: patternConfig})
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(cfg.branchRegexps) != 2 {
+		t.Errorf("Load() compiled %d regular expressions, want 2", len(cfg.branchRegexps))
+	}
+
+	tests := []struct {
+		branch  string
+		keys    []string
+		command string
+		port    int
+		env     map[string]string
+	}{
+		{
+			branch:  "release/2.0",
+			keys:    []string{"~^release/", "~^(hotfix|release)/", "release/*", "release/2.*", "release/2.0"},
+			command: "npm run preview",
+			port:    3150,
+			env:     map[string]string{"CHANNEL": "exact", "LEVEL": "regex2"},
+		},
+		{
+			branch:  "release/1.9",
+			keys:    []string{"~^release/", "~^(hotfix|release)/", "release/*"},
+			command: "npm run preview",
+			env:     map[string]string{"CHANNEL": "glob", "LEVEL": "regex2"},
+		},
+		{
+			branch:  "release/1.9/rc", // * does not match /
+			keys:    []string{"~^release/", "~^(hotfix|release)/"},
+			command: "npm run build:regex",
+			env:     map[string]string{"CHANNEL": "regex", "LEVEL": "regex2"},
+		},
+		{
+			branch:  "main",
+			command: "npm run dev",
+			env:     map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.branch, func(t *testing.T) {
+			if got := cfg.WorktreeKeys(tt.branch); !reflect.DeepEqual(got, tt.keys) {
+				t.Errorf("WorktreeKeys() = %q, want %q", got, tt.keys)
+			}
+			if got, _ := cfg.CommandForBranch("web", tt.branch, Vars{}); got != tt.command {
+				t.Errorf("CommandForBranch() = %q, want %q", got, tt.command)
+			}
+			if got := cfg.FixedPortForBranch("web", tt.branch); got != tt.port {
+				t.Errorf("FixedPortForBranch() = %d, want %d", got, tt.port)
+			}
+			if got, _ := cfg.EnvForBranch("web", tt.branch, Vars{}); !reflect.DeepEqual(got, tt.env) {
+				t.Errorf("EnvForBranch() = %v, want %v", got, tt.env)
+			}
+		})
+	}
+
+	vs, err := cfg.ExplainEnv("web", "release/2.0", Vars{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs[0].Source != FileName+`: worktrees."release/2.0".services.web.env.CHANNEL` || len(vs[0].Overrides) != 3 {
+		t.Errorf("ExplainEnv()[CHANNEL] = %+v", vs[0])
+	}
+}
+
+func TestWorktreePatternOrderAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		FileName: `
+include = ["extra.toml"]
+
+[services.web]
+command = "npm run dev"
+port_range = { min = 3100, max = 3199 }
+proxy_port = 3000
+
+[worktrees."feat/*".services.web]
+command = "main"
+
+[profiles.p.worktrees."feat/a*".services.web]
+command = "profile"
+`,
+		"extra.toml": `
+[worktrees."feat/?*".services.web]
+command = "included"
+`,
+	})
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cfg.CommandForBranch("web", "feat/abc", Vars{}); got != "main" {
+		t.Errorf("CommandForBranch() = %q, the including file comes after its includes", got)
+	}
+	cfg, err = LoadProfile(dir, "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cfg.CommandForBranch("web", "feat/abc", Vars{}); got != "profile" {
+		t.Errorf("CommandForBranch() with profile = %q, want profile", got)
+	}
+}
+
+func TestValidateWorktreePatterns(t *testing.T) {
+	for key, want := range map[string]string{
+		"~feat/(api": "invalid regular expression",
+		"release/[":  "invalid pattern",
+	} {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{FileName: strings.Replace(patternConfig, "release/2.0", key, 1)})
+		_, err := Load(dir)
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), key) {
+			t.Errorf("Load() with %q error = %v, want %q", key, err, want)
+		}
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{FileName: strings.Replace(patternConfig, "release/2.0", "release/3.*", 1)})
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), `worktree "release/3.*" service "web": port can only be fixed for a single branch`) {
+		t.Errorf("Load() with a port in a pattern error = %v", err)
+	}
+}
+
+func TestServiceEnabled(t *testing.T) {
+	off, on := false, true
+	cfg := &Config{
+		Services: map[string]ServiceConfig{
+			"web":    {Command: "x"},
+			"api":    {Command: "x", ExceptBranches: []string{"docs/*", "~-docs$"}},
+			"worker": {Command: "x", Enabled: &off},
+			"search": {Command: "x", OnlyBranches: []string{"main", "release/*"}},
+		},
+		Worktrees: map[string]WTOverride{
+			"data":      {Services: map[string]WTServiceOverride{"worker": {Enabled: &on}}},
+			"~^data":    {Services: map[string]WTServiceOverride{"search": {Enabled: &on}}},
+			"release/*": {Services: map[string]WTServiceOverride{"search": {Enabled: &off}}},
+			"release/1": {Services: map[string]WTServiceOverride{"search": {Enabled: &on}}},
+		},
+	}
+	for _, tt := range []struct {
+		branch  string
+		enabled []string
+	}{
+		{"main", []string{"api", "search", "web"}},
+		{"docs/intro", []string{"web"}},
+		{"fix-docs", []string{"web"}},
+		{"data", []string{"api", "search", "web", "worker"}},
+		{"release/2", []string{"api", "web"}},
+		{"release/1", []string{"api", "search", "web"}},
+	} {
+		var got []string
+		for _, name := range []string{"api", "search", "web", "worker", "missing"} {
+			if cfg.ServiceEnabled(name, tt.branch) {
+				got = append(got, name)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.enabled) {
+			t.Errorf("enabled services for %s = %v, want %v", tt.branch, got, tt.enabled)
+		}
+	}
+
+	cfg.Services["api"] = ServiceConfig{Command: "x", PortRange: PortRange{Min: 1, Max: 2}, ProxyPort: 3, OnlyBranches: []string{"~(x"}}
+	cfg.Services = map[string]ServiceConfig{"api": cfg.Services["api"]}
+	cfg.Worktrees = nil
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `service "api": only_branches: "~(x": invalid regular expression`) {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package detect
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ComposeService is the part of a docker compose service that portree
+// understands.
+type ComposeService struct {
+	Name        string
+	Image       string
+	Build       bool
+	Command     string
+	Ports       []ComposePort
+	Environment map[string]string
+	DependsOn   []string
+}
+
+// ComposePort is a port published by a compose service.
+type ComposePort struct {
+	Published int // host port, 0 if compose picks one
+	Target    int // container port
+}
+
+// composeFileNames are the names docker compose looks for, in its order of
+// preference.
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml"}
+
+// ParseCompose reads the services of a docker compose file, in file order.
+func ParseCompose(data []byte) ([]ComposeService, error) {
+	var doc struct {
+		Services yaml.Node `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Services.Kind == 0 {
+		return nil, nil
+	}
+	if doc.Services.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("services must be a mapping")
+	}
+
+	var services []ComposeService
+	for i := 0; i+1 < len(doc.Services.Content); i += 2 {
+		name := doc.Services.Content[i].Value
+		var raw struct {
+			Image       string      `yaml:"image"`
+			Build       yaml.Node   `yaml:"build"`
+			Command     yaml.Node   `yaml:"command"`
+			Ports       []yaml.Node `yaml:"ports"`
+			Environment yaml.Node   `yaml:"environment"`
+			DependsOn   yaml.Node   `yaml:"depends_on"`
+		}
+		if err := doc.Services.Content[i+1].Decode(&raw); err != nil {
+			return nil, fmt.Errorf("service %q: %w", name, err)
+		}
+		svc := ComposeService{Name: name, Image: raw.Image, Build: raw.Build.Kind != 0}
+		var err error
+		if svc.Command, err = composeCommand(raw.Command); err != nil {
+			return nil, fmt.Errorf("service %q: command: %w", name, err)
+		}
+		for _, p := range raw.Ports {
+			port, err := composePort(p)
+			if err != nil {
+				return nil, fmt.Errorf("service %q: ports: %w", name, err)
+			}
+			svc.Ports = append(svc.Ports, port)
+		}
+		if svc.Environment, err = composeEnvironment(raw.Environment); err != nil {
+			return nil, fmt.Errorf("service %q: environment: %w", name, err)
+		}
+		if svc.DependsOn, err = composeDependsOn(raw.DependsOn); err != nil {
+			return nil, fmt.Errorf("service %q: depends_on: %w", name, err)
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+// composeCommand accepts a string or a list of arguments.
+func composeCommand(n yaml.Node) (string, error) {
+	switch n.Kind {
+	case 0:
+		return "", nil
+	case yaml.ScalarNode:
+		return n.Value, nil
+	case yaml.SequenceNode:
+		var args []string
+		if err := n.Decode(&args); err != nil {
+			return "", err
+		}
+		for i, a := range args {
+			if a == "" || strings.ContainsAny(a, " \t\n'\"$\\") {
+				args[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+			}
+		}
+		return strings.Join(args, " "), nil
+	}
+	return "", fmt.Errorf("expected a string or a list")
+}
+
+// composePort parses the short ("8080:80", "127.0.0.1:8080:80/tcp", "80")
+// and long ({target: 80, published: 8080}) port syntaxes.
+func composePort(n yaml.Node) (ComposePort, error) {
+	if n.Kind == yaml.MappingNode {
+		var long struct {
+			Target    int    `yaml:"target"`
+			Published string `yaml:"published"`
+		}
+		if err := n.Decode(&long); err != nil {
+			return ComposePort{}, err
+		}
+		published, _ := strconv.Atoi(long.Published)
+		return ComposePort{Published: published, Target: long.Target}, nil
+	}
+	if n.Kind != yaml.ScalarNode {
+		return ComposePort{}, fmt.Errorf("unsupported port %v", n.Value)
+	}
+
+	spec, _, _ := strings.Cut(n.Value, "/")
+	parts := strings.Split(spec, ":")
+	target, err := firstPort(parts[len(parts)-1])
+	if err != nil {
+		return ComposePort{}, fmt.Errorf("port %q: %w", n.Value, err)
+	}
+	var published int
+	if len(parts) >= 2 && parts[len(parts)-2] != "" {
+		if published, err = firstPort(parts[len(parts)-2]); err != nil {
+			return ComposePort{}, fmt.Errorf("port %q: %w", n.Value, err)
+		}
+	}
+	return ComposePort{Published: published, Target: target}, nil
+}
+
+// firstPort parses a port or the first port of a range such as 3000-3005.
+func firstPort(s string) (int, error) {
+	s, _, _ = strings.Cut(s, "-")
+	p, err := strconv.Atoi(s)
+	if err != nil || p <= 0 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return p, nil
+}
+
+// composeEnvironment accepts a mapping or a list of KEY=value entries.
+func composeEnvironment(n yaml.Node) (map[string]string, error) {
+	switch n.Kind {
+	case 0:
+		return nil, nil
+	case yaml.MappingNode:
+		env := map[string]string{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			env[n.Content[i].Value] = n.Content[i+1].Value
+		}
+		return env, nil
+	case yaml.SequenceNode:
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return nil, err
+		}
+		env := map[string]string{}
+		for _, kv := range list {
+			k, v, _ := strings.Cut(kv, "=")
+			env[k] = v
+		}
+		return env, nil
+	}
+	return nil, fmt.Errorf("expected a mapping or a list")
+}
+
+// composeDependsOn accepts a list of names or a mapping of names to
+// conditions, and returns the names sorted.
+func composeDependsOn(n yaml.Node) ([]string, error) {
+	var names []string
+	switch n.Kind {
+	case 0:
+		return nil, nil
+	case yaml.SequenceNode:
+		if err := n.Decode(&names); err != nil {
+			return nil, err
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(n.Content); i += 2 {
+			names = append(names, n.Content[i].Value)
+		}
+	default:
+		return nil, fmt.Errorf("expected a list or a mapping")
+	}
+	sort.Strings(names)
+	return names, nil
+}
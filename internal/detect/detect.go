@@ -0,0 +1,454 @@
+// Package detect proposes portree services by looking at the files of a
+// repository: package.json scripts (Vite, Next.js and others), Rails and
+// Django apps, Go main packages, Procfiles and docker compose files.
+package detect
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fairy-pitta/portree/internal/config"
+)
+
+// Service is a service proposed by Detect.
+type Service struct {
+	Name    string
+	Command string
+	Dir     string // relative to the repository root, slash-separated; "" is the root
+	Source  string // what it was detected from, e.g. "Vite (apps/web/package.json)"
+	Note    string // advice for the user, if any
+
+	PortRange config.PortRange
+	ProxyPort int
+
+	frontend bool // served to browsers; gets a 3xxx proxy port
+}
+
+// maxDepth is how many directories below the root Detect looks into.
+const maxDepth = 3
+
+// skipDirs are never searched, in addition to hidden directories and
+// directories that are git repositories or worktrees of their own.
+var skipDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "dist": true, "build": true, "target": true,
+	"tmp": true, "log": true, "coverage": true, "__pycache__": true, "venv": true, "testdata": true,
+}
+
+// listenNote is attached to services whose command may not use $PORT.
+const listenNote = "make sure it listens on $PORT"
+
+// Detect scans the repository at root and returns the services it proposes,
+// in directory order, with unique names and non-overlapping ports.
+func Detect(root string) ([]Service, error) {
+	var services []Service
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		} else {
+			if skipDir(p, d.Name()) {
+				return filepath.SkipDir
+			}
+			if strings.Count(rel, "/") >= maxDepth {
+				return filepath.SkipDir
+			}
+		}
+		found, err := detectDir(root, p, rel)
+		if err != nil {
+			return err
+		}
+		services = append(services, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	uniqueNames(services)
+	assignPorts(services)
+	return services, nil
+}
+
+func skipDir(p, name string) bool {
+	if strings.HasPrefix(name, ".") || skipDirs[name] {
+		return true
+	}
+	_, err := os.Lstat(filepath.Join(p, ".git"))
+	return err == nil
+}
+
+// detectDir returns the services of one directory. A Procfile describes the
+// directory's processes authoritatively; otherwise one app server (Rails,
+// Django or a package.json script) is proposed. Compose services and Go
+// main packages are proposed in addition.
+func detectDir(root, dir, rel string) ([]Service, error) {
+	var services []Service
+	if exists(filepath.Join(dir, "Procfile")) {
+		found, err := detectProcfile(dir, rel)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, found...)
+	} else {
+		for _, detect := range []func(root, dir, rel string) (*Service, error){detectRails, detectDjango, detectNode} {
+			svc, err := detect(root, dir, rel)
+			if err != nil {
+				return nil, err
+			}
+			if svc != nil {
+				services = append(services, *svc)
+				break
+			}
+		}
+	}
+
+	compose, err := detectCompose(dir, rel)
+	if err != nil {
+		return nil, err
+	}
+	services = append(services, compose...)
+
+	if exists(filepath.Join(dir, "go.mod")) {
+		found, err := detectGo(dir, rel)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, found...)
+	}
+	return services, nil
+}
+
+func detectProcfile(dir, rel string) ([]Service, error) {
+	f, err := os.Open(filepath.Join(dir, "Procfile"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	procs, err := ParseProcfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path.Join(rel, "Procfile"), err)
+	}
+	services := make([]Service, 0, len(procs))
+	for _, p := range procs {
+		svc := Service{
+			Name:    p.Name,
+			Command: p.Command,
+			Dir:     rel,
+			Source:  "Procfile (" + path.Join(rel, "Procfile") + ")",
+		}
+		if !strings.Contains(p.Command, "PORT") {
+			svc.Note = listenNote
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+func detectRails(root, dir, rel string) (*Service, error) {
+	if !exists(filepath.Join(dir, "config", "application.rb")) || !exists(filepath.Join(dir, "bin", "rails")) {
+		return nil, nil
+	}
+	return &Service{
+		Name:    dirName(rel, "rails"),
+		Command: "bin/rails server -b 127.0.0.1 -p $PORT",
+		Dir:     rel,
+		Source:  "Rails (" + path.Join(rel, "config/application.rb") + ")",
+	}, nil
+}
+
+func detectDjango(root, dir, rel string) (*Service, error) {
+	if !exists(filepath.Join(dir, "manage.py")) {
+		return nil, nil
+	}
+	python := "python"
+	if exists(filepath.Join(dir, ".venv", "bin", "python")) {
+		python = ".venv/bin/python"
+	}
+	return &Service{
+		Name:    dirName(rel, "django"),
+		Command: python + " manage.py runserver 127.0.0.1:$PORT",
+		Dir:     rel,
+		Source:  "Django (" + path.Join(rel, "manage.py") + ")",
+	}, nil
+}
+
+type packageJSON struct {
+	Name            string            `json:"name"`
+	Scripts         map[string]string `json:"scripts"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+	PackageManager  string            `json:"packageManager"`
+}
+
+func (p packageJSON) dependsOn(name string) bool {
+	_, dep := p.Dependencies[name]
+	_, dev := p.DevDependencies[name]
+	return dep || dev
+}
+
+func readPackageJSON(file string) (*packageJSON, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+func detectNode(root, dir, rel string) (*Service, error) {
+	file := filepath.Join(dir, "package.json")
+	if !exists(file) {
+		return nil, nil
+	}
+	pkg, err := readPackageJSON(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path.Join(rel, "package.json"), err)
+	}
+	var script string
+	for _, s := range []string{"dev", "start", "serve"} {
+		if pkg.Scripts[s] != "" {
+			script = s
+			break
+		}
+	}
+	if script == "" {
+		return nil, nil
+	}
+
+	pm := packageManager(root, dir, pkg)
+	svc := &Service{
+		Name:     dirName(rel, packageName(pkg.Name)),
+		Command:  pm + " run " + script,
+		Dir:      rel,
+		frontend: true,
+	}
+	source := path.Join(rel, "package.json")
+	switch {
+	case pkg.dependsOn("vite") || hasConfig(dir, "vite.config"):
+		// Vite ignores $PORT.
+		if pm == "npm" {
+			svc.Command += " --"
+		}
+		svc.Command += " --port $PORT --strictPort"
+		svc.Source = "Vite (" + source + ")"
+	case pkg.dependsOn("next") || hasConfig(dir, "next.config"):
+		svc.Source = "Next.js (" + source + ")" // next dev reads $PORT
+	default:
+		svc.Source = fmt.Sprintf("package.json script %q (%s)", script, source)
+		if !strings.Contains(pkg.Scripts[script], "PORT") {
+			svc.Note = listenNote
+		}
+	}
+	return svc, nil
+}
+
+var lockFiles = []struct{ file, pm string }{
+	{"pnpm-lock.yaml", "pnpm"},
+	{"yarn.lock", "yarn"},
+	{"bun.lock", "bun"},
+	{"bun.lockb", "bun"},
+	{"package-lock.json", "npm"},
+}
+
+// packageManager guesses the package manager from the packageManager field
+// or a lock file in dir or one of its parents up to root.
+func packageManager(root, dir string, pkg *packageJSON) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		p := pkg
+		if d != dir {
+			p, _ = readPackageJSON(filepath.Join(d, "package.json"))
+		}
+		if p != nil && p.PackageManager != "" {
+			name, _, _ := strings.Cut(p.PackageManager, "@")
+			return name
+		}
+		for _, lock := range lockFiles {
+			if exists(filepath.Join(d, lock.file)) {
+				return lock.pm
+			}
+		}
+		if d == root || filepath.Dir(d) == d {
+			return "npm"
+		}
+	}
+}
+
+// packageName strips the scope of an npm package name.
+func packageName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		return "web"
+	}
+	return name
+}
+
+func hasConfig(dir, base string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, base+".*"))
+	return len(matches) > 0
+}
+
+func detectCompose(dir, rel string) ([]Service, error) {
+	for _, name := range composeFileNames {
+		file := filepath.Join(dir, name)
+		if !exists(file) {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		compose, err := ParseCompose(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path.Join(rel, name), err)
+		}
+		var services []Service
+		for _, c := range compose {
+			if len(c.Ports) == 0 {
+				continue // not reachable over HTTP
+			}
+			services = append(services, Service{
+				Name:    c.Name,
+				Command: ComposeCommand(c.Name, c.Ports[0].Target),
+				Dir:     rel,
+				Source:  "docker compose (" + path.Join(rel, name) + ")",
+			})
+		}
+		return services, nil
+	}
+	return nil, nil
+}
+
+// ComposeCommand runs one compose service with its container port published
+// on $PORT, in a compose project of its own for each worktree.
+func ComposeCommand(service string, target int) string {
+	return fmt.Sprintf("docker compose --project-name ${slug} run --rm --publish $PORT:%d %s", target, service)
+}
+
+// detectGo proposes the main packages of the module in dir.
+func detectGo(dir, rel string) ([]Service, error) {
+	var services []Service
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != dir && (skipDir(p, d.Name()) || exists(filepath.Join(p, "go.mod"))) {
+			return filepath.SkipDir
+		}
+		if !isMainPackage(p) {
+			return nil
+		}
+		pkg, _ := filepath.Rel(dir, p)
+		pkg = filepath.ToSlash(pkg)
+		name, target := path.Base(pkg), "./"+pkg
+		if pkg == "." {
+			name, target = dirName(rel, modulePath(dir)), "."
+		}
+		services = append(services, Service{
+			Name:    name,
+			Command: "go run " + target,
+			Dir:     rel,
+			Source:  "Go main package (" + path.Join(rel, pkg) + ")",
+			Note:    listenNote,
+		})
+		return nil
+	})
+	return services, err
+}
+
+// isMainPackage reports whether dir holds non-test Go files of package main.
+func isMainPackage(dir string) bool {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		ast, err := parser.ParseFile(token.NewFileSet(), f, nil, parser.PackageClauseOnly)
+		if err == nil && ast.Name.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+var moduleLine = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)`)
+
+// modulePath returns the last element of the module path in dir/go.mod.
+func modulePath(dir string) string {
+	data, _ := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if m := moduleLine.FindSubmatch(data); m != nil {
+		return path.Base(string(m[1]))
+	}
+	return "app"
+}
+
+// dirName names a service after its directory, or fallback at the root.
+func dirName(rel, fallback string) string {
+	if rel == "" {
+		return fallback
+	}
+	return path.Base(rel)
+}
+
+var invalidName = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// uniqueNames makes the service names valid TOML bare keys and unique.
+func uniqueNames(services []Service) {
+	seen := map[string]bool{}
+	for i := range services {
+		name := strings.Trim(invalidName.ReplaceAllString(strings.ToLower(services[i].Name), "-"), "-")
+		if name == "" {
+			name = "service"
+		}
+		unique := name
+		for n := 2; seen[unique]; n++ {
+			unique = fmt.Sprintf("%s-%d", name, n)
+		}
+		seen[unique] = true
+		services[i].Name = unique
+	}
+}
+
+// assignPorts gives browser-facing services proxy ports from 3000 and the
+// others from 8000, each with a range of 100 ports above them: 3000 with
+// 3100-3199, 3001 with 3200-3299, and so on.
+func assignPorts(services []Service) {
+	next := map[bool]int{}
+	for i := range services {
+		s := &services[i]
+		base := 8000
+		if s.frontend {
+			base = 3000
+		}
+		n := next[s.frontend]
+		next[s.frontend]++
+		s.ProxyPort = base + n
+		s.PortRange = config.PortRange{Min: base + 100*(n+1), Max: base + 100*(n+1) + 99}
+	}
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
@@ -0,0 +1,180 @@
+package detect
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fairy-pitta/portree/internal/config"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"pnpm-lock.yaml":                        "",
+		"apps/web/package.json":                 `{"name": "@acme/web", "scripts": {"dev": "vite", "build": "vite build"}, "devDependencies": {"vite": "^5"}}`,
+		"apps/site/package.json":                `{"name": "site", "scripts": {"dev": "next dev"}, "dependencies": {"next": "14"}}`,
+		"apps/site/node_modules/x/package.json": `{"scripts": {"dev": "x"}}`,
+		"apps/lib/package.json":                 `{"name": "lib", "scripts": {"build": "tsc"}}`,
+		"rails/config/application.rb":           "",
+		"rails/bin/rails":                       "",
+		"py/manage.py":                          "",
+		"go.mod":                                "module example.com/acme/tools\n",
+		"cmd/api/main.go":                       "package main\n\nfunc main() {}\n",
+		"internal/x/x.go":                       "package x\n",
+		"docker-compose.yml":                    "services:\n  db:\n    image: postgres\n  mail:\n    image: mailpit\n    ports: [\"8025:8025\"]\n",
+		".hidden/package.json":                  `{"scripts": {"dev": "x"}}`,
+	})
+
+	got, err := Detect(dir)
+	if err != nil {
+		t.Fatalf("Detect() error: %v", err)
+	}
+	want := []Service{
+		{Name: "mail", Command: "docker compose --project-name ${slug} run --rm --publish $PORT:8025 mail", Source: "docker compose (docker-compose.yml)",
+			ProxyPort: 8000, PortRange: config.PortRange{Min: 8100, Max: 8199}},
+		{Name: "api", Command: "go run ./cmd/api", Source: "Go main package (cmd/api)", Note: listenNote,
+			ProxyPort: 8001, PortRange: config.PortRange{Min: 8200, Max: 8299}},
+		{Name: "site", Command: "pnpm run dev", Dir: "apps/site", Source: "Next.js (apps/site/package.json)",
+			ProxyPort: 3000, PortRange: config.PortRange{Min: 3100, Max: 3199}, frontend: true},
+		{Name: "web", Command: "pnpm run dev --port $PORT --strictPort", Dir: "apps/web", Source: "Vite (apps/web/package.json)",
+			ProxyPort: 3001, PortRange: config.PortRange{Min: 3200, Max: 3299}, frontend: true},
+		{Name: "py", Command: "python manage.py runserver 127.0.0.1:$PORT", Dir: "py", Source: "Django (py/manage.py)",
+			ProxyPort: 8002, PortRange: config.PortRange{Min: 8300, Max: 8399}},
+		{Name: "rails", Command: "bin/rails server -b 127.0.0.1 -p $PORT", Dir: "rails", Source: "Rails (rails/config/application.rb)",
+			ProxyPort: 8003, PortRange: config.PortRange{Min: 8400, Max: 8499}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Detect() = %+v, want %d services", got, len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("Detect()[%d] = %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDetectProcfileAndNames(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"Procfile":         "web: bundle exec puma -p $PORT\nworker: bundle exec sidekiq\n",
+		"package.json":     `{"scripts": {"dev": "vite"}}`, // superseded by the Procfile
+		"web/package.json": `{"scripts": {"start": "node server.js"}, "packageManager": "yarn@4.1.0"}`,
+	})
+	got, err := Detect(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, commands, notes []string
+	for _, s := range got {
+		names = append(names, s.Name)
+		commands = append(commands, s.Command)
+		notes = append(notes, s.Note)
+	}
+	if want := []string{"web", "worker", "web-2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+	if want := []string{"bundle exec puma -p $PORT", "bundle exec sidekiq", "yarn run start"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("commands = %q, want %q", commands, want)
+	}
+	if want := []string{"", listenNote, listenNote}; !reflect.DeepEqual(notes, want) {
+		t.Errorf("notes = %q, want %q", notes, want)
+	}
+}
+
+func TestDetectInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"app/package.json": "{"})
+	if _, err := Detect(dir); err == nil || !strings.Contains(err.Error(), "app/package.json") {
+		t.Errorf("Detect() error = %v, want it to name app/package.json", err)
+	}
+}
+
+func TestParseProcfile(t *testing.T) {
+	procs, err := ParseProcfile(strings.NewReader("# comment\n\nweb: rails s -p $PORT\nworker:  sidekiq -C config.yml \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Process{{"web", "rails s -p $PORT"}, {"worker", "sidekiq -C config.yml"}}
+	if !reflect.DeepEqual(procs, want) {
+		t.Errorf("ParseProcfile() = %+v, want %+v", procs, want)
+	}
+
+	for input, msg := range map[string]string{
+		"web rails s":      "line 1: expected <name>: <command>",
+		"web: a\nweb: b\n": `line 2: duplicate process "web"`,
+	} {
+		if _, err := ParseProcfile(strings.NewReader(input)); err == nil || err.Error() != msg {
+			t.Errorf("ParseProcfile(%q) error = %v, want %q", input, err, msg)
+		}
+	}
+}
+
+func TestParseCompose(t *testing.T) {
+	services, err := ParseCompose([]byte(`
+services:
+  web:
+    build: .
+    command: ["npm", "run", "dev", "--", "--host", "0.0.0.0 x"]
+    ports:
+      - "127.0.0.1:3000:5173/tcp"
+      - target: 9229
+        published: "9229"
+    environment:
+      - NODE_ENV=development
+    depends_on:
+      redis:
+        condition: service_started
+      db:
+        condition: service_healthy
+  db:
+    image: postgres:16
+    ports: ["5432"]
+    environment:
+      POSTGRES_PASSWORD: secret
+  redis:
+    image: redis
+`))
+	if err != nil {
+		t.Fatalf("ParseCompose() error: %v", err)
+	}
+	want := []ComposeService{
+		{
+			Name:        "web",
+			Build:       true,
+			Command:     "npm run dev -- --host '0.0.0.0 x'",
+			Ports:       []ComposePort{{Published: 3000, Target: 5173}, {Published: 9229, Target: 9229}},
+			Environment: map[string]string{"NODE_ENV": "development"},
+			DependsOn:   []string{"db", "redis"},
+		},
+		{
+			Name:        "db",
+			Image:       "postgres:16",
+			Ports:       []ComposePort{{Target: 5432}},
+			Environment: map[string]string{"POSTGRES_PASSWORD": "secret"},
+		},
+		{Name: "redis", Image: "redis"},
+	}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("ParseCompose() =\n%+v\nwant\n%+v", services, want)
+	}
+
+	if _, err := ParseCompose([]byte("services:\n  web:\n    ports: [\"http\"]\n")); err == nil || !strings.Contains(err.Error(), `service "web": ports`) {
+		t.Errorf("ParseCompose() with a bad port error = %v", err)
+	}
+}
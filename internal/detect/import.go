@@ -0,0 +1,185 @@
+package detect
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fairy-pitta/portree/internal/config"
+)
+
+// hardPort matches a port written into a command: a -p/--port flag, a
+// listen address such as 0.0.0.0:8000, or a PORT=3000 assignment.
+var hardPort = regexp.MustCompile(`(?:(?:^|\s)(?:-p|--port)(?:\s+|=)|(?:localhost|127\.0\.0\.1|0\.0\.0\.0):|(?:^|\s)PORT=)(\d{2,5})\b`)
+
+// defaultPort matches the default of a ${PORT:-3000} reference.
+var defaultPort = regexp.MustCompile(`\$\{PORT:-(\d{2,5})\}`)
+
+// ImportProcfile translates the processes of a Procfile in dir, relative to
+// the repository root, into services. Ports written into a command are
+// replaced with $PORT and become the proxy port of the service.
+func ImportProcfile(procs []Process, dir string) []config.InitService {
+	services := make([]config.InitService, 0, len(procs))
+	for _, p := range procs {
+		command, port := usePort(p.Command)
+		svc := config.InitService{
+			Name:          p.Name,
+			ServiceConfig: config.ServiceConfig{Command: command, Dir: dir, ProxyPort: port},
+		}
+		if command != p.Command {
+			svc.Comments = append(svc.Comments, fmt.Sprintf("Port %d replaced with $PORT", port))
+		}
+		if !strings.Contains(command, "PORT") {
+			svc.Comments = append(svc.Comments, "TODO: "+listenNote)
+		}
+		services = append(services, svc)
+	}
+	allocatePorts(services, nil)
+	return services
+}
+
+// usePort replaces the ports written into command with $PORT and returns
+// the first of them, or the default of a ${PORT:-3000} reference.
+func usePort(command string) (string, int) {
+	port := 0
+	if m := defaultPort.FindStringSubmatch(command); m != nil {
+		port, _ = strconv.Atoi(m[1])
+	}
+	command = hardPort.ReplaceAllStringFunc(command, func(m string) string {
+		digits := hardPort.FindStringSubmatch(m)[1]
+		if port == 0 {
+			port, _ = strconv.Atoi(digits)
+		}
+		return strings.TrimSuffix(m, digits) + "$PORT"
+	})
+	return command, port
+}
+
+// ImportCompose translates the services of a compose file into services that
+// run them with docker compose, in a project of their own for each
+// worktree. file is the compose file's name and dir its directory relative
+// to the repository root. The first published port of a service becomes its
+// proxy port, and its container port is published on $PORT. environment
+// entries become service env entries, passed into the container, so that
+// worktree overrides apply to them; depends_on is kept, and portree starts
+// the dependencies instead of compose.
+func ImportCompose(compose []ComposeService, file, dir string) []config.InitService {
+	services := make([]config.InitService, 0, len(compose))
+	for _, c := range compose {
+		args := []string{"docker", "compose", "--file", file, "--project-name", "${slug}", "run", "--rm", "--no-deps"}
+		svc := config.InitService{Name: c.Name}
+		if len(c.Ports) > 0 {
+			args = append(args, "--publish", fmt.Sprintf("$PORT:%d", c.Ports[0].Target))
+			svc.ProxyPort = c.Ports[0].Published
+		} else {
+			svc.Comments = append(svc.Comments, "No published ports, so no proxy_port")
+		}
+
+		env := map[string]string{}
+		for k, v := range c.Environment {
+			// Empty values come from the environment compose runs in, and
+			// PORT would clash with the port portree assigns.
+			if v == "" || k == "PORT" {
+				continue
+			}
+			env[k] = composeInterpolation(v)
+		}
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = append(args, "--env", k)
+		}
+		args = append(args, c.Name)
+
+		svc.ServiceConfig = config.ServiceConfig{
+			Command:   strings.Join(args, " "),
+			Dir:       dir,
+			DependsOn: c.DependsOn,
+			ProxyPort: svc.ProxyPort,
+		}
+		if len(env) > 0 {
+			svc.Env = env
+		}
+		services = append(services, svc)
+	}
+	allocatePorts(services, func(i int) bool { return len(compose[i].Ports) > 0 })
+	return services
+}
+
+var composeVar = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// composeInterpolation rewrites compose's references to the environment,
+// ${NAME}, ${NAME:-default} and $NAME, as ${env:...} references and $$ as a
+// literal $.
+func composeInterpolation(s string) string {
+	return composeVar.ReplaceAllStringFunc(s, func(m string) string {
+		sub := composeVar.FindStringSubmatch(m)
+		switch {
+		case m == "$$":
+			return "$"
+		case sub[1] != "":
+			return "${env:" + sub[1]
+		}
+		return "${env:" + sub[2] + "}"
+	})
+}
+
+// allocatePorts keeps the proxy ports services already have, unless two
+// share one, and gives every service a port range of 100 ports that holds
+// no proxy port: the hundred above its proxy port where possible, otherwise
+// the first free one from 8100. Services without a proxy port get the first
+// free port from 8000, unless proxied reports that they have no port for
+// the proxy to reach; a nil proxied proxies all services.
+func allocatePorts(services []config.InitService, proxied func(i int) bool) {
+	used := map[int]bool{}
+	for i := range services {
+		if p := services[i].ProxyPort; used[p] {
+			services[i].ProxyPort = 0
+		} else if p != 0 {
+			used[p] = true
+		}
+	}
+
+	var ranges []config.PortRange
+	free := func(min, max int) bool {
+		for p := range used {
+			if p >= min && p <= max {
+				return false
+			}
+		}
+		for _, r := range ranges {
+			if min <= r.Max && r.Min <= max {
+				return false
+			}
+		}
+		return true
+	}
+	for i := range services {
+		start := 8100
+		if p := services[i].ProxyPort; p != 0 {
+			start = (p/100 + 1) * 100
+		}
+		for !free(start, start+99) {
+			start += 100
+		}
+		services[i].PortRange = config.PortRange{Min: start, Max: start + 99}
+		ranges = append(ranges, services[i].PortRange)
+	}
+
+	next := 8000
+	for i := range services {
+		if services[i].ProxyPort != 0 || (proxied != nil && !proxied(i)) {
+			continue
+		}
+		for !free(next, next) {
+			next++
+		}
+		services[i].ProxyPort = next
+		used[next] = true
+	}
+}
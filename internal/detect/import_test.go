@@ -0,0 +1,102 @@
+package detect
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fairy-pitta/portree/internal/config"
+)
+
+func TestUsePort(t *testing.T) {
+	for _, tt := range []struct {
+		command, want string
+		port          int
+	}{
+		{"bin/rails server -p 3000", "bin/rails server -p $PORT", 3000},
+		{"next dev --port=3001 --turbo", "next dev --port=$PORT --turbo", 3001},
+		{"python manage.py runserver 0.0.0.0:8000", "python manage.py runserver 0.0.0.0:$PORT", 8000},
+		{"PORT=3036 bin/vite dev", "PORT=$PORT bin/vite dev", 3036},
+		{"bin/rails s -p ${PORT:-3000}", "bin/rails s -p ${PORT:-3000}", 3000},
+		{"bundle exec sidekiq -c 5", "bundle exec sidekiq -c 5", 0},
+		{"cat app.log:1234", "cat app.log:1234", 0},
+	} {
+		got, port := usePort(tt.command)
+		if got != tt.want || port != tt.port {
+			t.Errorf("usePort(%q) = %q, %d; want %q, %d", tt.command, got, port, tt.want, tt.port)
+		}
+	}
+}
+
+func TestImportProcfile(t *testing.T) {
+	services := ImportProcfile([]Process{
+		{"web", "bin/rails server -p 3000"},
+		{"worker", "bundle exec sidekiq"},
+		{"api", "bin/api --port 3050"},
+	}, "backend")
+	want := []config.InitService{
+		{Name: "web", Comments: []string{"Port 3000 replaced with $PORT"}, ServiceConfig: config.ServiceConfig{
+			Command: "bin/rails server -p $PORT", Dir: "backend", ProxyPort: 3000, PortRange: config.PortRange{Min: 3100, Max: 3199}}},
+		{Name: "worker", Comments: []string{"TODO: " + listenNote}, ServiceConfig: config.ServiceConfig{
+			Command: "bundle exec sidekiq", Dir: "backend", ProxyPort: 8000, PortRange: config.PortRange{Min: 8100, Max: 8199}}},
+		{Name: "api", Comments: []string{"Port 3050 replaced with $PORT"}, ServiceConfig: config.ServiceConfig{
+			Command: "bin/api --port $PORT", Dir: "backend", ProxyPort: 3050, PortRange: config.PortRange{Min: 3200, Max: 3299}}},
+	}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("ImportProcfile() =\n%+v\nwant\n%+v", services, want)
+	}
+}
+
+func TestImportCompose(t *testing.T) {
+	services := ImportCompose([]ComposeService{
+		{
+			Name:        "web",
+			Ports:       []ComposePort{{Published: 3000, Target: 5173}},
+			Environment: map[string]string{"DATABASE_URL": "postgres://db/${DB:-app}?u=$USER&p=$$x", "PORT": "5173", "TOKEN": ""},
+			DependsOn:   []string{"db"},
+		},
+		{Name: "db", Ports: []ComposePort{{Target: 5432}}},
+		{Name: "mail", Ports: []ComposePort{{Published: 3000, Target: 8025}}},
+		{Name: "worker", DependsOn: []string{"db"}},
+	}, "compose.dev.yaml", "")
+
+	run := "docker compose --file compose.dev.yaml --project-name ${slug} run --rm --no-deps "
+	want := []config.InitService{
+		{Name: "web", ServiceConfig: config.ServiceConfig{
+			Command:   run + "--publish $PORT:5173 --env DATABASE_URL web",
+			Env:       map[string]string{"DATABASE_URL": "postgres://db/${env:DB:-app}?u=${env:USER}&p=$x"},
+			DependsOn: []string{"db"},
+			ProxyPort: 3000, PortRange: config.PortRange{Min: 3100, Max: 3199}}},
+		{Name: "db", ServiceConfig: config.ServiceConfig{
+			Command: run + "--publish $PORT:5432 db", ProxyPort: 8000, PortRange: config.PortRange{Min: 8100, Max: 8199}}},
+		{Name: "mail", ServiceConfig: config.ServiceConfig{ // 3000 is taken by web
+			Command: run + "--publish $PORT:8025 mail", ProxyPort: 8001, PortRange: config.PortRange{Min: 8200, Max: 8299}}},
+		{Name: "worker", Comments: []string{"No published ports, so no proxy_port"}, ServiceConfig: config.ServiceConfig{
+			Command: run + "worker", DependsOn: []string{"db"}, PortRange: config.PortRange{Min: 8300, Max: 8399}}},
+	}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("ImportCompose() =\n%+v\nwant\n%+v", services, want)
+	}
+	if _, err := config.RenderServices(services); err != nil {
+		t.Errorf("RenderServices() of imported services: %v", err)
+	}
+}
+
+func TestAllocatePortsAvoidsProxyPorts(t *testing.T) {
+	services := []config.InitService{
+		{Name: "a", ServiceConfig: config.ServiceConfig{Command: "a", ProxyPort: 8150}},
+		{Name: "b", ServiceConfig: config.ServiceConfig{Command: "b"}},
+		{Name: "c", ServiceConfig: config.ServiceConfig{Command: "c", ProxyPort: 3199}},
+	}
+	allocatePorts(services, nil)
+	var got []config.PortRange
+	for _, s := range services {
+		got = append(got, s.PortRange)
+	}
+	want := []config.PortRange{{Min: 8200, Max: 8299}, {Min: 8300, Max: 8399}, {Min: 3200, Max: 3299}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("port ranges = %v, want %v", got, want)
+	}
+	if services[1].ProxyPort != 8000 {
+		t.Errorf("proxy port of b = %d, want 8000", services[1].ProxyPort)
+	}
+}
@@ -0,0 +1,41 @@
+package detect
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Process is one line of a Procfile.
+type Process struct {
+	Name    string
+	Command string
+}
+
+var procfileLine = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*:\s*(.+)$`)
+
+// ParseProcfile reads the processes of a Procfile in order. Blank lines and
+// lines starting with # are ignored.
+func ParseProcfile(r io.Reader) ([]Process, error) {
+	var procs []Process
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := procfileLine.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: expected <name>: <command>", n)
+		}
+		if seen[m[1]] {
+			return nil, fmt.Errorf("line %d: duplicate process %q", n, m[1])
+		}
+		seen[m[1]] = true
+		procs = append(procs, Process{Name: m[1], Command: strings.TrimSpace(m[2])})
+	}
+	return procs, sc.Err()
+}
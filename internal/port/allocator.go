@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/state"
 )
 
 // Allocate returns a port for the given branch and service using FNV32 hash.
@@ -35,6 +36,12 @@ func Allocate(branch, service string, svc config.ServiceConfig, fixedPort int, u
 	return 0, fmt.Errorf("no available port in range [%d, %d] for %s/%s", pr.Min, pr.Max, branch, service)
 }
 
+// AllocateExtra returns a port from r for the extra port name of the given
+// branch and service, hashing and probing like Allocate.
+func AllocateExtra(branch, service, name string, r config.PortRange, used map[int]bool) (int, error) {
+	return Allocate(branch, state.ExtraPortService(service, name), config.ServiceConfig{PortRange: r}, 0, used)
+}
+
 // hashPort returns a port within [minPort, maxPort] based on FNV32 of branch+service.
 func hashPort(branch, service string, minPort, maxPort int) int {
 	h := fnv.New32a()
@@ -1,60 +1,184 @@
 package port
 
 import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
 	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/logging"
 	"github.com/fairy-pitta/portree/internal/state"
 )
 
-// Registry manages port assignments backed by state.
+// Registry manages port assignments backed by state. It also leases the
+// ports it assigns in the user-level LeaseStore, so that repositories with
+// overlapping port ranges do not assign the same port.
 type Registry struct {
-	store *state.FileStore
-	cfg   *config.Config
+	store  *state.FileStore
+	repo   string            // main worktree root, the parent of the state dir
+	leases *state.LeaseStore // nil if the user-level state dir is unavailable
+	cfg    atomic.Pointer[config.Config]
 }
 
 // NewRegistry creates a new port Registry.
 func NewRegistry(store *state.FileStore, cfg *config.Config) *Registry {
-	return &Registry{store: store, cfg: cfg}
+	r := &Registry{store: store, repo: filepath.Dir(store.Dir())}
+	if dir, err := state.GlobalStateDir(); err == nil {
+		if r.leases, err = state.NewLeaseStore(dir); err != nil {
+			logging.Warn("port leases disabled: %v", err)
+		}
+	}
+	r.cfg.Store(cfg)
+	return r
 }
 
-// AssignPort allocates a port for the given branch and service.
-// If a port was previously assigned and is still valid, it is reused.
-func (r *Registry) AssignPort(branch, service string) (int, error) {
-	var port int
-	err := r.store.WithLock(func() error {
+// SetConfig replaces the configuration used for new allocations.
+func (r *Registry) SetConfig(cfg *config.Config) {
+	r.cfg.Store(cfg)
+}
+
+// update runs fn with the repository state and the user-level leases
+// loaded and locked, and saves both if fn reports a change. Leases of this
+// repository that its state no longer assigns are dropped.
+func (r *Registry) update(fn func(st *state.State, leases *state.Leases) (bool, error)) error {
+	return r.store.WithLock(func() error {
 		st, err := r.store.Load()
 		if err != nil {
 			return err
 		}
+		if r.leases == nil {
+			changed, err := fn(st, &state.Leases{Ports: map[int]state.Lease{}})
+			if err != nil || !changed {
+				return err
+			}
+			return r.store.Save(st)
+		}
+		return r.leases.WithLock(func() error {
+			leases, err := r.leases.Load()
+			if err != nil {
+				return err
+			}
+			changed, err := fn(st, leases)
+			if err != nil {
+				return err
+			}
+			if changed {
+				if err := r.store.Save(st); err != nil {
+					return err
+				}
+			}
+			pruned := leases.Release(func(p int, l state.Lease) bool {
+				return l.Repo == r.repo && state.GetPortAssignment(st, l.Branch, l.Service) != p
+			})
+			if !changed && !pruned {
+				return nil
+			}
+			return r.leases.Save(leases)
+		})
+	})
+}
+
+// used returns the ports assigned in st and those leased by other
+// repositories.
+func (r *Registry) used(st *state.State, leases *state.Leases) map[int]bool {
+	used := leases.Taken(r.repo)
+	for _, p := range st.PortAssignments {
+		used[p] = true
+	}
+	return used
+}
+
+// AssignPort allocates a port for the given branch and service.
+// If a port was previously assigned and is still valid, it is reused. A
+// previous port that another repository has leased since is replaced.
+func (r *Registry) AssignPort(branch, service string) (int, error) {
+	var port int
+	err := r.update(func(st *state.State, leases *state.Leases) (bool, error) {
+		lease := state.NewLease(r.repo, branch, service)
 
 		// Check for existing assignment.
 		existing := state.GetPortAssignment(st, branch, service)
 		if existing > 0 {
-			port = existing
-			return nil
+			holder, held := leases.HeldElsewhere(existing, r.repo)
+			if !held {
+				port = existing
+				return leases.Acquire(existing, lease), nil
+			}
+			logging.Warn("port %d of %s/%s is leased by %s/%s in %s; assigning another",
+				existing, branch, service, holder.Branch, holder.Service, holder.Repo)
 		}
 
-		// Check for fixed port override.
-		fixedPort := r.cfg.FixedPortForBranch(service, branch)
+		cfg := r.cfg.Load()
 
-		// Build used ports set.
-		used := make(map[int]bool, len(st.PortAssignments))
-		for _, p := range st.PortAssignments {
-			used[p] = true
+		// Check for fixed port override.
+		fixedPort := cfg.FixedPortForBranch(service, branch)
+		if holder, held := leases.HeldElsewhere(fixedPort, r.repo); fixedPort > 0 && held {
+			return false, fmt.Errorf("fixed port %d for %s/%s is leased by %s/%s in %s",
+				fixedPort, branch, service, holder.Branch, holder.Service, holder.Repo)
 		}
 
-		svc := r.cfg.Services[service]
-		allocated, err := Allocate(branch, service, svc, fixedPort, used)
+		svc := cfg.Services[service]
+		allocated, err := Allocate(branch, service, svc, fixedPort, r.used(st, leases))
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		state.SetPortAssignment(st, branch, service, allocated)
+		leases.Acquire(allocated, lease)
 		port = allocated
-		return r.store.Save(st)
+		return true, nil
 	})
 	return port, err
 }
 
+// AssignExtraPorts allocates the extra_ports of the given branch and
+// service, keyed by name. Ports previously assigned are reused unless
+// another repository has leased them since.
+func (r *Registry) AssignExtraPorts(branch, service string) (map[string]int, error) {
+	extras := r.cfg.Load().Services[service].ExtraPorts
+	if len(extras) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(extras))
+	for name := range extras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ports := make(map[string]int, len(extras))
+	err := r.update(func(st *state.State, leases *state.Leases) (bool, error) {
+		used := r.used(st, leases)
+		changed := false
+		for _, name := range names {
+			key := state.ExtraPortService(service, name)
+			lease := state.NewLease(r.repo, branch, key)
+			if existing := state.GetPortAssignment(st, branch, key); existing > 0 {
+				holder, held := leases.HeldElsewhere(existing, r.repo)
+				if !held {
+					ports[name] = existing
+					changed = leases.Acquire(existing, lease) || changed
+					continue
+				}
+				logging.Warn("extra port %s (%d) of %s/%s is leased by %s/%s in %s; assigning another",
+					name, existing, branch, service, holder.Branch, holder.Service, holder.Repo)
+			}
+			allocated, err := AllocateExtra(branch, service, name, extras[name], used)
+			if err != nil {
+				return false, fmt.Errorf("extra port %s: %w", name, err)
+			}
+			used[allocated] = true
+			state.SetPortAssignment(st, branch, key, allocated)
+			leases.Acquire(allocated, lease)
+			ports[name] = allocated
+			changed = true
+		}
+		return changed, nil
+	})
+	return ports, err
+}
+
 // GetPort returns the currently assigned port for a branch+service, or 0.
 func (r *Registry) GetPort(branch, service string) (int, error) {
 	var port int
@@ -69,14 +193,63 @@ func (r *Registry) GetPort(branch, service string) (int, error) {
 	return port, err
 }
 
-// Release removes the port assignment for a branch+service.
-func (r *Registry) Release(branch, service string) error {
-	return r.store.WithLock(func() error {
+// GetExtraPorts returns the extra ports currently assigned to a
+// branch+service, keyed by name. Extra ports without an assignment are left
+// out.
+func (r *Registry) GetExtraPorts(branch, service string) (map[string]int, error) {
+	extras := r.cfg.Load().Services[service].ExtraPorts
+	if len(extras) == 0 {
+		return nil, nil
+	}
+	ports := make(map[string]int, len(extras))
+	err := r.store.WithLock(func() error {
 		st, err := r.store.Load()
 		if err != nil {
 			return err
 		}
+		for name := range extras {
+			if p := state.GetPortAssignment(st, branch, state.ExtraPortService(service, name)); p > 0 {
+				ports[name] = p
+			}
+		}
+		return nil
+	})
+	return ports, err
+}
+
+// Release removes the port assignments and leases for a branch+service,
+// extra ports included.
+func (r *Registry) Release(branch, service string) error {
+	return r.update(func(st *state.State, leases *state.Leases) (bool, error) {
 		delete(st.PortAssignments, state.PortKey(branch, service))
-		return r.store.Save(st)
+		extraPrefix := state.PortKey(branch, state.ExtraPortService(service, ""))
+		for key := range st.PortAssignments {
+			if strings.HasPrefix(key, extraPrefix) {
+				delete(st.PortAssignments, key)
+			}
+		}
+		return true, nil
+	})
+}
+
+// PruneBranches removes the service state and port assignments of branches
+// that are not active, releasing their leases, and returns the branches
+// whose service state was removed.
+func (r *Registry) PruneBranches(active map[string]bool) ([]string, error) {
+	var pruned []string
+	err := r.update(func(st *state.State, _ *state.Leases) (bool, error) {
+		pruned = state.OrphanedBranches(st, active)
+		for _, branch := range pruned {
+			delete(st.Services, branch)
+		}
+		changed := len(pruned) > 0
+		for key := range st.PortAssignments {
+			if branch, _ := state.ParsePortKey(key); !active[branch] {
+				delete(st.PortAssignments, key)
+				changed = true
+			}
+		}
+		return changed, nil
 	})
+	return pruned, err
 }
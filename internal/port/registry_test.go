@@ -1,6 +1,10 @@
 package port
 
 import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/fairy-pitta/portree/internal/config"
@@ -27,6 +31,7 @@ func newTestRegistry(t *testing.T) *Registry {
 		Worktrees: map[string]config.WTOverride{},
 	}
 
+	t.Setenv("XDG_STATE_HOME", t.TempDir()) // no user-level port leases
 	return NewRegistry(store, cfg)
 }
 
@@ -135,3 +140,217 @@ func TestRegistryRelease(t *testing.T) {
 		}
 	})
 }
+
+func TestRegistrySetConfig(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.SetConfig(&config.Config{
+		Services: map[string]config.ServiceConfig{
+			"api": {Command: "go run .", PortRange: config.PortRange{Min: 8100, Max: 8199}, ProxyPort: 8000},
+		},
+	})
+
+	port, err := reg.AssignPort("main", "api")
+	if err != nil {
+		t.Fatalf("AssignPort() after SetConfig error: %v", err)
+	}
+	if port < 8100 || port > 8199 {
+		t.Errorf("AssignPort() = %d, not in [8100, 8199]", port)
+	}
+}
+
+func TestRegistryAssignExtraPorts(t *testing.T) {
+	reg := newTestRegistry(t)
+	cfg := reg.cfg.Load()
+	web := cfg.Services["web"]
+	web.ExtraPorts = map[string]config.PortRange{
+		"hmr":     {Min: 24600, Max: 24699},
+		"inspect": {Min: 24600, Max: 24699}, // shared range
+	}
+	cfg.Services["web"] = web
+
+	if got, err := reg.GetExtraPorts("main", "web"); err != nil || len(got) != 0 {
+		t.Fatalf("GetExtraPorts() before assignment = %v, %v, want none", got, err)
+	}
+
+	first, err := reg.AssignExtraPorts("main", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reg.GetExtraPorts("main", "web"); err != nil || !maps.Equal(got, first) {
+		t.Errorf("GetExtraPorts() = %v, %v, want %v", got, err, first)
+	}
+	if len(first) != 2 || first["hmr"] == first["inspect"] {
+		t.Fatalf("AssignExtraPorts() = %v, want two distinct ports", first)
+	}
+	for name, p := range first {
+		if p < 24600 || p > 24699 {
+			t.Errorf("extra port %s = %d, not in [24600, 24699]", name, p)
+		}
+	}
+
+	second, err := reg.AssignExtraPorts("main", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second["hmr"] != first["hmr"] || second["inspect"] != first["inspect"] {
+		t.Errorf("AssignExtraPorts not idempotent: %v != %v", second, first)
+	}
+
+	other, err := reg.AssignExtraPorts("feature/x", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, p := range other {
+		if p == first["hmr"] || p == first["inspect"] {
+			t.Errorf("feature/x extra port %s = %d collides with main's %v", name, p, first)
+		}
+	}
+
+	if err := reg.Release("main", "web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.store.WithLock(func() error {
+		st, err := reg.store.Load()
+		if err != nil {
+			return err
+		}
+		if p := state.GetPortAssignment(st, "main", state.ExtraPortService("web", "hmr")); p != 0 {
+			t.Errorf("extra port after Release = %d, want 0", p)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryLeasesAcrossRepos(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"web": {Command: "npm start", PortRange: config.PortRange{Min: 3100, Max: 3101}, ProxyPort: 3000},
+		},
+	}
+	newRepo := func() *Registry {
+		store, err := state.NewFileStore(filepath.Join(t.TempDir(), ".portree"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewRegistry(store, cfg)
+	}
+	a, b := newRepo(), newRepo()
+
+	pa, err := a.AssignPort("main", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := b.AssignPort("main", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pa == pb {
+		t.Fatalf("two repositories were assigned the same port %d", pa)
+	}
+	if _, err := newRepo().AssignPort("main", "web"); err == nil {
+		t.Error("a third repository should find the two-port range leased")
+	}
+
+	// Releasing a port lets another repository have it.
+	if err := a.Release("main", "web"); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := newRepo().AssignPort("main", "web"); err != nil || p != pa {
+		t.Errorf("AssignPort() after release = %d, %v, want %d", p, err, pa)
+	}
+
+	// A fixed port leased by another repository is reported.
+	fixed := *cfg
+	fixed.Worktrees = map[string]config.WTOverride{
+		"main": {Services: map[string]config.WTServiceOverride{"web": {Port: pb}}},
+	}
+	c := newRepo()
+	c.SetConfig(&fixed)
+	if _, err := c.AssignPort("main", "web"); err == nil || !strings.Contains(err.Error(), "is leased by main/web") {
+		t.Errorf("AssignPort() of a leased fixed port error = %v", err)
+	}
+}
+
+func TestRegistryReassignsPortsLeasedElsewhere(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"web": {
+				Command:    "npm start",
+				PortRange:  config.PortRange{Min: 3100, Max: 3101},
+				ProxyPort:  3000,
+				ExtraPorts: map[string]config.PortRange{"hmr": {Min: 24600, Max: 24601}},
+			},
+		},
+	}
+	newRepo := func() *Registry {
+		store, err := state.NewFileStore(filepath.Join(t.TempDir(), ".portree"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewRegistry(store, cfg)
+	}
+	assign := func(r *Registry) (int, int) {
+		t.Helper()
+		p, err := r.AssignPort("main", "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		extras, err := r.AssignExtraPorts("main", "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p, extras["hmr"]
+	}
+
+	a, b := newRepo(), newRepo()
+	pa, ha := assign(a)
+
+	// With the leases lost, another repository gets the same ports...
+	if err := os.Remove(filepath.Join(stateHome, "portree", "ports.db")); err != nil {
+		t.Fatal(err)
+	}
+	if pb, hb := assign(b); pb != pa || hb != ha {
+		t.Fatalf("b was assigned %d and %d, want %d and %d", pb, hb, pa, ha)
+	}
+
+	// ...and the first one moves on instead of sharing them.
+	if p, h := assign(a); p == pa || h == ha {
+		t.Errorf("a kept %d and %d, which b holds", p, h)
+	}
+}
+
+func TestRegistryPruneBranches(t *testing.T) {
+	r := newTestRegistry(t)
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	r = NewRegistry(r.store, r.cfg.Load()) // with user-level port leases
+
+	for _, branch := range []string{"main", "gone"} {
+		if _, err := r.AssignPort(branch, "web"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.PruneBranches(map[string]bool{"main": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, _ := r.GetPort("gone", "web"); p != 0 {
+		t.Errorf("port of the pruned branch = %d, want none", p)
+	}
+	leases, err := r.leases.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases.Ports) != 1 {
+		t.Errorf("leases after PruneBranches() = %v, want only main's", leases.Ports)
+	}
+	for _, l := range leases.Ports {
+		if l.Branch != "main" {
+			t.Errorf("lease of %s survived PruneBranches()", l.Branch)
+		}
+	}
+}
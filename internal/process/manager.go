@@ -2,11 +2,15 @@ package process
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/fairy-pitta/portree/internal/cert"
 	"github.com/fairy-pitta/portree/internal/config"
 	"github.com/fairy-pitta/portree/internal/git"
 	"github.com/fairy-pitta/portree/internal/logging"
@@ -33,6 +37,20 @@ func NewManager(cfg *config.Config, store *state.FileStore, registry *port.Regis
 	}
 }
 
+// SetConfig replaces the configuration used for services started from now
+// on. Running services keep the command and environment they started with.
+func (m *Manager) SetConfig(cfg *config.Config) {
+	m.mu.Lock()
+	m.cfg = cfg
+	m.mu.Unlock()
+}
+
+func (m *Manager) config() *config.Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg
+}
+
 func (m *Manager) setRunner(key string, r *Runner) {
 	m.mu.Lock()
 	m.runners[key] = r
@@ -61,17 +79,30 @@ type ServiceResult struct {
 	Err     error
 }
 
-// StartServices starts services for the given worktree.
-// If serviceFilter is non-empty, only that service is started.
+// StartServices starts services for the given worktree, dependencies
+// first. If serviceFilter is non-empty, only that service is started.
 func (m *Manager) StartServices(tree *git.Worktree, serviceFilter string) []ServiceResult {
 	var results []ServiceResult
 
-	services := m.targetServices(serviceFilter)
+	cfg := m.config()
+	services := cfg.StartOrder(enabledServices(cfg, tree.Branch, serviceFilter))
+	if serviceFilter != "" && len(services) == 0 {
+		if _, ok := cfg.Services[serviceFilter]; ok {
+			return []ServiceResult{{
+				Branch: tree.Branch, Service: serviceFilter,
+				Err: fmt.Errorf("service %q is disabled for %s", serviceFilter, tree.Branch),
+			}}
+		}
+	}
 
 	// First allocate all ports so cross-service env vars are available.
 	portMap := map[string]int{}
+	extraPorts := map[string]map[string]int{}
 	for _, svcName := range services {
 		p, err := m.registry.AssignPort(tree.Branch, svcName)
+		if err == nil {
+			extraPorts[svcName], err = m.registry.AssignExtraPorts(tree.Branch, svcName)
+		}
 		if err != nil {
 			results = append(results, ServiceResult{
 				Branch: tree.Branch, Service: svcName, Err: err,
@@ -83,24 +114,11 @@ func (m *Manager) StartServices(tree *git.Worktree, serviceFilter string) []Serv
 
 	// Build proxy port map for cross-service URLs.
 	proxyPorts := map[string]int{}
-	for svcName, svc := range m.cfg.Services {
+	for svcName, svc := range cfg.Services {
 		proxyPorts[svcName] = svc.ProxyPort
 	}
 
-	// Determine proxy scheme from state.
-	proxyScheme := "http"
-	if err := m.store.WithLock(func() error {
-		st, e := m.store.Load()
-		if e != nil {
-			return e
-		}
-		if st.Proxy.HTTPS {
-			proxyScheme = "https"
-		}
-		return nil
-	}); err != nil {
-		logging.Warn("failed to load proxy state for scheme: %v", err)
-	}
+	proxyScheme := m.proxyScheme()
 
 	slug := tree.Slug()
 
@@ -122,13 +140,54 @@ func (m *Manager) StartServices(tree *git.Worktree, serviceFilter string) []Serv
 			continue
 		}
 
-		svc := m.cfg.Services[svcName]
-		command := m.cfg.CommandForBranch(svcName, tree.Branch)
-		env := m.cfg.EnvForBranch(svcName, tree.Branch)
+		svc := cfg.Services[svcName]
+		var tlsCert, tlsKey, caCert string
+		if svc.BackendTLS {
+			var err error
+			if tlsCert, tlsKey, caCert, err = m.backendCert(cfg, slug); err != nil {
+				results = append(results, ServiceResult{
+					Branch: tree.Branch, Service: svcName, Port: p, Err: err,
+				})
+				continue
+			}
+		}
+
+		rc := RunnerConfig{
+			ServiceName:          svcName,
+			Branch:               tree.Branch,
+			BranchSlug:           slug,
+			Port:                 p,
+			LogDir:               filepath.Join(m.store.Dir(), "logs"),
+			AllServicePorts:      portMap,
+			AllExtraPorts:        extraPorts,
+			AllServiceProxyPorts: proxyPorts,
+			ProxyScheme:          proxyScheme,
+			TLSCert:              tlsCert,
+			TLSKey:               tlsKey,
+			CACert:               caCert,
+		}
+
+		// Expand ${...} references in the command, dir and env.
+		vars := config.Vars{Slug: slug, WorktreePath: tree.Path, Auto: rc.AutoEnv()}
+		command, err := cfg.CommandForBranch(svcName, tree.Branch, vars)
+		if err == nil {
+			rc.Env, err = cfg.EnvForBranch(svcName, tree.Branch, vars)
+		}
+		var relDir string
+		if err == nil {
+			relDir, err = cfg.DirForBranch(svcName, tree.Branch, vars)
+		}
+		if err != nil {
+			results = append(results, ServiceResult{
+				Branch: tree.Branch, Service: svcName, Port: p, Err: err,
+			})
+			continue
+		}
+		rc.Command = command
 
 		dir := tree.Path
-		if svc.Dir != "" {
-			dir = filepath.Join(tree.Path, svc.Dir)
+		if relDir != "" {
+			dir = filepath.Join(tree.Path, relDir)
 		}
 
 		// Validate the resolved directory stays within the worktree root.
@@ -137,25 +196,13 @@ func (m *Manager) StartServices(tree *git.Worktree, serviceFilter string) []Serv
 		if cleanDir != cleanRoot && !strings.HasPrefix(cleanDir, cleanRoot+string(filepath.Separator)) {
 			results = append(results, ServiceResult{
 				Branch: tree.Branch, Service: svcName,
-				Err: fmt.Errorf("service directory %q resolves outside worktree root", svc.Dir),
+				Err: fmt.Errorf("service directory %q resolves outside worktree root", relDir),
 			})
 			continue
 		}
+		rc.Dir = dir
 
-		runner := NewRunner(RunnerConfig{
-			ServiceName:          svcName,
-			Branch:               tree.Branch,
-			BranchSlug:           slug,
-			Command:              command,
-			Dir:                  dir,
-			Port:                 p,
-			Env:                  env,
-			LogDir:               filepath.Join(m.store.Dir(), "logs"),
-			AllServicePorts:      portMap,
-			AllServiceProxyPorts: proxyPorts,
-			ProxyScheme:          proxyScheme,
-		})
-
+		runner := NewRunner(rc)
 		pid, err := runner.Start()
 		result := ServiceResult{
 			Branch: tree.Branch, Service: svcName, Port: p, PID: pid, Err: err,
@@ -182,10 +229,147 @@ func (m *Manager) StartServices(tree *git.Worktree, serviceFilter string) []Serv
 	return results
 }
 
-// StopServices stops services for the given worktree.
+// UnassignedPort is the value Environment gives port variables of services
+// that have no port yet; 'portree up' assigns them.
+const UnassignedPort = "(assigned on up)"
+
+// Environment returns the environment service would be started with in
+// tree, with the source of each variable. Like StartServices, it refuses
+// services that are disabled for the branch. It only reads port
+// assignments: ports not assigned yet have the value UnassignedPort.
+func (m *Manager) Environment(tree *git.Worktree, service string) ([]config.EnvVar, error) {
+	cfg := m.config()
+	if _, ok := cfg.Services[service]; !ok {
+		return nil, fmt.Errorf("unknown service %q", service)
+	}
+	if !cfg.ServiceEnabled(service, tree.Branch) {
+		return nil, fmt.Errorf("service %q is disabled for %s", service, tree.Branch)
+	}
+	vars, err := m.lookupVars(cfg, tree, service)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.ExplainEnv(service, tree.Branch, vars)
+}
+
+// ServiceDir returns the directory service runs in within tree, with
+// ${...} references expanded as for Environment.
+func (m *Manager) ServiceDir(tree *git.Worktree, service string) (string, error) {
+	cfg := m.config()
+	if cfg.Services[service].Dir == "" {
+		return tree.Path, nil
+	}
+	vars, err := m.lookupVars(cfg, tree, service)
+	if err != nil {
+		return "", err
+	}
+	dir, err := cfg.DirForBranch(service, tree.Branch, vars)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(tree.Path, dir), nil
+}
+
+// lookupVars returns the variables the config of service can refer to in
+// tree, without assigning ports; see Environment.
+func (m *Manager) lookupVars(cfg *config.Config, tree *git.Worktree, service string) (config.Vars, error) {
+	portMap := map[string]int{}
+	extraPorts := map[string]map[string]int{}
+	proxyPorts := map[string]int{}
+	var unassigned []string // variables of ports not assigned yet
+	for _, name := range enabledServices(cfg, tree.Branch, "") {
+		p, err := m.registry.GetPort(tree.Branch, name)
+		if err == nil {
+			extraPorts[name], err = m.registry.GetExtraPorts(tree.Branch, name)
+		}
+		if err != nil {
+			return config.Vars{}, fmt.Errorf("looking up ports of %s: %w", name, err)
+		}
+		if p == 0 {
+			p = cfg.FixedPortForBranch(name, tree.Branch)
+		}
+		if p == 0 {
+			unassigned = append(unassigned, config.PortVar(name))
+			if name == service {
+				unassigned = append(unassigned, "PORT")
+			}
+		}
+		for extra := range cfg.Services[name].ExtraPorts {
+			if extraPorts[name][extra] == 0 {
+				unassigned = append(unassigned, config.ExtraPortVar(name, extra))
+			}
+		}
+		portMap[name] = p
+		proxyPorts[name] = cfg.Services[name].ProxyPort
+	}
+
+	slug := tree.Slug()
+	rc := RunnerConfig{
+		ServiceName:          service,
+		Branch:               tree.Branch,
+		BranchSlug:           slug,
+		Port:                 portMap[service],
+		AllServicePorts:      portMap,
+		AllExtraPorts:        extraPorts,
+		AllServiceProxyPorts: proxyPorts,
+		ProxyScheme:          m.proxyScheme(),
+	}
+	if cfg.Services[service].BackendTLS {
+		paths, err := cert.RepoPaths(m.store.Dir(), cfg.TLS.LocalCA)
+		if err != nil {
+			return config.Vars{}, err
+		}
+		rc.TLSCert, rc.TLSKey = paths.BackendPaths(slug)
+		rc.CACert = paths.CACert
+	}
+
+	auto := rc.AutoEnv()
+	for _, name := range unassigned {
+		auto[name] = UnassignedPort
+	}
+	return config.Vars{Slug: slug, WorktreePath: tree.Path, Auto: auto}, nil
+}
+
+// proxyScheme returns the scheme the proxy serves, according to state.
+func (m *Manager) proxyScheme() string {
+	scheme := "http"
+	if err := m.store.WithLock(func() error {
+		st, e := m.store.Load()
+		if e != nil {
+			return e
+		}
+		if st.Proxy.HTTPS {
+			scheme = "https"
+		}
+		return nil
+	}); err != nil {
+		logging.Warn("failed to load proxy state for scheme: %v", err)
+	}
+	return scheme
+}
+
+// backendCert returns the certificate, key and CA paths for the backends of
+// the worktree with the given slug, issuing the certificate if needed.
+func (m *Manager) backendCert(cfg *config.Config, slug string) (certPath, keyPath, caPath string, err error) {
+	paths, err := cert.RepoPaths(m.store.Dir(), cfg.TLS.LocalCA)
+	if err != nil {
+		return "", "", "", err
+	}
+	certPath, keyPath, err = cert.EnsureBackendCert(paths, slug)
+	if err != nil {
+		return "", "", "", fmt.Errorf("issuing backend certificate: %w", err)
+	}
+	return certPath, keyPath, paths.CACert, nil
+}
+
+// StopServices stops services for the given worktree, dependents first.
 func (m *Manager) StopServices(tree *git.Worktree, serviceFilter string) []ServiceResult {
 	var results []ServiceResult
-	services := m.targetServices(serviceFilter)
+	// Disabled services are included so that ones started before they were
+	// disabled can still be stopped.
+	cfg := m.config()
+	services := cfg.StartOrder(serviceNames(cfg, serviceFilter))
+	slices.Reverse(services)
 
 	for _, svcName := range services {
 		key := tree.Branch + ":" + svcName
@@ -254,16 +438,27 @@ func (m *Manager) cleanStale(branch, service string) {
 	}
 }
 
-// targetServices returns sorted service names, optionally filtered.
-func (m *Manager) targetServices(filter string) []string {
+// enabledServices returns the sorted names of the services enabled for
+// branch, optionally filtered.
+func enabledServices(cfg *config.Config, branch, filter string) []string {
+	var names []string
+	for _, name := range serviceNames(cfg, filter) {
+		if cfg.ServiceEnabled(name, branch) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func serviceNames(cfg *config.Config, filter string) []string {
 	if filter != "" {
-		if _, ok := m.cfg.Services[filter]; ok {
+		if _, ok := cfg.Services[filter]; ok {
 			return []string{filter}
 		}
 		return nil
 	}
-	names := make([]string, 0, len(m.cfg.Services))
-	for name := range m.cfg.Services {
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
 		names = append(names, name)
 	}
 	sort.Strings(names)
@@ -280,3 +475,61 @@ func (m *Manager) StatusAll() (*state.State, error) {
 	})
 	return st, err
 }
+
+// proxyLogName is the access log 'portree proxy start' writes next to the
+// service logs.
+const proxyLogName = "proxy-access.log"
+
+// logFileName is the name of the log of service in the worktree with the
+// branch slug slug.
+func logFileName(slug, service string) string {
+	return fmt.Sprintf("%s.%s.log", slug, service)
+}
+
+// PruneLogs removes the logs in the state directory that were not written
+// to for maxAge, except those of running services and of a running proxy.
+// It returns the paths removed.
+func (m *Manager) PruneLogs(maxAge time.Duration) ([]string, error) {
+	dir := filepath.Join(m.store.Dir(), "logs")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading log dir: %w", err)
+	}
+	st, err := m.StatusAll()
+	if err != nil {
+		return nil, err
+	}
+
+	keep := map[string]bool{}
+	for branch, services := range st.Services {
+		for name, ss := range services {
+			if ss.Status == state.StatusRunning {
+				keep[logFileName(git.BranchSlug(branch), name)] = true
+			}
+		}
+	}
+	if st.Proxy.Status == state.StatusRunning {
+		keep[proxyLogName] = true
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var removed []string
+	for _, e := range entries {
+		if e.IsDir() || keep[e.Name()] || !strings.HasSuffix(e.Name(), ".log") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("removing old log: %w", err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
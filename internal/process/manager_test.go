@@ -1,6 +1,10 @@
 package process
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
@@ -10,7 +14,7 @@ import (
 	"github.com/fairy-pitta/portree/internal/state"
 )
 
-func TestTargetServices(t *testing.T) {
+func TestEnabledServices(t *testing.T) {
 	cfg := &config.Config{
 		Services: map[string]config.ServiceConfig{
 			"web":    {Command: "npm start"},
@@ -18,30 +22,63 @@ func TestTargetServices(t *testing.T) {
 			"worker": {Command: "python worker.py"},
 		},
 	}
-	store, _ := state.NewFileStore(t.TempDir())
-	m := NewManager(cfg, store, nil)
 
 	t.Run("no filter returns sorted", func(t *testing.T) {
-		got := m.targetServices("")
-		if len(got) != 3 {
-			t.Fatalf("targetServices() returned %d, want 3", len(got))
-		}
-		if got[0] != "api" || got[1] != "web" || got[2] != "worker" {
-			t.Errorf("targetServices() = %v, want [api, web, worker]", got)
+		got := enabledServices(cfg, "main", "")
+		if !reflect.DeepEqual(got, []string{"api", "web", "worker"}) {
+			t.Errorf("enabledServices() = %v, want [api web worker]", got)
 		}
 	})
 
 	t.Run("filter exists", func(t *testing.T) {
-		got := m.targetServices("web")
+		got := enabledServices(cfg, "main", "web")
 		if len(got) != 1 || got[0] != "web" {
-			t.Errorf("targetServices(web) = %v, want [web]", got)
+			t.Errorf("enabledServices(web) = %v, want [web]", got)
 		}
 	})
 
 	t.Run("filter not found", func(t *testing.T) {
-		got := m.targetServices("nonexistent")
+		got := enabledServices(cfg, "main", "nonexistent")
 		if got != nil {
-			t.Errorf("targetServices(nonexistent) = %v, want nil", got)
+			t.Errorf("enabledServices(nonexistent) = %v, want nil", got)
+		}
+	})
+
+	t.Run("start order follows dependencies", func(t *testing.T) {
+		deps := &config.Config{
+			Services: map[string]config.ServiceConfig{
+				"web":    {Command: "npm start", DependsOn: []string{"api"}},
+				"api":    {Command: "go run .", DependsOn: []string{"worker"}},
+				"worker": {Command: "python worker.py"},
+			},
+		}
+		got := deps.StartOrder(enabledServices(deps, "main", ""))
+		if !reflect.DeepEqual(got, []string{"worker", "api", "web"}) {
+			t.Errorf("StartOrder(enabledServices()) = %v, want [worker api web]", got)
+		}
+	})
+
+	t.Run("disabled services are skipped", func(t *testing.T) {
+		off := false
+		cfg.Services["worker"] = config.ServiceConfig{Command: "python worker.py", Enabled: &off}
+		cfg.Services["web"] = config.ServiceConfig{Command: "npm start", ExceptBranches: []string{"data/*"}}
+		got := enabledServices(cfg, "data/x", "")
+		if len(got) != 1 || got[0] != "api" {
+			t.Errorf("enabledServices(data/x) = %v, want [api]", got)
+		}
+		if got := enabledServices(cfg, "data/x", "web"); got != nil {
+			t.Errorf("enabledServices(data/x, web) = %v, want nil", got)
+		}
+
+		store, _ := state.NewFileStore(t.TempDir())
+		m := NewManager(cfg, store, nil)
+		tree := &git.Worktree{Branch: "data/x", Path: t.TempDir()}
+		results := m.StartServices(tree, "worker")
+		if len(results) != 1 || results[0].Err == nil || results[0].Err.Error() != `service "worker" is disabled for data/x` {
+			t.Errorf("StartServices(worker) = %+v", results)
+		}
+		if _, err := m.Environment(tree, "worker"); err == nil || err.Error() != `service "worker" is disabled for data/x` {
+			t.Errorf("Environment(worker) error = %v", err)
 		}
 	})
 }
@@ -102,6 +139,7 @@ func newTestManager(t *testing.T) (*Manager, *state.FileStore) {
 		Worktrees: map[string]config.WTOverride{},
 	}
 
+	t.Setenv("XDG_STATE_HOME", t.TempDir()) // no user-level port leases
 	registry := port.NewRegistry(store, cfg)
 	mgr := NewManager(cfg, store, registry)
 	return mgr, store
@@ -194,6 +232,27 @@ func TestManagerStartStopServices(t *testing.T) {
 	}
 }
 
+func TestManagerServiceDir(t *testing.T) {
+	mgr, _ := newTestManager(t)
+	tree := &git.Worktree{Path: t.TempDir(), Branch: "feature/x"}
+
+	if dir, err := mgr.ServiceDir(tree, "web"); err != nil || dir != tree.Path {
+		t.Errorf("ServiceDir() without dir = %q, %v, want the worktree", dir, err)
+	}
+
+	cfg := mgr.config()
+	web := cfg.Services["web"]
+	web.Dir = "apps/${slug}"
+	cfg.Services["web"] = web
+	want := filepath.Join(tree.Path, "apps", "feature-x")
+	if dir, err := mgr.ServiceDir(tree, "web"); err != nil || dir != want {
+		t.Errorf("ServiceDir() = %q, %v, want %q", dir, err, want)
+	}
+	if st, _ := mgr.store.Load(); len(st.PortAssignments) != 0 {
+		t.Errorf("ServiceDir() assigned ports: %v", st.PortAssignments)
+	}
+}
+
 func TestManagerCleanStale(t *testing.T) {
 	dir := t.TempDir()
 	store, err := state.NewFileStore(dir)
@@ -223,6 +282,7 @@ func TestManagerCleanStale(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	t.Setenv("XDG_STATE_HOME", t.TempDir()) // no user-level port leases
 	mgr := NewManager(cfg, store, port.NewRegistry(store, cfg))
 
 	// cleanStale should detect the dead PID and update state.
@@ -280,3 +340,55 @@ func TestManagerStopWithoutStart(t *testing.T) {
 		t.Errorf("StopServices error: %v", results[0].Err)
 	}
 }
+
+func TestManagerPruneLogs(t *testing.T) {
+	store, _ := state.NewFileStore(t.TempDir())
+	m := NewManager(&config.Config{}, store, nil)
+
+	if removed, err := m.PruneLogs(time.Hour); err != nil || removed != nil {
+		t.Fatalf("PruneLogs() without a log dir = %v, %v", removed, err)
+	}
+
+	if err := store.WithLock(func() error {
+		st, err := store.Load()
+		if err != nil {
+			return err
+		}
+		state.SetServiceState(st, "feature/x", "web", state.RunningServiceState(3100, 1))
+		state.SetServiceState(st, "main", "web", state.StoppedServiceState(3101))
+		return store.Save(st)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(store.Dir(), "logs")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for name, age := range map[string]time.Time{
+		"feature-x.web.log": old, // running
+		"main.web.log":      old,
+		"main.api.log":      time.Now(),
+		"proxy-access.log":  old,
+		"notes.txt":         old,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, age, age); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := m.PruneLogs(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "main.web.log"), filepath.Join(dir, "proxy-access.log")}
+	sort.Strings(removed)
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("PruneLogs() removed %v, want %v", removed, want)
+	}
+}
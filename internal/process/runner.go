@@ -6,10 +6,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/fairy-pitta/portree/internal/config"
 	"github.com/fairy-pitta/portree/internal/logging"
 )
 
@@ -27,10 +30,17 @@ type RunnerConfig struct {
 	LogDir      string            // directory for log files
 	// AllServicePorts maps service name -> assigned port for cross-service env vars.
 	AllServicePorts map[string]int
+	// AllExtraPorts maps service name -> extra port name -> assigned port.
+	AllExtraPorts map[string]map[string]int
 	// AllServiceProxyPorts maps service name -> proxy port for URL env vars.
 	AllServiceProxyPorts map[string]int
 	// ProxyScheme is "http" or "https" for PT_*_URL env vars.
 	ProxyScheme string
+	// TLSCert, TLSKey and CACert are the certificate, key and CA file paths
+	// for services with backend_tls; empty otherwise.
+	TLSCert string
+	TLSKey  string
+	CACert  string
 }
 
 // Runner manages a single child process.
@@ -62,7 +72,7 @@ func (r *Runner) Start() (int, error) {
 		return 0, fmt.Errorf("creating log dir: %w", err)
 	}
 
-	logPath := filepath.Join(r.config.LogDir, fmt.Sprintf("%s.%s.log", r.config.BranchSlug, r.config.ServiceName))
+	logPath := filepath.Join(r.config.LogDir, logFileName(r.config.BranchSlug, r.config.ServiceName))
 	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 	if err != nil {
 		return 0, fmt.Errorf("opening log file: %w", err)
@@ -221,27 +231,54 @@ func (r *Runner) buildEnv() []string {
 		env = append(env, k+"="+v)
 	}
 
-	// Add portree auto-injected vars.
-	env = append(env,
-		fmt.Sprintf("PORT=%d", r.config.Port),
-		fmt.Sprintf("PT_BRANCH=%s", r.config.Branch),
-		fmt.Sprintf("PT_BRANCH_SLUG=%s", r.config.BranchSlug),
-		fmt.Sprintf("PT_SERVICE=%s", r.config.ServiceName),
-	)
+	// Add portree auto-injected vars, in a stable order.
+	auto := r.config.AutoEnv()
+	keys := make([]string, 0, len(auto))
+	for k := range auto {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+auto[k])
+	}
+
+	return env
+}
 
-	// Add cross-service port and URL vars.
-	for svcName, svcPort := range r.config.AllServicePorts {
-		upper := strings.ToUpper(svcName)
-		env = append(env, fmt.Sprintf("PT_%s_PORT=%d", upper, svcPort))
+// AutoEnv returns the variables portree injects into every service: PORT,
+// PT_BRANCH, PT_BRANCH_SLUG, PT_SERVICE, PT_<SERVICE>_PORT and
+// PT_<SERVICE>_URL for each service, PT_<SERVICE>_<NAME>_PORT for each
+// extra port, and PT_TLS_* with backend_tls. Config values can refer to
+// them as ${NAME}.
+func (c RunnerConfig) AutoEnv() map[string]string {
+	env := map[string]string{
+		"PORT":           strconv.Itoa(c.Port),
+		"PT_BRANCH":      c.Branch,
+		"PT_BRANCH_SLUG": c.BranchSlug,
+		"PT_SERVICE":     c.ServiceName,
+	}
+	for svcName, svcPort := range c.AllServicePorts {
+		env[config.PortVar(svcName)] = strconv.Itoa(svcPort)
 	}
-	scheme := r.config.ProxyScheme
+	for svcName, extras := range c.AllExtraPorts {
+		for name, p := range extras {
+			env[config.ExtraPortVar(svcName, name)] = strconv.Itoa(p)
+		}
+	}
+	scheme := c.ProxyScheme
 	if scheme == "" {
 		scheme = "http"
 	}
-	for svcName, proxyPort := range r.config.AllServiceProxyPorts {
-		upper := strings.ToUpper(svcName)
-		env = append(env, fmt.Sprintf("PT_%s_URL=%s://%s.localhost:%d", upper, scheme, r.config.BranchSlug, proxyPort))
+	for svcName, proxyPort := range c.AllServiceProxyPorts {
+		if proxyPort == 0 {
+			continue // not proxied
+		}
+		env["PT_"+strings.ToUpper(svcName)+"_URL"] = fmt.Sprintf("%s://%s.localhost:%d", scheme, c.BranchSlug, proxyPort)
+	}
+	if c.TLSCert != "" {
+		env["PT_TLS_CERT"] = c.TLSCert
+		env["PT_TLS_KEY"] = c.TLSKey
+		env["PT_CA_CERT"] = c.CACert
 	}
-
 	return env
 }
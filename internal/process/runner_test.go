@@ -30,6 +30,10 @@ func TestBuildEnv(t *testing.T) {
 				"web": 3000,
 				"api": 8000,
 			},
+			AllExtraPorts: map[string]map[string]int{
+				"web": {"hmr": 24610},
+				"api": {"inspect": 9229},
+			},
 		},
 	}
 
@@ -85,6 +89,15 @@ func TestBuildEnv(t *testing.T) {
 		}
 	})
 
+	t.Run("extra ports", func(t *testing.T) {
+		if lookup["PT_WEB_HMR_PORT"] != "24610" {
+			t.Errorf("PT_WEB_HMR_PORT = %q, want %q", lookup["PT_WEB_HMR_PORT"], "24610")
+		}
+		if lookup["PT_API_INSPECT_PORT"] != "9229" {
+			t.Errorf("PT_API_INSPECT_PORT = %q, want %q", lookup["PT_API_INSPECT_PORT"], "9229")
+		}
+	})
+
 	t.Run("cross-service URLs", func(t *testing.T) {
 		if lookup["PT_WEB_URL"] != "http://feature-auth.localhost:3000" {
 			t.Errorf("PT_WEB_URL = %q, want %q", lookup["PT_WEB_URL"], "http://feature-auth.localhost:3000")
@@ -416,3 +429,38 @@ func TestIsPortAvailable(t *testing.T) {
 		}
 	})
 }
+
+func TestBuildEnv_BackendTLS(t *testing.T) {
+	lookupEnv := func(cfg RunnerConfig) map[string]string {
+		lookup := make(map[string]string)
+		for _, e := range (&Runner{config: cfg}).buildEnv() {
+			parts := strings.SplitN(e, "=", 2)
+			if len(parts) == 2 {
+				lookup[parts[0]] = parts[1]
+			}
+		}
+		return lookup
+	}
+
+	plain := lookupEnv(RunnerConfig{ServiceName: "web", Port: 3000})
+	if _, ok := plain["PT_TLS_CERT"]; ok {
+		t.Error("PT_TLS_CERT should not be set without backend_tls")
+	}
+
+	tlsEnv := lookupEnv(RunnerConfig{
+		ServiceName: "web",
+		Port:        3000,
+		TLSCert:     "/certs/main.crt",
+		TLSKey:      "/certs/main.key",
+		CACert:      "/ca/ca.crt",
+	})
+	for k, want := range map[string]string{
+		"PT_TLS_CERT": "/certs/main.crt",
+		"PT_TLS_KEY":  "/certs/main.key",
+		"PT_CA_CERT":  "/ca/ca.crt",
+	} {
+		if tlsEnv[k] != want {
+			t.Errorf("%s = %q, want %q", k, tlsEnv[k], want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/logging"
+)
+
+// Access log formats.
+const (
+	AccessLogJSON   = "json"
+	AccessLogCommon = "common"
+	AccessLogOff    = "off"
+)
+
+// AccessLogEntry is one line of the JSON access log.
+type AccessLogEntry struct {
+	Time        time.Time `json:"time"`
+	RemoteAddr  string    `json:"remote_addr"`
+	Method      string    `json:"method"`
+	Host        string    `json:"host"`
+	Path        string    `json:"path"`
+	Proto       string    `json:"proto"`
+	Slug        string    `json:"slug,omitempty"`
+	Branch      string    `json:"branch,omitempty"`
+	Service     string    `json:"service,omitempty"`
+	BackendPort int       `json:"backend_port,omitempty"`
+	Status      int       `json:"status"`
+	Bytes       int64     `json:"bytes"`
+	DurationMS  float64   `json:"duration_ms"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// AccessLog writes one line per proxied request. It is safe for concurrent use.
+type AccessLog struct {
+	format string
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// ValidAccessLogFormat reports whether format is a supported access log format.
+func ValidAccessLogFormat(format string) bool {
+	switch format {
+	case AccessLogJSON, AccessLogCommon, AccessLogOff:
+		return true
+	}
+	return false
+}
+
+// OpenAccessLog opens (or creates) the access log at path for appending.
+func OpenAccessLog(path, format string) (*AccessLog, error) {
+	if !ValidAccessLogFormat(format) || format == AccessLogOff {
+		return nil, fmt.Errorf("unsupported access log format %q (want %s or %s)", format, AccessLogJSON, AccessLogCommon)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening access log: %w", err)
+	}
+	return &AccessLog{format: format, w: f, closer: f}, nil
+}
+
+// NewAccessLog returns an AccessLog writing to w.
+func NewAccessLog(w io.Writer, format string) *AccessLog {
+	return &AccessLog{format: format, w: w}
+}
+
+// Close closes the underlying file, if any.
+func (l *AccessLog) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// Log writes e in the configured format.
+func (l *AccessLog) Log(e AccessLogEntry) {
+	var line []byte
+	switch l.format {
+	case AccessLogCommon:
+		line = []byte(formatCommon(e))
+	default:
+		data, err := json.Marshal(e)
+		if err != nil {
+			logging.Warn("access log: encoding entry: %v", err)
+			return
+		}
+		line = append(data, '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		logging.Warn("access log: %v", err)
+	}
+}
+
+// formatCommon renders e in Common Log Format, followed by the portree
+// routing fields as key=value pairs:
+//
+//	127.0.0.1 - - [10/Oct/2025:13:55:36 +0900] "GET / HTTP/1.1" 200 512 slug=main service=web backend_port=3100 duration_ms=1.52
+func formatCommon(e AccessLogEntry) string {
+	host := e.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" {
+		host = "-"
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	line := fmt.Sprintf("%s - - [%s] %q %d %s slug=%s service=%s backend_port=%d duration_ms=%s",
+		host,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+e.Path+" "+e.Proto,
+		e.Status,
+		size,
+		orDash(e.Slug),
+		orDash(e.Service),
+		e.BackendPort,
+		strconv.FormatFloat(e.DurationMS, 'f', 2, 64),
+	)
+	if e.Error != "" {
+		line += " error=" + strconv.Quote(e.Error)
+	}
+	return line + "\n"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// observeMiddleware records metrics and access log lines for every request.
+// Either of m and log may be nil.
+func observeMiddleware(m *Metrics, log *AccessLog, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, info := withRequestInfo(r)
+		rec := newResponseRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		elapsed := time.Since(start)
+		status := rec.Status()
+		if status == 0 && !info.Dropped {
+			// The handler returned without writing anything; net/http
+			// sends an implicit 200.
+			status = http.StatusOK
+		}
+		if m != nil {
+			slug := info.Slug
+			if info.Branch == "" { // no route matched
+				slug = unknownSlug
+			}
+			m.Observe(slug, info.Service, status, rec.bytes, elapsed, info.UpstreamErr != nil)
+		}
+		if log != nil {
+			e := AccessLogEntry{
+				Time:        start,
+				RemoteAddr:  r.RemoteAddr,
+				Method:      r.Method,
+				Host:        r.Host,
+				Path:        r.URL.RequestURI(),
+				Proto:       r.Proto,
+				Slug:        info.Slug,
+				Branch:      info.Branch,
+				Service:     info.Service,
+				BackendPort: info.BackendPort,
+				Status:      status,
+				Bytes:       rec.bytes,
+				DurationMS:  float64(elapsed.Microseconds()) / 1000,
+			}
+			if info.UpstreamErr != nil {
+				e.Error = info.UpstreamErr.Error()
+			}
+			log.Log(e)
+		}
+	})
+}
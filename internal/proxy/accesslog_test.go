@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/state"
+)
+
+// setupObserveTest returns a proxy routing feature-auth.localhost:3000 to a
+// backend replying "hello", with l (which may be nil) as its access log.
+func setupObserveTest(t *testing.T, l *AccessLog) (*ProxyServer, http.Handler) {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	t.Cleanup(backend.Close)
+
+	var backendPort int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &backendPort)
+
+	p, store := setupProxyTest(t)
+	st, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetPortAssignment(st, "feature/auth", "web", backendPort)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	if l != nil {
+		p.EnableAccessLog(l)
+	}
+	return p, p.middlewares(3000, p.handler(3000))
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var out bytes.Buffer
+	_, handler := setupObserveTest(t, NewAccessLog(&out, AccessLogJSON))
+
+	req := httptest.NewRequest("GET", "http://feature-auth.localhost:3000/api?x=1", nil)
+	req.Host = "feature-auth.localhost:3000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var e AccessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+		t.Fatalf("access log line is not JSON: %v\n%s", err, out.String())
+	}
+	if e.Slug != "feature-auth" || e.Service != "web" || e.Branch != "feature/auth" {
+		t.Errorf("route fields = %q/%q/%q", e.Slug, e.Service, e.Branch)
+	}
+	if e.BackendPort == 0 {
+		t.Error("BackendPort not recorded")
+	}
+	if e.Status != http.StatusOK || e.Bytes != 5 {
+		t.Errorf("Status/Bytes = %d/%d, want 200/5", e.Status, e.Bytes)
+	}
+	if e.Path != "/api?x=1" || e.Method != "GET" {
+		t.Errorf("Method/Path = %s %s", e.Method, e.Path)
+	}
+}
+
+func TestAccessLogUpstreamError(t *testing.T) {
+	var out bytes.Buffer
+	p, _ := setupProxyTest(t) // routes feature-auth to port 3150, where nothing listens
+	p.EnableAccessLog(NewAccessLog(&out, AccessLogJSON))
+	handler := p.middlewares(3000, p.handler(3000))
+
+	req := httptest.NewRequest("GET", "http://feature-auth.localhost:3000/", nil)
+	req.Host = "feature-auth.localhost:3000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var e AccessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != http.StatusBadGateway {
+		t.Errorf("Status = %d, want 502", e.Status)
+	}
+	if e.Error == "" {
+		t.Error("Error should describe the upstream failure")
+	}
+}
+
+func TestFormatCommon(t *testing.T) {
+	e := AccessLogEntry{
+		Time:        time.Date(2025, 10, 10, 13, 55, 36, 0, time.UTC),
+		RemoteAddr:  "127.0.0.1:54321",
+		Method:      "GET",
+		Path:        "/index.html",
+		Proto:       "HTTP/1.1",
+		Slug:        "main",
+		Service:     "web",
+		BackendPort: 3100,
+		Status:      200,
+		Bytes:       512,
+		DurationMS:  1.5,
+	}
+	want := `127.0.0.1 - - [10/Oct/2025:13:55:36 +0000] "GET /index.html HTTP/1.1" 200 512 slug=main service=web backend_port=3100 duration_ms=1.50` + "\n"
+	if got := formatCommon(e); got != want {
+		t.Errorf("formatCommon() =\n%s\nwant\n%s", got, want)
+	}
+
+	e.Slug, e.Service, e.Bytes = "", "", 0
+	if got := formatCommon(e); !strings.Contains(got, " 200 - slug=- service=- ") {
+		t.Errorf("empty fields should render as '-': %s", got)
+	}
+}
+
+func TestOpenAccessLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "proxy-access.log")
+	l, err := OpenAccessLog(path, AccessLogCommon)
+	if err != nil {
+		t.Fatalf("OpenAccessLog() error: %v", err)
+	}
+	l.Log(AccessLogEntry{Method: "GET", Path: "/", Proto: "HTTP/1.1", Status: 200})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"GET / HTTP/1.1" 200`) {
+		t.Errorf("log = %q", data)
+	}
+
+	if _, err := OpenAccessLog(path, "xml"); err == nil {
+		t.Error("OpenAccessLog with an unknown format should fail")
+	}
+}
@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/logging"
+)
+
+// AdminServer exposes the proxy's runtime data (captured exchanges, metrics,
+// ...) over a small HTTP API bound to the loopback interface.
+//
+// Requests must name the loopback address in their Host header and must not
+// carry an Origin header, so web pages cannot reach the API through DNS
+// rebinding. The /api endpoints also require the server's token as a bearer
+// token; /metrics does not, so that scrapers work without one. Requests that
+// change anything must be sent as application/json, which a cross-site form
+// cannot do without a CORS preflight.
+type AdminServer struct {
+	proxy   *ProxyServer
+	version string
+	token   string
+	mux     *http.ServeMux
+	srv     *http.Server
+	ln      net.Listener
+	port    int
+	mu      sync.Mutex
+}
+
+// NewAdminServer creates an AdminServer for p with a new random token.
+// version is reported in HAR exports.
+func NewAdminServer(p *ProxyServer, version string) *AdminServer {
+	a := &AdminServer{proxy: p, version: version, token: rand.Text(), mux: http.NewServeMux()}
+	a.mux.HandleFunc("GET /api/captures", a.listCaptures)
+	a.mux.HandleFunc("DELETE /api/captures", a.clearCaptures)
+	a.mux.HandleFunc("GET /api/captures/har", a.exportHAR)
+	a.mux.HandleFunc("GET /api/captures/{id}", a.getCapture)
+	a.mux.HandleFunc("GET /api/chaos", a.listChaos)
+	a.mux.HandleFunc("POST /api/chaos", a.addChaos)
+	a.mux.HandleFunc("DELETE /api/chaos", a.clearChaos)
+	a.mux.HandleFunc("DELETE /api/chaos/{id}", a.removeChaos)
+	a.mux.HandleFunc("GET /metrics", a.metrics)
+	return a
+}
+
+// Token returns the bearer token the /api endpoints require.
+func (a *AdminServer) Token() string {
+	return a.token
+}
+
+// Handler returns the admin API handler.
+func (a *AdminServer) Handler() http.Handler {
+	return a.guard(a.mux)
+}
+
+// guard rejects requests that did not come from a local admin client.
+func (a *AdminServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.loopbackHost(r.Host) || r.Header.Get("Origin") != "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(a.token)) != 1 {
+				http.Error(w, "missing or invalid admin token", http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+				http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopbackHost reports whether host is 127.0.0.1, localhost or [::1] with
+// the port the server listens on.
+func (a *AdminServer) loopbackHost(host string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return false
+	}
+	switch name {
+	case "127.0.0.1", "localhost", "::1":
+	default:
+		return false
+	}
+	a.mu.Lock()
+	want := a.port
+	a.mu.Unlock()
+	return want == 0 || port == strconv.Itoa(want)
+}
+
+// Start listens on 127.0.0.1:port (0 picks a free port) and returns the bound port.
+func (a *AdminServer) Start(port int) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		return 0, fmt.Errorf("admin: cannot listen on port %d: %w", port, err)
+	}
+	tcpAddr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		_ = ln.Close()
+		return 0, fmt.Errorf("admin: unexpected listener address %s", ln.Addr())
+	}
+	a.ln = ln
+	a.port = tcpAddr.Port
+	a.srv = &http.Server{
+		Handler:           recoveryMiddleware(a.Handler()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func(s *http.Server, l net.Listener) {
+		if err := s.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error("admin server error: %v", err)
+		}
+	}(a.srv, ln)
+	return a.port, nil
+}
+
+// Stop shuts the admin server down.
+func (a *AdminServer) Stop() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := a.srv.Shutdown(ctx)
+	_ = a.ln.Close()
+	a.srv = nil
+	a.ln = nil
+	a.port = 0
+	return err
+}
+
+func (a *AdminServer) captures(w http.ResponseWriter) *CaptureBuffer {
+	buf := a.proxy.CaptureBuffer()
+	if buf == nil {
+		http.Error(w, "capture is not enabled (start the proxy with --capture)", http.StatusNotFound)
+	}
+	return buf
+}
+
+func (a *AdminServer) listCaptures(w http.ResponseWriter, r *http.Request) {
+	buf := a.captures(w)
+	if buf == nil {
+		return
+	}
+	exchanges := buf.List()
+	slug := r.URL.Query().Get("slug")
+	service := r.URL.Query().Get("service")
+	summary := r.URL.Query().Get("summary") == "1"
+	filtered := make([]Exchange, 0, len(exchanges))
+	for _, ex := range exchanges {
+		if (slug == "" || ex.Slug == slug) && (service == "" || ex.Service == service) {
+			if summary {
+				filtered = append(filtered, ex.Summary())
+			} else {
+				filtered = append(filtered, ex.Redacted())
+			}
+		}
+	}
+	writeJSON(w, filtered)
+}
+
+func (a *AdminServer) getCapture(w http.ResponseWriter, r *http.Request) {
+	buf := a.captures(w)
+	if buf == nil {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid capture id", http.StatusBadRequest)
+		return
+	}
+	ex, ok := buf.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("capture %d not found", id), http.StatusNotFound)
+		return
+	}
+	// Credentials are only handed out on request, for replaying.
+	if r.URL.Query().Get("credentials") != "include" {
+		ex = ex.Redacted()
+	}
+	writeJSON(w, ex)
+}
+
+func (a *AdminServer) clearCaptures(w http.ResponseWriter, _ *http.Request) {
+	buf := a.captures(w)
+	if buf == nil {
+		return
+	}
+	buf.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AdminServer) exportHAR(w http.ResponseWriter, _ *http.Request) {
+	buf := a.captures(w)
+	if buf == nil {
+		return
+	}
+	exchanges := buf.List()
+	for i := range exchanges {
+		exchanges[i] = exchanges[i].Redacted()
+	}
+	writeJSON(w, BuildHAR(exchanges, a.version))
+}
+
+func (a *AdminServer) listChaos(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, a.proxy.Chaos().List())
+}
+
+func (a *AdminServer) addChaos(w http.ResponseWriter, r *http.Request) {
+	var rule ChaosRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	added, err := a.proxy.Chaos().Add(rule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(added); err != nil {
+		logging.Warn("admin: encoding response: %v", err)
+	}
+}
+
+func (a *AdminServer) removeChaos(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid rule id", http.StatusBadRequest)
+		return
+	}
+	if !a.proxy.Chaos().Remove(id) {
+		http.Error(w, fmt.Sprintf("chaos rule %d not found", id), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AdminServer) clearChaos(w http.ResponseWriter, _ *http.Request) {
+	a.proxy.Chaos().Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AdminServer) metrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := a.proxy.Metrics().WriteTo(w); err != nil {
+		logging.Warn("admin: writing metrics: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Warn("admin: encoding response: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminClient talks to a running proxy's AdminServer.
+type AdminClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewAdminClient creates a client for the admin API listening on
+// 127.0.0.1:port. token is the server's admin token, as recorded in the
+// state file.
+func NewAdminClient(port int, token string) *AdminClient {
+	return &AdminClient{
+		baseURL: "http://127.0.0.1:" + strconv.Itoa(port),
+		token:   token,
+		http:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Captures returns captured exchanges, optionally filtered by slug and
+// service. Credential headers are redacted.
+func (c *AdminClient) Captures(slug, service string) ([]Exchange, error) {
+	return c.captures(slug, service, false)
+}
+
+// CaptureSummaries is like Captures but leaves out headers and bodies; use
+// Capture to load a single exchange in full.
+func (c *AdminClient) CaptureSummaries(slug, service string) ([]Exchange, error) {
+	return c.captures(slug, service, true)
+}
+
+func (c *AdminClient) captures(slug, service string, summary bool) ([]Exchange, error) {
+	q := url.Values{}
+	if slug != "" {
+		q.Set("slug", slug)
+	}
+	if service != "" {
+		q.Set("service", service)
+	}
+	if summary {
+		q.Set("summary", "1")
+	}
+	var out []Exchange
+	err := c.do(http.MethodGet, "/api/captures?"+q.Encode(), nil, &out)
+	return out, err
+}
+
+// Capture returns a single captured exchange, with credential headers
+// redacted.
+func (c *AdminClient) Capture(id int64) (Exchange, error) {
+	var out Exchange
+	err := c.do(http.MethodGet, "/api/captures/"+strconv.FormatInt(id, 10), nil, &out)
+	return out, err
+}
+
+// CaptureWithCredentials is like Capture but keeps the Cookie and
+// Authorization headers, so that the request can be replayed.
+func (c *AdminClient) CaptureWithCredentials(id int64) (Exchange, error) {
+	var out Exchange
+	err := c.do(http.MethodGet, "/api/captures/"+strconv.FormatInt(id, 10)+"?credentials=include", nil, &out)
+	return out, err
+}
+
+// ClearCaptures empties the capture buffer.
+func (c *AdminClient) ClearCaptures() error {
+	return c.do(http.MethodDelete, "/api/captures", nil, nil)
+}
+
+// HAR returns the captured exchanges as a HAR document.
+func (c *AdminClient) HAR() (HAR, error) {
+	var out HAR
+	err := c.do(http.MethodGet, "/api/captures/har", nil, &out)
+	return out, err
+}
+
+// ChaosRules returns the active fault injection rules.
+func (c *AdminClient) ChaosRules() ([]ChaosRule, error) {
+	var out []ChaosRule
+	err := c.do(http.MethodGet, "/api/chaos", nil, &out)
+	return out, err
+}
+
+// AddChaosRule installs rule and returns it with its assigned ID.
+func (c *AdminClient) AddChaosRule(rule ChaosRule) (ChaosRule, error) {
+	var out ChaosRule
+	err := c.do(http.MethodPost, "/api/chaos", rule, &out)
+	return out, err
+}
+
+// RemoveChaosRule deletes a single rule.
+func (c *AdminClient) RemoveChaosRule(id int64) error {
+	return c.do(http.MethodDelete, "/api/chaos/"+strconv.FormatInt(id, 10), nil, nil)
+}
+
+// ClearChaos removes all fault injection rules.
+func (c *AdminClient) ClearChaos() error {
+	return c.do(http.MethodDelete, "/api/chaos", nil, nil)
+}
+
+// do performs a request against the admin API. in, if non-nil, is sent as a
+// JSON body; out, if non-nil, receives the decoded JSON response. Requests
+// other than GET are always marked as JSON, as the server requires.
+func (c *AdminClient) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("contacting proxy admin API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("proxy admin API: %s", strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding admin response: %w", err)
+	}
+	return nil
+}
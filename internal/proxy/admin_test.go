@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestAdminServerCaptures(t *testing.T) {
+	p, _ := setupProxyTest(t)
+	buf := NewCaptureBuffer(10)
+	p.EnableCapture(buf, 0)
+	buf.Add(Exchange{Slug: "main", Service: "web", Method: "GET", URL: "http://main.localhost:3000/"})
+	buf.Add(Exchange{
+		Slug: "feature-auth", Service: "web", Method: "GET", URL: "http://feature-auth.localhost:3000/",
+		RequestHeader:  http.Header{"Cookie": {"session=secret"}, "Authorization": {"Bearer secret"}, "Accept": {"*/*"}},
+		ResponseHeader: http.Header{"Set-Cookie": {"session=secret"}},
+		ResponseBody:   []byte("hello"),
+	})
+
+	admin := NewAdminServer(p, "test")
+	port, err := admin.Start(0)
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer func() { _ = admin.Stop() }()
+
+	client := NewAdminClient(port, admin.Token())
+
+	t.Run("list", func(t *testing.T) {
+		got, err := client.Captures("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 {
+			t.Errorf("Captures() = %d entries, want 2", len(got))
+		}
+	})
+
+	t.Run("filter by slug", func(t *testing.T) {
+		got, err := client.Captures("main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].Slug != "main" {
+			t.Errorf("Captures(main) = %+v", got)
+		}
+	})
+
+	t.Run("summaries", func(t *testing.T) {
+		got, err := client.CaptureSummaries("feature-auth", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].ID != 2 || got[0].RequestHeader != nil || got[0].ResponseBody != nil {
+			t.Errorf("CaptureSummaries() = %+v, want no headers or bodies", got)
+		}
+	})
+
+	t.Run("redacted", func(t *testing.T) {
+		ex, err := client.Capture(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range []string{"Cookie", "Authorization"} {
+			if got := ex.RequestHeader.Get(h); got != redactedValue {
+				t.Errorf("Capture(2) %s = %q, want redacted", h, got)
+			}
+		}
+		if got := ex.ResponseHeader.Get("Set-Cookie"); got != redactedValue {
+			t.Errorf("Capture(2) Set-Cookie = %q, want redacted", got)
+		}
+		if got := ex.RequestHeader.Get("Accept"); got != "*/*" {
+			t.Errorf("Capture(2) Accept = %q, want it kept", got)
+		}
+
+		list, err := client.Captures("feature-auth", "")
+		if err != nil || len(list) != 1 || list[0].RequestHeader.Get("Cookie") != redactedValue {
+			t.Errorf("Captures() should redact credentials, got %+v, %v", list, err)
+		}
+
+		ex, err = client.CaptureWithCredentials(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ex.RequestHeader.Get("Cookie"); got != "session=secret" {
+			t.Errorf("CaptureWithCredentials(2) Cookie = %q", got)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		ex, err := client.Capture(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ex.Slug != "feature-auth" {
+			t.Errorf("Capture(2).Slug = %q", ex.Slug)
+		}
+		if _, err := client.Capture(99); err == nil {
+			t.Error("Capture(99) should fail")
+		}
+	})
+
+	t.Run("har", func(t *testing.T) {
+		har, err := client.HAR()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(har.Log.Entries) != 2 || har.Log.Creator.Version != "test" {
+			t.Errorf("HAR() = %+v", har.Log)
+		}
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		if err := client.ClearCaptures(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := client.Captures("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Errorf("Captures() after clear = %d entries, want 0", len(got))
+		}
+	})
+}
+
+func TestAdminServerCaptureDisabled(t *testing.T) {
+	p, _ := setupProxyTest(t)
+	admin := NewAdminServer(p, "test")
+	port, err := admin.Start(0)
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer func() { _ = admin.Stop() }()
+
+	if _, err := NewAdminClient(port, admin.Token()).Captures("", ""); err == nil {
+		t.Error("Captures() should fail when capture is disabled")
+	}
+}
+
+func TestAdminServerGuard(t *testing.T) {
+	p, _ := setupProxyTest(t)
+	buf := NewCaptureBuffer(10)
+	p.EnableCapture(buf, 0)
+	buf.Add(Exchange{Slug: "main", Service: "web", Method: "GET", RequestHeader: http.Header{"Cookie": {"session=secret"}}})
+
+	admin := NewAdminServer(p, "test")
+	port, err := admin.Start(0)
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer func() { _ = admin.Stop() }()
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+
+	tests := []struct {
+		name   string
+		path   string
+		host   string
+		header http.Header
+		want   int
+	}{
+		{"token", "/api/captures/1?credentials=include", addr, http.Header{"Authorization": {"Bearer " + admin.Token()}}, http.StatusOK},
+		{"localhost", "/api/captures", "localhost:" + strconv.Itoa(port), http.Header{"Authorization": {"Bearer " + admin.Token()}}, http.StatusOK},
+		{"no token", "/api/captures/1?credentials=include", addr, nil, http.StatusUnauthorized},
+		{"wrong token", "/api/captures", addr, http.Header{"Authorization": {"Bearer nope"}}, http.StatusUnauthorized},
+		{"rebound host", "/api/captures", "evil.example:" + strconv.Itoa(port), http.Header{"Authorization": {"Bearer " + admin.Token()}}, http.StatusForbidden},
+		{"other port", "/metrics", "127.0.0.1:1", nil, http.StatusForbidden},
+		{"origin", "/api/captures", addr, http.Header{"Authorization": {"Bearer " + admin.Token()}, "Origin": {"http://evil.example"}}, http.StatusForbidden},
+		{"metrics without token", "/metrics", addr, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Host = tt.host
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("GET %s (Host %s) = %d, want %d", tt.path, tt.host, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/fairy-pitta/portree/internal/config"
+)
+
+// backendURL returns the address of route's backend: https for services
+// with backend_tls, http otherwise.
+func backendURL(cfg *config.Config, route Route) *url.URL {
+	scheme := "http"
+	if cfg != nil && cfg.Services[route.Service].BackendTLS {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: "127.0.0.1:" + strconv.Itoa(route.Port)}
+}
+
+// NewBackendTransport returns a transport for requests to backends whose TLS
+// certificates are verified against the portree CA at caPath. The CA is
+// read on every handshake, so a CA created or rotated after the proxy
+// started is picked up.
+func NewBackendTransport(caPath string) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{
+		// Verification happens in VerifyConnection against the portree CA
+		// instead of the system roots.
+		InsecureSkipVerify: true, //nolint:gosec // verified below
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return verifyBackend(cs, caPath)
+		},
+	}
+	return t
+}
+
+func verifyBackend(cs tls.ConnectionState, caPath string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("backend presented no certificate")
+	}
+	data, err := os.ReadFile(caPath)
+	if err != nil {
+		return fmt.Errorf("reading portree CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificate in %s", caPath)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
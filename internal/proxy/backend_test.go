@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/fairy-pitta/portree/internal/cert"
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/state"
+)
+
+// setupBackendTLSTest serves feature-auth on proxy port 3000 through an
+// HTTPS backend whose certificate is issued by a portree CA in dir.
+func setupBackendTLSTest(t *testing.T, caPath string) (front string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := cert.Paths(filepath.Join(dir, "certs")).WithCA(filepath.Join(dir, "ca"))
+	certPath, keyPath, err := cert.EnsureBackendCert(paths, "feature-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "tls=%v host=%s", r.TLS != nil, r.Host)
+	}))
+	backend.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+	backend.StartTLS()
+	t.Cleanup(backend.Close)
+	var backendPort int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &backendPort)
+
+	p, store := setupProxyTest(t)
+	st, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetPortAssignment(st, "feature/auth", "web", backendPort)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := *p.resolver.Config()
+	cfg.Services = map[string]config.ServiceConfig{
+		"web": {Command: "npm start", PortRange: config.PortRange{Min: 3100, Max: 3199}, ProxyPort: 3000, BackendTLS: true},
+	}
+	p.resolver.SetConfig(&cfg)
+
+	if caPath == "" {
+		caPath = paths.CACert
+	}
+	p.EnableBackendTLS(caPath)
+
+	srv := httptest.NewServer(p.handler(3000))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestProxyBackendTLS(t *testing.T) {
+	front := setupBackendTLSTest(t, "")
+
+	req, _ := http.NewRequest("GET", front+"/", nil)
+	req.Host = "feature-auth.localhost:3000"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "tls=true host=feature-auth.localhost:3000" {
+		t.Errorf("got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestProxyBackendTLSUntrusted(t *testing.T) {
+	// Verify against a different CA: the backend must be rejected.
+	other, err := cert.EnsureCerts(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := setupBackendTLSTest(t, other.CACert)
+
+	req, _ := http.NewRequest("GET", front+"/", nil)
+	req.Host = "feature-auth.localhost:3000"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502 for an untrusted backend", resp.StatusCode)
+	}
+}
@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCaptureSize is the default number of exchanges kept in the ring buffer.
+	DefaultCaptureSize = 200
+	// DefaultCaptureBodyLimit is the default number of body bytes recorded per direction.
+	DefaultCaptureBodyLimit = 64 * 1024
+)
+
+// Exchange is a single captured request/response pair.
+type Exchange struct {
+	ID          int64         `json:"id"`
+	Time        time.Time     `json:"time"`
+	Slug        string        `json:"slug"`
+	Branch      string        `json:"branch,omitempty"`
+	Service     string        `json:"service,omitempty"`
+	BackendPort int           `json:"backend_port,omitempty"`
+	Duration    time.Duration `json:"duration"`
+
+	Method               string      `json:"method"`
+	URL                  string      `json:"url"`
+	Proto                string      `json:"proto"`
+	RequestHeader        http.Header `json:"request_header,omitempty"`
+	RequestBody          []byte      `json:"request_body,omitempty"`
+	RequestBodyTruncated bool        `json:"request_body_truncated,omitempty"`
+
+	Status                int         `json:"status"`
+	ResponseHeader        http.Header `json:"response_header,omitempty"`
+	ResponseBody          []byte      `json:"response_body,omitempty"`
+	ResponseBodyTruncated bool        `json:"response_body_truncated,omitempty"`
+}
+
+// credentialHeaders are the headers whose values the admin API redacts.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redactedValue replaces the values of credential headers.
+const redactedValue = "[redacted]"
+
+// Summary returns ex without its headers and bodies.
+func (ex Exchange) Summary() Exchange {
+	ex.RequestHeader, ex.ResponseHeader = nil, nil
+	ex.RequestBody, ex.ResponseBody = nil, nil
+	return ex
+}
+
+// Redacted returns ex with the values of credential headers, such as
+// Cookie and Authorization, replaced by "[redacted]".
+func (ex Exchange) Redacted() Exchange {
+	ex.RequestHeader = redactHeader(ex.RequestHeader)
+	ex.ResponseHeader = redactHeader(ex.ResponseHeader)
+	return ex
+}
+
+// redactHeader returns a copy of h with credential values replaced, or h
+// itself if it carries none.
+func redactHeader(h http.Header) http.Header {
+	var out http.Header
+	for _, name := range credentialHeaders {
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if out == nil {
+			out = h.Clone()
+		}
+		redacted := make([]string, len(values))
+		for i := range redacted {
+			redacted[i] = redactedValue
+		}
+		out[http.CanonicalHeaderKey(name)] = redacted
+	}
+	if out == nil {
+		return h
+	}
+	return out
+}
+
+// CaptureBuffer is a fixed-size ring buffer of captured exchanges.
+// It is safe for concurrent use.
+type CaptureBuffer struct {
+	mu      sync.Mutex
+	entries []Exchange
+	next    int // index of the slot the next exchange is written to
+	full    bool
+	lastID  int64
+}
+
+// NewCaptureBuffer creates a CaptureBuffer holding up to capacity exchanges.
+func NewCaptureBuffer(capacity int) *CaptureBuffer {
+	if capacity <= 0 {
+		capacity = DefaultCaptureSize
+	}
+	return &CaptureBuffer{entries: make([]Exchange, capacity)}
+}
+
+// Add stores ex, evicting the oldest exchange if the buffer is full.
+// It assigns and returns the exchange ID.
+func (b *CaptureBuffer) Add(ex Exchange) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	ex.ID = b.lastID
+	b.entries[b.next] = ex
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+	return ex.ID
+}
+
+// List returns all captured exchanges, oldest first.
+func (b *CaptureBuffer) List() []Exchange {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]Exchange(nil), b.entries[:b.next]...)
+	}
+	out := make([]Exchange, 0, len(b.entries))
+	out = append(out, b.entries[b.next:]...)
+	out = append(out, b.entries[:b.next]...)
+	return out
+}
+
+// Get returns the exchange with the given ID if it is still in the buffer.
+func (b *CaptureBuffer) Get(id int64) (Exchange, bool) {
+	for _, ex := range b.List() {
+		if ex.ID == id {
+			return ex, true
+		}
+	}
+	return Exchange{}, false
+}
+
+// Clear removes all captured exchanges. IDs keep increasing afterwards.
+func (b *CaptureBuffer) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = make([]Exchange, len(b.entries))
+	b.next = 0
+	b.full = false
+}
+
+// captureMiddleware records every exchange passing through next into buf.
+// Request and response bodies are recorded up to bodyLimit bytes each;
+// the traffic itself is streamed through untouched.
+func captureMiddleware(buf *CaptureBuffer, bodyLimit int, scheme string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, info := withRequestInfo(r)
+		start := time.Now()
+
+		reqBody := newLimitedBuffer(bodyLimit)
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &teeBody{ReadCloser: r.Body, buf: reqBody}
+		}
+		reqHeader := r.Header.Clone()
+
+		rec := newResponseRecorder(w)
+		rec.body = newLimitedBuffer(bodyLimit)
+
+		next.ServeHTTP(rec, r)
+
+		u := *r.URL
+		u.Scheme = scheme
+		u.Host = r.Host
+		buf.Add(Exchange{
+			Time:                  start,
+			Slug:                  ParseSlugFromHost(r.Host),
+			Branch:                info.Branch,
+			Service:               info.Service,
+			BackendPort:           info.BackendPort,
+			Duration:              time.Since(start),
+			Method:                r.Method,
+			URL:                   u.String(),
+			Proto:                 r.Proto,
+			RequestHeader:         reqHeader,
+			RequestBody:           reqBody.Bytes(),
+			RequestBodyTruncated:  reqBody.truncated,
+			Status:                rec.Status(),
+			ResponseHeader:        rec.header,
+			ResponseBody:          rec.body.Bytes(),
+			ResponseBodyTruncated: rec.body.truncated,
+		})
+	})
+}
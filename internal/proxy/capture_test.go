@@ -0,0 +1,317 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/cert"
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/state"
+)
+
+func TestCaptureBuffer(t *testing.T) {
+	t.Run("keeps insertion order", func(t *testing.T) {
+		buf := NewCaptureBuffer(3)
+		buf.Add(Exchange{Method: "GET"})
+		buf.Add(Exchange{Method: "POST"})
+
+		got := buf.List()
+		if len(got) != 2 {
+			t.Fatalf("List() returned %d entries, want 2", len(got))
+		}
+		if got[0].ID != 1 || got[1].ID != 2 {
+			t.Errorf("IDs = %d, %d, want 1, 2", got[0].ID, got[1].ID)
+		}
+	})
+
+	t.Run("evicts oldest when full", func(t *testing.T) {
+		buf := NewCaptureBuffer(2)
+		for i := 0; i < 5; i++ {
+			buf.Add(Exchange{})
+		}
+		got := buf.List()
+		if len(got) != 2 {
+			t.Fatalf("List() returned %d entries, want 2", len(got))
+		}
+		if got[0].ID != 4 || got[1].ID != 5 {
+			t.Errorf("IDs = %d, %d, want 4, 5", got[0].ID, got[1].ID)
+		}
+		if _, ok := buf.Get(1); ok {
+			t.Error("Get(1) should fail after eviction")
+		}
+		if _, ok := buf.Get(5); !ok {
+			t.Error("Get(5) should succeed")
+		}
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		buf := NewCaptureBuffer(2)
+		buf.Add(Exchange{})
+		buf.Clear()
+		if n := len(buf.List()); n != 0 {
+			t.Errorf("List() after Clear = %d entries, want 0", n)
+		}
+		if id := buf.Add(Exchange{}); id != 2 {
+			t.Errorf("ID after Clear = %d, want 2", id)
+		}
+	})
+}
+
+// setupCaptureTest starts a backend that echoes the request body and returns a
+// capturing proxy handler routing feature-auth.localhost:3000 to it.
+func setupCaptureTest(t *testing.T, bodyLimit int) (http.Handler, *CaptureBuffer) {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, "echo:%s", body)
+	}))
+	t.Cleanup(backend.Close)
+
+	var backendPort int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &backendPort)
+
+	store, err := state.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &state.State{
+		Services:        map[string]map[string]*state.ServiceState{},
+		PortAssignments: map[string]int{},
+	}
+	state.SetPortAssignment(st, "feature/auth", "web", backendPort)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"web": {Command: "npm start", PortRange: config.PortRange{Min: 3100, Max: 3199}, ProxyPort: 3000},
+		},
+	}
+	p := NewProxyServer(NewResolver(cfg, store), nil)
+	buf := NewCaptureBuffer(10)
+	p.EnableCapture(buf, bodyLimit)
+	return p.middlewares(3000, p.handler(3000)), buf
+}
+
+func TestCaptureMiddleware(t *testing.T) {
+	handler, buf := setupCaptureTest(t, 1024)
+
+	req := httptest.NewRequest("POST", "http://feature-auth.localhost:3000/api/items?x=1", strings.NewReader("hello"))
+	req.Host = "feature-auth.localhost:3000"
+	req.Header.Set("X-Test", "yes")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Body.String() != "echo:hello" {
+		t.Fatalf("client body = %q, want %q", rec.Body.String(), "echo:hello")
+	}
+
+	got := buf.List()
+	if len(got) != 1 {
+		t.Fatalf("captured %d exchanges, want 1", len(got))
+	}
+	ex := got[0]
+	if ex.Slug != "feature-auth" || ex.Service != "web" || ex.Branch != "feature/auth" {
+		t.Errorf("route = %s/%s/%s, want feature-auth/web/feature/auth", ex.Slug, ex.Service, ex.Branch)
+	}
+	if ex.Method != "POST" || ex.URL != "http://feature-auth.localhost:3000/api/items?x=1" {
+		t.Errorf("request = %s %s", ex.Method, ex.URL)
+	}
+	if ex.RequestHeader.Get("X-Test") != "yes" {
+		t.Error("request header X-Test not captured")
+	}
+	if string(ex.RequestBody) != "hello" {
+		t.Errorf("request body = %q, want %q", ex.RequestBody, "hello")
+	}
+	if ex.Status != http.StatusCreated {
+		t.Errorf("status = %d, want %d", ex.Status, http.StatusCreated)
+	}
+	if string(ex.ResponseBody) != "echo:hello" {
+		t.Errorf("response body = %q, want %q", ex.ResponseBody, "echo:hello")
+	}
+	if ex.ResponseHeader.Get("Content-Type") != "text/plain" {
+		t.Errorf("response Content-Type = %q", ex.ResponseHeader.Get("Content-Type"))
+	}
+}
+
+func TestCaptureMiddlewareTruncatesBodies(t *testing.T) {
+	handler, buf := setupCaptureTest(t, 4)
+
+	req := httptest.NewRequest("POST", "http://feature-auth.localhost:3000/", strings.NewReader("0123456789"))
+	req.Host = "feature-auth.localhost:3000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// The client must still receive the full response.
+	if rec.Body.String() != "echo:0123456789" {
+		t.Fatalf("client body = %q", rec.Body.String())
+	}
+
+	ex := buf.List()[0]
+	if string(ex.RequestBody) != "0123" || !ex.RequestBodyTruncated {
+		t.Errorf("request body = %q (truncated=%v), want %q truncated", ex.RequestBody, ex.RequestBodyTruncated, "0123")
+	}
+	if string(ex.ResponseBody) != "echo" || !ex.ResponseBodyTruncated {
+		t.Errorf("response body = %q (truncated=%v), want %q truncated", ex.ResponseBody, ex.ResponseBodyTruncated, "echo")
+	}
+}
+
+func TestCaptureMiddlewareRecordsErrors(t *testing.T) {
+	handler, buf := setupCaptureTest(t, 1024)
+
+	req := httptest.NewRequest("GET", "http://unknown.localhost:3000/", nil)
+	req.Host = "unknown.localhost:3000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	ex := buf.List()[0]
+	if ex.Status != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", ex.Status, http.StatusNotFound)
+	}
+	if ex.Slug != "unknown" {
+		t.Errorf("slug = %q, want %q", ex.Slug, "unknown")
+	}
+}
+
+func TestBuildHAR(t *testing.T) {
+	ex := Exchange{
+		ID:             1,
+		Time:           time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Slug:           "main",
+		Service:        "web",
+		Duration:       1500 * time.Millisecond,
+		Method:         "POST",
+		URL:            "http://main.localhost:3000/login?next=%2Fhome",
+		Proto:          "HTTP/1.1",
+		RequestHeader:  http.Header{"Content-Type": {"application/json"}},
+		RequestBody:    []byte(`{"user":"a"}`),
+		Status:         302,
+		ResponseHeader: http.Header{"Location": {"/home"}},
+		ResponseBody:   []byte{0xff, 0xfe},
+	}
+
+	har := BuildHAR([]Exchange{ex}, "test")
+	if har.Log.Version != "1.2" || har.Log.Creator.Name != "portree" {
+		t.Errorf("log header = %+v", har.Log)
+	}
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(har.Log.Entries))
+	}
+	e := har.Log.Entries[0]
+	if e.Time != 1500 {
+		t.Errorf("time = %v, want 1500", e.Time)
+	}
+	if len(e.Request.QueryString) != 1 || e.Request.QueryString[0] != (HARNameValue{Name: "next", Value: "/home"}) {
+		t.Errorf("queryString = %+v", e.Request.QueryString)
+	}
+	if e.Request.PostData == nil || e.Request.PostData.Text != `{"user":"a"}` {
+		t.Errorf("postData = %+v", e.Request.PostData)
+	}
+	if e.Response.RedirectURL != "/home" || e.Response.StatusText != "Found" {
+		t.Errorf("response = %+v", e.Response)
+	}
+	if e.Response.Content.Encoding != "base64" {
+		t.Errorf("binary body encoding = %q, want base64", e.Response.Content.Encoding)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var gotHost, gotBody, gotHeader string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		gotHeader = r.Header.Get("X-Test")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer backend.Close()
+
+	var port int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &port)
+
+	ex := Exchange{
+		ID:            7,
+		Method:        "PUT",
+		URL:           "http://feature-auth.localhost:3000/items/1",
+		RequestHeader: http.Header{"X-Test": {"yes"}, "Connection": {"close"}},
+		RequestBody:   []byte("payload"),
+	}
+	route := Route{Branch: "main", Service: "web", Port: port}
+	resp, err := Replay(context.Background(), ex, nil, route, "main.localhost:3000", nil)
+	if err != nil {
+		t.Fatalf("Replay() error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+	if gotHost != "main.localhost:3000" {
+		t.Errorf("Host = %q, want main.localhost:3000", gotHost)
+	}
+	if gotBody != "payload" || gotHeader != "yes" {
+		t.Errorf("body = %q, X-Test = %q", gotBody, gotHeader)
+	}
+}
+
+func TestReplayBackendTLS(t *testing.T) {
+	dir := t.TempDir()
+	paths := cert.Paths(filepath.Join(dir, "certs")).WithCA(filepath.Join(dir, "ca"))
+	certPath, keyPath, err := cert.EnsureBackendCert(paths, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "tls=%v host=%s", r.TLS != nil, r.Host)
+	}))
+	backend.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+	backend.StartTLS()
+	defer backend.Close()
+	var port int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &port)
+
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"web": {Command: "npm start", ProxyPort: 3000, BackendTLS: true},
+	}}
+	ex := Exchange{ID: 8, Method: "GET", URL: "https://feature-auth.localhost:3000/"}
+	route := Route{Branch: "main", Service: "web", Port: port}
+	resp, err := Replay(context.Background(), ex, cfg, route, "main.localhost:3000", NewBackendTransport(paths.CACert))
+	if err != nil {
+		t.Fatalf("Replay() error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "tls=true host=main.localhost:3000" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestReplaceSlugInHost(t *testing.T) {
+	tests := []struct{ host, slug, want string }{
+		{"feature-auth.localhost:3000", "main", "main.localhost:3000"},
+		{"feature-auth.localhost", "main", "main.localhost"},
+		{"feature-auth.192.168.1.5.nip.io:3000", "main", "main.192.168.1.5.nip.io:3000"},
+		{"feature-auth.192-168-1-5.sslip.io", "main", "main.192-168-1-5.sslip.io"},
+		{"localhost:3000", "main", "main.localhost:3000"},
+	}
+	for _, tt := range tests {
+		if got := ReplaceSlugInHost(tt.host, tt.slug); got != tt.want {
+			t.Errorf("ReplaceSlugInHost(%q, %q) = %q, want %q", tt.host, tt.slug, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/logging"
+)
+
+// ChaosRule injects faults into requests matching Slug, Service and Path.
+// Empty selectors match everything.
+type ChaosRule struct {
+	ID      int64  `json:"id"`
+	Slug    string `json:"slug,omitempty"`
+	Service string `json:"service,omitempty"`
+	// Path is a glob matched against the request path; "*" matches any
+	// sequence of characters (including "/") and "?" a single character.
+	Path string `json:"path,omitempty"`
+
+	// LatencyMS delays the request before forwarding it, plus a random
+	// extra delay of up to JitterMS.
+	LatencyMS int `json:"latency_ms,omitempty"`
+	JitterMS  int `json:"jitter_ms,omitempty"`
+	// ErrorRate (0-1) is the fraction of requests answered with ErrorStatus
+	// (default 503) instead of being forwarded.
+	ErrorRate   float64 `json:"error_rate,omitempty"`
+	ErrorStatus int     `json:"error_status,omitempty"`
+	// Bandwidth limits the response to this many bytes per second.
+	Bandwidth int64 `json:"bandwidth,omitempty"`
+	// DropRate (0-1) is the fraction of connections closed without a response.
+	DropRate float64 `json:"drop_rate,omitempty"`
+}
+
+// Validate checks that the rule's values are in range and fills in defaults.
+func (r *ChaosRule) Validate() error {
+	if r.LatencyMS < 0 || r.JitterMS < 0 {
+		return errors.New("latency and jitter must not be negative")
+	}
+	if r.ErrorRate < 0 || r.ErrorRate > 1 {
+		return fmt.Errorf("error rate %v must be between 0 and 1", r.ErrorRate)
+	}
+	if r.DropRate < 0 || r.DropRate > 1 {
+		return fmt.Errorf("drop rate %v must be between 0 and 1", r.DropRate)
+	}
+	if r.Bandwidth < 0 {
+		return errors.New("bandwidth must not be negative")
+	}
+	if r.ErrorStatus == 0 {
+		r.ErrorStatus = http.StatusServiceUnavailable
+	}
+	if r.ErrorStatus < 400 || r.ErrorStatus > 599 {
+		return fmt.Errorf("error status %d must be a 4xx or 5xx code", r.ErrorStatus)
+	}
+	if r.LatencyMS == 0 && r.JitterMS == 0 && r.ErrorRate == 0 && r.Bandwidth == 0 && r.DropRate == 0 {
+		return errors.New("rule has no effect: set latency, jitter, error rate, bandwidth or drop rate")
+	}
+	return nil
+}
+
+// Matches reports whether the rule applies to a request.
+func (r ChaosRule) Matches(slug, service, path string) bool {
+	return (r.Slug == "" || r.Slug == slug) &&
+		(r.Service == "" || r.Service == service) &&
+		(r.Path == "" || globMatch(r.Path, path))
+}
+
+// Effects describes the rule's faults, e.g. "+200ms±50ms, 10% 503, 64KiB/s".
+func (r ChaosRule) Effects() string {
+	var parts []string
+	if r.LatencyMS > 0 || r.JitterMS > 0 {
+		s := fmt.Sprintf("+%dms", r.LatencyMS)
+		if r.JitterMS > 0 {
+			s += fmt.Sprintf("±%dms", r.JitterMS)
+		}
+		parts = append(parts, s)
+	}
+	if r.ErrorRate > 0 {
+		parts = append(parts, fmt.Sprintf("%s%% %d", formatPercent(r.ErrorRate), r.ErrorStatus))
+	}
+	if r.Bandwidth > 0 {
+		parts = append(parts, formatBytes(r.Bandwidth)+"/s")
+	}
+	if r.DropRate > 0 {
+		parts = append(parts, formatPercent(r.DropRate)+"% dropped")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatPercent(rate float64) string {
+	return strconv.FormatFloat(rate*100, 'f', -1, 64)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// globMatch matches s against pattern, where "*" matches any sequence of
+// characters and "?" matches exactly one.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return s == ""
+}
+
+// ChaosRules is the runtime-editable set of fault injection rules. The first
+// matching rule, in order of creation, applies to a request.
+type ChaosRules struct {
+	mu     sync.RWMutex
+	rules  []ChaosRule
+	nextID int64
+}
+
+// NewChaosRules creates an empty rule set.
+func NewChaosRules() *ChaosRules {
+	return &ChaosRules{nextID: 1}
+}
+
+// Add validates rule, assigns it an ID and appends it.
+func (c *ChaosRules) Add(rule ChaosRule) (ChaosRule, error) {
+	if err := rule.Validate(); err != nil {
+		return ChaosRule{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rule.ID = c.nextID
+	c.nextID++
+	c.rules = append(c.rules, rule)
+	return rule, nil
+}
+
+// List returns a copy of all rules.
+func (c *ChaosRules) List() []ChaosRule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]ChaosRule, len(c.rules))
+	copy(out, c.rules)
+	return out
+}
+
+// Remove deletes the rule with the given ID and reports whether it existed.
+func (c *ChaosRules) Remove(id int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, r := range c.rules {
+		if r.ID == id {
+			c.rules = append(c.rules[:i], c.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Clear removes all rules.
+func (c *ChaosRules) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = nil
+}
+
+// Match returns the first rule applying to the request.
+func (c *ChaosRules) Match(slug, service, path string) (ChaosRule, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, r := range c.rules {
+		if r.Matches(slug, service, path) {
+			return r, true
+		}
+	}
+	return ChaosRule{}, false
+}
+
+// applyChaos injects rule's faults into the request. It returns the writer to
+// forward the response through, and false if the request has already been
+// answered (or dropped) and must not be forwarded.
+func applyChaos(w http.ResponseWriter, r *http.Request, rule ChaosRule) (http.ResponseWriter, bool) {
+	if rule.DropRate > 0 && rand.Float64() < rule.DropRate {
+		logging.Verbose("chaos: dropping %s %s (rule %d)", r.Method, r.URL.Path, rule.ID)
+		if info := requestInfoFrom(r.Context()); info != nil {
+			info.Dropped = true
+		}
+		dropConnection(w)
+		return w, false
+	}
+
+	delay := time.Duration(rule.LatencyMS) * time.Millisecond
+	if rule.JitterMS > 0 {
+		delay += time.Duration(rand.IntN(rule.JitterMS+1)) * time.Millisecond
+	}
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			t.Stop()
+			return w, false
+		}
+	}
+
+	if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+		w.Header().Set("X-Portree-Chaos", "rule="+strconv.FormatInt(rule.ID, 10))
+		http.Error(w, fmt.Sprintf("portree: injected %d by chaos rule %d", rule.ErrorStatus, rule.ID), rule.ErrorStatus)
+		return w, false
+	}
+
+	if rule.Bandwidth > 0 {
+		return &throttledWriter{ResponseWriter: w, rate: rule.Bandwidth, start: time.Now()}, true
+	}
+	return w, true
+}
+
+// dropConnection closes the client connection without sending a response.
+func dropConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// Hijacking is not possible (e.g. HTTP/2); abort the response instead.
+		panic(http.ErrAbortHandler)
+	}
+	_ = conn.Close()
+}
+
+// throttledWriter limits the rate at which the response body is written.
+type throttledWriter struct {
+	http.ResponseWriter
+	rate    int64 // bytes per second
+	start   time.Time
+	written int64
+}
+
+// throttleChunk bounds how much is written between pauses, so slow rates
+// still stream smoothly.
+const throttleChunk = 4 << 10
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		n := min(len(p), throttleChunk, int(max(t.rate, 1)))
+		m, err := t.ResponseWriter.Write(p[:n])
+		total += m
+		t.written += int64(m)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+		_ = http.NewResponseController(t.ResponseWriter).Flush()
+
+		// Sleep until the bytes written so far are within the budget.
+		due := t.start.Add(time.Duration(float64(t.written) / float64(t.rate) * float64(time.Second)))
+		if d := time.Until(due); d > 0 {
+			time.Sleep(d)
+		}
+	}
+	return total, nil
+}
+
+// Flush forwards to the underlying writer.
+func (t *throttledWriter) Flush() {
+	_ = http.NewResponseController(t.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (t *throttledWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
@@ -0,0 +1,293 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/state"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"/api/*", "/api/users", true},
+		{"/api/*", "/api/users/1", true},
+		{"/api/*", "/apix", false},
+		{"*.js", "/assets/app.js", true},
+		{"/users/?", "/users/1", true},
+		{"/users/?", "/users/12", false},
+		{"/exact", "/exact", true},
+		{"/exact", "/exact/", false},
+		{"*", "", true},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxbyy", false},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestChaosRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    ChaosRule
+		wantErr bool
+	}{
+		{"latency", ChaosRule{LatencyMS: 100}, false},
+		{"no effect", ChaosRule{Slug: "main"}, true},
+		{"negative latency", ChaosRule{LatencyMS: -1}, true},
+		{"error rate too high", ChaosRule{ErrorRate: 1.5}, true},
+		{"drop rate negative", ChaosRule{DropRate: -0.1}, true},
+		{"bad error status", ChaosRule{ErrorRate: 0.5, ErrorStatus: 200}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	r := ChaosRule{ErrorRate: 0.5}
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if r.ErrorStatus != http.StatusServiceUnavailable {
+		t.Errorf("default ErrorStatus = %d, want 503", r.ErrorStatus)
+	}
+}
+
+func TestChaosRules(t *testing.T) {
+	c := NewChaosRules()
+	a, err := c.Add(ChaosRule{Slug: "main", Path: "/api/*", LatencyMS: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Add(ChaosRule{Service: "web", ErrorRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != 1 || b.ID != 2 {
+		t.Errorf("IDs = %d, %d, want 1, 2", a.ID, b.ID)
+	}
+
+	if r, ok := c.Match("main", "web", "/api/x"); !ok || r.ID != a.ID {
+		t.Errorf("Match(main, web, /api/x) = %v, %v, want rule %d", r.ID, ok, a.ID)
+	}
+	if r, ok := c.Match("main", "web", "/"); !ok || r.ID != b.ID {
+		t.Errorf("Match(main, web, /) = %v, %v, want rule %d", r.ID, ok, b.ID)
+	}
+	if _, ok := c.Match("other", "api", "/"); ok {
+		t.Error("Match(other, api, /) should not match")
+	}
+
+	if !c.Remove(a.ID) || c.Remove(a.ID) {
+		t.Error("Remove should succeed once")
+	}
+	if got := len(c.List()); got != 1 {
+		t.Errorf("List() = %d rules, want 1", got)
+	}
+	c.Clear()
+	if got := len(c.List()); got != 0 {
+		t.Errorf("List() after Clear = %d rules, want 0", got)
+	}
+}
+
+// setupChaosTest starts a proxy listener for feature-auth whose backend
+// returns body and counts the requests it receives.
+func setupChaosTest(t *testing.T, body string) (*ProxyServer, string, *atomic.Int32) {
+	t.Helper()
+
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(backend.Close)
+	var backendPort int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &backendPort)
+
+	p, store := setupProxyTest(t)
+	st, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetPortAssignment(st, "feature/auth", "web", backendPort)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	front := httptest.NewServer(recoveryMiddleware(p.middlewares(3000, p.handler(3000))))
+	t.Cleanup(front.Close)
+	return p, front.URL, &hits
+}
+
+func chaosGet(t *testing.T, frontURL, path string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest("GET", frontURL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "feature-auth.localhost:3000"
+	return http.DefaultClient.Do(req)
+}
+
+func TestChaosInjectedError(t *testing.T) {
+	p, front, hits := setupChaosTest(t, "ok")
+	if _, err := p.Chaos().Add(ChaosRule{Slug: "feature-auth", Path: "/api/*", ErrorRate: 1, ErrorStatus: 502}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := chaosGet(t, front, "/api/items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Portree-Chaos") == "" {
+		t.Error("injected response should carry X-Portree-Chaos")
+	}
+	if hits.Load() != 0 {
+		t.Error("injected error should not reach the backend")
+	}
+
+	// Paths outside the glob are forwarded untouched.
+	resp, err = chaosGet(t, front, "/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || hits.Load() != 1 {
+		t.Errorf("status = %d, hits = %d, want 200 and 1", resp.StatusCode, hits.Load())
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	p, front, _ := setupChaosTest(t, "ok")
+	if _, err := p.Chaos().Add(ChaosRule{LatencyMS: 150}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	resp, err := chaosGet(t, front, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("request took %v, want at least 150ms", elapsed)
+	}
+}
+
+func TestChaosDrop(t *testing.T) {
+	p, front, hits := setupChaosTest(t, "ok")
+	if _, err := p.Chaos().Add(ChaosRule{DropRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := chaosGet(t, front, "/")
+	if err == nil {
+		_ = resp.Body.Close()
+		t.Fatalf("expected a connection error, got status %d", resp.StatusCode)
+	}
+	if hits.Load() != 0 {
+		t.Error("dropped request should not reach the backend")
+	}
+}
+
+func TestChaosBandwidth(t *testing.T) {
+	body := strings.Repeat("x", 3000)
+	p, front, _ := setupChaosTest(t, body)
+	if _, err := p.Chaos().Add(ChaosRule{Bandwidth: 10000}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	resp, err := chaosGet(t, front, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(got) != body {
+		t.Fatalf("body length = %d, want %d", len(got), len(body))
+	}
+	// 3000 bytes at 10000 B/s takes ~300ms.
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("request took %v, want at least 250ms", elapsed)
+	}
+}
+
+func TestAdminServerChaos(t *testing.T) {
+	p, _ := setupProxyTest(t)
+	admin := NewAdminServer(p, "test")
+	port, err := admin.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = admin.Stop() }()
+	client := NewAdminClient(port, admin.Token())
+
+	added, err := client.AddChaosRule(ChaosRule{Slug: "main", LatencyMS: 100})
+	if err != nil {
+		t.Fatalf("AddChaosRule() error: %v", err)
+	}
+	if _, err := client.AddChaosRule(ChaosRule{Slug: "main"}); err == nil {
+		t.Error("AddChaosRule with no effect should fail")
+	}
+
+	rules, err := client.ChaosRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].ID != added.ID {
+		t.Errorf("ChaosRules() = %+v", rules)
+	}
+
+	if err := client.RemoveChaosRule(added.ID); err != nil {
+		t.Errorf("RemoveChaosRule() error: %v", err)
+	}
+	if err := client.RemoveChaosRule(added.ID); err == nil {
+		t.Error("removing a missing rule should fail")
+	}
+
+	if _, err := client.AddChaosRule(ChaosRule{ErrorRate: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ClearChaos(); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := client.ChaosRules(); len(rules) != 0 {
+		t.Errorf("ChaosRules() after clear = %+v", rules)
+	}
+
+	// A cross-site form can only send text/plain without a preflight.
+	req, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1:"+strconv.Itoa(port)+"/api/chaos", strings.NewReader(`{"drop_rate":1}`))
+	req.Header.Set("Authorization", "Bearer "+admin.Token())
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain POST = %d, want %d", resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+	if rules, _ := client.ChaosRules(); len(rules) != 0 {
+		t.Errorf("text/plain POST installed %+v", rules)
+	}
+}
@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR is the root of an HTTP Archive 1.2 document.
+// See http://www.softwareishard.com/blog/har-12-spec/.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the "log" object of a HAR document.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the application that produced the archive.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request/response pair.
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	// Non-standard fields are prefixed with an underscore per the spec.
+	Slug    string `json:"_slug,omitempty"`
+	Service string `json:"_service,omitempty"`
+}
+
+// HARRequest describes the request of an entry.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse describes the response of an entry.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a generic name/value pair (headers, query params, cookies).
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData describes a request body.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent describes a response body.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings breaks down the time spent on an entry, in milliseconds.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// BuildHAR converts captured exchanges into a HAR document.
+func BuildHAR(exchanges []Exchange, creatorVersion string) HAR {
+	entries := make([]HAREntry, 0, len(exchanges))
+	for _, ex := range exchanges {
+		entries = append(entries, harEntry(ex))
+	}
+	return HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "portree", Version: creatorVersion},
+		Entries: entries,
+	}}
+}
+
+func harEntry(ex Exchange) HAREntry {
+	ms := float64(ex.Duration) / float64(time.Millisecond)
+
+	req := HARRequest{
+		Method:      ex.Method,
+		URL:         ex.URL,
+		HTTPVersion: ex.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(ex.RequestHeader),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(ex.RequestBody),
+	}
+	if u, err := url.Parse(ex.URL); err == nil {
+		req.QueryString = harValues(u.Query())
+	}
+	if len(ex.RequestBody) > 0 {
+		req.PostData = &HARPostData{
+			MimeType: ex.RequestHeader.Get("Content-Type"),
+			Text:     string(ex.RequestBody),
+		}
+	}
+
+	content := HARContent{
+		Size:     len(ex.ResponseBody),
+		MimeType: ex.ResponseHeader.Get("Content-Type"),
+	}
+	if utf8.Valid(ex.ResponseBody) {
+		content.Text = string(ex.ResponseBody)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(ex.ResponseBody)
+		content.Encoding = "base64"
+	}
+
+	return HAREntry{
+		StartedDateTime: ex.Time.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request:         req,
+		Response: HARResponse{
+			Status:      ex.Status,
+			StatusText:  http.StatusText(ex.Status),
+			HTTPVersion: ex.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(ex.ResponseHeader),
+			Content:     content,
+			RedirectURL: ex.ResponseHeader.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(ex.ResponseBody),
+		},
+		Timings: HARTimings{Wait: ms},
+		Slug:    ex.Slug,
+		Service: ex.Service,
+	}
+}
+
+func harHeaders(h http.Header) []HARNameValue {
+	return harValues(url.Values(h))
+}
+
+// harValues flattens a multi-valued map into sorted name/value pairs.
+func harValues(v url.Values) []HARNameValue {
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []HARNameValue{}
+	for _, name := range names {
+		for _, val := range v[name] {
+			out = append(out, HARNameValue{Name: name, Value: val})
+		}
+	}
+	return out
+}
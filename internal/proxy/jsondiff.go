@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// maxDiffs caps the number of differences reported for a single comparison.
+const maxDiffs = 20
+
+// DiffJSON compares two JSON documents structurally and returns a list of
+// human-readable differences such as `$.items[1].name: "a" != "b"`.
+// ok is false if either document is not valid JSON.
+func DiffJSON(a, b []byte) (diffs []string, ok bool) {
+	va, err := decodeJSON(a)
+	if err != nil {
+		return nil, false
+	}
+	vb, err := decodeJSON(b)
+	if err != nil {
+		return nil, false
+	}
+	d := &jsonDiffer{}
+	d.diff("$", va, vb)
+	return d.diffs, true
+}
+
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // keep 1 and 1.0 distinct and avoid float rounding
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type jsonDiffer struct {
+	diffs []string
+}
+
+func (d *jsonDiffer) add(format string, args ...any) {
+	if len(d.diffs) < maxDiffs {
+		d.diffs = append(d.diffs, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *jsonDiffer) diff(path string, a, b any) {
+	if len(d.diffs) >= maxDiffs {
+		return
+	}
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			d.add("%s: %s != %s", path, jsonSnippet(a), jsonSnippet(b))
+			return
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "." + k
+			x, inA := av[k]
+			y, inB := bv[k]
+			switch {
+			case !inB:
+				d.add("%s: missing in shadow", child)
+			case !inA:
+				d.add("%s: only in shadow", child)
+			default:
+				d.diff(child, x, y)
+			}
+		}
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			d.add("%s: %s != %s", path, jsonSnippet(a), jsonSnippet(b))
+			return
+		}
+		if len(av) != len(bv) {
+			d.add("%s: length %d != %d", path, len(av), len(bv))
+		}
+		n := min(len(av), len(bv))
+		for i := 0; i < n; i++ {
+			d.diff(path+"["+strconv.Itoa(i)+"]", av[i], bv[i])
+		}
+	default:
+		if jsonSnippet(a) != jsonSnippet(b) {
+			d.add("%s: %s != %s", path, jsonSnippet(a), jsonSnippet(b))
+		}
+	}
+}
+
+// jsonSnippet renders v compactly, shortened for log output.
+func jsonSnippet(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	const maxLen = 60
+	if len(data) > maxLen {
+		return string(data[:maxLen-1]) + "…"
+	}
+	return string(data)
+}
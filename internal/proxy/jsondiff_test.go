@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   string
+		want   []string
+		wantOK bool
+	}{
+		{"equal ignoring key order", `{"a":1,"b":2}`, `{"b":2,"a":1}`, nil, true},
+		{"scalar change", `{"a":1}`, `{"a":2}`, []string{"$.a: 1 != 2"}, true},
+		{"number precision kept", `{"a":1}`, `{"a":1.0}`, []string{"$.a: 1 != 1.0"}, true},
+		{"missing key", `{"a":1,"b":2}`, `{"a":1}`, []string{"$.b: missing in shadow"}, true},
+		{"extra key", `{"a":1}`, `{"a":1,"c":3}`, []string{"$.c: only in shadow"}, true},
+		{"nested array", `{"items":[{"n":"x"},{"n":"y"}]}`, `{"items":[{"n":"x"},{"n":"z"}]}`,
+			[]string{`$.items[1].n: "y" != "z"`}, true},
+		{"array length", `[1,2]`, `[1,2,3]`, []string{"$: length 2 != 3"}, true},
+		{"type change", `{"a":[1]}`, `{"a":{"x":1}}`, []string{`$.a: [1] != {"x":1}`}, true},
+		{"invalid JSON", `{"a":`, `{}`, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DiffJSON([]byte(tt.a), []byte(tt.b))
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffJSONCapsDiffs(t *testing.T) {
+	a := []byte(`[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0]`)
+	b := []byte(`[1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1]`)
+	got, _ := DiffJSON(a, b)
+	if len(got) != maxDiffs {
+		t.Errorf("len(diffs) = %d, want %d", len(got), maxDiffs)
+	}
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds (in seconds) of the latency histogram,
+// matching the Prometheus client defaults.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unknownSlug is the slug label of requests that matched no worktree, so
+// that made-up Host headers cannot create new series.
+const unknownSlug = "unknown"
+
+// routeLabels identifies a slug/service pair.
+type routeLabels struct {
+	slug    string
+	service string
+}
+
+type requestLabels struct {
+	routeLabels
+	code int
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+// Metrics collects per-route proxy metrics and renders them in the
+// Prometheus text exposition format. It is safe for concurrent use.
+type Metrics struct {
+	mu             sync.Mutex
+	requests       map[requestLabels]uint64
+	durations      map[routeLabels]*histogram
+	upstreamErrors map[routeLabels]uint64
+	responseBytes  map[routeLabels]uint64
+}
+
+// NewMetrics creates an empty Metrics collector.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:       map[requestLabels]uint64{},
+		durations:      map[routeLabels]*histogram{},
+		upstreamErrors: map[routeLabels]uint64{},
+		responseBytes:  map[routeLabels]uint64{},
+	}
+}
+
+// Observe records a completed request.
+func (m *Metrics) Observe(slug, service string, code int, bytes int64, d time.Duration, upstreamErr bool) {
+	rl := routeLabels{slug: slug, service: service}
+	secs := d.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{routeLabels: rl, code: code}]++
+	m.responseBytes[rl] += uint64(max(bytes, 0))
+	if upstreamErr {
+		m.upstreamErrors[rl]++
+	}
+
+	h, ok := m.durations[rl]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[rl] = h
+	}
+	for i, le := range durationBuckets {
+		if secs <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += secs
+}
+
+// WriteTo writes all metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString("# HELP portree_proxy_requests_total Requests handled by the proxy.\n")
+	b.WriteString("# TYPE portree_proxy_requests_total counter\n")
+	reqKeys := make([]requestLabels, 0, len(m.requests))
+	for k := range m.requests {
+		reqKeys = append(reqKeys, k)
+	}
+	sort.Slice(reqKeys, func(i, j int) bool {
+		if reqKeys[i].routeLabels != reqKeys[j].routeLabels {
+			return routeLess(reqKeys[i].routeLabels, reqKeys[j].routeLabels)
+		}
+		return reqKeys[i].code < reqKeys[j].code
+	})
+	for _, k := range reqKeys {
+		fmt.Fprintf(&b, "portree_proxy_requests_total{%s,code=\"%d\"} %d\n", k.routeLabels, k.code, m.requests[k])
+	}
+
+	b.WriteString("# HELP portree_proxy_request_duration_seconds Time spent handling proxied requests.\n")
+	b.WriteString("# TYPE portree_proxy_request_duration_seconds histogram\n")
+	for _, k := range sortedRoutes(m.durations) {
+		h := m.durations[k]
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "portree_proxy_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				k, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&b, "portree_proxy_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k, h.count)
+		fmt.Fprintf(&b, "portree_proxy_request_duration_seconds_sum{%s} %s\n", k, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "portree_proxy_request_duration_seconds_count{%s} %d\n", k, h.count)
+	}
+
+	b.WriteString("# HELP portree_proxy_upstream_errors_total Requests that failed to reach the backend.\n")
+	b.WriteString("# TYPE portree_proxy_upstream_errors_total counter\n")
+	for _, k := range sortedRoutes(m.upstreamErrors) {
+		fmt.Fprintf(&b, "portree_proxy_upstream_errors_total{%s} %d\n", k, m.upstreamErrors[k])
+	}
+
+	b.WriteString("# HELP portree_proxy_response_bytes_total Response body bytes sent to clients.\n")
+	b.WriteString("# TYPE portree_proxy_response_bytes_total counter\n")
+	for _, k := range sortedRoutes(m.responseBytes) {
+		fmt.Fprintf(&b, "portree_proxy_response_bytes_total{%s} %d\n", k, m.responseBytes[k])
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// String renders the labels as `slug="...",service="..."`.
+func (l routeLabels) String() string {
+	return fmt.Sprintf("slug=\"%s\",service=\"%s\"", escapeLabel(l.slug), escapeLabel(l.service))
+}
+
+func routeLess(a, b routeLabels) bool {
+	if a.slug != b.slug {
+		return a.slug < b.slug
+	}
+	return a.service < b.service
+}
+
+func sortedRoutes[V any](m map[routeLabels]V) []routeLabels {
+	keys := make([]routeLabels, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return routeLess(keys[i], keys[j]) })
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsWriteTo(t *testing.T) {
+	m := NewMetrics()
+	m.Observe("main", "web", 200, 100, 3*time.Millisecond, false)
+	m.Observe("main", "web", 200, 50, 200*time.Millisecond, false)
+	m.Observe("main", "web", 502, 0, time.Millisecond, true)
+	m.Observe(`we"ird`, "api", 404, 10, time.Millisecond, false)
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE portree_proxy_requests_total counter",
+		`portree_proxy_requests_total{slug="main",service="web",code="200"} 2`,
+		`portree_proxy_requests_total{slug="main",service="web",code="502"} 1`,
+		`portree_proxy_requests_total{slug="we\"ird",service="api",code="404"} 1`,
+		`portree_proxy_request_duration_seconds_bucket{slug="main",service="web",le="0.005"} 2`,
+		`portree_proxy_request_duration_seconds_bucket{slug="main",service="web",le="0.1"} 2`,
+		`portree_proxy_request_duration_seconds_bucket{slug="main",service="web",le="0.25"} 3`,
+		`portree_proxy_request_duration_seconds_bucket{slug="main",service="web",le="+Inf"} 3`,
+		`portree_proxy_request_duration_seconds_count{slug="main",service="web"} 3`,
+		`portree_proxy_upstream_errors_total{slug="main",service="web"} 1`,
+		`portree_proxy_response_bytes_total{slug="main",service="web"} 150`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestAdminServerMetrics(t *testing.T) {
+	p, handler := setupObserveTest(t, nil)
+
+	req := httptest.NewRequest("GET", "http://feature-auth.localhost:3000/", nil)
+	req.Host = "feature-auth.localhost:3000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	admin := NewAdminServer(p, "test")
+	port, err := admin.Start(0)
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer func() { _ = admin.Stop() }()
+
+	resp, err := http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	want := `portree_proxy_requests_total{slug="feature-auth",service="web",code="200"} 1`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("/metrics missing %q\n%s", want, body)
+	}
+}
+
+func TestObserveUnknownSlug(t *testing.T) {
+	p, handler := setupObserveTest(t, nil)
+
+	for _, host := range []string{"made-up-1.localhost:3000", "made-up-2.localhost:3000", "localhost:3000"} {
+		req := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		req.Host = host
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var b strings.Builder
+	if _, err := p.Metrics().WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if strings.Contains(out, "made-up") {
+		t.Errorf("metrics should not label unresolved slugs\n%s", out)
+	}
+	want := `portree_proxy_requests_total{slug="unknown",service="web",code="404"} 2`
+	if !strings.Contains(out, want) {
+		t.Errorf("metrics output missing %q\n%s", want, out)
+	}
+}
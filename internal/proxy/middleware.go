@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// requestInfo carries routing details from the proxy handler back out to the
+// middlewares wrapping it. The handler fills it in once a route is resolved.
+type requestInfo struct {
+	Slug        string
+	Branch      string
+	Service     string
+	BackendPort int
+	// UpstreamErr is set when the backend could not be reached.
+	UpstreamErr error
+	// Dropped is set when a chaos rule closed the connection without a response.
+	Dropped bool
+}
+
+type requestInfoKey struct{}
+
+// withRequestInfo returns r with a requestInfo attached. If r already carries
+// one, it is reused so that nested middlewares share the same record.
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	if info := requestInfoFrom(r.Context()); info != nil {
+		return r, info
+	}
+	info := &requestInfo{}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
+}
+
+// requestInfoFrom returns the requestInfo stored in ctx, or nil.
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// responseRecorder wraps an http.ResponseWriter to record the status code,
+// the number of bytes written and, optionally, a prefix of the body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	body        *limitedBuffer // nil = do not record the body
+	header      http.Header    // snapshot taken when the header is written
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if !rr.wroteHeader {
+		rr.wroteHeader = true
+		rr.status = code
+		rr.header = rr.ResponseWriter.Header().Clone()
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if !rr.wroteHeader {
+		rr.WriteHeader(http.StatusOK)
+	}
+	n, err := rr.ResponseWriter.Write(p)
+	rr.bytes += int64(n)
+	if rr.body != nil {
+		_, _ = rr.body.Write(p[:n])
+	}
+	return n, err
+}
+
+// Flush forwards to the underlying writer so streaming responses (SSE, HMR)
+// keep working through the recorder.
+func (rr *responseRecorder) Flush() {
+	_ = http.NewResponseController(rr.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which
+// httputil.ReverseProxy needs to hijack WebSocket upgrades.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Status returns the recorded status code (200 if only the body was written,
+// 0 if nothing was written).
+func (rr *responseRecorder) Status() int {
+	return rr.status
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newLimitedBuffer(limit int) *limitedBuffer {
+	return &limitedBuffer{limit: limit}
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - b.buf.Len()
+	if room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+// Bytes returns a copy of the recorded data.
+func (b *limitedBuffer) Bytes() []byte {
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// teeBody copies everything read from the wrapped body into a limitedBuffer.
+type teeBody struct {
+	io.ReadCloser
+	buf *limitedBuffer
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		_, _ = t.buf.Write(p[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,477 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/git"
+	"github.com/fairy-pitta/portree/internal/logging"
+	"github.com/fairy-pitta/portree/internal/tracing"
+)
+
+const (
+	// DefaultMirrorBodyLimit is the largest request body that is mirrored and
+	// the number of response body bytes compared.
+	DefaultMirrorBodyLimit = 1 << 20
+	// maxMirrorInFlight bounds the number of concurrent shadow requests.
+	maxMirrorInFlight = 32
+	mirrorTimeout     = 30 * time.Second
+)
+
+// ignoredMirrorHeaders are response headers expected to differ between two
+// otherwise identical responses.
+var ignoredMirrorHeaders = map[string]bool{
+	"Date":           true,
+	"Content-Length": true,
+	"Etag":           true,
+	"Last-Modified":  true,
+	"Set-Cookie":     true,
+	"X-Request-Id":   true,
+	"Server-Timing":  true,
+	"Age":            true,
+}
+
+// ParseMirrorRule parses a "primary=shadow" flag value. Both sides may be
+// branch names or slugs; they are normalized to slugs.
+func ParseMirrorRule(s string) (primary, shadow string, err error) {
+	p, sh, ok := strings.Cut(s, "=")
+	p = git.BranchSlug(strings.TrimSpace(p))
+	sh = git.BranchSlug(strings.TrimSpace(sh))
+	if !ok || p == "" || sh == "" {
+		return "", "", fmt.Errorf("invalid mirror rule %q (want primary=shadow)", s)
+	}
+	if p == sh {
+		return "", "", fmt.Errorf("invalid mirror rule %q: primary and shadow are the same", s)
+	}
+	return p, sh, nil
+}
+
+// MirrorResult is the outcome of comparing a primary response with its shadow.
+type MirrorResult struct {
+	Time          time.Time `json:"time"`
+	Primary       string    `json:"primary"`
+	Shadow        string    `json:"shadow"`
+	Service       string    `json:"service"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	PrimaryStatus int       `json:"primary_status"`
+	ShadowStatus  int       `json:"shadow_status,omitempty"`
+	ShadowError   string    `json:"shadow_error,omitempty"`
+	HeaderDiffs   []string  `json:"header_diffs,omitempty"`
+	BodyDiffs     []string  `json:"body_diffs,omitempty"`
+}
+
+// Match reports whether the shadow response matched the primary.
+func (r MirrorResult) Match() bool {
+	return r.ShadowError == "" && r.PrimaryStatus == r.ShadowStatus &&
+		len(r.HeaderDiffs) == 0 && len(r.BodyDiffs) == 0
+}
+
+// Mirror duplicates traffic from primary slugs to shadow slugs and records
+// how the responses differ.
+type Mirror struct {
+	rules        map[string]string // primary slug -> shadow slug
+	resolver     *Resolver
+	bodyLimit    int
+	logPath      string
+	logMu        sync.Mutex
+	inFlight     chan struct{}
+	client       *http.Client
+	clientHeader string          // header carrying the client cert subject; "" = none
+	tracer       *tracing.Tracer // nil = tracing disabled
+	scheme       string          // scheme clients use to reach the proxy
+	wg           sync.WaitGroup
+}
+
+// NewMirror creates a Mirror. rules maps primary slugs to shadow slugs;
+// results are appended as JSON lines to logPath.
+func NewMirror(resolver *Resolver, rules map[string]string, logPath string, bodyLimit int) *Mirror {
+	if bodyLimit <= 0 {
+		bodyLimit = DefaultMirrorBodyLimit
+	}
+	return &Mirror{
+		rules:     rules,
+		resolver:  resolver,
+		bodyLimit: bodyLimit,
+		logPath:   logPath,
+		scheme:    "http",
+		inFlight:  make(chan struct{}, maxMirrorInFlight),
+		client: &http.Client{
+			Timeout:       mirrorTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Wait blocks until all in-flight shadow requests have completed.
+func (m *Mirror) Wait() {
+	m.wg.Wait()
+}
+
+// shadowResponse is what the shadow backend answered.
+type shadowResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	err    error
+}
+
+// middleware mirrors requests received on proxyPort.
+func (m *Mirror) middleware(proxyPort int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slug := ParseSlugFromHost(r.Host)
+		shadowSlug, ok := m.rules[slug]
+		if !ok || r.Header.Get("Upgrade") != "" || m.answersPreflight(r, slug, proxyPort) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Buffer the body so it can be sent twice. Oversized bodies are
+		// forwarded untouched and not mirrored.
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, int64(m.bodyLimit)+1))
+			if err != nil {
+				http.Error(w, "portree: reading request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(body) > m.bodyLimit {
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+				logging.Verbose("mirror: request body for %s exceeds %d bytes, not mirroring", r.URL.Path, m.bodyLimit)
+				next.ServeHTTP(w, r)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		select {
+		case m.inFlight <- struct{}{}:
+		default:
+			logging.Verbose("mirror: too many shadow requests in flight, skipping %s", r.URL.Path)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Send the shadow request concurrently with the primary.
+		shadowCh := make(chan shadowResponse, 1)
+		shadowReq := r.Clone(context.Background())
+		m.wg.Add(1)
+		go func() {
+			shadowCh <- m.sendShadow(shadowReq, body, shadowSlug, proxyPort)
+		}()
+
+		r, info := withRequestInfo(r)
+		rec := newResponseRecorder(w)
+		rec.body = newLimitedBuffer(m.bodyLimit)
+
+		// Compare once the primary has answered, even if the handler panics,
+		// so the in-flight slot is always released.
+		defer func() {
+			primary := shadowResponse{status: rec.Status(), header: rec.header, body: rec.body.Bytes()}
+			result := MirrorResult{
+				Time:    time.Now(),
+				Primary: slug,
+				Shadow:  shadowSlug,
+				Service: info.Service,
+				Method:  r.Method,
+				Path:    r.URL.Path,
+			}
+			go func() {
+				defer m.wg.Done()
+				defer func() { <-m.inFlight }()
+				compareMirror(&result, primary, <-shadowCh)
+				m.record(result)
+			}()
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// answersPreflight reports whether the proxy answers r itself as a CORS
+// preflight, in which case there is no backend response to compare.
+func (m *Mirror) answersPreflight(r *http.Request, slug string, proxyPort int) bool {
+	if !isPreflight(r) {
+		return false
+	}
+	cfg := m.resolver.Config()
+	return cfg.Services[m.resolver.ServiceForProxyPort(proxyPort)].Proxy.CORS && corsOrigin(r, slug, cfg) != ""
+}
+
+// sendShadow replays req against the shadow slug's backend. The request is
+// rewritten as the proxy rewrites primary requests. The response is rewritten
+// as if it had been served on the primary's host, so that only differences
+// between the two backends show up.
+func (m *Mirror) sendShadow(req *http.Request, body []byte, shadowSlug string, proxyPort int) (res shadowResponse) {
+	route, err := m.resolver.ResolveRoute(shadowSlug, proxyPort)
+	if err != nil {
+		return shadowResponse{err: err}
+	}
+	cfg := m.resolver.Config()
+	opts := cfg.Services[route.Service].Proxy
+	slug := ParseSlugFromHost(req.Host)
+	shadowHost := ReplaceSlugInHost(req.Host, shadowSlug)
+
+	target := backendURL(cfg, route)
+	target.Path, target.RawPath, target.RawQuery = req.URL.Path, req.URL.RawPath, req.URL.RawQuery
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+	out, err := http.NewRequestWithContext(ctx, req.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return shadowResponse{err: err}
+	}
+	out.Header = req.Header.Clone()
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	// Like httputil.ReverseProxy, do not pass on forwarding headers set by
+	// the client.
+	for _, h := range []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Proto"} {
+		out.Header.Del(h)
+	}
+	out.Host = shadowHost
+	out.Header.Set("X-Forwarded-Host", shadowHost)
+	if m.tracer != nil {
+		span := startMirrorSpan(m.tracer, req, shadowHost, m.scheme)
+		setSpanRoute(span, shadowSlug, route.Service, route)
+		out.Header.Set("traceparent", span.Context().Traceparent())
+		defer func() { endServerSpan(span, res.status, res.err) }()
+	}
+	if m.clientHeader != "" {
+		setClientSubject(out, m.clientHeader, req.TLS)
+	}
+	in := req.WithContext(ctx)
+	in.Host = shadowHost
+	rewriteRequest(&httputil.ProxyRequest{In: in, Out: out}, opts, headerTemplate(route, shadowSlug, shadowHost), m.scheme)
+	out.Header.Set("X-Portree-Mirror", "1")
+
+	resp, err := m.client.Do(out)
+	if err != nil {
+		return shadowResponse{err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	rewriteResponse(resp, opts, headerTemplate(route, slug, req.Host), route, req.Host, m.scheme)
+	if opts.CORS {
+		if origin := corsOrigin(req, slug, cfg); origin != "" {
+			setCORSHeaders(resp.Header, origin)
+		}
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, int64(m.bodyLimit)))
+	if err != nil {
+		return shadowResponse{err: err}
+	}
+	return shadowResponse{status: resp.StatusCode, header: resp.Header, body: respBody}
+}
+
+// compareMirror fills in the differences between primary and shadow.
+func compareMirror(result *MirrorResult, primary, shadow shadowResponse) {
+	result.PrimaryStatus = primary.status
+	if shadow.err != nil {
+		result.ShadowError = shadow.err.Error()
+		return
+	}
+	result.ShadowStatus = shadow.status
+	result.HeaderDiffs = diffHeaders(primary.header, shadow.header)
+	result.BodyDiffs = diffBodies(primary, shadow)
+}
+
+func diffHeaders(a, b http.Header) []string {
+	names := map[string]bool{}
+	for k := range a {
+		names[k] = true
+	}
+	for k := range b {
+		names[k] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		if !ignoredMirrorHeaders[http.CanonicalHeaderKey(k)] {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, k := range sorted {
+		av := strings.Join(a.Values(k), ", ")
+		bv := strings.Join(b.Values(k), ", ")
+		switch {
+		case av == bv:
+		case len(a.Values(k)) == 0:
+			diffs = append(diffs, fmt.Sprintf("%s: only in shadow (%q)", k, bv))
+		case len(b.Values(k)) == 0:
+			diffs = append(diffs, fmt.Sprintf("%s: missing in shadow (%q)", k, av))
+		default:
+			diffs = append(diffs, fmt.Sprintf("%s: %q != %q", k, av, bv))
+		}
+	}
+	return diffs
+}
+
+func diffBodies(primary, shadow shadowResponse) []string {
+	if bytes.Equal(primary.body, shadow.body) {
+		return nil
+	}
+	if isJSON(primary.header) || isJSON(shadow.header) {
+		if diffs, ok := DiffJSON(primary.body, shadow.body); ok {
+			return diffs
+		}
+	}
+	return []string{fmt.Sprintf("body differs (%d vs %d bytes)", len(primary.body), len(shadow.body))}
+}
+
+func isJSON(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// record appends a result to the mirror log.
+func (m *Mirror) record(result MirrorResult) {
+	if !result.Match() {
+		logging.Verbose("mirror: %s %s differs between %s and %s", result.Method, result.Path, result.Primary, result.Shadow)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		logging.Warn("mirror: encoding result: %v", err)
+		return
+	}
+
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(m.logPath), 0700); err != nil {
+		logging.Warn("mirror: creating log directory: %v", err)
+		return
+	}
+	f, err := os.OpenFile(m.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		logging.Warn("mirror: opening log: %v", err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		logging.Warn("mirror: writing log: %v", err)
+	}
+}
+
+// ReadMirrorLog reads all results from a mirror log. A missing file yields no results.
+func ReadMirrorLog(path string) ([]MirrorResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening mirror log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var results []MirrorResult
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var r MirrorResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			logging.Warn("skipping malformed mirror log line: %v", err)
+			continue
+		}
+		results = append(results, r)
+	}
+	return results, scanner.Err()
+}
+
+// MirrorEndpointSummary aggregates results for one method + path.
+type MirrorEndpointSummary struct {
+	Primary      string   `json:"primary"`
+	Shadow       string   `json:"shadow"`
+	Service      string   `json:"service"`
+	Method       string   `json:"method"`
+	Path         string   `json:"path"`
+	Total        int      `json:"total"`
+	Mismatches   int      `json:"mismatches"`
+	StatusDiffs  int      `json:"status_diffs"`
+	HeaderDiffs  int      `json:"header_diffs"`
+	BodyDiffs    int      `json:"body_diffs"`
+	ShadowErrors int      `json:"shadow_errors"`
+	Examples     []string `json:"examples,omitempty"`
+}
+
+// maxMirrorExamples is the number of distinct example differences kept per endpoint.
+const maxMirrorExamples = 5
+
+// SummarizeMirror groups results by primary/shadow/service/method/path.
+// Endpoints are sorted with the most mismatches first.
+func SummarizeMirror(results []MirrorResult) []MirrorEndpointSummary {
+	index := map[string]*MirrorEndpointSummary{}
+	var order []string
+	for _, r := range results {
+		key := strings.Join([]string{r.Primary, r.Shadow, r.Service, r.Method, r.Path}, "\x00")
+		s, ok := index[key]
+		if !ok {
+			s = &MirrorEndpointSummary{Primary: r.Primary, Shadow: r.Shadow, Service: r.Service, Method: r.Method, Path: r.Path}
+			index[key] = s
+			order = append(order, key)
+		}
+		s.Total++
+		if r.Match() {
+			continue
+		}
+		s.Mismatches++
+		var examples []string
+		switch {
+		case r.ShadowError != "":
+			s.ShadowErrors++
+			examples = append(examples, "shadow error: "+r.ShadowError)
+		default:
+			if r.PrimaryStatus != r.ShadowStatus {
+				s.StatusDiffs++
+				examples = append(examples, fmt.Sprintf("status %d != %d", r.PrimaryStatus, r.ShadowStatus))
+			}
+			if len(r.HeaderDiffs) > 0 {
+				s.HeaderDiffs++
+				examples = append(examples, r.HeaderDiffs...)
+			}
+			if len(r.BodyDiffs) > 0 {
+				s.BodyDiffs++
+				examples = append(examples, r.BodyDiffs...)
+			}
+		}
+		for _, ex := range examples {
+			if len(s.Examples) >= maxMirrorExamples {
+				break
+			}
+			if !slices.Contains(s.Examples, ex) {
+				s.Examples = append(s.Examples, ex)
+			}
+		}
+	}
+
+	out := make([]MirrorEndpointSummary, 0, len(order))
+	for _, key := range order {
+		out = append(out, *index[key])
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Mismatches > out[j].Mismatches
+	})
+	return out
+}
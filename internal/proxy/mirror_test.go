@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/state"
+	"github.com/fairy-pitta/portree/internal/tracing"
+)
+
+func TestParseMirrorRule(t *testing.T) {
+	tests := []struct {
+		in                  string
+		wantPrimary, wantSh string
+		wantErr             bool
+	}{
+		{"main=feature-x", "main", "feature-x", false},
+		{"main = feature/x", "main", "feature-x", false},
+		{"main", "", "", true},
+		{"main=", "", "", true},
+		{"main=main", "", "", true},
+	}
+	for _, tt := range tests {
+		p, sh, err := ParseMirrorRule(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMirrorRule(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if p != tt.wantPrimary || sh != tt.wantSh {
+			t.Errorf("ParseMirrorRule(%q) = %q, %q, want %q, %q", tt.in, p, sh, tt.wantPrimary, tt.wantSh)
+		}
+	}
+}
+
+// startJSONBackend starts a backend answering with body and records request bodies.
+func startJSONBackend(t *testing.T, body string, got *[]string) int {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		*got = append(*got, r.Host+" "+string(b))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	var port int
+	_, _ = fmt.Sscanf(srv.Listener.Addr().String(), "127.0.0.1:%d", &port)
+	return port
+}
+
+func TestMirrorMiddleware(t *testing.T) {
+	var primaryReqs, shadowReqs []string
+	primaryPort := startJSONBackend(t, `{"id":1,"tags":["a","b"]}`, &primaryReqs)
+	shadowPort := startJSONBackend(t, `{"id":1,"tags":["a","c"]}`, &shadowReqs)
+
+	dir := t.TempDir()
+	store, err := state.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &state.State{
+		Services:        map[string]map[string]*state.ServiceState{},
+		PortAssignments: map[string]int{},
+	}
+	state.SetPortAssignment(st, "main", "api", primaryPort)
+	state.SetPortAssignment(st, "feature/x", "api", shadowPort)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"api": {Command: "serve", PortRange: config.PortRange{Min: 8100, Max: 8199}, ProxyPort: 8000},
+		},
+	}
+	resolver := NewResolver(cfg, store)
+	logPath := filepath.Join(dir, "logs", "mirror.jsonl")
+	mirror := NewMirror(resolver, map[string]string{"main": "feature-x"}, logPath, 0)
+	p := NewProxyServer(resolver, nil)
+	p.EnableMirror(mirror)
+	handler := p.middlewares(8000, p.handler(8000))
+
+	req := httptest.NewRequest("POST", "http://main.localhost:8000/items", strings.NewReader(`{"name":"x"}`))
+	req.Host = "main.localhost:8000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	mirror.Wait()
+
+	if rec.Body.String() != `{"id":1,"tags":["a","b"]}` {
+		t.Errorf("client received %q, want the primary response", rec.Body.String())
+	}
+	if len(primaryReqs) != 1 || primaryReqs[0] != `main.localhost:8000 {"name":"x"}` {
+		t.Errorf("primary requests = %q", primaryReqs)
+	}
+	if len(shadowReqs) != 1 || shadowReqs[0] != `feature-x.localhost:8000 {"name":"x"}` {
+		t.Errorf("shadow requests = %q", shadowReqs)
+	}
+
+	results, err := ReadMirrorLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("mirror log has %d results, want 1", len(results))
+	}
+	r := results[0]
+	if r.Match() {
+		t.Error("result should not match")
+	}
+	if r.Service != "api" || r.Primary != "main" || r.Shadow != "feature-x" {
+		t.Errorf("result route = %+v", r)
+	}
+	if len(r.BodyDiffs) != 1 || r.BodyDiffs[0] != `$.tags[1]: "b" != "c"` {
+		t.Errorf("body diffs = %q", r.BodyDiffs)
+	}
+	if len(r.HeaderDiffs) != 0 {
+		t.Errorf("header diffs = %q, want none", r.HeaderDiffs)
+	}
+}
+
+func TestMirrorMiddlewareIgnoresOtherSlugs(t *testing.T) {
+	p, _ := setupProxyTest(t)
+	mirror := NewMirror(p.resolver, map[string]string{"main": "feature-x"}, filepath.Join(t.TempDir(), "m.jsonl"), 0)
+
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	req := httptest.NewRequest("GET", "http://other.localhost:3000/", nil)
+	req.Host = "other.localhost:3000"
+	mirror.middleware(3000, next).ServeHTTP(httptest.NewRecorder(), req)
+	mirror.Wait()
+
+	if !called {
+		t.Error("next handler was not called")
+	}
+	if results, _ := ReadMirrorLog(mirror.logPath); len(results) != 0 {
+		t.Errorf("unexpected mirror results: %+v", results)
+	}
+}
+
+func TestMirrorClientSubject(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, r.Host+" "+r.Header.Get("X-Client-Cert-Subject"))
+	}))
+	defer backend.Close()
+	var port int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &port)
+
+	p, store := setupProxyTest(t)
+	st, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetPortAssignment(st, "main", "web", port)
+	state.SetPortAssignment(st, "feature/x", "web", port)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	mirror := NewMirror(p.resolver, map[string]string{"main": "feature-x"}, filepath.Join(t.TempDir(), "m.jsonl"), 0)
+	p.EnableMirror(mirror)
+	p.ForwardClientSubject("X-Client-Cert-Subject")
+	handler := p.middlewares(3000, p.handler(3000))
+
+	send := func(cs *tls.ConnectionState) {
+		req := httptest.NewRequest("GET", "http://main.localhost:3000/", nil)
+		req.Host = "main.localhost:3000"
+		req.Header.Set("X-Client-Cert-Subject", "CN=forged")
+		req.TLS = cs
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		mirror.Wait()
+	}
+
+	send(nil)
+	verified := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+	send(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{verified}}})
+
+	sort.Strings(got)
+	want := []string{
+		"feature-x.localhost:3000 ",
+		"feature-x.localhost:3000 CN=alice",
+		"main.localhost:3000 ",
+		"main.localhost:3000 CN=alice",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("backends received %q, want %q", got, want)
+	}
+}
+
+func TestMirrorAppliesProxyOptions(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, fmt.Sprintf("%s tenant=%s cookie=%q proto=%s traced=%t",
+			r.Host, r.Header.Get("X-Tenant"), r.Header.Get("Cookie"), r.Header.Get("X-Forwarded-Proto"), r.Header.Get("traceparent") != ""))
+		mu.Unlock()
+		w.Header().Set("Server", "dev")
+		_, _ = fmt.Fprint(w, "ok")
+	}))
+	defer backend.Close()
+	var port int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &port)
+
+	p, store := setupProxyTest(t)
+	st, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetPortAssignment(st, "main", "web", port)
+	state.SetPortAssignment(st, "feature/x", "web", port)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	cfg := *p.resolver.Config()
+	cfg.Services = map[string]config.ServiceConfig{
+		"web": {
+			Command:   "npm start",
+			PortRange: config.PortRange{Min: 3100, Max: 3199},
+			ProxyPort: 3000,
+			Proxy: config.ProxyOptions{
+				RequestHeaders:        map[string]string{"X-Tenant": "{slug}"},
+				RemoveRequestHeaders:  []string{"Cookie"},
+				ResponseHeaders:       map[string]string{"X-Served-By": "portree"},
+				RemoveResponseHeaders: []string{"Server"},
+				XForwarded:            true,
+				CORS:                  true,
+			},
+		},
+	}
+	p.resolver.SetConfig(&cfg)
+
+	logPath := filepath.Join(t.TempDir(), "m.jsonl")
+	mirror := NewMirror(p.resolver, map[string]string{"main": "feature-x"}, logPath, 0)
+	p.EnableMirror(mirror)
+	p.EnableTracing(tracing.NewTracer(nil))
+	handler := p.middlewares(3000, p.handler(3000))
+
+	req := httptest.NewRequest("GET", "http://main.localhost:3000/", nil)
+	req.Host = "main.localhost:3000"
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("Origin", "http://main.localhost:3000")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	mirror.Wait()
+
+	sort.Strings(got)
+	want := []string{
+		`feature-x.localhost:3000 tenant=feature-x cookie="" proto=http traced=true`,
+		`main.localhost:3000 tenant=main cookie="" proto=http traced=true`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("backends received %q, want %q", got, want)
+	}
+
+	results, err := ReadMirrorLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Match() {
+		t.Errorf("mirror results = %+v, want a single match", results)
+	}
+}
+
+func TestSummarizeMirror(t *testing.T) {
+	results := []MirrorResult{
+		{Primary: "main", Shadow: "fx", Method: "GET", Path: "/a", PrimaryStatus: 200, ShadowStatus: 200},
+		{Primary: "main", Shadow: "fx", Method: "GET", Path: "/b", PrimaryStatus: 200, ShadowStatus: 500},
+		{Primary: "main", Shadow: "fx", Method: "GET", Path: "/b", PrimaryStatus: 200, ShadowError: "connection refused"},
+		{Primary: "main", Shadow: "fx", Method: "GET", Path: "/b", PrimaryStatus: 200, ShadowStatus: 200, BodyDiffs: []string{"$.x: 1 != 2"}},
+	}
+
+	summary := SummarizeMirror(results)
+	if len(summary) != 2 {
+		t.Fatalf("len(summary) = %d, want 2", len(summary))
+	}
+	b := summary[0]
+	if b.Path != "/b" {
+		t.Fatalf("most mismatching endpoint = %q, want /b", b.Path)
+	}
+	if b.Total != 3 || b.Mismatches != 3 || b.StatusDiffs != 1 || b.ShadowErrors != 1 || b.BodyDiffs != 1 {
+		t.Errorf("summary for /b = %+v", b)
+	}
+	if len(b.Examples) != 3 {
+		t.Errorf("examples = %q", b.Examples)
+	}
+	if summary[1].Mismatches != 0 {
+		t.Errorf("summary for /a = %+v", summary[1])
+	}
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/fairy-pitta/portree/internal/config"
+)
+
+// hopHeaders are connection-specific headers that must not be replayed.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Content-Length",
+}
+
+// Replay re-sends a captured request to route's backend, over https when
+// the service has backend_tls. The Host header is set to host so that the
+// backend sees the request as if it had come through the proxy for the
+// target worktree. transport carries the request; nil means
+// http.DefaultTransport.
+func Replay(ctx context.Context, ex Exchange, cfg *config.Config, route Route, host string, transport http.RoundTripper) (*http.Response, error) {
+	orig, err := url.Parse(ex.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing captured URL: %w", err)
+	}
+	target := backendURL(cfg, route)
+	target.Path, target.RawPath, target.RawQuery = orig.Path, orig.RawPath, orig.RawQuery
+
+	req, err := http.NewRequestWithContext(ctx, ex.Method, target.String(), bytes.NewReader(ex.RequestBody))
+	if err != nil {
+		return nil, fmt.Errorf("building replay request: %w", err)
+	}
+	req.Header = ex.RequestHeader.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.Host = host
+	req.Header.Set("X-Forwarded-Host", host)
+	req.Header.Set("X-Portree-Replay", strconv.FormatInt(ex.ID, 10))
+
+	// Do not follow redirects: the caller wants to see exactly what the
+	// backend answered.
+	client := &http.Client{
+		Transport:     transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return client.Do(req)
+}
+
+// ReplaceSlugInHost swaps the slug in a proxy host for newSlug, keeping the
+// rest of the host: ".localhost", a wildcard DNS suffix such as
+// ".192.168.1.5.nip.io", and the port. Hosts without a slug become
+// "<newSlug>.localhost", keeping the port.
+// "feature-auth.localhost:3000", "main" -> "main.localhost:3000"
+// "feature-auth.192.168.1.5.nip.io:3000", "main" -> "main.192.168.1.5.nip.io:3000"
+func ReplaceSlugInHost(host, newSlug string) string {
+	if slug := ParseSlugFromHost(host); slug != "" {
+		return newSlug + host[len(slug):]
+	}
+	port := ""
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		port = host[idx:]
+	}
+	return newSlug + ".localhost" + port
+}
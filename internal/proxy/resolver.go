@@ -2,7 +2,9 @@ package proxy
 
 import (
 	"fmt"
+	"net"
 	"strings"
+	"sync/atomic"
 
 	"github.com/fairy-pitta/portree/internal/config"
 	"github.com/fairy-pitta/portree/internal/git"
@@ -11,27 +13,61 @@ import (
 
 // Resolver maps slug + proxy_port to real backend port.
 type Resolver struct {
-	cfg   *config.Config
+	cfg   atomic.Pointer[config.Config]
 	store *state.FileStore
 }
 
 // NewResolver creates a new Resolver.
 func NewResolver(cfg *config.Config, store *state.FileStore) *Resolver {
-	return &Resolver{cfg: cfg, store: store}
+	r := &Resolver{store: store}
+	r.cfg.Store(cfg)
+	return r
+}
+
+// SetConfig atomically replaces the configuration used for routing, e.g.
+// after .portree.toml was edited. In-flight requests keep the old one.
+func (r *Resolver) SetConfig(cfg *config.Config) {
+	r.cfg.Store(cfg)
+}
+
+// Config returns the current configuration.
+func (r *Resolver) Config() *config.Config {
+	return r.cfg.Load()
+}
+
+// Route describes the backend a request is forwarded to.
+type Route struct {
+	Branch  string
+	Service string
+	Port    int
 }
 
 // Resolve returns the real backend port for a slug and proxy port.
 func (r *Resolver) Resolve(slug string, proxyPort int) (int, error) {
-	// Find which service uses this proxy port.
-	serviceName := ""
-	for name, svc := range r.cfg.Services {
+	route, err := r.ResolveRoute(slug, proxyPort)
+	if err != nil {
+		return 0, err
+	}
+	return route.Port, nil
+}
+
+// ServiceForProxyPort returns the name of the service listening on proxyPort,
+// or "" if none is configured.
+func (r *Resolver) ServiceForProxyPort(proxyPort int) string {
+	for name, svc := range r.cfg.Load().Services {
 		if svc.ProxyPort == proxyPort {
-			serviceName = name
-			break
+			return name
 		}
 	}
+	return ""
+}
+
+// ResolveRoute returns the branch, service and backend port for a slug and proxy port.
+func (r *Resolver) ResolveRoute(slug string, proxyPort int) (Route, error) {
+	// Find which service uses this proxy port.
+	serviceName := r.ServiceForProxyPort(proxyPort)
 	if serviceName == "" {
-		return 0, fmt.Errorf("no service configured for proxy_port %d", proxyPort)
+		return Route{}, fmt.Errorf("no service configured for proxy_port %d", proxyPort)
 	}
 
 	// Resolve branch and port in a single lock to avoid inconsistency.
@@ -56,13 +92,16 @@ func (r *Resolver) Resolve(slug string, proxyPort int) (int, error) {
 		port = state.GetPortAssignment(st, branch, serviceName)
 		return nil
 	}); err != nil {
-		return 0, err
+		return Route{}, err
 	}
 
+	if !r.cfg.Load().ServiceEnabled(serviceName, branch) {
+		return Route{}, fmt.Errorf("service %q is disabled for %s (slug: %s)", serviceName, branch, slug)
+	}
 	if port == 0 {
-		return 0, fmt.Errorf("no port assigned for %s/%s (slug: %s)", branch, serviceName, slug)
+		return Route{}, fmt.Errorf("no port assigned for %s/%s (slug: %s)", branch, serviceName, slug)
 	}
-	return port, nil
+	return Route{Branch: branch, Service: serviceName, Port: port}, nil
 }
 
 // AvailableSlugs returns all known branch slugs.
@@ -93,8 +132,28 @@ func (r *Resolver) AvailableSlugs() ([]string, error) {
 	return slugs, nil
 }
 
+// KnownSlug reports whether slug, or its last label for multi-level names
+// like "api.feature-x", is the slug of a worktree with assigned ports.
+func (r *Resolver) KnownSlug(slug string) bool {
+	if slug == "" {
+		return false
+	}
+	slugs, err := r.AvailableSlugs()
+	if err != nil {
+		return false
+	}
+	for _, s := range slugs {
+		if slug == s || strings.HasSuffix(slug, "."+s) {
+			return true
+		}
+	}
+	return false
+}
+
 // ParseSlugFromHost extracts the slug from a Host header value.
 // "feature-auth.localhost:3000" -> "feature-auth"
+// "feature-auth.192.168.1.5.nip.io:3000" -> "feature-auth"
+// "api.feature-auth.192-168-1-5.sslip.io" -> "api.feature-auth"
 // "localhost:3000" -> ""
 func ParseSlugFromHost(host string) string {
 	// Remove port.
@@ -102,6 +161,15 @@ func ParseSlugFromHost(host string) string {
 	if idx := strings.LastIndex(h, ":"); idx != -1 {
 		h = h[:idx]
 	}
+	h = strings.ToLower(h)
+
+	// Wildcard DNS hosts used for LAN sharing: <slug>.192.168.1.5.nip.io
+	// or <slug>.192-168-1-5.sslip.io.
+	for _, suffix := range wildcardDNSSuffixes {
+		if rest, ok := strings.CutSuffix(h, suffix); ok {
+			return trimIPLabels(rest)
+		}
+	}
 
 	// Check for .localhost suffix.
 	if !strings.HasSuffix(h, ".localhost") {
@@ -114,3 +182,27 @@ func ParseSlugFromHost(host string) string {
 	}
 	return slug
 }
+
+// trimIPLabels returns what precedes the IPv4 address at the end of name,
+// written either dotted ("api.main.192.168.1.5") or dashed
+// ("api.main.192-168-1-5"). It returns "" if there is no such address or
+// nothing precedes it.
+func trimIPLabels(name string) string {
+	labels := strings.Split(name, ".")
+	if n := len(labels); n > 4 && isIPv4(strings.Join(labels[n-4:], ".")) {
+		return strings.Join(labels[:n-4], ".")
+	}
+	if n := len(labels); n > 1 && isIPv4(strings.ReplaceAll(labels[n-1], "-", ".")) {
+		return strings.Join(labels[:n-1], ".")
+	}
+	return ""
+}
+
+func isIPv4(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil
+}
+
+// wildcardDNSSuffixes are public DNS services that resolve <anything>.<ip>.<suffix>
+// to <ip>, which lets other devices on the LAN reach a slug subdomain.
+var wildcardDNSSuffixes = []string{".nip.io", ".sslip.io"}
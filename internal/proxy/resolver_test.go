@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/fairy-pitta/portree/internal/config"
@@ -25,6 +26,15 @@ func TestParseSlugFromHost(t *testing.T) {
 		{"non-localhost", "feature-auth.example.com:3000", ""},
 		{"just .localhost", ".localhost:3000", ""},
 		{"deep subdomain", "my-feature.localhost:8080", "my-feature"},
+		{"nip.io dotted IP", "feature-x.192.168.1.5.nip.io:3000", "feature-x"},
+		{"nip.io dashed IP", "feature-x.192-168-1-5.nip.io", "feature-x"},
+		{"sslip.io", "main.10.0.0.2.sslip.io:3000", "main"},
+		{"nip.io without slug", "192-168-1-5.nip.io:3000", ""},
+		{"nip.io bare dotted IP", "192.168.1.5.nip.io:3000", ""},
+		{"nip.io multi-level dotted IP", "api.feature-x.192.168.1.5.nip.io:3000", "api.feature-x"},
+		{"sslip.io multi-level dashed IP", "api.feature-x.192-168-1-5.sslip.io", "api.feature-x"},
+		{"nip.io without IP", "feature-x.example.nip.io", ""},
+		{"uppercase host", "Feature-X.LOCALHOST:3000", "feature-x"},
 	}
 
 	for _, tt := range tests {
@@ -116,3 +126,58 @@ func TestResolverAvailableSlugs(t *testing.T) {
 		t.Errorf("AvailableSlugs() = %v, want [feature-auth, main]", slugs)
 	}
 }
+
+func TestResolverKnownSlug(t *testing.T) {
+	resolver, _ := setupResolver(t)
+
+	for slug, want := range map[string]bool{
+		"feature-auth":     true,
+		"api.feature-auth": true,
+		"made-up":          false,
+		"xfeature-auth":    false,
+		"":                 false,
+	} {
+		if got := resolver.KnownSlug(slug); got != want {
+			t.Errorf("KnownSlug(%q) = %v, want %v", slug, got, want)
+		}
+	}
+}
+
+func TestResolverSetConfig(t *testing.T) {
+	resolver, _ := setupResolver(t)
+
+	if _, err := resolver.Resolve("feature-auth", 4000); err == nil {
+		t.Fatal("Resolve() on an unconfigured proxy port should fail")
+	}
+
+	cfg := *resolver.Config()
+	cfg.Services = map[string]config.ServiceConfig{
+		"web": {Command: "npm start", PortRange: config.PortRange{Min: 3100, Max: 3199}, ProxyPort: 4000},
+	}
+	resolver.SetConfig(&cfg)
+
+	port, err := resolver.Resolve("feature-auth", 4000)
+	if err != nil {
+		t.Fatalf("Resolve() after SetConfig error: %v", err)
+	}
+	if port != 3150 {
+		t.Errorf("Resolve() = %d, want 3150", port)
+	}
+	if _, err := resolver.Resolve("feature-auth", 3000); err == nil {
+		t.Error("the old proxy port should no longer resolve")
+	}
+}
+
+func TestResolverDisabledService(t *testing.T) {
+	resolver, _ := setupResolver(t)
+	cfg := *resolver.Config()
+	cfg.Services = map[string]config.ServiceConfig{
+		"web": {Command: "npm start", PortRange: config.PortRange{Min: 3100, Max: 3199}, ProxyPort: 3000, OnlyBranches: []string{"main"}},
+	}
+	resolver.SetConfig(&cfg)
+
+	_, err := resolver.Resolve("feature-auth", 3000)
+	if err == nil || !strings.Contains(err.Error(), `service "web" is disabled for feature/auth`) {
+		t.Errorf("Resolve() error = %v, want disabled", err)
+	}
+}
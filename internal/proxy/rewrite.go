@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/fairy-pitta/portree/internal/config"
+)
+
+// headerTemplate expands the placeholders allowed in [services.x.proxy]
+// header values.
+func headerTemplate(route Route, slug, host string) *strings.Replacer {
+	return strings.NewReplacer(
+		"{slug}", slug,
+		"{branch}", route.Branch,
+		"{service}", route.Service,
+		"{host}", host,
+		"{port}", strconv.Itoa(route.Port),
+	)
+}
+
+// rewriteRequest applies the request-side proxy options to an outgoing request.
+func rewriteRequest(pr *httputil.ProxyRequest, opts config.ProxyOptions, tmpl *strings.Replacer, scheme string) {
+	if opts.XForwarded {
+		pr.SetXForwarded()
+		pr.Out.Header.Set("X-Forwarded-Proto", scheme)
+		_, port, err := net.SplitHostPort(pr.In.Host)
+		if err != nil {
+			port = "80"
+			if scheme == "https" {
+				port = "443"
+			}
+		}
+		pr.Out.Header.Set("X-Forwarded-Port", port)
+	}
+	for _, name := range opts.RemoveRequestHeaders {
+		pr.Out.Header.Del(name)
+	}
+	for name, value := range opts.RequestHeaders {
+		pr.Out.Header.Set(name, tmpl.Replace(value))
+	}
+}
+
+// rewriteResponse applies the response-side proxy options to a backend response.
+func rewriteResponse(resp *http.Response, opts config.ProxyOptions, tmpl *strings.Replacer, route Route, host, scheme string) {
+	if opts.RewriteLocation {
+		if loc := resp.Header.Get("Location"); loc != "" {
+			resp.Header.Set("Location", rewriteLocation(loc, route.Port, host, scheme))
+		}
+	}
+	if opts.RewriteCookieDomain {
+		rewriteCookieDomains(resp.Header, hostname(host))
+	}
+	for _, name := range opts.RemoveResponseHeaders {
+		resp.Header.Del(name)
+	}
+	for name, value := range opts.ResponseHeaders {
+		resp.Header.Set(name, tmpl.Replace(value))
+	}
+}
+
+// rewriteLocation points an absolute redirect to the backend itself
+// (e.g. http://localhost:3150/login) at the proxied host instead. Other
+// locations are returned unchanged.
+func rewriteLocation(loc string, backendPort int, host, scheme string) string {
+	u, err := url.Parse(loc)
+	if err != nil || u.Host == "" || u.Port() != strconv.Itoa(backendPort) || !isLocalHostname(u.Hostname()) {
+		return loc
+	}
+	u.Scheme = scheme
+	u.Host = host
+	return u.String()
+}
+
+// rewriteCookieDomains replaces the Domain attribute of each Set-Cookie
+// header with domain.
+func rewriteCookieDomains(h http.Header, domain string) {
+	cookies := h.Values("Set-Cookie")
+	if len(cookies) == 0 {
+		return
+	}
+	h.Del("Set-Cookie")
+	for _, c := range cookies {
+		parts := strings.Split(c, ";")
+		for i, part := range parts {
+			name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if i > 0 && strings.EqualFold(name, "domain") {
+				parts[i] = " Domain=" + domain
+			}
+		}
+		h.Add("Set-Cookie", strings.Join(parts, ";"))
+	}
+}
+
+func isLocalHostname(h string) bool {
+	if strings.EqualFold(h, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(h)
+	return ip != nil && ip.IsLoopback()
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// corsOrigin returns r's Origin if it is allowed to make CORS requests to
+// slug: the origin must address the same worktree on one of the proxy
+// ports, i.e. be a sibling service. It returns "" otherwise.
+func corsOrigin(r *http.Request, slug string, cfg *config.Config) string {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return ""
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || ParseSlugFromHost(u.Host) != slug {
+		return ""
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return ""
+	}
+	for _, svc := range cfg.Services {
+		if svc.ProxyPort == port {
+			return origin
+		}
+	}
+	return ""
+}
+
+// isPreflight reports whether r is a CORS preflight request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// setCORSHeaders allows origin to read the response, including credentials.
+func setCORSHeaders(h http.Header, origin string) {
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Allow-Credentials", "true")
+	h.Add("Vary", "Origin")
+}
+
+// answerPreflight responds to a CORS preflight without forwarding it,
+// allowing whatever method and headers the browser asked for.
+func answerPreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	setCORSHeaders(h, origin)
+	h.Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+	if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	h.Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setClientSubject puts the subject of the verified client certificate in
+// header, or removes the header when there is none so that clients cannot
+// forge it.
+func setClientSubject(out *http.Request, header string, cs *tls.ConnectionState) {
+	out.Header.Del(header)
+	if cs != nil && len(cs.VerifiedChains) > 0 && len(cs.VerifiedChains[0]) > 0 {
+		out.Header.Set(header, cs.VerifiedChains[0][0].Subject.String())
+	}
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/state"
+)
+
+func TestRewriteLocation(t *testing.T) {
+	tests := []struct {
+		loc, want string
+	}{
+		{"http://localhost:3150/login", "https://feature-x.localhost:3000/login"},
+		{"http://127.0.0.1:3150/a?b=1", "https://feature-x.localhost:3000/a?b=1"},
+		{"http://localhost:4000/login", "http://localhost:4000/login"},
+		{"https://example.com/", "https://example.com/"},
+		{"/relative", "/relative"},
+	}
+	for _, tt := range tests {
+		if got := rewriteLocation(tt.loc, 3150, "feature-x.localhost:3000", "https"); got != tt.want {
+			t.Errorf("rewriteLocation(%q) = %q, want %q", tt.loc, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteCookieDomains(t *testing.T) {
+	h := http.Header{}
+	h.Add("Set-Cookie", "session=abc; Domain=localhost; Path=/; HttpOnly")
+	h.Add("Set-Cookie", "theme=dark; Path=/")
+	rewriteCookieDomains(h, "feature-x.localhost")
+
+	got := h.Values("Set-Cookie")
+	if len(got) != 2 {
+		t.Fatalf("Set-Cookie count = %d, want 2", len(got))
+	}
+	if got[0] != "session=abc; Domain=feature-x.localhost; Path=/; HttpOnly" {
+		t.Errorf("Set-Cookie[0] = %q", got[0])
+	}
+	if got[1] != "theme=dark; Path=/" {
+		t.Errorf("Set-Cookie[1] = %q, cookies without Domain should be unchanged", got[1])
+	}
+}
+
+func TestCORSOrigin(t *testing.T) {
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"web": {ProxyPort: 3000},
+		"api": {ProxyPort: 8000},
+	}}
+	tests := []struct {
+		origin, want string
+	}{
+		{"http://feature-x.localhost:3000", "http://feature-x.localhost:3000"},
+		{"http://feature-x.192.168.1.5.nip.io:3000", "http://feature-x.192.168.1.5.nip.io:3000"},
+		{"http://main.localhost:3000", ""},
+		{"http://feature-x.localhost:5173", ""},
+		{"http://feature-x.localhost", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := corsOrigin(r, "feature-x", cfg); got != tt.want {
+			t.Errorf("corsOrigin(%q) = %q, want %q", tt.origin, got, tt.want)
+		}
+	}
+}
+
+// setupRewriteTest serves feature-auth on proxy port 3000 with opts, through
+// a backend that records the request headers it receives and replies with
+// respond.
+func setupRewriteTest(t *testing.T, opts config.ProxyOptions, respond func(w http.ResponseWriter, r *http.Request)) (front string, received *http.Header) {
+	t.Helper()
+
+	received = &http.Header{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*received = r.Header.Clone()
+		respond(w, r)
+	}))
+	t.Cleanup(backend.Close)
+	var backendPort int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &backendPort)
+
+	p, store := setupProxyTest(t)
+	st, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetPortAssignment(st, "feature/auth", "web", backendPort)
+	state.SetPortAssignment(st, "feature/auth", "api", backendPort+1)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := *p.resolver.Config()
+	cfg.Services = map[string]config.ServiceConfig{
+		"web": {Command: "npm start", PortRange: config.PortRange{Min: 3100, Max: 3199}, ProxyPort: 3000, Proxy: opts},
+		"api": {Command: "go run .", PortRange: config.PortRange{Min: 8100, Max: 8199}, ProxyPort: 8000},
+	}
+	p.resolver.SetConfig(&cfg)
+
+	srv := httptest.NewServer(p.handler(3000))
+	t.Cleanup(srv.Close)
+	return srv.URL, received
+}
+
+func TestProxyHeaderRewriting(t *testing.T) {
+	opts := config.ProxyOptions{
+		RequestHeaders:        map[string]string{"Origin": "http://localhost:{port}", "X-Branch": "{branch}"},
+		RemoveRequestHeaders:  []string{"X-Debug"},
+		ResponseHeaders:       map[string]string{"X-Served-By": "{service}@{slug}"},
+		RemoveResponseHeaders: []string{"Server"},
+		XForwarded:            true,
+		RewriteLocation:       true,
+		RewriteCookieDomain:   true,
+	}
+	front, received := setupRewriteTest(t, opts, func(w http.ResponseWriter, r *http.Request) {
+		backend := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		w.Header().Set("Server", "dev-server")
+		w.Header().Set("Location", "http://"+backend.String()+"/next")
+		w.Header().Set("Set-Cookie", "sid=1; Domain=localhost; Path=/")
+		w.WriteHeader(http.StatusFound)
+	})
+
+	req, _ := http.NewRequest("GET", front+"/", nil)
+	req.Host = "feature-auth.localhost:3000"
+	req.Header.Set("X-Debug", "1")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if !strings.HasPrefix(received.Get("Origin"), "http://localhost:") {
+		t.Errorf("Origin = %q, want the templated backend origin", received.Get("Origin"))
+	}
+	if got := received.Get("X-Branch"); got != "feature/auth" {
+		t.Errorf("X-Branch = %q, want feature/auth", got)
+	}
+	if received.Get("X-Debug") != "" {
+		t.Error("X-Debug should be removed")
+	}
+	if received.Get("X-Forwarded-Proto") != "http" || received.Get("X-Forwarded-Port") != "3000" || received.Get("X-Forwarded-For") == "" {
+		t.Errorf("X-Forwarded-* = %q, %q, %q", received.Get("X-Forwarded-Proto"), received.Get("X-Forwarded-Port"), received.Get("X-Forwarded-For"))
+	}
+
+	if got := resp.Header.Get("X-Served-By"); got != "web@feature-auth" {
+		t.Errorf("X-Served-By = %q, want web@feature-auth", got)
+	}
+	if resp.Header.Get("Server") != "" {
+		t.Error("Server should be removed")
+	}
+	if got := resp.Header.Get("Location"); got != "http://feature-auth.localhost:3000/next" {
+		t.Errorf("Location = %q", got)
+	}
+	if got := resp.Header.Get("Set-Cookie"); got != "sid=1; Domain=feature-auth.localhost; Path=/" {
+		t.Errorf("Set-Cookie = %q", got)
+	}
+}
+
+func TestProxyCORS(t *testing.T) {
+	var hits int
+	front, _ := setupRewriteTest(t, config.ProxyOptions{CORS: true}, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	})
+
+	preflight, _ := http.NewRequest("OPTIONS", front+"/api", nil)
+	preflight.Host = "feature-auth.localhost:3000"
+	preflight.Header.Set("Origin", "http://feature-auth.localhost:8000")
+	preflight.Header.Set("Access-Control-Request-Method", "PUT")
+	preflight.Header.Set("Access-Control-Request-Headers", "content-type")
+	resp, err := http.DefaultClient.Do(preflight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || hits != 0 {
+		t.Errorf("preflight status = %d, backend hits = %d, want 204 and 0", resp.StatusCode, hits)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") != "http://feature-auth.localhost:8000" ||
+		resp.Header.Get("Access-Control-Allow-Methods") != "PUT" ||
+		resp.Header.Get("Access-Control-Allow-Headers") != "content-type" {
+		t.Errorf("preflight headers = %v", resp.Header)
+	}
+
+	get := func(origin string) *http.Response {
+		req, _ := http.NewRequest("GET", front+"/api", nil)
+		req.Host = "feature-auth.localhost:3000"
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+	if resp := get("http://feature-auth.localhost:8000"); resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("sibling origin: headers = %v", resp.Header)
+	}
+	if resp := get("http://main.localhost:8000"); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Error("origins of other worktrees should not be allowed")
+	}
+}
+
+func TestSetClientSubject(t *testing.T) {
+	client := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", Organization: []string{"Portree"}}}
+
+	out := httptest.NewRequest("GET", "/", nil)
+	out.Header.Set("X-Client-Cert-Subject", "CN=forged")
+	setClientSubject(out, "X-Client-Cert-Subject", &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{client}},
+	})
+	if got := out.Header.Get("X-Client-Cert-Subject"); got != "CN=alice,O=Portree" {
+		t.Errorf("subject header = %q", got)
+	}
+
+	// Without a verified certificate a forged header is dropped.
+	for _, cs := range []*tls.ConnectionState{nil, {}} {
+		out := httptest.NewRequest("GET", "/", nil)
+		out.Header.Set("X-Client-Cert-Subject", "CN=forged")
+		setClientSubject(out, "X-Client-Cert-Subject", cs)
+		if got := out.Header.Get("X-Client-Cert-Subject"); got != "" {
+			t.Errorf("subject header = %q, want none", got)
+		}
+	}
+}
@@ -8,14 +8,15 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/fairy-pitta/portree/internal/logging"
+	"github.com/fairy-pitta/portree/internal/tracing"
 )
 
 const shutdownTimeout = 5 * time.Second
@@ -26,13 +27,31 @@ type ProxyServer struct {
 	tlsConfig *tls.Config // nil = plain HTTP
 	servers   []*http.Server
 	listeners []net.Listener
+	ports     []int // proxy port served by servers[i]
 	mu        sync.Mutex
+
+	capture          *CaptureBuffer // nil = capture disabled
+	captureBodyLimit int
+	mirror           *Mirror // nil = mirroring disabled
+	metrics          *Metrics
+	accessLog        *AccessLog      // nil = access log disabled
+	tracer           *tracing.Tracer // nil = tracing disabled
+	chaos            *ChaosRules
+	shareAddr        string            // LAN address to listen on in addition to loopback
+	shareSecret      []byte            // nil = sharing disabled
+	transport        http.RoundTripper // to backends; nil = http.DefaultTransport
+	clientHeader     string            // header carrying the client cert subject; "" = none
 }
 
 // NewProxyServer creates a new ProxyServer.
 // Pass a non-nil tlsConfig to enable HTTPS.
 func NewProxyServer(resolver *Resolver, tlsConfig *tls.Config) *ProxyServer {
-	return &ProxyServer{resolver: resolver, tlsConfig: tlsConfig}
+	return &ProxyServer{
+		resolver:  resolver,
+		tlsConfig: tlsConfig,
+		metrics:   NewMetrics(),
+		chaos:     NewChaosRules(),
+	}
 }
 
 // Scheme returns "https" if TLS is configured, otherwise "http".
@@ -43,56 +62,236 @@ func (p *ProxyServer) Scheme() string {
 	return "http"
 }
 
+// EnableCapture turns on request capture into buf, recording up to bodyLimit
+// bytes of each request and response body. It must be called before Start.
+func (p *ProxyServer) EnableCapture(buf *CaptureBuffer, bodyLimit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bodyLimit <= 0 {
+		bodyLimit = DefaultCaptureBodyLimit
+	}
+	p.capture = buf
+	p.captureBodyLimit = bodyLimit
+}
+
+// EnableMirror turns on traffic mirroring. It must be called before Start.
+func (p *ProxyServer) EnableMirror(m *Mirror) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mirror = m
+	if p.transport != nil {
+		m.client.Transport = p.transport
+	}
+	m.clientHeader = p.clientHeader
+	m.tracer = p.tracer
+	m.scheme = p.Scheme()
+}
+
+// ForwardClientSubject sends the subject of the verified client certificate
+// to backends in header, replacing any value sent by the client. Requests
+// without a verified certificate have the header removed. It must be called
+// before Start.
+func (p *ProxyServer) ForwardClientSubject(header string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clientHeader = http.CanonicalHeaderKey(header)
+	if p.mirror != nil {
+		p.mirror.clientHeader = p.clientHeader
+	}
+}
+
+// EnableBackendTLS lets the proxy connect over HTTPS to services with
+// backend_tls, verifying their certificates against the CA at caPath. It
+// must be called before Start.
+func (p *ProxyServer) EnableBackendTLS(caPath string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transport = NewBackendTransport(caPath)
+	if p.mirror != nil {
+		p.mirror.client.Transport = p.transport
+	}
+}
+
+// EnableAccessLog writes one line per request to l. It must be called before Start.
+func (p *ProxyServer) EnableAccessLog(l *AccessLog) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accessLog = l
+}
+
+// EnableTracing starts a server span for every request and propagates the
+// trace context to backends. It must be called before Start.
+func (p *ProxyServer) EnableTracing(t *tracing.Tracer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tracer = t
+	if p.mirror != nil {
+		p.mirror.tracer = t
+	}
+}
+
+// Metrics returns the proxy's request metrics.
+func (p *ProxyServer) Metrics() *Metrics {
+	return p.metrics
+}
+
+// EnableSharing additionally listens on addr (an IP address) and requires a
+// share token derived from secret on requests that do not come from loopback.
+// It must be called before Start.
+func (p *ProxyServer) EnableSharing(addr string, secret []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shareAddr = addr
+	p.shareSecret = secret
+}
+
+// Chaos returns the fault injection rules, which may be edited at runtime.
+func (p *ProxyServer) Chaos() *ChaosRules {
+	return p.chaos
+}
+
+// CaptureBuffer returns the capture buffer, or nil if capture is disabled.
+func (p *ProxyServer) CaptureBuffer() *CaptureBuffer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.capture
+}
+
 // Start launches proxy listeners for the given proxy ports.
 func (p *ProxyServer) Start(proxyPorts map[string]int) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Collect unique proxy ports.
-	ports := map[int]bool{}
+	for _, port := range uniquePorts(proxyPorts) {
+		if err := p.listenPortLocked(port); err != nil {
+			// Clean up already started servers.
+			_ = p.stopLocked()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reconcile brings the set of listeners in line with proxyPorts after a
+// config reload: listeners for ports that are no longer used are shut down
+// gracefully and new ports start listening. Listeners for unchanged ports are
+// left alone, so their connections are not interrupted.
+func (p *ProxyServer) Reconcile(proxyPorts map[string]int) (added, removed []int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	want := map[int]bool{}
 	for _, port := range proxyPorts {
-		ports[port] = true
+		want[port] = true
+	}
+	have := map[int]bool{}
+	for _, port := range p.ports {
+		have[port] = true
 	}
 
-	for port := range ports {
-		srv := &http.Server{
-			Addr:              "127.0.0.1:" + strconv.Itoa(port),
-			Handler:           recoveryMiddleware(p.handler(port)),
-			ReadTimeout:       30 * time.Second,
-			ReadHeaderTimeout: 10 * time.Second,
-			IdleTimeout:       120 * time.Second,
-			// WriteTimeout is intentionally 0 (unlimited): dev backends often use
-			// SSE or chunked streaming (e.g. Vite/webpack HMR) which would be
-			// terminated by a fixed write deadline.
+	for _, port := range sortedPorts(have) {
+		if !want[port] {
+			if e := p.stopPortLocked(port); e != nil {
+				logging.Warn("proxy: shutting down listener on port %d: %v", port, e)
+			}
+			removed = append(removed, port)
+		}
+	}
+	for _, port := range sortedPorts(want) {
+		if have[port] {
+			continue
 		}
+		if e := p.listenPortLocked(port); e != nil {
+			_ = p.stopPortLocked(port)
+			err = errors.Join(err, e)
+			continue
+		}
+		added = append(added, port)
+	}
+	return added, removed, err
+}
 
-		ln, err := net.Listen("tcp", srv.Addr)
-		if err != nil {
-			// Clean up already started servers.
-			_ = p.stopLocked()
-			return fmt.Errorf("proxy: cannot listen on %s: %w", srv.Addr, err)
+// listenPortLocked starts the servers for proxyPort on every listen host.
+// Must be called with p.mu held.
+func (p *ProxyServer) listenPortLocked(port int) error {
+	for _, host := range p.hostsLocked() {
+		if err := p.listenLocked(net.JoinHostPort(host, strconv.Itoa(port)), port); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if p.tlsConfig != nil {
-			ln = tls.NewListener(ln, p.tlsConfig)
+// hostsLocked returns the addresses each proxy port listens on: loopback,
+// plus the share address when LAN sharing is enabled.
+func (p *ProxyServer) hostsLocked() []string {
+	hosts := []string{"127.0.0.1"}
+	if p.shareAddr != "" {
+		if ip := net.ParseIP(p.shareAddr); ip != nil && ip.IsUnspecified() {
+			hosts = []string{p.shareAddr} // already covers loopback
+		} else if ip == nil || !ip.IsLoopback() {
+			hosts = append(hosts, p.shareAddr)
 		}
+	}
+	return hosts
+}
 
-		p.servers = append(p.servers, srv)
-		p.listeners = append(p.listeners, ln)
-		// Goroutine-level recovery catches panics from Serve() itself (e.g. listener errors).
-		// Per-request panics are caught by recoveryMiddleware wrapping the handler.
-		go func(s *http.Server, l net.Listener) {
-			defer func() {
-				if r := recover(); r != nil {
-					logging.Error("panic in proxy server goroutine: %v\n%s", r, debug.Stack())
-				}
-			}()
-			if err := s.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
-				logging.Error("proxy server error on %s: %v", s.Addr, err)
-			}
-		}(srv, ln)
+func uniquePorts(proxyPorts map[string]int) []int {
+	set := map[int]bool{}
+	for _, port := range proxyPorts {
+		set[port] = true
+	}
+	return sortedPorts(set)
+}
+
+func sortedPorts(set map[int]bool) []int {
+	ports := make([]int, 0, len(set))
+	for port := range set {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// listenLocked starts a proxy server for proxyPort on addr.
+// Must be called with p.mu held.
+func (p *ProxyServer) listenLocked(addr string, port int) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           recoveryMiddleware(p.middlewares(port, p.handler(port))),
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		// WriteTimeout is intentionally 0 (unlimited): dev backends often use
+		// SSE or chunked streaming (e.g. Vite/webpack HMR) which would be
+		// terminated by a fixed write deadline.
+	}
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("proxy: cannot listen on %s: %w", srv.Addr, err)
 	}
 
+	if p.tlsConfig != nil {
+		ln = tls.NewListener(ln, p.tlsConfig)
+	}
+
+	p.servers = append(p.servers, srv)
+	p.listeners = append(p.listeners, ln)
+	p.ports = append(p.ports, port)
+	// Goroutine-level recovery catches panics from Serve() itself (e.g. listener errors).
+	// Per-request panics are caught by recoveryMiddleware wrapping the handler.
+	go func(s *http.Server, l net.Listener) {
+		defer func() {
+			if r := recover(); r != nil {
+				logging.Error("panic in proxy server goroutine: %v\n%s", r, debug.Stack())
+			}
+		}()
+		if err := s.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error("proxy server error on %s: %v", s.Addr, err)
+		}
+	}(srv, ln)
 	return nil
 }
 
@@ -118,6 +317,29 @@ func (p *ProxyServer) stopLocked() error {
 	}
 	p.servers = nil
 	p.listeners = nil
+	p.ports = nil
+	return lastErr
+}
+
+// stopPortLocked gracefully shuts down the servers for proxyPort and forgets
+// them. Must be called with p.mu held.
+func (p *ProxyServer) stopPortLocked(port int) error {
+	var lastErr error
+	n := 0
+	for i, srv := range p.servers {
+		if p.ports[i] != port {
+			p.servers[n], p.listeners[n], p.ports[n] = srv, p.listeners[i], p.ports[i]
+			n++
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := srv.Shutdown(ctx); err != nil {
+			lastErr = err
+		}
+		cancel()
+		_ = p.listeners[i].Close()
+	}
+	p.servers, p.listeners, p.ports = p.servers[:n], p.listeners[:n], p.ports[:n]
 	return lastErr
 }
 
@@ -126,6 +348,10 @@ func recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					// Deliberate abort: let net/http close the connection quietly.
+					panic(rec)
+				}
 				logging.Error("panic in HTTP handler: %v\n%s", rec, debug.Stack())
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
@@ -134,9 +360,33 @@ func recoveryMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// middlewares wraps h with metrics and access logging plus the optional,
+// opt-in middlewares. Must be called with p.mu held.
+func (p *ProxyServer) middlewares(proxyPort int, h http.Handler) http.Handler {
+	if p.mirror != nil {
+		h = p.mirror.middleware(proxyPort, h)
+	}
+	if p.capture != nil {
+		h = captureMiddleware(p.capture, p.captureBodyLimit, p.Scheme(), h)
+	}
+	if p.shareSecret != nil {
+		h = shareAuthMiddleware(p.shareSecret, h)
+	}
+	return observeMiddleware(p.metrics, p.accessLog, h)
+}
+
 // handler returns an http.Handler for a specific proxy port.
 func (p *ProxyServer) handler(proxyPort int) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var span *tracing.Span
+		var upstreamErr error
+		if p.tracer != nil {
+			rec := newResponseRecorder(w)
+			w = rec
+			span = startServerSpan(p.tracer, r, p.Scheme())
+			defer func() { endServerSpan(span, rec.Status(), upstreamErr) }()
+		}
+
 		slug := ParseSlugFromHost(r.Host)
 		if slug == "" {
 			http.Error(w, "portree: missing subdomain in Host header.\n"+
@@ -144,7 +394,17 @@ func (p *ProxyServer) handler(proxyPort int) http.Handler {
 			return
 		}
 
-		backendPort, err := p.resolver.Resolve(slug, proxyPort)
+		route, err := p.resolver.ResolveRoute(slug, proxyPort)
+		service := p.resolver.ServiceForProxyPort(proxyPort)
+		if info := requestInfoFrom(r.Context()); info != nil {
+			info.Slug = slug
+			info.Service = service
+			info.Branch = route.Branch
+			info.BackendPort = route.Port
+		}
+		if span != nil {
+			setSpanRoute(span, slug, service, route)
+		}
 		if err != nil {
 			msg := fmt.Sprintf("portree: no worktree found for slug %q", slug)
 			if slugs, err := p.resolver.AvailableSlugs(); err == nil && len(slugs) > 0 {
@@ -154,16 +414,54 @@ func (p *ProxyServer) handler(proxyPort int) http.Handler {
 			return
 		}
 
-		target, err := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", backendPort))
-		if err != nil {
-			http.Error(w, "portree: invalid backend URL", http.StatusInternalServerError)
-			return
+		if rule, ok := p.chaos.Match(slug, service, r.URL.Path); ok {
+			var forward bool
+			if w, forward = applyChaos(w, r, rule); !forward {
+				return
+			}
+		}
+
+		cfg := p.resolver.Config()
+		opts := cfg.Services[service].Proxy
+		tmpl := headerTemplate(route, slug, r.Host)
+		var origin string // allowed CORS origin, "" = none
+		if opts.CORS {
+			if origin = corsOrigin(r, slug, cfg); origin != "" && isPreflight(r) {
+				answerPreflight(w, r, origin)
+				return
+			}
 		}
+
+		target := backendURL(cfg, route)
 		proxy := &httputil.ReverseProxy{
+			Transport: p.transport,
 			Rewrite: func(pr *httputil.ProxyRequest) {
 				pr.SetURL(target)
 				pr.Out.Host = r.Host
 				pr.Out.Header.Set("X-Forwarded-Host", r.Host)
+				if span != nil {
+					// The backend's spans become children of the proxy span.
+					pr.Out.Header.Set("traceparent", span.Context().Traceparent())
+				}
+				if p.clientHeader != "" {
+					setClientSubject(pr.Out, p.clientHeader, r.TLS)
+				}
+				rewriteRequest(pr, opts, tmpl, p.Scheme())
+			},
+			ModifyResponse: func(resp *http.Response) error {
+				rewriteResponse(resp, opts, tmpl, route, r.Host, p.Scheme())
+				if origin != "" {
+					setCORSHeaders(resp.Header, origin)
+				}
+				return nil
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				upstreamErr = err
+				if info := requestInfoFrom(r.Context()); info != nil {
+					info.UpstreamErr = err
+				}
+				logging.Verbose("proxy: %s/%s (port %d): %v", route.Branch, route.Service, route.Port, err)
+				w.WriteHeader(http.StatusBadGateway)
 			},
 		}
 		proxy.ServeHTTP(w, r)
@@ -1,7 +1,10 @@
 package proxy
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -141,6 +144,66 @@ func TestProxyServerStartDuplicatePort(t *testing.T) {
 	}
 }
 
+func TestProxyServerReconcile(t *testing.T) {
+	proxy, _ := setupProxyTest(t)
+
+	if err := proxy.Start(map[string]int{"web": 19302}); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer func() { _ = proxy.Stop() }()
+
+	added, removed, err := proxy.Reconcile(map[string]int{"web": 19302, "api": 19303})
+	if err != nil {
+		t.Fatalf("Reconcile() error: %v", err)
+	}
+	if fmt.Sprint(added) != "[19303]" || len(removed) != 0 {
+		t.Errorf("Reconcile() = %v, %v, want [19303], []", added, removed)
+	}
+	// Keep a connection open on the port that stays configured.
+	conn, err := net.Dial("tcp", "127.0.0.1:19303")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	br := bufio.NewReader(conn)
+	get := func() error {
+		if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: unknown.localhost:19303\r\n\r\n"); err != nil {
+			return err
+		}
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.Body.Close()
+	}
+	if err := get(); err != nil {
+		t.Fatalf("request on new port: %v", err)
+	}
+
+	added, removed, err = proxy.Reconcile(map[string]int{"api": 19303})
+	if err != nil {
+		t.Fatalf("Reconcile() error: %v", err)
+	}
+	if len(added) != 0 || fmt.Sprint(removed) != "[19302]" {
+		t.Errorf("Reconcile() = %v, %v, want [], [19302]", added, removed)
+	}
+	if err := get(); err != nil {
+		t.Errorf("connection on unchanged port was interrupted: %v", err)
+	}
+	if c, err := net.Dial("tcp", "127.0.0.1:19302"); err == nil {
+		_ = c.Close()
+		t.Error("removed port should no longer accept connections")
+	}
+
+	proxy.mu.Lock()
+	nServers := len(proxy.servers)
+	proxy.mu.Unlock()
+	if nServers != 1 {
+		t.Errorf("servers count = %d, want 1", nServers)
+	}
+}
+
 func TestRecoveryMiddleware(t *testing.T) {
 	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		panic("test panic")
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ShareTokenParam is the query parameter carrying a share token.
+	ShareTokenParam = "pt_token"
+	// shareCookie stores the token after the first authenticated request so
+	// that follow-up requests (assets, XHR) need not repeat it.
+	shareCookie = "portree_share"
+)
+
+// LoadOrCreateShareSecret reads the share secret at path, generating and
+// storing a new random one if the file does not exist.
+func LoadOrCreateShareSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(secret) < 16 {
+			return nil, fmt.Errorf("invalid share secret in %s; delete it to generate a new one", path)
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading share secret: %w", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generating share secret: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating state directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(secret)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("writing share secret: %w", err)
+	}
+	return secret, nil
+}
+
+// ShareToken derives the access token for slug. Tokens are stable for a given
+// secret, so 'portree share' can print them without asking the proxy;
+// deleting the secret file revokes all of them.
+func ShareToken(secret []byte, slug string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("portree-share:" + slug))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// ShareHost returns the nip.io host name that resolves to ip and routes to slug.
+func ShareHost(slug, ip string) string {
+	return slug + "." + ip + ".nip.io"
+}
+
+// ResolveBindAddress turns a --bind value (an IP address or an interface
+// name) into an IP address. An empty value picks the first private IPv4
+// address of an active interface.
+func ResolveBindAddress(bind string) (string, error) {
+	if bind != "" {
+		if ip := net.ParseIP(bind); ip != nil {
+			return ip.String(), nil
+		}
+		iface, err := net.InterfaceByName(bind)
+		if err != nil {
+			return "", fmt.Errorf("--bind %q is neither an IP address nor a network interface", bind)
+		}
+		if ip := interfaceIPv4(iface); ip != nil {
+			return ip.String(), nil
+		}
+		return "", fmt.Errorf("interface %s has no IPv4 address", bind)
+	}
+
+	return lanIPv4()
+}
+
+// ShareAddress returns the address to put in share links for the proxy
+// listening on bindAddr. For an unspecified address such as 0.0.0.0, which
+// clients cannot connect to, it is the first private IPv4 address.
+func ShareAddress(bindAddr string) (string, error) {
+	if ip := net.ParseIP(bindAddr); ip != nil && ip.IsUnspecified() {
+		return lanIPv4()
+	}
+	return bindAddr, nil
+}
+
+// lanIPv4 returns the first private IPv4 address of an active interface.
+func lanIPv4() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("listing network interfaces: %w", err)
+	}
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if ip := interfaceIPv4(iface); ip != nil && ip.IsPrivate() {
+			return ip.String(), nil
+		}
+	}
+	return "", errors.New("no LAN address found; pass one with --bind")
+}
+
+func interfaceIPv4(iface *net.Interface) net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			if ip4 := ipnet.IP.To4(); ip4 != nil {
+				return ip4
+			}
+		}
+	}
+	return nil
+}
+
+// shareAuthMiddleware requires a valid share token on requests that do not
+// come from the loopback interface. The token is accepted as the pt_token
+// query parameter, the portree_share cookie, or a basic auth password, and
+// is removed from the request before it is forwarded.
+func shareAuthMiddleware(secret []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isLoopback(r.RemoteAddr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slug := ParseSlugFromHost(r.Host)
+		want := ShareToken(secret, slug)
+		valid := func(tok string) bool {
+			return slug != "" && subtle.ConstantTimeCompare([]byte(tok), []byte(want)) == 1
+		}
+
+		// Query parameter: remember the token in a cookie and, for
+		// navigations, redirect to the clean URL.
+		if q := r.URL.Query(); q.Has(ShareTokenParam) {
+			if !valid(q.Get(ShareTokenParam)) {
+				denyShare(w, slug)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     shareCookie,
+				Value:    want,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			q.Del(ShareTokenParam)
+			clean := *r.URL
+			clean.RawQuery = q.Encode()
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				http.Redirect(w, r, clean.RequestURI(), http.StatusFound)
+				return
+			}
+			r = r.Clone(r.Context())
+			r.URL = &clean
+			r.RequestURI = clean.RequestURI()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c, err := r.Cookie(shareCookie); err == nil && valid(c.Value) {
+			r = r.Clone(r.Context())
+			stripCookie(r, shareCookie)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, pass, ok := r.BasicAuth(); ok && valid(pass) {
+			r = r.Clone(r.Context())
+			r.Header.Del("Authorization")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		denyShare(w, slug)
+	})
+}
+
+func denyShare(w http.ResponseWriter, slug string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="portree %s"`, slug))
+	http.Error(w, "portree: a share token is required (see 'portree share')", http.StatusUnauthorized)
+}
+
+// stripCookie removes the named cookie from r's Cookie header.
+func stripCookie(r *http.Request, name string) {
+	var kept []string
+	for _, c := range r.Cookies() {
+		if c.Name != name {
+			kept = append(kept, c.String())
+		}
+	}
+	r.Header.Del("Cookie")
+	if len(kept) > 0 {
+		r.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
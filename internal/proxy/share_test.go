@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateShareSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "share.key")
+
+	first, err := LoadOrCreateShareSecret(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateShareSecret() error: %v", err)
+	}
+	second, err := LoadOrCreateShareSecret(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != string(second) {
+		t.Error("secret should be stable once created")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("secret file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	if err := os.WriteFile(path, []byte("not hex"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrCreateShareSecret(path); err == nil {
+		t.Error("corrupt secret should be rejected")
+	}
+}
+
+func TestShareToken(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	a := ShareToken(secret, "feature-x")
+	if a != ShareToken(secret, "feature-x") {
+		t.Error("token should be deterministic")
+	}
+	if a == ShareToken(secret, "main") {
+		t.Error("tokens should differ per slug")
+	}
+	if a == ShareToken([]byte("another secret, another token!!"), "feature-x") {
+		t.Error("tokens should differ per secret")
+	}
+}
+
+func TestShareAuthMiddleware(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	token := ShareToken(secret, "feature-x")
+	const host = "feature-x.192.168.1.5.nip.io:3000"
+
+	var forwarded *http.Request
+	handler := shareAuthMiddleware(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+	}))
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		forwarded = nil
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	newReq := func(method, target, remote string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		r.Host = host
+		r.RemoteAddr = remote
+		return r
+	}
+
+	t.Run("loopback needs no token", func(t *testing.T) {
+		serve(newReq("GET", "/", "127.0.0.1:50000"))
+		if forwarded == nil {
+			t.Error("loopback request was not forwarded")
+		}
+	})
+
+	t.Run("remote without token", func(t *testing.T) {
+		rec := serve(newReq("GET", "/", "192.168.1.20:50000"))
+		if rec.Code != http.StatusUnauthorized || forwarded != nil {
+			t.Errorf("status = %d, forwarded = %v, want 401 and not forwarded", rec.Code, forwarded != nil)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Error("missing WWW-Authenticate challenge")
+		}
+	})
+
+	t.Run("query token sets cookie and redirects", func(t *testing.T) {
+		rec := serve(newReq("GET", "/page?a=1&pt_token="+token, "192.168.1.20:50000"))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("status = %d, want 302", rec.Code)
+		}
+		if loc := rec.Header().Get("Location"); loc != "/page?a=1" {
+			t.Errorf("Location = %q, want /page?a=1", loc)
+		}
+		if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Secure {
+			t.Error("expected the share cookie to be set, not Secure over HTTP")
+		}
+	})
+
+	t.Run("cookie is Secure over HTTPS", func(t *testing.T) {
+		r := newReq("GET", "/?pt_token="+token, "192.168.1.20:50000")
+		r.TLS = &tls.ConnectionState{}
+		cookies := serve(r).Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].Secure {
+			t.Errorf("cookies = %+v, want a Secure share cookie", cookies)
+		}
+	})
+
+	t.Run("query token on POST is stripped and forwarded", func(t *testing.T) {
+		serve(newReq("POST", "/api?pt_token="+token, "192.168.1.20:50000"))
+		if forwarded == nil {
+			t.Fatal("request was not forwarded")
+		}
+		if forwarded.URL.Query().Has(ShareTokenParam) {
+			t.Error("token should be removed from the forwarded URL")
+		}
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		r := newReq("GET", "/", "192.168.1.20:50000")
+		r.AddCookie(&http.Cookie{Name: shareCookie, Value: token})
+		r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		serve(r)
+		if forwarded == nil {
+			t.Fatal("request was not forwarded")
+		}
+		if _, err := forwarded.Cookie(shareCookie); err == nil {
+			t.Error("share cookie should not reach the backend")
+		}
+		if c, err := forwarded.Cookie("session"); err != nil || c.Value != "abc" {
+			t.Error("other cookies should be kept")
+		}
+	})
+
+	t.Run("basic auth", func(t *testing.T) {
+		r := newReq("GET", "/", "192.168.1.20:50000")
+		r.SetBasicAuth("anyone", token)
+		serve(r)
+		if forwarded == nil {
+			t.Fatal("request was not forwarded")
+		}
+		if forwarded.Header.Get("Authorization") != "" {
+			t.Error("Authorization should not reach the backend")
+		}
+	})
+
+	t.Run("token for another slug", func(t *testing.T) {
+		rec := serve(newReq("GET", "/?pt_token="+ShareToken(secret, "main"), "192.168.1.20:50000"))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rec.Code)
+		}
+	})
+}
+
+func TestResolveBindAddress(t *testing.T) {
+	got, err := ResolveBindAddress("192.168.1.5")
+	if err != nil || got != "192.168.1.5" {
+		t.Errorf("ResolveBindAddress(ip) = %q, %v", got, err)
+	}
+	if _, err := ResolveBindAddress("no-such-interface0"); err == nil {
+		t.Error("unknown interface should fail")
+	}
+}
+
+func TestShareAddress(t *testing.T) {
+	if got, err := ShareAddress("192.168.1.5"); err != nil || got != "192.168.1.5" {
+		t.Errorf("ShareAddress(ip) = %q, %v", got, err)
+	}
+	got, err := ShareAddress("0.0.0.0")
+	if err != nil {
+		t.Skipf("no LAN address on this machine: %v", err)
+	}
+	if ip := net.ParseIP(got); ip == nil || ip.IsUnspecified() || !ip.IsPrivate() {
+		t.Errorf("ShareAddress(0.0.0.0) = %q, want a private address", got)
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/fairy-pitta/portree/internal/tracing"
+)
+
+// startServerSpan starts the server span for r, continuing the caller's trace
+// if the request carries a valid traceparent header.
+func startServerSpan(t *tracing.Tracer, r *http.Request, scheme string) *tracing.Span {
+	parent, _ := tracing.ParseTraceparent(r.Header.Get("traceparent"))
+	return t.Start(parent, r.Method, tracing.SpanKindServer,
+		tracing.Attribute{Key: "http.request.method", Value: r.Method},
+		tracing.Attribute{Key: "url.scheme", Value: scheme},
+		tracing.Attribute{Key: "url.path", Value: r.URL.Path},
+		tracing.Attribute{Key: "server.address", Value: r.Host},
+		tracing.Attribute{Key: "user_agent.original", Value: r.UserAgent()},
+	)
+}
+
+// startMirrorSpan starts the client span for a shadow request, as a sibling
+// of the primary's server span.
+func startMirrorSpan(t *tracing.Tracer, r *http.Request, shadowHost, scheme string) *tracing.Span {
+	parent, _ := tracing.ParseTraceparent(r.Header.Get("traceparent"))
+	return t.Start(parent, r.Method+" (mirror)", tracing.SpanKindClient,
+		tracing.Attribute{Key: "http.request.method", Value: r.Method},
+		tracing.Attribute{Key: "url.scheme", Value: scheme},
+		tracing.Attribute{Key: "url.path", Value: r.URL.Path},
+		tracing.Attribute{Key: "server.address", Value: shadowHost},
+		tracing.Attribute{Key: "portree.mirror", Value: true},
+	)
+}
+
+// setSpanRoute records the resolved worktree route on span.
+func setSpanRoute(span *tracing.Span, slug, service string, route Route) {
+	span.SetAttributes(
+		tracing.Attribute{Key: "portree.slug", Value: slug},
+		tracing.Attribute{Key: "portree.service", Value: service},
+		tracing.Attribute{Key: "portree.branch", Value: route.Branch},
+		tracing.Attribute{Key: "portree.backend_port", Value: route.Port},
+	)
+}
+
+// endServerSpan records the outcome of the request and ends span.
+// As for any server span, only 5xx responses mark it as failed. A status of
+// 0 means no response was written, e.g. because the connection was dropped or
+// the client went away; the span then has no status code and is failed as
+// aborted.
+func endServerSpan(span *tracing.Span, status int, upstreamErr error) {
+	if status != 0 {
+		span.SetAttributes(tracing.Attribute{Key: "http.response.status_code", Value: status})
+	}
+	switch {
+	case upstreamErr != nil:
+		span.SetAttributes(tracing.Attribute{Key: "error.type", Value: "upstream_unreachable"})
+		span.SetStatus(tracing.StatusError, upstreamErr.Error())
+	case status == 0:
+		span.SetAttributes(tracing.Attribute{Key: "error.type", Value: "aborted"})
+		span.SetStatus(tracing.StatusError, "no response was written")
+	case status >= 500:
+		span.SetAttributes(tracing.Attribute{Key: "error.type", Value: strconv.Itoa(status)})
+		span.SetStatus(tracing.StatusError, "")
+	}
+	span.End()
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fairy-pitta/portree/internal/state"
+	"github.com/fairy-pitta/portree/internal/tracing"
+)
+
+func TestHandlerTracing(t *testing.T) {
+	// OTLP collector stand-in that keeps the raw export bodies.
+	var mu sync.Mutex
+	var exports []map[string]any
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		exports = append(exports, body)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	var gotTraceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer backend.Close()
+	var backendPort int
+	_, _ = fmt.Sscanf(backend.Listener.Addr().String(), "127.0.0.1:%d", &backendPort)
+
+	p, store := setupProxyTest(t)
+	st, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetPortAssignment(st, "feature/auth", "web", backendPort)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracing.NewExporter(tracing.TracesURL(collector.URL), "portree-proxy", "test")
+	p.EnableTracing(tracing.NewTracer(exporter))
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "http://feature-auth.localhost:3000/", nil)
+	req.Host = "feature-auth.localhost:3000"
+	req.Header.Set("traceparent", incoming)
+	rec := httptest.NewRecorder()
+	p.handler(3000).ServeHTTP(rec, req)
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want 418", rec.Code)
+	}
+
+	sc, ok := tracing.ParseTraceparent(gotTraceparent)
+	if !ok {
+		t.Fatalf("backend got traceparent %q, want a valid one", gotTraceparent)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("backend trace ID = %s, want the incoming trace", sc.TraceID)
+	}
+	if gotTraceparent == incoming {
+		t.Error("backend should see the proxy span as parent, not the caller's span")
+	}
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(exports) != 1 {
+		t.Fatalf("collector got %d exports, want 1", len(exports))
+	}
+	data, _ := json.Marshal(exports[0])
+	for _, want := range []string{
+		`"spanId":"` + sc.SpanID.String() + `"`,
+		`"parentSpanId":"00f067aa0ba902b7"`,
+		`"key":"portree.slug","value":{"stringValue":"feature-auth"}`,
+		`"key":"portree.service","value":{"stringValue":"web"}`,
+		fmt.Sprintf(`"key":"portree.backend_port","value":{"intValue":"%d"}`, backendPort),
+		`"key":"http.response.status_code","value":{"intValue":"418"}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("exported span missing %s\n%s", want, data)
+		}
+	}
+}
+
+func TestHandlerTracingDropped(t *testing.T) {
+	var mu sync.Mutex
+	var exports []json.RawMessage
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		exports = append(exports, body)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	p, _ := setupProxyTest(t)
+	exporter := tracing.NewExporter(tracing.TracesURL(collector.URL), "portree-proxy", "test")
+	p.EnableTracing(tracing.NewTracer(exporter))
+	if _, err := p.Chaos().Add(ChaosRule{DropRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "http://feature-auth.localhost:3000/", nil)
+	req.Host = "feature-auth.localhost:3000"
+	func() {
+		defer func() { _ = recover() }()
+		p.handler(3000).ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(exports) != 1 {
+		t.Fatalf("collector got %d exports, want 1", len(exports))
+	}
+	data := string(exports[0])
+	if strings.Contains(data, "http.response.status_code") {
+		t.Errorf("dropped request should have no status code\n%s", data)
+	}
+	for _, want := range []string{
+		`"key":"error.type","value":{"stringValue":"aborted"}`,
+		`"status":{"code":2`,
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("exported span missing %s\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/logging"
+)
+
+// Lease records that a port is assigned to a service of a repository. The
+// user-level leases let repositories with overlapping port ranges avoid
+// each other's ports.
+type Lease struct {
+	Repo    string `json:"repo"` // main worktree root
+	Branch  string `json:"branch"`
+	Service string `json:"service"` // see ExtraPortService for extra ports
+	Since   string `json:"since"`
+}
+
+// Leases maps ports to the leases that hold them.
+type Leases struct {
+	Ports map[int]Lease `json:"ports"`
+
+	states map[string]*State // repo -> its state, read once; nil = unreadable
+}
+
+// LeaseStore keeps the leases of all repositories of the user in a JSON
+// file, ports.db, locked like a FileStore.
+type LeaseStore struct {
+	filePath string
+	lockPath string
+}
+
+// GlobalStateDir returns the user-level state directory shared by all
+// repositories: $XDG_STATE_HOME/portree, or ~/.local/state/portree when
+// XDG_STATE_HOME is not set.
+func GlobalStateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "portree"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("locating home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "portree"), nil
+}
+
+// NewLeaseStore creates a LeaseStore in dir, typically GlobalStateDir.
+func NewLeaseStore(dir string) (*LeaseStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating state directory: %w", err)
+	}
+	return &LeaseStore{
+		filePath: filepath.Join(dir, "ports.db"),
+		lockPath: filepath.Join(dir, "ports.lock"),
+	}, nil
+}
+
+// Path returns the path of the leases file.
+func (s *LeaseStore) Path() string {
+	return s.filePath
+}
+
+// Load reads the leases from disk. Returns no leases if the file doesn't
+// exist.
+func (s *LeaseStore) Load() (*Leases, error) {
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Leases{Ports: map[int]Lease{}}, nil
+		}
+		return nil, fmt.Errorf("reading leases: %w", err)
+	}
+	var l Leases
+	if err := json.Unmarshal(data, &l); err != nil {
+		logging.Warn("corrupt leases file, starting fresh: %v", err)
+		return &Leases{Ports: map[int]Lease{}}, nil
+	}
+	if l.Ports == nil {
+		l.Ports = map[int]Lease{}
+	}
+	return &l, nil
+}
+
+// Save writes the leases to disk.
+func (s *LeaseStore) Save(l *Leases) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling leases: %w", err)
+	}
+	return os.WriteFile(s.filePath, data, 0600)
+}
+
+// WithLock executes fn while holding an exclusive lock on the leases.
+// Callers that also lock a repository's FileStore must lock it first.
+func (s *LeaseStore) WithLock(fn func() error) error {
+	return WithFileLock(s.lockPath, fn)
+}
+
+// NewLease returns a lease of port to service in branch of repo, starting
+// now.
+func NewLease(repo, branch, service string) Lease {
+	return Lease{Repo: repo, Branch: branch, Service: service, Since: time.Now().Format(time.RFC3339)}
+}
+
+// Same reports whether l and other are held by the same service.
+func (l Lease) Same(other Lease) bool {
+	return l.Repo == other.Repo && l.Branch == other.Branch && l.Service == other.Service
+}
+
+// Live reports whether the lease on port is held by a repository that
+// still assigns port to the lease's branch and service. Leases of deleted
+// repositories, pruned branches and released ports are not live. The state
+// of each repository is read once per l, so that checking many leases
+// stays cheap; Load a fresh Leases to see later changes.
+func (l *Leases) Live(port int) bool {
+	lease, ok := l.Ports[port]
+	if !ok {
+		return false
+	}
+	st := l.repoState(lease.Repo)
+	return st != nil && GetPortAssignment(st, lease.Branch, lease.Service) == port
+}
+
+func (l *Leases) repoState(repo string) *State {
+	if st, ok := l.states[repo]; ok {
+		return st
+	}
+	if l.states == nil {
+		l.states = map[string]*State{}
+	}
+	var st *State
+	if data, err := os.ReadFile(filepath.Join(repo, ".portree", "state.json")); err == nil {
+		var s State
+		if json.Unmarshal(data, &s) == nil {
+			st = &s
+		}
+	}
+	l.states[repo] = st
+	return st
+}
+
+// Taken returns the ports leased by other repositories than repo, whose
+// leases are live.
+func (l *Leases) Taken(repo string) map[int]bool {
+	taken := map[int]bool{}
+	for p, lease := range l.Ports {
+		if lease.Repo != repo && l.Live(p) {
+			taken[p] = true
+		}
+	}
+	return taken
+}
+
+// HeldElsewhere returns the lease on port if it is a live lease of another
+// repository than repo.
+func (l *Leases) HeldElsewhere(port int, repo string) (Lease, bool) {
+	cur, ok := l.Ports[port]
+	return cur, ok && cur.Repo != repo && l.Live(port)
+}
+
+// Acquire leases port to lease unless a live lease of another repository
+// holds it. It reports whether the leases changed.
+func (l *Leases) Acquire(port int, lease Lease) bool {
+	if cur, ok := l.Ports[port]; ok {
+		if cur.Same(lease) {
+			return false
+		}
+		if _, held := l.HeldElsewhere(port, lease.Repo); held {
+			return false
+		}
+	}
+	l.Ports[port] = lease
+	return true
+}
+
+// Release removes the leases that match, and reports whether any did.
+func (l *Leases) Release(match func(port int, lease Lease) bool) bool {
+	changed := false
+	for p, lease := range l.Ports {
+		if match(p, lease) {
+			delete(l.Ports, p)
+			changed = true
+		}
+	}
+	return changed
+}
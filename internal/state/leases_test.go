@@ -0,0 +1,133 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newLeaseRepo creates a repository state dir whose state assigns port to
+// branch and service, and returns the repository root.
+func newLeaseRepo(t *testing.T, branch, service string, port int) string {
+	t.Helper()
+	repo := t.TempDir()
+	store, err := NewFileStore(filepath.Join(repo, ".portree"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := emptyState()
+	SetPortAssignment(st, branch, service, port)
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestGlobalStateDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/xdg")
+	if got, _ := GlobalStateDir(); got != "/xdg/portree" {
+		t.Errorf("GlobalStateDir() = %q", got)
+	}
+
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("HOME", "/home/me")
+	if got, _ := GlobalStateDir(); got != "/home/me/.local/state/portree" {
+		t.Errorf("GlobalStateDir() without XDG_STATE_HOME = %q", got)
+	}
+}
+
+func TestLeaseStoreRoundTrip(t *testing.T) {
+	store, err := NewLeaseStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	leases, err := store.Load()
+	if err != nil || len(leases.Ports) != 0 {
+		t.Fatalf("Load() of a missing file = %v, %v", leases, err)
+	}
+
+	leases.Ports[3117] = NewLease("/repo", "main", "web")
+	if err := store.WithLock(func() error { return store.Save(leases) }); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := got.Ports[3117]; !l.Same(Lease{Repo: "/repo", Branch: "main", Service: "web"}) || l.Since == "" {
+		t.Errorf("Load() = %+v", got.Ports)
+	}
+
+	if err := os.WriteFile(store.Path(), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Load(); err != nil || len(got.Ports) != 0 {
+		t.Errorf("Load() of a corrupt file = %v, %v, want no leases", got, err)
+	}
+}
+
+func TestLeases(t *testing.T) {
+	a := newLeaseRepo(t, "main", "web", 3117)
+	b := newLeaseRepo(t, "main", "web", 3120)
+	gone := filepath.Join(t.TempDir(), "gone")
+
+	leases := &Leases{Ports: map[int]Lease{
+		3117: NewLease(a, "main", "web"),
+		3118: NewLease(a, "feature/x", "web"), // no longer assigned
+		3119: NewLease(gone, "main", "web"),
+	}}
+
+	if !leases.Live(3117) || leases.Live(3118) || leases.Live(3119) || leases.Live(3120) {
+		t.Error("Live() should hold only for ports the repository still assigns")
+	}
+	if held, ok := leases.HeldElsewhere(3117, b); !ok || held.Repo != a {
+		t.Errorf("HeldElsewhere(3117, b) = %+v, %v, want the lease of a", held, ok)
+	}
+	if _, ok := leases.HeldElsewhere(3117, a); ok {
+		t.Error("HeldElsewhere() reported a lease of the same repository")
+	}
+
+	if taken := leases.Taken(b); len(taken) != 1 || !taken[3117] {
+		t.Errorf("Taken(b) = %v, want [3117]", taken)
+	}
+	if taken := leases.Taken(a); len(taken) != 0 {
+		t.Errorf("Taken(a) = %v, want none of its own", taken)
+	}
+
+	if leases.Acquire(3117, NewLease(b, "main", "web")) {
+		t.Error("Acquire() took a live lease of another repository")
+	}
+	if leases.Acquire(3117, NewLease(a, "main", "web")) {
+		t.Error("Acquire() of a port already leased to the same service reported a change")
+	}
+	if !leases.Acquire(3119, NewLease(b, "main", "web")) || leases.Ports[3119].Repo != b {
+		t.Error("Acquire() should replace a stale lease")
+	}
+
+	if !leases.Release(func(p int, _ Lease) bool { return !leases.Live(p) }) {
+		t.Error("Release() reported no change")
+	}
+	if _, ok := leases.Ports[3117]; !ok || len(leases.Ports) != 1 {
+		t.Errorf("leases after Release = %v, want only the live 3117", leases.Ports)
+	}
+}
+
+func TestLeasesReadStatesOnce(t *testing.T) {
+	a := newLeaseRepo(t, "main", "web", 3117)
+	leases := &Leases{Ports: map[int]Lease{3117: NewLease(a, "main", "web")}}
+	if !leases.Live(3117) {
+		t.Fatal("Live() = false, want true")
+	}
+
+	// The state read first is kept for the life of leases.
+	if err := os.Remove(filepath.Join(a, ".portree", "state.json")); err != nil {
+		t.Fatal(err)
+	}
+	if !leases.Live(3117) {
+		t.Error("Live() read the state of the repository again")
+	}
+	fresh := &Leases{Ports: leases.Ports}
+	if fresh.Live(3117) {
+		t.Error("Live() of new leases = true for a repository without state")
+	}
+}
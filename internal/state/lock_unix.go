@@ -12,7 +12,13 @@ import (
 
 // WithLock executes fn while holding an exclusive file lock.
 func (s *FileStore) WithLock(fn func() error) error {
-	f, err := os.OpenFile(s.lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	return WithFileLock(s.lockPath, fn)
+}
+
+// WithFileLock executes fn while holding an exclusive lock on the file at
+// lockPath, which is created if needed.
+func WithFileLock(lockPath string, fn func() error) error {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		return fmt.Errorf("opening lock file: %w", err)
 	}
@@ -16,6 +16,9 @@ const (
 	StatusRunning = "running"
 	// StatusStopped indicates a stopped service or proxy.
 	StatusStopped = "stopped"
+	// StatusDisabled is shown for services that are disabled for a
+	// worktree. It is never stored.
+	StatusDisabled = "disabled"
 )
 
 const lockTimeout = 10 * time.Second
@@ -33,6 +36,15 @@ type ProxyState struct {
 	PID    int    `json:"pid"`
 	Status string `json:"status"`
 	HTTPS  bool   `json:"https,omitempty"`
+	// AdminPort is the loopback port of the proxy's admin API.
+	AdminPort int `json:"admin_port,omitempty"`
+	// AdminToken is the bearer token the admin API requires.
+	AdminToken string `json:"admin_token,omitempty"`
+	// Capture reports whether request capture is enabled.
+	Capture bool `json:"capture,omitempty"`
+	// ShareAddr is the LAN address the proxy also listens on when started
+	// with --share, or "" if sharing is off.
+	ShareAddr string `json:"share_addr,omitempty"`
 }
 
 // State represents the full persisted state.
@@ -122,6 +134,12 @@ func PortKey(branch, service string) string {
 	return branch + ":" + service
 }
 
+// ExtraPortService is the name the extra port name of service is assigned
+// under, as if it were a service of its own: "<service>#<name>".
+func ExtraPortService(service, name string) string {
+	return service + "#" + name
+}
+
 // ParsePortKey splits a port key back into branch and service.
 // Returns the original key as branch with an empty service if no separator is found.
 func ParsePortKey(key string) (branch, service string) {
@@ -0,0 +1,289 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fairy-pitta/portree/internal/logging"
+)
+
+const (
+	// maxBatchSize is the number of spans sent per OTLP request.
+	maxBatchSize = 128
+	// maxQueueSize bounds the number of spans waiting for export; further
+	// spans are dropped until the queue drains.
+	maxQueueSize = 2048
+	// flushInterval is how often pending spans are exported.
+	flushInterval = 2 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// TracesURL turns an OTLP/HTTP endpoint such as http://localhost:4318 into
+// the traces URL (http://localhost:4318/v1/traces). URLs that already end in
+// /v1/traces are returned unchanged.
+func TracesURL(endpoint string) string {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return endpoint + "/v1/traces"
+}
+
+// EndpointFromEnv returns the OTLP traces URL configured through the standard
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT
+// environment variables, or "" if neither is set.
+func EndpointFromEnv() string {
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); v != "" {
+		return v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		return TracesURL(v)
+	}
+	return ""
+}
+
+// Exporter batches finished spans and sends them to an OTLP/HTTP collector
+// using the JSON encoding.
+type Exporter struct {
+	url         string
+	serviceName string
+	version     string
+	client      *http.Client
+
+	mu      sync.Mutex
+	pending []*Span
+	dropped int
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewExporter creates an Exporter posting to url (see TracesURL) and starts
+// its background flush loop. serviceName and version describe the resource.
+func NewExporter(url, serviceName, version string) *Exporter {
+	e := &Exporter{
+		url:         url,
+		serviceName: serviceName,
+		version:     version,
+		client:      &http.Client{Timeout: exportTimeout},
+		flush:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// Export queues s for sending.
+func (e *Exporter) Export(s *Span) {
+	e.mu.Lock()
+	if len(e.pending) >= maxQueueSize {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.pending = append(e.pending, s)
+	full := len(e.pending) >= maxBatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown stops the flush loop and sends any pending spans.
+// It must be called at most once.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	close(e.stop)
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return e.exportPending(ctx)
+}
+
+func (e *Exporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		case <-e.flush:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		if err := e.exportPending(ctx); err != nil {
+			logging.Verbose("tracing: %v", err)
+		}
+		cancel()
+	}
+}
+
+// exportPending sends all queued spans in batches of maxBatchSize.
+func (e *Exporter) exportPending(ctx context.Context) error {
+	e.mu.Lock()
+	spans := e.pending
+	e.pending = nil
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+
+	if dropped > 0 {
+		logging.Warn("tracing: export queue full, dropped %d spans", dropped)
+	}
+	for len(spans) > 0 {
+		n := min(len(spans), maxBatchSize)
+		if err := e.send(ctx, spans[:n]); err != nil {
+			return err
+		}
+		spans = spans[n:]
+	}
+	return nil
+}
+
+func (e *Exporter) send(ctx context.Context, spans []*Span) error {
+	data, err := json.Marshal(e.buildRequest(spans))
+	if err != nil {
+		return fmt.Errorf("encoding spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("building export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("exporting %d spans: %w", len(spans), err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("exporting %d spans: collector returned %s", len(spans), resp.Status)
+	}
+	return nil
+}
+
+// OTLP/JSON request types. See
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding — trace
+// and span IDs are hex strings and 64-bit integers are decimal strings.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              SpanKind       `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    StatusCode `json:"code,omitempty"`
+		Message string     `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+func (e *Exporter) buildRequest(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.ctx.TraceID.String(),
+			SpanID:            s.ctx.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        toKeyValues(s.attrs),
+			Status:            otlpStatus{Code: s.statusCode, Message: s.statusMessage},
+		}
+		if s.parent.IsValid() {
+			span.ParentSpanID = s.parent.String()
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: toKeyValues([]Attribute{
+			{Key: "service.name", Value: e.serviceName},
+			{Key: "service.version", Value: e.version},
+		})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/fairy-pitta/portree", Version: e.version},
+			Spans: out,
+		}},
+	}}}
+}
+
+func toKeyValues(attrs []Attribute) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpAnyValue
+		switch x := a.Value.(type) {
+		case string:
+			v.StringValue = &x
+		case int:
+			s := strconv.Itoa(x)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &x
+		case bool:
+			v.BoolValue = &x
+		default:
+			s := fmt.Sprint(x)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return kvs
+}
@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// collector is a stand-in for an OTLP/HTTP collector that keeps every
+// decoded export request.
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	paths    []string
+}
+
+func startCollector(t *testing.T) (*collector, string) {
+	t.Helper()
+	c := &collector{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, req)
+		c.paths = append(c.paths, r.URL.Path)
+		c.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return c, srv.URL
+}
+
+func (c *collector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []otlpSpan
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				out = append(out, ss.Spans...)
+			}
+		}
+	}
+	return out
+}
+
+func TestExporter(t *testing.T) {
+	c, url := startCollector(t)
+	exp := NewExporter(TracesURL(url), "portree-proxy", "test")
+	tr := NewTracer(exp)
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := tr.Start(parent, "GET", SpanKindServer, Attribute{Key: "portree.slug", Value: "main"})
+	span.SetAttributes(Attribute{Key: "portree.backend_port", Value: 3100})
+	span.SetStatus(StatusError, "boom")
+	span.End()
+
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+
+	spans := c.spans()
+	if len(spans) != 1 {
+		t.Fatalf("collector got %d spans, want 1", len(spans))
+	}
+	got := spans[0]
+	if got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("trace/parent = %s/%s", got.TraceID, got.ParentSpanID)
+	}
+	if got.Kind != SpanKindServer || got.Status.Code != StatusError || got.Status.Message != "boom" {
+		t.Errorf("kind/status = %d/%+v", got.Kind, got.Status)
+	}
+	attrs := map[string]otlpAnyValue{}
+	for _, kv := range got.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if v := attrs["portree.slug"].StringValue; v == nil || *v != "main" {
+		t.Errorf("portree.slug = %v", v)
+	}
+	if v := attrs["portree.backend_port"].IntValue; v == nil || *v != "3100" {
+		t.Errorf("portree.backend_port = %v", v)
+	}
+	if c.paths[0] != "/v1/traces" {
+		t.Errorf("export path = %s, want /v1/traces", c.paths[0])
+	}
+
+	var service string
+	for _, kv := range c.requests[0].ResourceSpans[0].Resource.Attributes {
+		if kv.Key == "service.name" && kv.Value.StringValue != nil {
+			service = *kv.Value.StringValue
+		}
+	}
+	if service != "portree-proxy" {
+		t.Errorf("service.name = %q", service)
+	}
+}
+
+func TestExporterSkipsUnsampledSpans(t *testing.T) {
+	c, url := startCollector(t)
+	exp := NewExporter(TracesURL(url), "portree-proxy", "test")
+	tr := NewTracer(exp)
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	tr.Start(parent, "GET", SpanKindServer).End()
+
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.spans()); n != 0 {
+		t.Errorf("collector got %d spans, want 0", n)
+	}
+}
+
+func TestTracesURL(t *testing.T) {
+	tests := map[string]string{
+		"http://localhost:4318":           "http://localhost:4318/v1/traces",
+		"http://localhost:4318/":          "http://localhost:4318/v1/traces",
+		"http://localhost:4318/v1/traces": "http://localhost:4318/v1/traces",
+		"https://otel.example.com/otlp":   "https://otel.example.com/otlp/v1/traces",
+	}
+	for in, want := range tests {
+		if got := TracesURL(in); got != want {
+			t.Errorf("TracesURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEndpointFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	if got := EndpointFromEnv(); got != "" {
+		t.Errorf("EndpointFromEnv() = %q, want empty", got)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	if got := EndpointFromEnv(); got != "http://collector:4318/v1/traces" {
+		t.Errorf("EndpointFromEnv() = %q", got)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://collector:4318/custom")
+	if got := EndpointFromEnv(); got != "http://collector:4318/custom" {
+		t.Errorf("EndpointFromEnv() = %q, traces endpoint should win as-is", got)
+	}
+}
@@ -0,0 +1,189 @@
+// Package tracing implements the small subset of OpenTelemetry tracing that
+// the proxy needs: W3C trace context propagation and span export over
+// OTLP/HTTP (JSON encoding).
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID and SpanID are the W3C trace context identifiers.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether t is non-zero.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether s is non-zero.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both identifiers are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent renders sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+// ok is false if the value is malformed or carries all-zero identifiers.
+func ParseTraceparent(s string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if !decodeHex(flags[:], parts[3]) {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&0x01 != 0
+	return sc, sc.IsValid()
+}
+
+// decodeHex decodes lowercase hex s into dst, which must match its length exactly.
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// SpanKind mirrors the OTLP span kinds used by portree.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// StatusCode mirrors the OTLP span status codes.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a span attribute. Value is a string, int, int64, float64 or bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span is a single unit of work. It is safe for concurrent use.
+type Span struct {
+	tracer *Tracer
+
+	mu            sync.Mutex
+	name          string
+	kind          SpanKind
+	ctx           SpanContext
+	parent        SpanID
+	start         time.Time
+	end           time.Time
+	attrs         []Attribute
+	statusCode    StatusCode
+	statusMessage string
+	ended         bool
+}
+
+// Context returns the span's identifiers, for propagation to child spans.
+func (s *Span) Context() SpanContext {
+	return s.ctx
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// SetStatus sets the span status.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusCode = code
+	s.statusMessage = msg
+}
+
+// End finishes the span and hands it to the exporter. Calls after the first are no-ops.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.ctx.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// Tracer creates spans and sends finished ones to an Exporter.
+type Tracer struct {
+	exporter *Exporter
+}
+
+// NewTracer creates a Tracer exporting to e.
+func NewTracer(e *Exporter) *Tracer {
+	return &Tracer{exporter: e}
+}
+
+// Start begins a span. If parent is valid, the span joins its trace (and
+// inherits its sampling decision); otherwise a new sampled trace is started.
+func (t *Tracer) Start(parent SpanContext, name string, kind SpanKind, attrs ...Attribute) *Span {
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+		attrs:  attrs,
+	}
+	if parent.IsValid() {
+		s.ctx.TraceID = parent.TraceID
+		s.ctx.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(s.ctx.TraceID[:])
+		s.ctx.Sampled = true
+	}
+	_, _ = rand.Read(s.ctx.SpanID[:])
+	return s
+}
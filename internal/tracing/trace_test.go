@@ -0,0 +1,74 @@
+package tracing
+
+import "testing"
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version with extra field", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xyz", true, true},
+		{"version 00 with extra field", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xyz", false, false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"short trace id", "00-4bf92f35-00f067aa0ba902b7-01", false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.in)
+			if ok != tt.ok {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+			}
+			if ok && sc.Sampled != tt.sampled {
+				t.Errorf("Sampled = %v, want %v", sc.Sampled, tt.sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	const in = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(in)
+	if !ok {
+		t.Fatal("ParseTraceparent failed")
+	}
+	if got := sc.Traceparent(); got != in {
+		t.Errorf("Traceparent() = %q, want %q", got, in)
+	}
+}
+
+func TestTracerStart(t *testing.T) {
+	tr := NewTracer(nil)
+
+	root := tr.Start(SpanContext{}, "root", SpanKindServer)
+	if !root.Context().IsValid() || !root.Context().Sampled {
+		t.Fatalf("root span context = %+v, want a new sampled trace", root.Context())
+	}
+	if root.parent.IsValid() {
+		t.Error("root span should have no parent")
+	}
+
+	child := tr.Start(root.Context(), "child", SpanKindServer)
+	if child.Context().TraceID != root.Context().TraceID {
+		t.Error("child should join the parent's trace")
+	}
+	if child.parent != root.Context().SpanID {
+		t.Error("child parent span ID should be the root span ID")
+	}
+	if child.Context().SpanID == root.Context().SpanID {
+		t.Error("child should get its own span ID")
+	}
+
+	unsampled := tr.Start(SpanContext{TraceID: root.ctx.TraceID, SpanID: root.ctx.SpanID}, "x", SpanKindServer)
+	if unsampled.Context().Sampled {
+		t.Error("span should inherit the parent's sampling decision")
+	}
+	unsampled.End() // must not panic without an exporter
+}
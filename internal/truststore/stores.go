@@ -0,0 +1,283 @@
+package truststore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fairy-pitta/portree/internal/cert"
+)
+
+// darwinStore is the macOS System keychain.
+type darwinStore struct{}
+
+func (darwinStore) Name() string { return "macOS System keychain" }
+
+func (darwinStore) Installed(ca CA, _ Runner) (bool, error) {
+	return cert.IsTrusted(ca.Path)
+}
+
+func (darwinStore) InstallCommands(ca CA) []Command {
+	return []Command{{Sudo: true, Name: "security", Args: []string{
+		"add-trusted-cert", "-d", "-r", "trustRoot", "-k", "/Library/Keychains/System.keychain", ca.Path,
+	}}}
+}
+
+func (darwinStore) UninstallCommands(ca CA) []Command {
+	return []Command{
+		{Sudo: true, Name: "security", Args: []string{"remove-trusted-cert", "-d", ca.Path}},
+		{Sudo: true, Name: "security", Args: []string{"delete-certificate", "-Z", ca.SHA1, "/Library/Keychains/System.keychain"}},
+	}
+}
+
+// linuxStore is the system CA directory of a Linux distribution, refreshed
+// with update-ca-certificates (Debian, Ubuntu, Alpine, Arch) or
+// update-ca-trust (Fedora, RHEL).
+type linuxStore struct {
+	dir    string // directory the CA file is copied into
+	update []string
+	legacy string // CA file installed by earlier versions of portree, or ""
+}
+
+func (s linuxStore) Name() string { return "system (" + s.dir + ")" }
+
+func (s linuxStore) path(ca CA) string { return filepath.Join(s.dir, ca.Nickname+".crt") }
+
+func (s linuxStore) Installed(ca CA, _ Runner) (bool, error) {
+	_, err := os.Stat(s.path(ca))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// HasLeftovers reports whether the CA file of earlier versions of portree,
+// which named it portree-dev-ca.crt, is still installed.
+func (s linuxStore) HasLeftovers() bool {
+	if s.legacy == "" {
+		return false
+	}
+	_, err := os.Stat(s.legacy)
+	return err == nil
+}
+
+func (s linuxStore) InstallCommands(ca CA) []Command {
+	cmds := []Command{{Sudo: true, Name: "mkdir", Args: []string{"-p", s.dir}}}
+	if s.HasLeftovers() {
+		cmds = append(cmds, Command{Sudo: true, Name: "rm", Args: []string{"-f", s.legacy}})
+	}
+	return append(cmds,
+		Command{Sudo: true, Name: "cp", Args: []string{ca.Path, s.path(ca)}},
+		Command{Sudo: true, Name: s.update[0], Args: s.update[1:]},
+	)
+}
+
+func (s linuxStore) UninstallCommands(ca CA) []Command {
+	cmds := []Command{{Sudo: true, Name: "rm", Args: []string{"-f", s.path(ca)}}}
+	if s.HasLeftovers() {
+		cmds = append(cmds, Command{Sudo: true, Name: "rm", Args: []string{"-f", s.legacy}})
+	}
+	return append(cmds, Command{Sudo: true, Name: s.update[0], Args: s.update[1:]})
+}
+
+// nssStore is an NSS certificate database, as used by Firefox profiles and
+// by Chromium on Linux (~/.pki/nssdb). Changes go through certutil.
+type nssStore struct {
+	label    string // e.g. "Firefox profile abc.default"
+	db       string // "sql:<dir>" or "dbm:<dir>"
+	certutil string
+}
+
+func (s nssStore) Name() string { return "NSS " + s.label }
+
+func (s nssStore) Installed(ca CA, r Runner) (bool, error) {
+	return r.Check(Command{Name: s.certutil, Args: []string{"-d", s.db, "-L", "-n", ca.Nickname}}), nil
+}
+
+func (s nssStore) InstallCommands(ca CA) []Command {
+	return []Command{{Name: s.certutil, Args: []string{"-d", s.db, "-A", "-t", "C,,", "-n", ca.Nickname, "-i", ca.Path}}}
+}
+
+func (s nssStore) UninstallCommands(ca CA) []Command {
+	return []Command{{Name: s.certutil, Args: []string{"-d", s.db, "-D", "-n", ca.Nickname}}}
+}
+
+// javaStore is a JVM cacerts keystore, changed with keytool.
+type javaStore struct {
+	cacerts string
+	keytool string
+	sudo    bool // cacerts is not writable by the current user
+}
+
+// javaStorePass is the well-known default password of cacerts files.
+const javaStorePass = "changeit"
+
+func (s javaStore) Name() string { return "Java (" + s.cacerts + ")" }
+
+func (s javaStore) Installed(ca CA, r Runner) (bool, error) {
+	return r.Check(Command{Name: s.keytool, Args: []string{
+		"-list", "-keystore", s.cacerts, "-storepass", javaStorePass, "-alias", ca.Nickname,
+	}}), nil
+}
+
+func (s javaStore) InstallCommands(ca CA) []Command {
+	return []Command{{Sudo: s.sudo, Name: s.keytool, Args: []string{
+		"-importcert", "-noprompt", "-keystore", s.cacerts, "-storepass", javaStorePass,
+		"-alias", ca.Nickname, "-file", ca.Path,
+	}}}
+}
+
+func (s javaStore) UninstallCommands(ca CA) []Command {
+	return []Command{{Sudo: s.sudo, Name: s.keytool, Args: []string{
+		"-delete", "-keystore", s.cacerts, "-storepass", javaStorePass, "-alias", ca.Nickname,
+	}}}
+}
+
+// Env describes the machine for Discover. Tests point it at temporary
+// directories.
+type Env struct {
+	GOOS     string
+	Home     string
+	JavaHome string
+	// LookPath finds executables, like exec.LookPath.
+	LookPath func(name string) (string, error)
+	// Writable reports whether the current user can modify path.
+	Writable func(path string) bool
+}
+
+// Discover returns the trust stores present on the machine described by env.
+// Stores that exist but cannot be managed because a tool is missing are
+// reported as warnings.
+func Discover(env Env) (stores []Store, warnings []string) {
+	switch env.GOOS {
+	case "darwin":
+		stores = append(stores, darwinStore{})
+	case "linux":
+		if _, err := env.LookPath("update-ca-certificates"); err == nil {
+			stores = append(stores, linuxStore{
+				dir:    "/usr/local/share/ca-certificates/portree",
+				update: []string{"update-ca-certificates", "--fresh"},
+				legacy: "/usr/local/share/ca-certificates/portree/portree-dev-ca.crt",
+			})
+		} else if _, err := env.LookPath("update-ca-trust"); err == nil {
+			stores = append(stores, linuxStore{
+				dir:    "/etc/pki/ca-trust/source/anchors",
+				update: []string{"update-ca-trust", "extract"},
+			})
+		} else {
+			warnings = append(warnings, "neither update-ca-certificates nor update-ca-trust found; skipping the system store")
+		}
+	}
+
+	if dbs := nssDatabases(env); len(dbs) > 0 {
+		certutil, err := env.LookPath("certutil")
+		if err != nil {
+			warnings = append(warnings, "found NSS databases (Firefox/Chromium) but no certutil; install it (e.g. libnss3-tools or nss) and run 'portree trust' again")
+		} else {
+			for _, s := range dbs {
+				s.certutil = certutil
+				stores = append(stores, s)
+			}
+		}
+	}
+
+	if s, ok := javaKeystore(env); ok {
+		stores = append(stores, s)
+	}
+	return stores, warnings
+}
+
+// nssDatabases finds NSS databases in the user's home directory.
+func nssDatabases(env Env) []nssStore {
+	var dirs []string
+	if env.GOOS != "darwin" {
+		dirs = append(dirs,
+			filepath.Join(env.Home, ".pki", "nssdb"),
+			filepath.Join(env.Home, "snap", "chromium", "current", ".pki", "nssdb"),
+		)
+	}
+	var profileRoots []string
+	switch env.GOOS {
+	case "darwin":
+		profileRoots = []string{filepath.Join(env.Home, "Library", "Application Support", "Firefox", "Profiles")}
+	default:
+		profileRoots = []string{
+			filepath.Join(env.Home, ".mozilla", "firefox"),
+			filepath.Join(env.Home, "snap", "firefox", "common", ".mozilla", "firefox"),
+			filepath.Join(env.Home, ".var", "app", "org.mozilla.firefox", ".mozilla", "firefox"),
+		}
+	}
+	for _, root := range profileRoots {
+		profiles, _ := filepath.Glob(filepath.Join(root, "*"))
+		dirs = append(dirs, profiles...)
+	}
+
+	var stores []nssStore
+	for _, dir := range dirs {
+		var db string
+		switch {
+		case fileExists(filepath.Join(dir, "cert9.db")):
+			db = "sql:" + dir
+		case fileExists(filepath.Join(dir, "cert8.db")):
+			db = "dbm:" + dir
+		default:
+			continue
+		}
+		label := "(" + tildePath(dir, env.Home) + ")"
+		if strings.Contains(dir, "irefox") {
+			label = "Firefox profile " + filepath.Base(dir)
+		}
+		stores = append(stores, nssStore{label: label, db: db})
+	}
+	return stores
+}
+
+// javaKeystore locates the cacerts file and keytool of the default JVM.
+func javaKeystore(env Env) (javaStore, bool) {
+	javaHome := env.JavaHome
+	if javaHome == "" {
+		java, err := env.LookPath("java")
+		if err != nil {
+			return javaStore{}, false
+		}
+		if resolved, err := filepath.EvalSymlinks(java); err == nil {
+			java = resolved
+		}
+		javaHome = filepath.Dir(filepath.Dir(java)) // <home>/bin/java
+	}
+
+	var cacerts string
+	for _, p := range []string{
+		filepath.Join(javaHome, "lib", "security", "cacerts"),
+		filepath.Join(javaHome, "jre", "lib", "security", "cacerts"),
+	} {
+		if fileExists(p) {
+			cacerts = p
+			break
+		}
+	}
+	if cacerts == "" {
+		return javaStore{}, false
+	}
+
+	keytool := filepath.Join(javaHome, "bin", "keytool")
+	if !fileExists(keytool) {
+		var err error
+		if keytool, err = env.LookPath("keytool"); err != nil {
+			return javaStore{}, false
+		}
+	}
+	return javaStore{cacerts: cacerts, keytool: keytool, sudo: !env.Writable(cacerts)}, true
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func tildePath(path, home string) string {
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
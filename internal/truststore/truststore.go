@@ -0,0 +1,178 @@
+// Package truststore installs the portree CA into the trust stores used by
+// browsers and runtimes: the operating system store, NSS databases (Firefox,
+// Chromium on Linux) and Java cacerts files.
+package truststore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/fairy-pitta/portree/internal/cert"
+)
+
+// CA is the certificate to install.
+type CA struct {
+	Path string
+	// Nickname identifies the CA inside NSS databases and Java keystores,
+	// and names the file in the Linux system store.
+	Nickname string
+	// SHA1 is the upper-case hex SHA-1 fingerprint, used by the macOS
+	// security tool.
+	SHA1 string
+}
+
+// LoadCA reads the CA certificate at path.
+func LoadCA(path string) (CA, error) {
+	fp, err := cert.Fingerprint(path)
+	if err != nil {
+		return CA{}, fmt.Errorf("reading CA certificate: %w", err)
+	}
+	sha1, err := cert.SHA1Fingerprint(path)
+	if err != nil {
+		return CA{}, fmt.Errorf("reading CA certificate: %w", err)
+	}
+	return CA{Path: path, Nickname: "portree-" + fp[:16], SHA1: sha1}, nil
+}
+
+// Command is an external command run to change a trust store.
+type Command struct {
+	Sudo bool // run as root
+	Name string
+	Args []string
+}
+
+// String formats c as a shell command line.
+func (c Command) String() string {
+	parts := make([]string, 0, len(c.Args)+2)
+	if c.Sudo {
+		parts = append(parts, "sudo")
+	}
+	parts = append(parts, c.Name)
+	for _, a := range c.Args {
+		if a == "" || strings.ContainsAny(a, " \t'\"$,") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		parts = append(parts, a)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Runner executes commands.
+type Runner interface {
+	// Run executes c, showing its output.
+	Run(c Command) error
+	// Check executes c quietly and reports whether it succeeded.
+	Check(c Command) bool
+}
+
+// Store is a trust store that can hold the CA.
+type Store interface {
+	// Name describes the store for humans, e.g. "NSS (~/.pki/nssdb)".
+	Name() string
+	// Installed reports whether ca is already in the store.
+	Installed(ca CA, r Runner) (bool, error)
+	// InstallCommands returns the commands that add ca to the store.
+	InstallCommands(ca CA) []Command
+	// UninstallCommands returns the commands that remove ca from the store.
+	UninstallCommands(ca CA) []Command
+}
+
+// cleaner is implemented by stores that may hold files left behind by
+// earlier versions of portree. Their install and uninstall commands remove
+// the leftovers.
+type cleaner interface {
+	HasLeftovers() bool
+}
+
+// Action is the set of commands that brings one store to the desired state.
+type Action struct {
+	Store    Store
+	Commands []Command
+}
+
+// Plan returns the actions needed to install ca into every store that lacks
+// it or, with uninstall, to remove it from every store that has it. Stores
+// with leftovers of earlier versions always get an action.
+func Plan(stores []Store, ca CA, uninstall bool, r Runner) ([]Action, error) {
+	var actions []Action
+	for _, s := range stores {
+		installed, err := s.Installed(ca, r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Name(), err)
+		}
+		leftovers := false
+		if c, ok := s.(cleaner); ok {
+			leftovers = c.HasLeftovers()
+		}
+		switch {
+		case uninstall && (installed || leftovers):
+			actions = append(actions, Action{Store: s, Commands: s.UninstallCommands(ca)})
+		case !uninstall && (!installed || leftovers):
+			actions = append(actions, Action{Store: s, Commands: s.InstallCommands(ca)})
+		}
+	}
+	return actions, nil
+}
+
+// Apply runs the commands of each action in order, stopping at the first
+// failure.
+func Apply(actions []Action, r Runner) error {
+	for _, a := range actions {
+		for _, c := range a.Commands {
+			if err := r.Run(c); err != nil {
+				return fmt.Errorf("%s: %s: %w", a.Store.Name(), c, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ExecRunner runs commands on this machine, prefixing sudo where needed
+// unless already running as root.
+type ExecRunner struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (e ExecRunner) command(c Command) *exec.Cmd {
+	if c.Sudo && os.Geteuid() != 0 {
+		return exec.Command("sudo", append([]string{c.Name}, c.Args...)...)
+	}
+	return exec.Command(c.Name, c.Args...)
+}
+
+// Run implements Runner.
+func (e ExecRunner) Run(c Command) error {
+	cmd := e.command(c)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = e.Stdin, e.Stdout, e.Stderr
+	return cmd.Run()
+}
+
+// Check implements Runner.
+func (e ExecRunner) Check(c Command) bool {
+	return e.command(c).Run() == nil
+}
+
+// DefaultEnv describes the current machine.
+func DefaultEnv() Env {
+	home, _ := os.UserHomeDir()
+	return Env{
+		GOOS:     runtime.GOOS,
+		Home:     home,
+		JavaHome: os.Getenv("JAVA_HOME"),
+		LookPath: exec.LookPath,
+		Writable: func(path string) bool {
+			f, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				return false
+			}
+			_ = f.Close()
+			return true
+		},
+	}
+}
@@ -0,0 +1,303 @@
+package truststore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fairy-pitta/portree/internal/cert"
+)
+
+// fakeRunner records commands and reports the listed check commands as
+// successful.
+type fakeRunner struct {
+	present map[string]bool // Command.String() of checks that succeed
+	ran     []string
+	failOn  string
+}
+
+func (f *fakeRunner) Run(c Command) error {
+	f.ran = append(f.ran, c.String())
+	if f.failOn != "" && c.Name == f.failOn {
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func (f *fakeRunner) Check(c Command) bool { return f.present[c.String()] }
+
+func testCA(t *testing.T) CA {
+	t.Helper()
+	paths, err := cert.EnsureCerts(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(paths.CACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testEnv returns a Linux Env rooted at a temporary home directory, with the
+// given executables on the PATH.
+func testEnv(t *testing.T, tools ...string) Env {
+	t.Helper()
+	return Env{
+		GOOS: "linux",
+		Home: t.TempDir(),
+		LookPath: func(name string) (string, error) {
+			for _, tool := range tools {
+				if tool == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", errors.New("not found")
+		},
+		Writable: func(string) bool { return true },
+	}
+}
+
+func storeNames(stores []Store) []string {
+	names := make([]string, len(stores))
+	for i, s := range stores {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+func TestLoadCA(t *testing.T) {
+	ca := testCA(t)
+	if !strings.HasPrefix(ca.Nickname, "portree-") || len(ca.Nickname) != len("portree-")+16 {
+		t.Errorf("Nickname = %q", ca.Nickname)
+	}
+	if len(ca.SHA1) != 40 || ca.SHA1 != strings.ToUpper(ca.SHA1) {
+		t.Errorf("SHA1 = %q", ca.SHA1)
+	}
+	if _, err := LoadCA(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("LoadCA should fail for a missing file")
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	c := Command{Sudo: true, Name: "certutil", Args: []string{"-t", "C,,", "-d", "sql:/home/me/My Profile", "it's"}}
+	want := `sudo certutil -t 'C,,' -d 'sql:/home/me/My Profile' 'it'\''s'`
+	if got := c.String(); got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestDiscoverNSS(t *testing.T) {
+	env := testEnv(t, "update-ca-certificates", "certutil")
+	touch(t, filepath.Join(env.Home, ".pki", "nssdb", "cert9.db"))
+	touch(t, filepath.Join(env.Home, ".mozilla", "firefox", "abc.default-release", "cert9.db"))
+	touch(t, filepath.Join(env.Home, ".mozilla", "firefox", "old.default", "cert8.db"))
+	touch(t, filepath.Join(env.Home, ".mozilla", "firefox", "empty.profile", "prefs.js"))
+
+	stores, warnings := Discover(env)
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v", warnings)
+	}
+	got := strings.Join(storeNames(stores), "\n")
+	for _, want := range []string{
+		"system (/usr/local/share/ca-certificates/portree)",
+		"NSS (" + filepath.Join("~", ".pki", "nssdb") + ")",
+		"NSS Firefox profile abc.default-release",
+		"NSS Firefox profile old.default",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("stores missing %q:\n%s", want, got)
+		}
+	}
+	if len(stores) != 4 {
+		t.Errorf("got %d stores, want 4:\n%s", len(stores), got)
+	}
+
+	ca := CA{Path: "/ca.pem", Nickname: "portree-x"}
+	for _, s := range stores {
+		if s.Name() != "NSS Firefox profile old.default" {
+			continue
+		}
+		cmds := s.InstallCommands(ca)
+		want := "certutil -d dbm:" + filepath.Join(env.Home, ".mozilla", "firefox", "old.default") + " -A -t 'C,,' -n portree-x -i /ca.pem"
+		if len(cmds) != 1 || !strings.HasSuffix(cmds[0].String(), want) {
+			t.Errorf("InstallCommands = %v, want suffix %q", cmds, want)
+		}
+	}
+}
+
+func TestDiscoverWarnsWithoutCertutil(t *testing.T) {
+	env := testEnv(t, "update-ca-trust")
+	touch(t, filepath.Join(env.Home, "snap", "firefox", "common", ".mozilla", "firefox", "p.default", "cert9.db"))
+
+	stores, warnings := Discover(env)
+	if len(stores) != 1 || stores[0].Name() != "system (/etc/pki/ca-trust/source/anchors)" {
+		t.Errorf("stores = %v", storeNames(stores))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "certutil") {
+		t.Errorf("warnings = %v", warnings)
+	}
+}
+
+func TestDiscoverDarwinFirefox(t *testing.T) {
+	env := testEnv(t, "certutil")
+	env.GOOS = "darwin"
+	touch(t, filepath.Join(env.Home, ".pki", "nssdb", "cert9.db")) // ignored on macOS
+	touch(t, filepath.Join(env.Home, "Library", "Application Support", "Firefox", "Profiles", "x.default", "cert9.db"))
+
+	stores, _ := Discover(env)
+	got := storeNames(stores)
+	if len(got) != 2 || got[0] != "macOS System keychain" || got[1] != "NSS Firefox profile x.default" {
+		t.Errorf("stores = %v", got)
+	}
+}
+
+func TestDiscoverJava(t *testing.T) {
+	env := testEnv(t)
+	env.GOOS = "windows"
+	env.JavaHome = filepath.Join(env.Home, "jdk")
+	cacerts := filepath.Join(env.JavaHome, "jre", "lib", "security", "cacerts")
+	touch(t, cacerts)
+	touch(t, filepath.Join(env.JavaHome, "bin", "keytool"))
+	env.Writable = func(string) bool { return false }
+
+	stores, _ := Discover(env)
+	if len(stores) != 1 || stores[0].Name() != "Java ("+cacerts+")" {
+		t.Fatalf("stores = %v", storeNames(stores))
+	}
+	cmds := stores[0].InstallCommands(CA{Path: "/ca.pem", Nickname: "portree-x"})
+	if len(cmds) != 1 || !cmds[0].Sudo || !strings.Contains(cmds[0].String(), "-importcert -noprompt -keystore "+cacerts) {
+		t.Errorf("InstallCommands = %v", cmds)
+	}
+}
+
+func TestDiscoverJavaFromPath(t *testing.T) {
+	env := testEnv(t)
+	env.GOOS = "windows"
+	jdk := filepath.Join(env.Home, "jdk")
+	touch(t, filepath.Join(jdk, "bin", "java"))
+	touch(t, filepath.Join(jdk, "lib", "security", "cacerts"))
+	env.LookPath = func(name string) (string, error) {
+		if name == "java" {
+			return filepath.Join(jdk, "bin", "java"), nil
+		}
+		return "", errors.New("not found")
+	}
+
+	// No keytool next to java or on the PATH: the store cannot be managed.
+	if stores, _ := Discover(env); len(stores) != 0 {
+		t.Errorf("stores = %v, want none without keytool", storeNames(stores))
+	}
+
+	touch(t, filepath.Join(jdk, "bin", "keytool"))
+	stores, _ := Discover(env)
+	if len(stores) != 1 || stores[0].(javaStore).sudo {
+		t.Errorf("stores = %v", storeNames(stores))
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	ca := testCA(t)
+	sys := linuxStore{dir: t.TempDir(), update: []string{"update-ca-certificates", "--fresh"}}
+	nss := nssStore{label: "(~/.pki/nssdb)", db: "sql:/nssdb", certutil: "certutil"}
+	java := javaStore{cacerts: "/jdk/lib/security/cacerts", keytool: "keytool"}
+	stores := []Store{sys, nss, java}
+
+	// The NSS database already has the CA.
+	r := &fakeRunner{present: map[string]bool{
+		"certutil -d sql:/nssdb -L -n " + ca.Nickname: true,
+	}}
+	actions, err := Plan(stores, ca, false, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].Store.Name() != sys.Name() || actions[1].Store.Name() != java.Name() {
+		t.Fatalf("install actions = %+v", actions)
+	}
+	if err := Apply(actions, r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.ran) != 4 || !strings.HasPrefix(r.ran[3], "keytool -importcert") {
+		t.Errorf("ran = %v", r.ran)
+	}
+
+	// Simulate the copy into the system store; uninstall now covers it and
+	// the NSS database, but not the Java keystore.
+	touch(t, sys.path(ca))
+	actions, err = Plan(stores, ca, true, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].Store.Name() != sys.Name() || actions[1].Store.Name() != nss.Name() {
+		t.Fatalf("uninstall actions = %+v", actions)
+	}
+	if got := actions[1].Commands[0].String(); got != "certutil -d sql:/nssdb -D -n "+ca.Nickname {
+		t.Errorf("uninstall command = %s", got)
+	}
+
+	// Apply stops at the first failing command.
+	r = &fakeRunner{failOn: "rm"}
+	err = Apply(actions, r)
+	if err == nil || !strings.Contains(err.Error(), "system (") || len(r.ran) != 1 {
+		t.Errorf("Apply() = %v, ran %v", err, r.ran)
+	}
+}
+
+func TestLinuxStoreLegacyCA(t *testing.T) {
+	ca := testCA(t)
+	dir := t.TempDir()
+	sys := linuxStore{
+		dir:    dir,
+		update: []string{"update-ca-certificates", "--fresh"},
+		legacy: filepath.Join(dir, "portree-dev-ca.crt"),
+	}
+	r := &fakeRunner{}
+
+	// Nothing installed: install copies the CA, uninstall has nothing to do.
+	if actions, err := Plan([]Store{sys}, ca, true, r); err != nil || len(actions) != 0 {
+		t.Errorf("uninstall actions without any CA = %+v, %v", actions, err)
+	}
+
+	// The current CA is installed next to the one of an earlier version:
+	// both install and uninstall remove the old file.
+	touch(t, sys.path(ca))
+	touch(t, sys.legacy)
+	for _, uninstall := range []bool{false, true} {
+		actions, err := Plan([]Store{sys}, ca, uninstall, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actions) != 1 {
+			t.Fatalf("Plan(uninstall=%v) = %+v, want one action", uninstall, actions)
+		}
+		removed := false
+		for _, c := range actions[0].Commands {
+			if c.String() == "sudo rm -f "+sys.legacy {
+				removed = true
+			}
+		}
+		if !removed {
+			t.Errorf("Plan(uninstall=%v) commands = %v, want the legacy CA removed", uninstall, actions[0].Commands)
+		}
+	}
+
+	// Without leftovers an installed CA needs no action.
+	if err := os.Remove(sys.legacy); err != nil {
+		t.Fatal(err)
+	}
+	if actions, err := Plan([]Store{sys}, ca, false, r); err != nil || len(actions) != 0 {
+		t.Errorf("install actions = %+v, %v, want none", actions, err)
+	}
+}
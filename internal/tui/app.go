@@ -3,8 +3,11 @@ package tui
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/charmbracelet/bubbles/key"
@@ -16,6 +19,7 @@ import (
 	"github.com/fairy-pitta/portree/internal/logging"
 	"github.com/fairy-pitta/portree/internal/port"
 	"github.com/fairy-pitta/portree/internal/process"
+	"github.com/fairy-pitta/portree/internal/proxy"
 	"github.com/fairy-pitta/portree/internal/state"
 )
 
@@ -27,11 +31,14 @@ const (
 
 // Model is the top-level Bubble Tea model for the dashboard.
 type Model struct {
-	cfg      *config.Config
+	// cfg is swapped on reload while commands read it on other goroutines.
+	cfg      atomic.Pointer[config.Config]
 	repoRoot string
+	profile  string // config profile, kept across reloads
 	store    *state.FileStore
 	registry *port.Registry
 	manager  *process.Manager
+	watcher  *config.Watcher // nil = do not watch the config file
 	keys     KeyMap
 	trees    []git.Worktree // cached at init
 
@@ -39,9 +46,18 @@ type Model struct {
 	cursor       int
 	proxyRunning bool
 	proxyPorts   []int
+	adminPort    int    // proxy admin API port, 0 if unknown
+	adminToken   string // proxy admin API token
 	statusMsg    string
 	width        int
 	height       int
+
+	showInspector bool
+	captures      []proxy.Exchange // summaries, oldest first
+	capturesErr   error
+	requestCursor int             // selected request, 0 being the newest
+	request       *proxy.Exchange // selected request in full, once loaded
+	requestErr    error
 }
 
 // NewModel creates a new dashboard model.
@@ -65,27 +81,42 @@ func NewModel(cfg *config.Config, repoRoot string) (*Model, error) {
 		return nil, fmt.Errorf("listing worktrees: %w", err)
 	}
 
-	// Collect proxy ports.
+	m := &Model{
+		repoRoot:   repoRoot,
+		profile:    cfg.Profile,
+		store:      store,
+		registry:   registry,
+		manager:    mgr,
+		watcher:    config.NewWatcher(pollInterval, config.WatchPaths(repoRoot, cfg)...),
+		keys:       DefaultKeyMap(),
+		trees:      trees,
+		proxyPorts: collectProxyPorts(cfg),
+	}
+	m.cfg.Store(cfg)
+	return m, nil
+}
+
+// collectProxyPorts returns the distinct proxy ports of cfg in ascending order.
+func collectProxyPorts(cfg *config.Config) []int {
 	var proxyPorts []int
 	seen := map[int]bool{}
 	for _, svc := range cfg.Services {
-		if !seen[svc.ProxyPort] {
+		if svc.ProxyPort != 0 && !seen[svc.ProxyPort] {
 			seen[svc.ProxyPort] = true
 			proxyPorts = append(proxyPorts, svc.ProxyPort)
 		}
 	}
 	sort.Ints(proxyPorts)
+	return proxyPorts
+}
 
-	return &Model{
-		cfg:        cfg,
-		repoRoot:   repoRoot,
-		store:      store,
-		registry:   registry,
-		manager:    mgr,
-		keys:       DefaultKeyMap(),
-		trees:      trees,
-		proxyPorts: proxyPorts,
-	}, nil
+// checkConfig reloads the config if the file changed since the last check.
+func (m *Model) checkConfig() tea.Msg {
+	if m.watcher == nil || !m.watcher.Changed() {
+		return nil
+	}
+	cfg, err := config.LoadProfile(m.repoRoot, m.profile)
+	return ConfigReloadedMsg{Cfg: cfg, Err: err}
 }
 
 // Init implements tea.Model.
@@ -105,7 +136,45 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case TickMsg:
-		return m, tea.Batch(m.refreshStatus, tickCmd())
+		if m.showInspector {
+			return m, tea.Batch(m.refreshStatus, m.checkConfig, m.fetchCaptures(), tickCmd())
+		}
+		return m, tea.Batch(m.refreshStatus, m.checkConfig, tickCmd())
+
+	case ConfigReloadedMsg:
+		if msg.Err != nil {
+			m.statusMsg = fmt.Sprintf("Config reload failed: %v", msg.Err)
+			return m, nil
+		}
+		m.cfg.Store(msg.Cfg)
+		applyTheme(msg.Cfg.Theme)
+		m.proxyPorts = collectProxyPorts(msg.Cfg)
+		if m.watcher != nil {
+			m.watcher.SetPaths(config.WatchPaths(m.repoRoot, msg.Cfg)...)
+		}
+		if m.registry != nil {
+			m.registry.SetConfig(msg.Cfg)
+		}
+		if m.manager != nil {
+			m.manager.SetConfig(msg.Cfg)
+		}
+		m.statusMsg = "Config reloaded"
+		return m, m.refreshStatus
+
+	case CapturesMsg:
+		m.captures = msg.Exchanges
+		m.capturesErr = msg.Err
+		if n := min(len(m.captures), maxInspectorRows); m.requestCursor >= n {
+			m.requestCursor = max(n-1, 0)
+		}
+		return m, nil
+
+	case CaptureMsg:
+		m.request, m.requestErr = nil, msg.Err
+		if msg.Err == nil {
+			m.request = &msg.Exchange
+		}
+		return m, nil
 
 	case StatusUpdateMsg:
 		m.rows = msg.Rows
@@ -116,6 +185,11 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return e
 			}
 			m.proxyRunning = st.Proxy.Status == state.StatusRunning && st.Proxy.PID > 0 && process.IsProcessRunning(st.Proxy.PID)
+			m.adminPort = 0
+			if m.proxyRunning {
+				m.adminPort = st.Proxy.AdminPort
+				m.adminToken = st.Proxy.AdminToken
+			}
 			return nil
 		}); err != nil {
 			logging.Warn("failed to load proxy state: %v", err)
@@ -154,7 +228,14 @@ func (m *Model) View() string {
 	proxyLine := renderProxyStatus(m.proxyRunning, m.proxyPorts)
 	help := renderHelp(m.keys, tableWidth)
 
-	content := fmt.Sprintf("%s\n\n%s\n%s\n%s", title, table, proxyLine, help)
+	content := fmt.Sprintf("%s\n\n%s\n%s", title, table, proxyLine)
+	if m.showInspector {
+		content += "\n" + renderInspector(m.captures, m.capturesErr, m.requestCursor, tableWidth)
+		if m.request != nil || m.requestErr != nil {
+			content += "\n" + renderRequest(m.request, m.requestErr, tableWidth)
+		}
+	}
+	content += "\n" + help
 
 	if m.statusMsg != "" {
 		content += "\n\n" + m.statusMsg
@@ -192,6 +273,9 @@ func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case key.Matches(msg, m.keys.Open):
 		return m, m.openSelected
 
+	case key.Matches(msg, m.keys.Edit):
+		return m, m.editSelected()
+
 	case key.Matches(msg, m.keys.StartAll):
 		return m, m.startAll
 
@@ -204,6 +288,38 @@ func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case key.Matches(msg, m.keys.ViewLogs):
 		return m, m.viewLogs
+
+	case key.Matches(msg, m.keys.Inspect):
+		m.showInspector = !m.showInspector
+		m.request, m.requestErr = nil, nil
+		if m.showInspector {
+			return m, m.fetchCaptures()
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.PrevRequest):
+		if m.showInspector && m.requestCursor > 0 {
+			m.requestCursor--
+			m.request, m.requestErr = nil, nil
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.NextRequest):
+		if m.showInspector && m.requestCursor < min(len(m.captures), maxInspectorRows)-1 {
+			m.requestCursor++
+			m.request, m.requestErr = nil, nil
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.ShowRequest):
+		if !m.showInspector {
+			return m, nil
+		}
+		if m.request != nil || m.requestErr != nil {
+			m.request, m.requestErr = nil, nil
+			return m, nil
+		}
+		return m, m.fetchSelectedCapture()
 	}
 
 	return m, nil
@@ -217,8 +333,9 @@ func (m *Model) selectedRow() *ServiceRow {
 }
 
 func (m *Model) refreshStatus() tea.Msg {
-	serviceNames := make([]string, 0, len(m.cfg.Services))
-	for name := range m.cfg.Services {
+	cfg := m.cfg.Load()
+	serviceNames := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
 		serviceNames = append(serviceNames, name)
 	}
 	sort.Strings(serviceNames)
@@ -259,6 +376,9 @@ func (m *Model) refreshStatus() tea.Msg {
 			} else {
 				row.Status = state.StatusStopped
 			}
+			if row.Status != state.StatusRunning && !cfg.ServiceEnabled(svcName, tree.Branch) {
+				row.Status = state.StatusDisabled
+			}
 
 			rows = append(rows, row)
 		}
@@ -326,10 +446,14 @@ func (m *Model) openSelected() tea.Msg {
 		return ActionResultMsg{Message: fmt.Sprintf("%s/%s is not running, start it first", row.Branch, row.Service), IsError: true}
 	}
 
-	svc, ok := m.cfg.Services[row.Service]
+	cfg := m.cfg.Load()
+	svc, ok := cfg.Services[row.Service]
 	if !ok {
 		return ActionResultMsg{Message: "Unknown service", IsError: true}
 	}
+	if svc.ProxyPort == 0 {
+		return ActionResultMsg{Message: fmt.Sprintf("%s has no proxy_port", row.Service), IsError: true}
+	}
 
 	// Determine scheme from proxy state.
 	scheme := "http"
@@ -347,12 +471,56 @@ func (m *Model) openSelected() tea.Msg {
 	}
 
 	url := browser.BuildURL(scheme, row.Slug, svc.ProxyPort)
-	if err := browser.Open(url); err != nil {
+	if err := browser.OpenWith(cfg.Browser, url); err != nil {
 		return ActionResultMsg{Message: fmt.Sprintf("Error opening browser: %v", err), IsError: true}
 	}
 	return ActionResultMsg{Message: fmt.Sprintf("Opening %s", url)}
 }
 
+// editSelected opens the directory of the selected service in the editor,
+// suspending the dashboard while a terminal editor runs.
+func (m *Model) editSelected() tea.Cmd {
+	row := m.selectedRow()
+	if row == nil {
+		return func() tea.Msg { return ActionResultMsg{Message: "No service selected"} }
+	}
+	tree := &git.Worktree{Path: m.worktreePath(row.Branch), Branch: row.Branch}
+	dir, err := m.manager.ServiceDir(tree, row.Service)
+	if err != nil {
+		return func() tea.Msg { return ActionResultMsg{Message: fmt.Sprintf("Error: %v", err), IsError: true} }
+	}
+	c, err := editorCommand(m.cfg.Load().Editor, dir)
+	if err != nil {
+		return func() tea.Msg { return ActionResultMsg{Message: fmt.Sprintf("Error: %v", err), IsError: true} }
+	}
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		if err != nil {
+			return ActionResultMsg{Message: fmt.Sprintf("Error opening editor: %v", err), IsError: true}
+		}
+		return ActionResultMsg{Message: fmt.Sprintf("Opened %s in the editor", dir)}
+	})
+}
+
+// editorCommand returns the command that opens path with editor, such as
+// "code" or "nvim", or with $VISUAL or $EDITOR when editor is empty.
+func editorCommand(editor, path string) (*exec.Cmd, error) {
+	if editor == "" {
+		editor = os.Getenv("VISUAL")
+	}
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		where := "the user config file"
+		if path, err := config.UserConfigPath(); err == nil {
+			where = path
+		}
+		return nil, fmt.Errorf("no editor set: set editor in %s or $EDITOR", where)
+	}
+	return exec.Command(args[0], append(args[1:], path)...), nil
+}
+
 func (m *Model) startAll() tea.Msg {
 	count := 0
 	for _, tree := range m.trees {
@@ -401,6 +569,37 @@ func (m *Model) viewLogs() tea.Msg {
 	return ActionResultMsg{Message: fmt.Sprintf("Log file: %s", logPath)}
 }
 
+// fetchCaptures returns a command that loads summaries of the captured
+// exchanges from the running proxy's admin API. Bodies are only loaded for
+// the selected request.
+func (m *Model) fetchCaptures() tea.Cmd {
+	port, token := m.adminPort, m.adminToken
+	return func() tea.Msg {
+		if port == 0 {
+			return CapturesMsg{Err: fmt.Errorf("proxy is not running")}
+		}
+		exchanges, err := proxy.NewAdminClient(port, token).CaptureSummaries("", "")
+		return CapturesMsg{Exchanges: exchanges, Err: err}
+	}
+}
+
+// fetchSelectedCapture returns a command that loads the selected request in
+// full.
+func (m *Model) fetchSelectedCapture() tea.Cmd {
+	i := len(m.captures) - 1 - m.requestCursor
+	if i < 0 || i >= len(m.captures) {
+		return func() tea.Msg { return CaptureMsg{Err: fmt.Errorf("no request selected")} }
+	}
+	port, token, id := m.adminPort, m.adminToken, m.captures[i].ID
+	return func() tea.Msg {
+		if port == 0 {
+			return CaptureMsg{Err: fmt.Errorf("proxy is not running")}
+		}
+		ex, err := proxy.NewAdminClient(port, token).Capture(id)
+		return CaptureMsg{Exchange: ex, Err: err}
+	}
+}
+
 // worktreePath looks up the worktree path from cached worktrees.
 func (m *Model) worktreePath(branch string) string {
 	for _, t := range m.trees {
@@ -417,6 +616,7 @@ func Run(cfg *config.Config, repoRoot string) error {
 	if err != nil {
 		return err
 	}
+	applyTheme(cfg.Theme)
 
 	p := tea.NewProgram(model, tea.WithAltScreen())
 	_, err = p.Run()
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/fairy-pitta/portree/internal/config"
 	"github.com/fairy-pitta/portree/internal/git"
+	"github.com/fairy-pitta/portree/internal/proxy"
 	"github.com/fairy-pitta/portree/internal/state"
 )
 
@@ -244,6 +246,92 @@ func TestModelUpdate_ToggleProxy(t *testing.T) {
 	}
 }
 
+func TestModelUpdate_ToggleInspector(t *testing.T) {
+	m := testModel(t, nil)
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'i'}})
+	model := mustModel(t, updated)
+	if !model.showInspector {
+		t.Fatal("'i' should show the inspector")
+	}
+	if cmd == nil {
+		t.Fatal("showing the inspector should fetch captures")
+	}
+
+	// Without a running proxy the fetch reports an error in the pane.
+	updated, _ = model.Update(cmd())
+	model = mustModel(t, updated)
+	if model.capturesErr == nil {
+		t.Error("capturesErr should be set when the proxy is not running")
+	}
+	if !strings.Contains(model.View(), "Requests") {
+		t.Error("view should contain the inspector pane")
+	}
+
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'i'}})
+	model = mustModel(t, updated)
+	if model.showInspector {
+		t.Error("second 'i' should hide the inspector")
+	}
+}
+
+func TestModelUpdate_CapturesMsg(t *testing.T) {
+	m := testModel(t, nil)
+	m.showInspector = true
+
+	exchanges := []proxy.Exchange{
+		{ID: 1, Slug: "main", Method: "GET", URL: "http://main.localhost:3000/api/items", Status: 200},
+	}
+	updated, _ := m.Update(CapturesMsg{Exchanges: exchanges})
+	model := mustModel(t, updated)
+
+	view := model.View()
+	if !strings.Contains(view, "/api/items") {
+		t.Error("inspector pane should list captured paths")
+	}
+}
+
+func TestModelUpdate_ShowRequest(t *testing.T) {
+	m := testModel(t, nil)
+	m.showInspector = true
+	m.captures = []proxy.Exchange{
+		{ID: 1, Slug: "main", Method: "GET", URL: "http://main.localhost:3000/old", Status: 200},
+		{ID: 2, Slug: "main", Method: "POST", URL: "http://main.localhost:3000/new", Status: 201},
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}})
+	model := mustModel(t, updated)
+	if model.requestCursor != 1 {
+		t.Fatalf("']' should select the older request, cursor = %d", model.requestCursor)
+	}
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}})
+	model = mustModel(t, updated)
+	if model.requestCursor != 1 {
+		t.Errorf("']' should stop at the oldest request, cursor = %d", model.requestCursor)
+	}
+
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = mustModel(t, updated)
+	if cmd == nil {
+		t.Fatal("enter should load the selected request")
+	}
+
+	updated, _ = model.Update(CaptureMsg{Exchange: proxy.Exchange{
+		ID: 1, Method: "GET", URL: "http://main.localhost:3000/old", Status: 200,
+		ResponseBody: []byte(`{"items":[]}`),
+	}})
+	model = mustModel(t, updated)
+	if view := model.View(); !strings.Contains(view, `{"items":[]}`) {
+		t.Error("view should show the body of the selected request")
+	}
+
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = mustModel(t, updated)
+	if model.request != nil {
+		t.Error("second enter should hide the bodies")
+	}
+}
+
 func TestSelectedRow(t *testing.T) {
 	t.Run("valid cursor", func(t *testing.T) {
 		rows := []ServiceRow{
@@ -419,11 +507,11 @@ func TestOpenSelected_NotRunning(t *testing.T) {
 		{Branch: "main", Slug: "main", Service: "frontend", Port: 3100, Status: state.StatusStopped},
 	}
 	m := testModel(t, rows)
-	m.cfg = &config.Config{
+	m.cfg.Store(&config.Config{
 		Services: map[string]config.ServiceConfig{
 			"frontend": {Command: "echo", PortRange: config.PortRange{Min: 3100, Max: 3199}, ProxyPort: 3000},
 		},
-	}
+	})
 
 	msg := m.openSelected()
 	result, ok := msg.(ActionResultMsg)
@@ -479,3 +567,87 @@ func TestViewLogs_WithLogFile(t *testing.T) {
 		t.Errorf("message should contain 'Log file:', got: %s", result.Message)
 	}
 }
+
+func TestModelUpdate_ConfigReloadedMsg(t *testing.T) {
+	m := testModel(t, nil)
+
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"web": {ProxyPort: 3000},
+		"api": {ProxyPort: 9000},
+	}}
+	updated, cmd := m.Update(ConfigReloadedMsg{Cfg: cfg})
+	model := mustModel(t, updated)
+	if model.cfg.Load() != cfg {
+		t.Error("cfg should be replaced")
+	}
+	if got := fmt.Sprint(model.proxyPorts); got != "[3000 9000]" {
+		t.Errorf("proxyPorts = %s, want [3000 9000]", got)
+	}
+	if model.statusMsg != "Config reloaded" {
+		t.Errorf("statusMsg = %q", model.statusMsg)
+	}
+	if cmd == nil {
+		t.Error("reload should refresh the status")
+	}
+
+	updated, _ = model.Update(ConfigReloadedMsg{Err: fmt.Errorf("bad toml")})
+	model = mustModel(t, updated)
+	if model.cfg.Load() != cfg {
+		t.Error("a failed reload should keep the previous config")
+	}
+	if !strings.Contains(model.statusMsg, "bad toml") {
+		t.Errorf("statusMsg = %q, want the reload error", model.statusMsg)
+	}
+}
+
+func TestModelCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	m := testModel(t, nil)
+	m.repoRoot = dir
+	m.watcher = config.NewWatcher(pollInterval, config.Paths(dir)...)
+
+	if msg := m.checkConfig(); msg != nil {
+		t.Errorf("checkConfig() without changes = %#v, want nil", msg)
+	}
+
+	toml := "[services.web]\ncommand = \"npm run dev\"\nport_range = { min = 3100, max = 3199 }\nproxy_port = 3000\n"
+	if err := os.WriteFile(filepath.Join(dir, config.FileName), []byte(toml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := m.checkConfig().(ConfigReloadedMsg)
+	if !ok || msg.Err != nil || msg.Cfg == nil {
+		t.Fatalf("checkConfig() = %#v, want a reloaded config", msg)
+	}
+	if _, ok := msg.Cfg.Services["web"]; !ok {
+		t.Error("reloaded config should contain the web service")
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "vi")
+
+	c, err := editorCommand("code --new-window", "/src/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(c.Args, " "); got != "code --new-window /src/app" {
+		t.Errorf("editorCommand() args = %q", got)
+	}
+
+	c, err = editorCommand("", "/src/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(c.Args, " "); got != "vi /src/app" {
+		t.Errorf("editorCommand() with $EDITOR args = %q", got)
+	}
+
+	t.Setenv("EDITOR", "")
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	_, err = editorCommand("", "/src/app")
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "portree", "config.toml")) {
+		t.Errorf("editorCommand() with no editor set error = %v, want the user config path", err)
+	}
+}
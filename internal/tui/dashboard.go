@@ -2,10 +2,13 @@ package tui
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 
+	"github.com/fairy-pitta/portree/internal/proxy"
 	"github.com/fairy-pitta/portree/internal/state"
 )
 
@@ -61,8 +64,11 @@ func renderTable(rows []ServiceRow, cursor int, termWidth int) string {
 		}
 
 		statusStr := statusStopped
-		if row.Status == state.StatusRunning {
+		switch row.Status {
+		case state.StatusRunning:
 			statusStr = statusRunning
+		case state.StatusDisabled:
+			statusStr = statusDisabled
 		}
 
 		pidStr := "—"
@@ -107,11 +113,110 @@ func renderProxyStatus(running bool, ports []int) string {
 	return proxyStoppedStyle.Render("Proxy: ○ stopped")
 }
 
+// maxInspectorRows is the number of most recent exchanges shown in the inspector pane.
+const maxInspectorRows = 8
+
+// renderInspector renders the most recent captured exchanges, newest first,
+// marking the one at cursor.
+func renderInspector(exchanges []proxy.Exchange, err error, cursor, width int) string {
+	var b strings.Builder
+	b.WriteString(inspectorTitleStyle.Render("Requests"))
+	b.WriteString("\n")
+
+	switch {
+	case err != nil:
+		b.WriteString(helpStyle.UnsetMarginTop().Render(err.Error()))
+		return b.String()
+	case len(exchanges) == 0:
+		b.WriteString(helpStyle.UnsetMarginTop().Render("No requests captured yet (start the proxy with --capture)"))
+		return b.String()
+	}
+
+	if len(exchanges) > maxInspectorRows {
+		exchanges = exchanges[len(exchanges)-maxInspectorRows:]
+	}
+	// Leave room for the fixed columns and the border.
+	pathWidth := width - 6 - 8 - 14 - 8 - 6 - 10 - 5*2
+	if pathWidth < 10 {
+		pathWidth = 10
+	}
+	for i := len(exchanges) - 1; i >= 0; i-- {
+		ex := exchanges[i]
+		path := ex.URL
+		if u, err := url.Parse(ex.URL); err == nil {
+			path = u.RequestURI()
+		}
+		if len(path) > pathWidth {
+			path = path[:pathWidth-1] + "…"
+		}
+		statusStyle := rowStyle
+		if ex.Status >= 500 || ex.Status == 0 {
+			statusStyle = lipgloss.NewStyle().Foreground(colorRed)
+		}
+		cells := []string{
+			lipgloss.NewStyle().Width(8).Render(ex.Time.Format("15:04:05")),
+			lipgloss.NewStyle().Width(14).Render(ex.Slug),
+			lipgloss.NewStyle().Width(8).Render(ex.Method),
+			lipgloss.NewStyle().Width(pathWidth).Render(path),
+			statusStyle.Width(6).Render(fmt.Sprintf("%d", ex.Status)),
+			lipgloss.NewStyle().Width(10).Render(ex.Duration.Round(time.Millisecond).String()),
+		}
+		if len(exchanges)-1-i == cursor {
+			b.WriteString("▸ " + strings.Join(cells, "  "))
+		} else {
+			b.WriteString("  " + strings.Join(cells, "  "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// maxBodyLines is the number of lines of each body shown for the selected
+// request.
+const maxBodyLines = 6
+
+// renderRequest renders the bodies of the selected request.
+func renderRequest(ex *proxy.Exchange, err error, width int) string {
+	if err != nil {
+		return helpStyle.UnsetMarginTop().Render(err.Error())
+	}
+	var b strings.Builder
+	b.WriteString(inspectorTitleStyle.Render(fmt.Sprintf("#%d %s %s → %d", ex.ID, ex.Method, ex.URL, ex.Status)))
+	b.WriteString("\n")
+	writeBody(&b, "Request", ex.RequestBody, ex.RequestBodyTruncated, width)
+	writeBody(&b, "Response", ex.ResponseBody, ex.ResponseBodyTruncated, width)
+	return b.String()
+}
+
+// writeBody writes the first lines of body, cut to width.
+func writeBody(b *strings.Builder, label string, body []byte, truncated bool, width int) {
+	if len(body) == 0 {
+		b.WriteString(helpStyle.UnsetMarginTop().Render(label+": (empty)") + "\n")
+		return
+	}
+	if truncated {
+		label += " (truncated)"
+	}
+	b.WriteString(headerStyle.UnsetBorderBottom().Render(label) + "\n")
+	lines := strings.Split(strings.TrimRight(string(body), "\n"), "\n")
+	if len(lines) > maxBodyLines {
+		lines = append(lines[:maxBodyLines], "…")
+	}
+	lineWidth := max(width-8, 10)
+	for _, line := range lines {
+		if len(line) > lineWidth {
+			line = line[:lineWidth-1] + "…"
+		}
+		b.WriteString("  " + line + "\n")
+	}
+}
+
 // renderHelp renders the key binding help bar with automatic wrapping.
 func renderHelp(keys KeyMap, width int) string {
 	items := []string{
 		"[s] start", "[x] stop", "[r] restart", "[o] open", "[l] logs",
-		"[a] all start", "[X] all stop", "[p] proxy", "[q] quit",
+		"[a] all start", "[X] all stop", "[p] proxy", "[i] inspect",
+		"[ ] request", "[enter] bodies", "[q] quit",
 	}
 
 	// Account for border padding (~6 chars)
@@ -54,6 +54,7 @@ func TestRenderTableWithRows(t *testing.T) {
 		{Branch: "main", Slug: "main", Service: "frontend", Port: 3100, Status: state.StatusRunning, PID: 12345},
 		{Branch: "main", Slug: "main", Service: "backend", Port: 8100, Status: state.StatusStopped, PID: 0},
 		{Branch: "feature/auth", Slug: "feature-auth", Service: "frontend", Port: 3117, Status: state.StatusRunning, PID: 12346},
+		{Branch: "docs", Slug: "docs", Service: "backend", Status: state.StatusDisabled},
 	}
 
 	result := renderTable(rows, 0, 100)
@@ -84,6 +85,9 @@ func TestRenderTableWithRows(t *testing.T) {
 	if !strings.Contains(result, "○ stopped") {
 		t.Error("table should contain stopped indicator")
 	}
+	if !strings.Contains(result, "– disabled") {
+		t.Error("table should contain disabled indicator")
+	}
 
 	// Cursor on first row
 	if !strings.Contains(result, "▸") {
@@ -209,6 +213,7 @@ func TestDefaultKeyMap(t *testing.T) {
 		{"Stop", km.Stop},
 		{"Restart", km.Restart},
 		{"Open", km.Open},
+		{"Edit", km.Edit},
 		{"StartAll", km.StartAll},
 		{"StopAll", km.StopAll},
 		{"ToggleProxy", km.ToggleProxy},
@@ -10,10 +10,15 @@ type KeyMap struct {
 	Stop        key.Binding
 	Restart     key.Binding
 	Open        key.Binding
+	Edit        key.Binding
 	StartAll    key.Binding
 	StopAll     key.Binding
 	ToggleProxy key.Binding
 	ViewLogs    key.Binding
+	Inspect     key.Binding
+	PrevRequest key.Binding
+	NextRequest key.Binding
+	ShowRequest key.Binding
 	Quit        key.Binding
 }
 
@@ -44,6 +49,10 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("o"),
 			key.WithHelp("o", "open in browser"),
 		),
+		Edit: key.NewBinding(
+			key.WithKeys("e"),
+			key.WithHelp("e", "open in editor"),
+		),
 		StartAll: key.NewBinding(
 			key.WithKeys("a"),
 			key.WithHelp("a", "start all"),
@@ -60,6 +69,22 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("l"),
 			key.WithHelp("l", "view logs"),
 		),
+		Inspect: key.NewBinding(
+			key.WithKeys("i"),
+			key.WithHelp("i", "toggle request inspector"),
+		),
+		PrevRequest: key.NewBinding(
+			key.WithKeys("["),
+			key.WithHelp("[", "newer request"),
+		),
+		NextRequest: key.NewBinding(
+			key.WithKeys("]"),
+			key.WithHelp("]", "older request"),
+		),
+		ShowRequest: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "show request bodies"),
+		),
 		Quit: key.NewBinding(
 			key.WithKeys("q", "ctrl+c"),
 			key.WithHelp("q", "quit"),
@@ -70,9 +95,9 @@ func DefaultKeyMap() KeyMap {
 // ShortHelp returns a compact help string.
 func (k KeyMap) ShortHelp() []key.Binding {
 	return []key.Binding{
-		k.Start, k.Stop, k.Restart, k.Open,
+		k.Start, k.Stop, k.Restart, k.Open, k.Edit,
 		k.StartAll, k.StopAll, k.ToggleProxy,
-		k.ViewLogs, k.Quit,
+		k.ViewLogs, k.Inspect, k.Quit,
 	}
 }
 
@@ -80,8 +105,9 @@ func (k KeyMap) ShortHelp() []key.Binding {
 func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.Up, k.Down},
-		{k.Start, k.Stop, k.Restart, k.Open},
+		{k.Start, k.Stop, k.Restart, k.Open, k.Edit},
 		{k.StartAll, k.StopAll, k.ToggleProxy},
-		{k.ViewLogs, k.Quit},
+		{k.ViewLogs, k.Inspect, k.Quit},
+		{k.PrevRequest, k.NextRequest, k.ShowRequest},
 	}
 }
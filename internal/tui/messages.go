@@ -4,6 +4,9 @@ import (
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fairy-pitta/portree/internal/config"
+	"github.com/fairy-pitta/portree/internal/proxy"
 )
 
 // TickMsg triggers periodic state refresh.
@@ -30,6 +33,27 @@ type ActionResultMsg struct {
 	IsError bool
 }
 
+// CapturesMsg carries summaries of the exchanges fetched from the proxy's
+// admin API, without headers and bodies.
+type CapturesMsg struct {
+	Exchanges []proxy.Exchange
+	Err       error
+}
+
+// CaptureMsg carries a single exchange, bodies included, fetched from the
+// proxy's admin API.
+type CaptureMsg struct {
+	Exchange proxy.Exchange
+	Err      error
+}
+
+// ConfigReloadedMsg carries the result of re-reading .portree.toml after
+// it changed on disk.
+type ConfigReloadedMsg struct {
+	Cfg *config.Config
+	Err error
+}
+
 // ProxyStatusMsg carries the proxy status.
 type ProxyStatusMsg struct {
 	Running bool
@@ -1,15 +1,21 @@
 package tui
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"os"
+	"sync"
+
+	"github.com/charmbracelet/lipgloss"
+)
 
 var (
-	// Colors
+	// Colors. Text and highlight colors have a variant for light terminal
+	// backgrounds; see applyTheme.
 	colorPrimary = lipgloss.Color("#7C3AED") // purple
 	colorGreen   = lipgloss.Color("#10B981")
 	colorRed     = lipgloss.Color("#EF4444")
 	colorGray    = lipgloss.Color("#6B7280")
-	colorDimGray = lipgloss.Color("#374151")
-	colorWhite   = lipgloss.Color("#F9FAFB")
+	colorDimGray = lipgloss.AdaptiveColor{Light: "#E5E7EB", Dark: "#374151"}
+	colorWhite   = lipgloss.AdaptiveColor{Light: "#111827", Dark: "#F9FAFB"}
 
 	// Title bar
 	titleStyle = lipgloss.NewStyle().
@@ -45,6 +51,10 @@ var (
 			Foreground(colorRed).
 			Render("○ stopped")
 
+	statusDisabled = lipgloss.NewStyle().
+			Foreground(colorGray).
+			Render("– disabled")
+
 	// Footer / help bar
 	helpStyle = lipgloss.NewStyle().
 			Foreground(colorGray).
@@ -58,9 +68,36 @@ var (
 	proxyStoppedStyle = lipgloss.NewStyle().
 				Foreground(colorRed)
 
+	// Request inspector pane
+	inspectorTitleStyle = lipgloss.NewStyle().
+				Bold(true).
+				Foreground(colorPrimary).
+				MarginTop(1)
+
 	// Border for the whole dashboard
 	borderStyle = lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
 			BorderForeground(colorPrimary).
 			Padding(1, 2)
 )
+
+// terminalIsDark reports whether the terminal has a dark background. It
+// asks the terminal once, through a renderer of its own so that the answer
+// is not one applyTheme set.
+var terminalIsDark = sync.OnceValue(func() bool {
+	return lipgloss.NewRenderer(os.Stdout).HasDarkBackground()
+})
+
+// applyTheme selects the variant of the adaptive colors for theme, the
+// theme key of the config: "dark", "light", or anything else to follow the
+// terminal's background. Only the last queries the terminal.
+func applyTheme(theme string) {
+	switch theme {
+	case "dark":
+		lipgloss.SetHasDarkBackground(true)
+	case "light":
+		lipgloss.SetHasDarkBackground(false)
+	default:
+		lipgloss.SetHasDarkBackground(terminalIsDark())
+	}
+}